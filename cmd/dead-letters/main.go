@@ -0,0 +1,70 @@
+// Command dead-letters inspects and replays the notification messages that
+// were moved to the dead-letter queue after failing every attempt.
+//
+//	dead-letters list                 prints the dead-lettered messages as JSON
+//	dead-letters replay               moves them all back to the queue
+//	dead-letters replay <id> [<id>…]  moves back only the messages with these IDs
+//
+// Fix the cause of the failures before replaying, or the messages end up in
+// the dead-letter queue again after their attempts.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	conf "github.com/tigerhall-kittens/config"
+	"github.com/tigerhall-kittens/pkg/messaging"
+)
+
+func main() {
+	configFile := flag.String("config", "config/local/server.yml", "path to the configuration file")
+	limit := flag.Int("limit", 100, "number of messages to read from the head of the dead-letter queue")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] list | replay [message-id...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Read the configuration from server.yml
+	config, err := conf.ReadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("Failed to read configuration: %v", err)
+	}
+
+	broker, err := messaging.NewMessageBroker(config.RabbitMq)
+	if err != nil {
+		log.Fatalf("Failed to connect to RabbitMQ: %v", err)
+	}
+	defer broker.Close()
+
+	switch command := flag.Arg(0); command {
+	case "list":
+		letters, err := broker.DeadLetters(*limit)
+		if err != nil {
+			log.Fatalf("Failed to read the dead-letter queue: %v", err)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(letters); err != nil {
+			log.Fatalf("Failed to print the dead-lettered messages: %v", err)
+		}
+	case "replay":
+		replayed, err := broker.ReplayDeadLetters(flag.Args()[1:], *limit)
+		if err != nil {
+			log.Fatalf("Failed after replaying %d messages: %v", replayed, err)
+		}
+		log.Printf("Replayed %d messages", replayed)
+	default:
+		log.Printf("Unknown command %q", command)
+		flag.Usage()
+		os.Exit(2)
+	}
+}
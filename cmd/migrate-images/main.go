@@ -0,0 +1,55 @@
+// Command migrate-images moves sighting images that are still stored in the
+// database to the configured image store, and computes the perceptual hash of
+// images that were uploaded before images were hashed.
+//
+// It can be run while the server is up and is safe to run again after a
+// failure. Postgres only returns the space of the moved images to the
+// operating system after a VACUUM FULL of tiger_sightings.
+package main
+
+import (
+	"flag"
+	"log"
+
+	conf "github.com/tigerhall-kittens/config"
+	"github.com/tigerhall-kittens/pkg/imagestore"
+	"github.com/tigerhall-kittens/pkg/repository"
+	"github.com/tigerhall-kittens/pkg/service"
+)
+
+func main() {
+	configFile := flag.String("config", "config/local/server.yml", "path to the configuration file")
+	batchSize := flag.Int("batch-size", 100, "number of images to move or hash per batch")
+	flag.Parse()
+
+	// Read the configuration from server.yml
+	config, err := conf.ReadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("Failed to read configuration: %v", err)
+	}
+
+	images, err := imagestore.FromConfig(config.ImageStore)
+	if err != nil {
+		log.Fatalf("Failed to initialize the image store: %v", err)
+	}
+
+	store, err := repository.NewPostgresRepository(conf.BuildDBConnectionString(config.Database))
+	if err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+
+	moved, skipped, err := service.MigrateLegacyImages(store, images, *batchSize)
+	if err != nil {
+		log.Fatalf("Failed after moving %d images: %v", moved, err)
+	}
+	log.Printf("Moved %d images to the %s image store", moved, config.ImageStore.Driver)
+	if skipped > 0 {
+		log.Printf("Skipped %d images that could not be moved, they are still in the database", skipped)
+	}
+
+	hashed, err := service.BackfillImageHashes(store, images, *batchSize)
+	if err != nil {
+		log.Fatalf("Failed after hashing %d images: %v", hashed, err)
+	}
+	log.Printf("Hashed %d images", hashed)
+}
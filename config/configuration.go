@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -12,15 +13,167 @@ type Config struct {
 	JWT
 	RabbitMq
 	Server
+	Sightings
+	ImageStore
+	Privacy
+	Uploads
+	Notifications
+	Outbox
+	Worker
 }
 
 type Server struct {
 	Port string `yaml:"port"`
+	// PublicURL is where clients reach the API, for links in notification emails
+	PublicURL string `yaml:"publicURL"`
+	// ShutdownTimeout bounds the wait for the requests in progress on shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+}
+
+// Outbox configures the relay that publishes the events written to the outbox table.
+type Outbox struct {
+	// PollInterval is how often the outbox is checked for events to publish
+	PollInterval time.Duration `yaml:"pollInterval"`
+	// RetryBackoff is the wait before publishing an event again; it doubles with every failed attempt
+	// up to MaxBackoff
+	RetryBackoff time.Duration `yaml:"retryBackoff"`
+	MaxBackoff   time.Duration `yaml:"maxBackoff"`
+	// BatchSize bounds the number of events published in one run
+	BatchSize int `yaml:"batchSize"`
+	// Lease is how long the events of a run are kept from the relays of other instances; it must
+	// outlast publishing a batch
+	Lease time.Duration `yaml:"lease"`
+}
+
+// Worker configures the worker command, which consumes the notification messages.
+type Worker struct {
+	// Concurrency is the number of messages processed at the same time
+	Concurrency int `yaml:"concurrency"`
+	// Prefetch is the number of messages RabbitMQ sends ahead of their acknowledgement; it is at least
+	// Concurrency
+	Prefetch int `yaml:"prefetch"`
+	// DrainTimeout bounds the wait for the messages in progress on shutdown; the messages still
+	// unacknowledged afterwards are delivered again
+	DrainTimeout time.Duration `yaml:"drainTimeout"`
 }
 
 type RabbitMq struct {
-	AmqpURL   string `yaml:"amqpURL"`
-	QueueName string `yaml:"queueName"`
+	// Driver is "amqp" for RabbitMQ, "memory" for an in-process queue that needs no RabbitMQ and
+	// sends the notifications from the serve command, or "noop", which drops every event
+	Driver  string `yaml:"driver"`
+	AmqpURL string `yaml:"amqpURL"`
+	// Exchange is the topic exchange that events are published to, with their type as the routing key
+	Exchange string `yaml:"exchange"`
+	// QueueName is the queue of the notification emails, bound to the exchange with Bindings
+	QueueName string   `yaml:"queueName"`
+	Bindings  []string `yaml:"bindings"`
+	// ReconnectBackoff is the wait before reconnecting after the connection is lost; it doubles with
+	// every failed attempt up to MaxReconnectBackoff
+	ReconnectBackoff    time.Duration `yaml:"reconnectBackoff"`
+	MaxReconnectBackoff time.Duration `yaml:"maxReconnectBackoff"`
+	// PublishTimeout bounds the wait for RabbitMQ to confirm a published event
+	PublishTimeout time.Duration `yaml:"publishTimeout"`
+	// MaxDeliveryAttempts is how often a message is processed before it is moved to DeadLetterQueue
+	MaxDeliveryAttempts int `yaml:"maxDeliveryAttempts"`
+	// RetryBackoff is the wait before a failed message is processed again; it doubles with every
+	// failed attempt up to MaxRetryBackoff
+	RetryBackoff    time.Duration `yaml:"retryBackoff"`
+	MaxRetryBackoff time.Duration `yaml:"maxRetryBackoff"`
+	// DeadLetterQueue keeps the messages that could not be processed; it defaults to QueueName with a
+	// ".dead" suffix
+	DeadLetterQueue string `yaml:"deadLetterQueue"`
+}
+
+// Notifications configures the emails that tell reporters about new sightings of their tigers.
+type Notifications struct {
+	// Driver is either "smtp" or "log", which only logs the emails
+	Driver string `yaml:"driver"`
+	SMTP   SMTP   `yaml:"smtp"`
+	// MaxAttempts is how often a scheduled email is tried, once per ScheduleInterval, before its delivery
+	// is recorded as failed. Other emails are tried again with their message, as set in RabbitMq.
+	MaxAttempts int `yaml:"maxAttempts"`
+	// ScheduleInterval is how often the emails held back for quiet hours and digests are checked for being due
+	ScheduleInterval time.Duration `yaml:"scheduleInterval"`
+	// Lease is how long the scheduled emails of a run are kept from other runs; it must outlast sending
+	// a batch. Emails left unsent by a run that stopped are sent by a later run once it runs out.
+	Lease time.Duration `yaml:"lease"`
+}
+
+// SMTP configures the mail server that notification emails are sent through.
+type SMTP struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	// Username and Password are optional; without them the server must accept mail unauthenticated
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// From is the sender address, optionally with a display name such as "Tigerhall <no-reply@example.com>"
+	From string `yaml:"from"`
+}
+
+// Sightings configures the default proximity rule applied to new sightings.
+// It can be overridden per tiger.
+type Sightings struct {
+	// MinDistanceKm is the distance within which a sighting is too close to an earlier one
+	MinDistanceKm float64 `yaml:"minDistanceKm"`
+	// TimeWindow limits the check to sightings this close in time; zero compares against the latest sighting only
+	TimeWindow time.Duration `yaml:"timeWindow"`
+	// Action is either "reject" or "flag"
+	Action string `yaml:"action"`
+	// Exif bounds how far the reported location and time may be from the image's EXIF data
+	Exif ExifCheck `yaml:"exif"`
+	// Duplicates decides what happens to images that look like an image of an earlier sighting
+	Duplicates DuplicateCheck `yaml:"duplicates"`
+}
+
+// ExifCheck configures when a sighting is flagged because it disagrees with the EXIF data of its image.
+type ExifCheck struct {
+	MaxDistanceKm     float64       `yaml:"maxDistanceKm"`
+	MaxTimeDifference time.Duration `yaml:"maxTimeDifference"`
+}
+
+// DuplicateCheck configures the detection of near-duplicate sighting images by their perceptual hash.
+type DuplicateCheck struct {
+	// MaxDistance is the number of differing hash bits, out of 64, up to which two images are duplicates
+	MaxDistance int `yaml:"maxDistance"`
+	// Action is either "reject" or "flag"
+	Action string `yaml:"action"`
+}
+
+// Uploads limits the images that can be uploaded with sightings.
+type Uploads struct {
+	MaxBytes int64 `yaml:"maxBytes"`
+	// MaxPixels bounds the memory needed to decode an image
+	MaxPixels int `yaml:"maxPixels"`
+	// MaxImages is the number of images a sighting can have
+	MaxImages int `yaml:"maxImages"`
+}
+
+// Privacy configures what public responses reveal about protected tigers.
+type Privacy struct {
+	// CoarsenProtectedTigers rounds the coordinates of protected tigers and their sightings in responses
+	CoarsenProtectedTigers bool `yaml:"coarsenProtectedTigers"`
+	// CoordinateDecimals is the number of decimal places kept; one is about 11 km
+	CoordinateDecimals int `yaml:"coordinateDecimals"`
+}
+
+// ImageStore configures where sighting images are kept.
+type ImageStore struct {
+	// Driver is either "local" or "s3"
+	Driver string `yaml:"driver"`
+	// Dir is the root directory of the local store
+	Dir string `yaml:"dir"`
+	S3  S3     `yaml:"s3"`
+}
+
+// S3 configures an S3-compatible object store such as AWS S3 or MinIO.
+type S3 struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"accessKey"`
+	SecretKey string `yaml:"secretKey"`
+	// PathStyle addresses the bucket in the path instead of the host name, as MinIO expects
+	PathStyle bool `yaml:"pathStyle"`
 }
 
 type Database struct {
@@ -41,7 +194,39 @@ func ReadConfig(filename string) (*Config, error) {
 		return nil, err
 	}
 
-	var config Config
+	// Defaults for settings that may be omitted from the file
+	config := Config{
+		RabbitMq: RabbitMq{
+			Driver:              "amqp",
+			Exchange:            "tigerhall.events",
+			Bindings:            []string{"notification.#"},
+			ReconnectBackoff:    time.Second,
+			MaxReconnectBackoff: 30 * time.Second,
+			PublishTimeout:      5 * time.Second,
+			MaxDeliveryAttempts: 5,
+			RetryBackoff:        5 * time.Second,
+			MaxRetryBackoff:     5 * time.Minute,
+		},
+		Sightings: Sightings{
+			MinDistanceKm: 5,
+			Action:        "reject",
+			Exif:          ExifCheck{MaxDistanceKm: 1, MaxTimeDifference: time.Hour},
+			Duplicates:    DuplicateCheck{MaxDistance: 4, Action: "flag"},
+		},
+		Server:     Server{ShutdownTimeout: 30 * time.Second},
+		ImageStore: ImageStore{Driver: "local", Dir: "data/images"},
+		Privacy:    Privacy{CoarsenProtectedTigers: true, CoordinateDecimals: 1},
+		Uploads:    Uploads{MaxBytes: 10 << 20, MaxPixels: 40_000_000, MaxImages: 10},
+		Notifications: Notifications{
+			Driver:           "log",
+			SMTP:             SMTP{Port: 25},
+			MaxAttempts:      3,
+			ScheduleInterval: time.Minute,
+			Lease:            5 * time.Minute,
+		},
+		Outbox: Outbox{PollInterval: time.Second, RetryBackoff: time.Second, MaxBackoff: 5 * time.Minute, BatchSize: 100, Lease: time.Minute},
+		Worker: Worker{Concurrency: 4, Prefetch: 8, DrainTimeout: 30 * time.Second},
+	}
 	err = yaml.Unmarshal(data, &config)
 	if err != nil {
 		return nil, err
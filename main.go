@@ -1,23 +1,71 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	conf "github.com/tigerhall-kittens/config"
 	inits "github.com/tigerhall-kittens/pkg"
 	"github.com/tigerhall-kittens/pkg/auth"
+	"github.com/tigerhall-kittens/pkg/handlers"
+	"github.com/tigerhall-kittens/pkg/migrate"
+	"github.com/tigerhall-kittens/pkg/repository/store"
 	"github.com/tigerhall-kittens/pkg/server"
+	"github.com/tigerhall-kittens/pkg/upload"
 )
 
 func main() {
+	configFile := flag.String("config", "config/local/server.yml", "path to the configuration file")
+	migrationsDir := flag.String("migrations", "migrations", "directory of the migrations applied by the migrate command")
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage: %s [flags] [command]\n\n", os.Args[0])
+		fmt.Fprintln(out, "Commands:")
+		fmt.Fprintln(out, "  serve    serve the API and publish the outbox events (default)")
+		fmt.Fprintln(out, "  worker   consume the notification messages and send the emails")
+		fmt.Fprintln(out, "  migrate  apply the pending database migrations")
+		fmt.Fprintln(out, "\nFlags:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	command := "serve"
+	if flag.NArg() > 0 {
+		command = flag.Arg(0)
+	}
+
 	// Read the configuration from server.yml
-	config, err := conf.ReadConfig("config/local/server.yml")
+	config, err := conf.ReadConfig(*configFile)
 	if err != nil {
 		log.Fatalf("Failed to read configuration: %v", err)
 	}
 
+	switch command {
+	case "serve":
+		serve(config)
+	case "worker":
+		worker(config)
+	case "migrate":
+		migrateDatabase(config, *migrationsDir)
+	default:
+		log.Printf("Unknown command %q", command)
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func serve(config *conf.Config) {
+	// Shut down on SIGTERM, as sent by container orchestrators before they kill the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Initialize the service
-	service, err := inits.InitializeService(config)
+	service, err := inits.InitializeService(ctx, config)
 	if err != nil {
 		log.Fatalf("Failed to initialize the service: %v", err)
 	}
@@ -26,11 +74,38 @@ func main() {
 	srv := server.NewServer()
 
 	// Set up the routes and handlers
-	srv.SetupRoutes(service, auth.NewAuth(config.JWT.SecretKey))
+	srv.SetupRoutes(service, auth.NewAuth(config.JWT.SecretKey), handlers.WithUploadLimits(upload.FromConfig(config.Uploads)))
+
+	// Serve until a signal arrives, then finish the requests in progress
+	err = srv.Run(ctx, config.Server.Port, config.Server.ShutdownTimeout)
+	if err != nil {
+		log.Fatalf("Failed to run the server: %v", err)
+	}
+}
+
+func worker(config *conf.Config) {
+	// Drain on SIGTERM, as sent by container orchestrators before they kill the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := inits.RunWorker(ctx, config); err != nil {
+		log.Fatalf("Failed to run the worker: %v", err)
+	}
+}
 
-	// Start the server
-	err = srv.Start(config.Server.Port)
+func migrateDatabase(config *conf.Config, dir string) {
+	db, err := store.NewPostgresDB(conf.BuildDBConnectionString(config.Database))
+	if err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+	defer db.Close()
+
+	applied, err := migrate.Up(db, dir)
+	for _, version := range applied {
+		log.Printf("Applied migration %d", version)
+	}
 	if err != nil {
-		log.Fatalf("Failed to start the server: %v", err)
+		log.Fatalf("Failed to migrate the database: %v", err)
 	}
+	log.Printf("Applied %d migrations", len(applied))
 }
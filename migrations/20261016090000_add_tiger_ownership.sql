@@ -0,0 +1,15 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Users are regular users unless promoted to admin by hand
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user';
+
+-- Record who created each tiger (NULL for tigers created before this migration)
+ALTER TABLE tigers ADD COLUMN IF NOT EXISTS created_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+-- +goose Down
+-- SQL in section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE tigers DROP COLUMN IF EXISTS created_by;
+
+ALTER TABLE users DROP COLUMN IF EXISTS role;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Move every tiger to its latest sighting when that sighting is newer than the tiger's last_seen
+UPDATE tigers
+SET last_seen = latest.timestamp, lat = latest.lat, long = latest.long
+FROM (
+    SELECT DISTINCT ON (tiger_id) tiger_id, timestamp, lat, long
+    FROM tiger_sightings
+    ORDER BY tiger_id, timestamp DESC
+    ) AS latest
+WHERE tigers.id = latest.tiger_id AND tigers.last_seen < latest.timestamp;
+
+-- Speeds up looking up the latest sighting of a tiger
+CREATE INDEX IF NOT EXISTS idx_tiger_sightings_tiger_id_timestamp ON tiger_sightings (tiger_id, timestamp DESC);
+
+-- +goose Down
+-- SQL in section 'Down' is executed when this migration is rolled back
+
+-- The backfilled positions are kept; only the index is dropped
+DROP INDEX IF EXISTS idx_tiger_sightings_tiger_id_timestamp;
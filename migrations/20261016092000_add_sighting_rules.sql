@@ -0,0 +1,20 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Per-tiger overrides of the configured proximity rule; NULL columns use the configured default
+CREATE TABLE IF NOT EXISTS tiger_sighting_rules (
+    tiger_id INTEGER PRIMARY KEY REFERENCES tigers(id) ON DELETE CASCADE,
+    min_distance_km DOUBLE PRECISION,
+    time_window_seconds INTEGER,
+    action VARCHAR(10)
+    );
+
+-- Reasons why a sighting was accepted but flagged for review
+ALTER TABLE tiger_sightings ADD COLUMN IF NOT EXISTS flags TEXT[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+-- SQL in section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE tiger_sightings DROP COLUMN IF EXISTS flags;
+
+DROP TABLE IF EXISTS tiger_sighting_rules;
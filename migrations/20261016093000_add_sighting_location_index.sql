@@ -0,0 +1,10 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Supports the bounding box prefilter of the area searches
+CREATE INDEX IF NOT EXISTS idx_tiger_sightings_lat_long ON tiger_sightings (lat, long);
+
+-- +goose Down
+-- SQL in section 'Down' is executed when this migration is rolled back
+
+DROP INDEX IF EXISTS idx_tiger_sightings_lat_long;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Images are kept in the image store and the row only locates them.
+-- Existing images stay in the image column until they are moved by cmd/migrate-images.
+ALTER TABLE tiger_sightings ADD COLUMN IF NOT EXISTS image_key TEXT;
+ALTER TABLE tiger_sightings ADD COLUMN IF NOT EXISTS image_sha256 VARCHAR(64);
+ALTER TABLE tiger_sightings ADD COLUMN IF NOT EXISTS image_width INTEGER;
+ALTER TABLE tiger_sightings ADD COLUMN IF NOT EXISTS image_height INTEGER;
+
+-- +goose Down
+-- SQL in section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE tiger_sightings DROP COLUMN IF EXISTS image_height;
+ALTER TABLE tiger_sightings DROP COLUMN IF EXISTS image_width;
+ALTER TABLE tiger_sightings DROP COLUMN IF EXISTS image_sha256;
+ALTER TABLE tiger_sightings DROP COLUMN IF EXISTS image_key;
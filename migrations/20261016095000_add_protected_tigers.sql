@@ -0,0 +1,10 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- The coordinates of protected tigers and their sightings are coarsened in public responses
+ALTER TABLE tigers ADD COLUMN IF NOT EXISTS protected BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+-- SQL in section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE tigers DROP COLUMN IF EXISTS protected;
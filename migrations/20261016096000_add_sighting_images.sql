@@ -0,0 +1,47 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- A sighting can have several images, in the order they were uploaded
+CREATE TABLE IF NOT EXISTS sighting_images (
+    id SERIAL PRIMARY KEY,
+    sighting_id INTEGER NOT NULL REFERENCES tiger_sightings(id) ON DELETE CASCADE,
+    image_key TEXT NOT NULL,
+    image_sha256 VARCHAR(64) NOT NULL,
+    image_width INTEGER,
+    image_height INTEGER,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+    );
+
+CREATE INDEX IF NOT EXISTS idx_sighting_images_sighting_id ON sighting_images (sighting_id, id);
+
+INSERT INTO sighting_images (sighting_id, image_key, image_sha256, image_width, image_height)
+SELECT id, image_key, COALESCE(image_sha256, ''), image_width, image_height
+FROM tiger_sightings
+WHERE image_key IS NOT NULL
+ORDER BY id;
+
+-- Images that are still kept in the database stay in the image column until they are moved by cmd/migrate-images
+ALTER TABLE tiger_sightings DROP COLUMN IF EXISTS image_height;
+ALTER TABLE tiger_sightings DROP COLUMN IF EXISTS image_width;
+ALTER TABLE tiger_sightings DROP COLUMN IF EXISTS image_sha256;
+ALTER TABLE tiger_sightings DROP COLUMN IF EXISTS image_key;
+
+-- +goose Down
+-- SQL in section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE tiger_sightings ADD COLUMN IF NOT EXISTS image_key TEXT;
+ALTER TABLE tiger_sightings ADD COLUMN IF NOT EXISTS image_sha256 VARCHAR(64);
+ALTER TABLE tiger_sightings ADD COLUMN IF NOT EXISTS image_width INTEGER;
+ALTER TABLE tiger_sightings ADD COLUMN IF NOT EXISTS image_height INTEGER;
+
+-- Only the first image of each sighting can be kept
+UPDATE tiger_sightings
+SET image_key = first.image_key, image_sha256 = first.image_sha256, image_width = first.image_width, image_height = first.image_height
+FROM (
+    SELECT DISTINCT ON (sighting_id) sighting_id, image_key, image_sha256, image_width, image_height
+    FROM sighting_images
+    ORDER BY sighting_id, id
+) AS first
+WHERE tiger_sightings.id = first.sighting_id;
+
+DROP TABLE IF EXISTS sighting_images;
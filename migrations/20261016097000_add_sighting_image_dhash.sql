@@ -0,0 +1,10 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Difference hash of the image, used to find near-duplicates; existing images are hashed by cmd/migrate-images
+ALTER TABLE sighting_images ADD COLUMN IF NOT EXISTS dhash BIGINT;
+
+-- +goose Down
+-- SQL in section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE sighting_images DROP COLUMN IF EXISTS dhash;
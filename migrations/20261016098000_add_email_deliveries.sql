@@ -0,0 +1,21 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- One row per notification email, recording whether it reached the recipient
+CREATE TABLE IF NOT EXISTS email_deliveries (
+    id SERIAL PRIMARY KEY,
+    recipient TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    sent_at TIMESTAMP
+    );
+
+CREATE INDEX IF NOT EXISTS idx_email_deliveries_recipient ON email_deliveries (recipient, created_at);
+
+-- +goose Down
+-- SQL in section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS email_deliveries;
@@ -0,0 +1,57 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Users who want to hear about every sighting of a tiger
+CREATE TABLE IF NOT EXISTS tiger_subscriptions (
+    tiger_id INTEGER NOT NULL REFERENCES tigers(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (tiger_id, user_id)
+    );
+
+CREATE INDEX IF NOT EXISTS idx_tiger_subscriptions_user_id ON tiger_subscriptions (user_id);
+
+-- Users who want to hear about any sighting within radius_km of a point
+CREATE TABLE IF NOT EXISTS area_subscriptions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    lat DOUBLE PRECISION NOT NULL,
+    long DOUBLE PRECISION NOT NULL,
+    radius_km DOUBLE PRECISION NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+    );
+
+CREATE INDEX IF NOT EXISTS idx_area_subscriptions_user_id ON area_subscriptions (user_id);
+
+-- How and when each user is notified; users without a row get the defaults
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    channels TEXT[] NOT NULL DEFAULT '{email}',
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    quiet_hours_start TIME,
+    quiet_hours_end TIME,
+    digest BOOLEAN NOT NULL DEFAULT FALSE,
+    digest_time TIME NOT NULL DEFAULT '08:00'
+    );
+
+-- Emails held back for quiet hours or a digest keep their content until they are sent
+ALTER TABLE email_deliveries ADD COLUMN IF NOT EXISTS body TEXT;
+ALTER TABLE email_deliveries ADD COLUMN IF NOT EXISTS link TEXT;
+ALTER TABLE email_deliveries ADD COLUMN IF NOT EXISTS reason TEXT;
+ALTER TABLE email_deliveries ADD COLUMN IF NOT EXISTS deliver_after TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_email_deliveries_deliver_after ON email_deliveries (deliver_after) WHERE status = 'scheduled';
+
+-- +goose Down
+-- SQL in section 'Down' is executed when this migration is rolled back
+
+DROP INDEX IF EXISTS idx_email_deliveries_deliver_after;
+
+ALTER TABLE email_deliveries DROP COLUMN IF EXISTS deliver_after;
+ALTER TABLE email_deliveries DROP COLUMN IF EXISTS reason;
+ALTER TABLE email_deliveries DROP COLUMN IF EXISTS link;
+ALTER TABLE email_deliveries DROP COLUMN IF EXISTS body;
+
+DROP TABLE IF EXISTS notification_preferences;
+DROP TABLE IF EXISTS area_subscriptions;
+DROP TABLE IF EXISTS tiger_subscriptions;
@@ -0,0 +1,24 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Events written in the same transaction as the change they describe, until the relay publishes them.
+-- Published rows are kept as a record of what was published and when.
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL UNIQUE,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMP
+    );
+
+CREATE INDEX IF NOT EXISTS idx_outbox_next_attempt_at ON outbox (next_attempt_at, id) WHERE status = 'pending';
+
+-- +goose Down
+-- SQL in section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS outbox;
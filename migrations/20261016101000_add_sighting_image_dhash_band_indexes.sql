@@ -0,0 +1,25 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Supports the prefilter of the near-duplicate search: two hashes within 7 bits of each other have at
+-- least one of their eight bytes in common
+CREATE INDEX IF NOT EXISTS idx_sighting_images_dhash_band0 ON sighting_images (((dhash >> 56) & 255));
+CREATE INDEX IF NOT EXISTS idx_sighting_images_dhash_band1 ON sighting_images (((dhash >> 48) & 255));
+CREATE INDEX IF NOT EXISTS idx_sighting_images_dhash_band2 ON sighting_images (((dhash >> 40) & 255));
+CREATE INDEX IF NOT EXISTS idx_sighting_images_dhash_band3 ON sighting_images (((dhash >> 32) & 255));
+CREATE INDEX IF NOT EXISTS idx_sighting_images_dhash_band4 ON sighting_images (((dhash >> 24) & 255));
+CREATE INDEX IF NOT EXISTS idx_sighting_images_dhash_band5 ON sighting_images (((dhash >> 16) & 255));
+CREATE INDEX IF NOT EXISTS idx_sighting_images_dhash_band6 ON sighting_images (((dhash >> 8) & 255));
+CREATE INDEX IF NOT EXISTS idx_sighting_images_dhash_band7 ON sighting_images (((dhash >> 0) & 255));
+
+-- +goose Down
+-- SQL in section 'Down' is executed when this migration is rolled back
+
+DROP INDEX IF EXISTS idx_sighting_images_dhash_band0;
+DROP INDEX IF EXISTS idx_sighting_images_dhash_band1;
+DROP INDEX IF EXISTS idx_sighting_images_dhash_band2;
+DROP INDEX IF EXISTS idx_sighting_images_dhash_band3;
+DROP INDEX IF EXISTS idx_sighting_images_dhash_band4;
+DROP INDEX IF EXISTS idx_sighting_images_dhash_band5;
+DROP INDEX IF EXISTS idx_sighting_images_dhash_band6;
+DROP INDEX IF EXISTS idx_sighting_images_dhash_band7;
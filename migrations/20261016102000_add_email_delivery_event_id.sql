@@ -0,0 +1,13 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- The event that requested the email, so that a redelivered event only retries the emails that were not sent
+ALTER TABLE email_deliveries ADD COLUMN IF NOT EXISTS event_id UUID;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_email_deliveries_event_id ON email_deliveries (event_id, recipient) WHERE event_id IS NOT NULL;
+
+-- +goose Down
+-- SQL in section 'Down' is executed when this migration is rolled back
+
+DROP INDEX IF EXISTS idx_email_deliveries_event_id;
+ALTER TABLE email_deliveries DROP COLUMN IF EXISTS event_id;
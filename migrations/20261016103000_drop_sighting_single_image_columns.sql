@@ -0,0 +1,33 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Databases that left the single-image columns of tiger_sightings in place keep their images in
+-- sighting_images before the columns are dropped; images copied earlier are not copied again
+-- +goose StatementBegin
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'tiger_sightings' AND column_name = 'image_key'
+    ) THEN
+        INSERT INTO sighting_images (sighting_id, image_key, image_sha256, image_width, image_height)
+        SELECT ts.id, ts.image_key, COALESCE(ts.image_sha256, ''), ts.image_width, ts.image_height
+        FROM tiger_sightings ts
+        WHERE ts.image_key IS NOT NULL
+          AND NOT EXISTS (SELECT 1 FROM sighting_images si WHERE si.sighting_id = ts.id AND si.image_key = ts.image_key)
+        ORDER BY ts.id;
+    END IF;
+END
+$$;
+-- +goose StatementEnd
+
+ALTER TABLE tiger_sightings DROP COLUMN IF EXISTS image_height;
+ALTER TABLE tiger_sightings DROP COLUMN IF EXISTS image_width;
+ALTER TABLE tiger_sightings DROP COLUMN IF EXISTS image_sha256;
+ALTER TABLE tiger_sightings DROP COLUMN IF EXISTS image_key;
+
+-- +goose Down
+-- SQL in section 'Down' is executed when this migration is rolled back
+
+-- The images stay in sighting_images; rolling back 20261016096000_add_sighting_images restores the columns
+SELECT 1;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- A scheduler run claims the due emails until claimed_until. Emails still pending after it, because the
+-- run stopped before recording whether they were sent, are claimed again by a later run.
+ALTER TABLE email_deliveries ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_email_deliveries_claimed_until ON email_deliveries (claimed_until) WHERE status = 'pending' AND claimed_until IS NOT NULL;
+
+-- +goose Down
+-- SQL in section 'Down' is executed when this migration is rolled back
+
+DROP INDEX IF EXISTS idx_email_deliveries_claimed_until;
+ALTER TABLE email_deliveries DROP COLUMN IF EXISTS claimed_until;
@@ -0,0 +1,62 @@
+// Package dhash computes difference hashes of images to find near-duplicate uploads, such as the
+// same camera-trap frame reported twice after being resized or recompressed.
+package dhash
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math/bits"
+
+	"github.com/disintegration/imaging"
+	conf "github.com/tigerhall-kittens/config"
+	"github.com/tigerhall-kittens/pkg/rules"
+)
+
+// Hash returns the 64-bit difference hash of the image. The image is shrunk to 9x8 grey pixels and
+// each bit records whether a pixel is brighter than its right neighbour, so the hash survives
+// scaling, recompression and small colour changes.
+func Hash(img image.Image) uint64 {
+	small := imaging.Resize(img, 9, 8, imaging.Box)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if luma(small.At(x, y)) > luma(small.At(x+1, y)) {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// Distance is the number of bits in which two hashes differ.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+func luma(c color.Color) uint8 {
+	return color.GrayModel.Convert(c).(color.Gray).Y
+}
+
+// DefaultCheck flags images within 4 bits of an earlier image.
+var DefaultCheck = Check{MaxDistance: 4, Action: rules.ActionFlag}
+
+// Check decides when an uploaded image is a near-duplicate of an earlier one and what happens to it.
+type Check struct {
+	MaxDistance int
+	Action      rules.Action
+}
+
+// FromConfig builds the check from the configuration.
+func FromConfig(config conf.DuplicateCheck) (Check, error) {
+	check := Check{MaxDistance: config.MaxDistance, Action: rules.Action(config.Action)}
+	if check.MaxDistance < 0 || check.MaxDistance > 64 {
+		return Check{}, fmt.Errorf("maximum distance must be between 0 and 64, got %d", check.MaxDistance)
+	}
+	if check.Action != rules.ActionReject && check.Action != rules.ActionFlag {
+		return Check{}, fmt.Errorf("action must be %q or %q, got %q", rules.ActionReject, rules.ActionFlag, check.Action)
+	}
+	return check, nil
+}
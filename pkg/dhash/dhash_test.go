@@ -0,0 +1,58 @@
+package dhash
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+	conf "github.com/tigerhall-kittens/config"
+	"github.com/tigerhall-kittens/pkg/rules"
+)
+
+// testImage returns an image whose brightness falls from left to right, with a dark square in its top left corner.
+func testImage(width, height int) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8(255 - 255*x/width)
+			if x < width/4 && y < height/4 {
+				v = 0
+			}
+			img.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+	return img
+}
+
+func TestHash_SurvivesResizing(t *testing.T) {
+	original := testImage(640, 480)
+	resized := imaging.Resize(original, 200, 150, imaging.Lanczos)
+
+	assert.LessOrEqual(t, Distance(Hash(original), Hash(resized)), 2, "A resized copy should hash alike")
+}
+
+func TestHash_DiffersForDifferentImages(t *testing.T) {
+	mirrored := imaging.FlipH(testImage(640, 480))
+
+	assert.Greater(t, Distance(Hash(testImage(640, 480)), Hash(mirrored)), 32, "A mirrored image should hash differently")
+}
+
+func TestDistance(t *testing.T) {
+	assert.Equal(t, 0, Distance(0xff, 0xff))
+	assert.Equal(t, 8, Distance(0xff, 0))
+	assert.Equal(t, 64, Distance(^uint64(0), 0))
+}
+
+func TestFromConfig(t *testing.T) {
+	check, err := FromConfig(conf.DuplicateCheck{MaxDistance: 6, Action: "reject"})
+	assert.NoError(t, err)
+	assert.Equal(t, Check{MaxDistance: 6, Action: rules.ActionReject}, check)
+
+	_, err = FromConfig(conf.DuplicateCheck{MaxDistance: 6, Action: "ignore"})
+	assert.Error(t, err, "Unknown actions should be refused")
+
+	_, err = FromConfig(conf.DuplicateCheck{MaxDistance: 65, Action: "flag"})
+	assert.Error(t, err, "Distances beyond the hash size should be refused")
+}
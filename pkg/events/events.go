@@ -0,0 +1,172 @@
+// Package events defines the domain events published to the message broker. Every event travels in an
+// Envelope whose Type doubles as the routing key on the topic exchange, so that consumers bind only to
+// the events they need.
+package events
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/tigerhall-kittens/pkg/models"
+	"github.com/tigerhall-kittens/pkg/utils"
+)
+
+// Event types, which are also the routing keys of the events.
+const (
+	TigerCreated    = "tiger.created"
+	SightingCreated = "sighting.created"
+	UserSignedUp    = "user.signed_up"
+	// EmailRequested asks the notifier to send emails; it is internal to the service and not a
+	// domain event for other consumers
+	EmailRequested = "notification.email_requested"
+)
+
+// Version is the current version of the payload of every event type. It is raised when a payload
+// changes in a way that existing consumers cannot read.
+const Version = 1
+
+// Envelope wraps the payload of an event with what consumers need to route, deduplicate and trace it.
+type Envelope struct {
+	// ID is unique to the event, so that consumers can drop events delivered more than once
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+	// OccurredAt is when the change happened, not when the event was published
+	OccurredAt time.Time `json:"occurredAt"`
+	// CorrelationID is shared by the events that follow from the same change, such as a sighting and
+	// the emails about it
+	CorrelationID string          `json:"correlationID"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// TigerCreatedData is the payload of a TigerCreated event. The location of protected tigers is
+// coarsened, as in the public API.
+type TigerCreatedData struct {
+	TigerID     int       `json:"tigerID"`
+	Name        string    `json:"name"`
+	DateOfBirth time.Time `json:"dateOfBirth"`
+	LastSeen    time.Time `json:"lastSeen"`
+	Lat         float64   `json:"lat"`
+	Long        float64   `json:"long"`
+	CreatedBy   int       `json:"createdBy,omitempty"`
+	Protected   bool      `json:"protected"`
+}
+
+// SightingCreatedData is the payload of a SightingCreated event. The location of sightings of
+// protected tigers is coarsened, as in the public API.
+type SightingCreatedData struct {
+	SightingID int       `json:"sightingID"`
+	TigerID    int       `json:"tigerID"`
+	TigerName  string    `json:"tigerName"`
+	Protected  bool      `json:"protected"`
+	Timestamp  time.Time `json:"timestamp"`
+	Lat        float64   `json:"lat"`
+	Long       float64   `json:"long"`
+	ImageCount int       `json:"imageCount"`
+	Flags      []string  `json:"flags,omitempty"`
+}
+
+// UserSignedUpData is the payload of a UserSignedUp event.
+type UserSignedUpData struct {
+	UserID   int    `json:"userID"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// EmailRequestedData is the payload of an EmailRequested event.
+type EmailRequestedData struct {
+	Emails []utils.EmailTemplate `json:"emails"`
+}
+
+// New wraps the payload in an envelope of the current version. The event starts a new correlation
+// unless it is given the correlation ID of the event it follows from.
+func New(eventType string, occurredAt time.Time, correlationID string, data interface{}) (Envelope, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("failed to encode %s event: %v", eventType, err)
+	}
+	id, err := newID()
+	if err != nil {
+		return Envelope{}, err
+	}
+	if correlationID == "" {
+		correlationID = id
+	}
+	return Envelope{
+		ID:            id,
+		Type:          eventType,
+		Version:       Version,
+		OccurredAt:    occurredAt.UTC(),
+		CorrelationID: correlationID,
+		Data:          payload,
+	}, nil
+}
+
+// Decode reads the payload of the event into data, refusing versions it does not know.
+func (e Envelope) Decode(data interface{}) error {
+	if e.Version != Version {
+		return fmt.Errorf("unsupported version %d of %s event", e.Version, e.Type)
+	}
+	if err := json.Unmarshal(e.Data, data); err != nil {
+		return fmt.Errorf("failed to decode %s event: %v", e.Type, err)
+	}
+	return nil
+}
+
+// NewTigerCreated describes the newly created tiger. The caller coarsens the location of a protected
+// tiger before.
+func NewTigerCreated(tiger *models.Tiger, occurredAt time.Time) (Envelope, error) {
+	return New(TigerCreated, occurredAt, "", TigerCreatedData{
+		TigerID:     tiger.ID,
+		Name:        tiger.Name,
+		DateOfBirth: tiger.DateOfBirth,
+		LastSeen:    tiger.LastSeen,
+		Lat:         tiger.Lat,
+		Long:        tiger.Long,
+		CreatedBy:   tiger.CreatedBy,
+		Protected:   tiger.Protected,
+	})
+}
+
+// NewSightingCreated describes the new sighting of the tiger. The caller coarsens the location of a
+// protected tiger before.
+func NewSightingCreated(tiger *models.Tiger, sighting *models.TigerSighting, occurredAt time.Time) (Envelope, error) {
+	return New(SightingCreated, occurredAt, "", SightingCreatedData{
+		SightingID: sighting.ID,
+		TigerID:    tiger.ID,
+		TigerName:  tiger.Name,
+		Protected:  tiger.Protected,
+		Timestamp:  sighting.Timestamp,
+		Lat:        sighting.Lat,
+		Long:       sighting.Long,
+		ImageCount: len(sighting.StoredImages),
+		Flags:      sighting.Flags,
+	})
+}
+
+// NewUserSignedUp describes the new user, leaving out their password.
+func NewUserSignedUp(user *models.User, occurredAt time.Time) (Envelope, error) {
+	return New(UserSignedUp, occurredAt, "", UserSignedUpData{
+		UserID:   user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+	})
+}
+
+// NewEmailRequested asks for the emails to be sent as part of the correlation of an earlier event.
+func NewEmailRequested(emails []utils.EmailTemplate, occurredAt time.Time, correlationID string) (Envelope, error) {
+	return New(EmailRequested, occurredAt, correlationID, EmailRequestedData{Emails: emails})
+}
+
+// newID returns a random version 4 UUID.
+func newID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate event ID: %v", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
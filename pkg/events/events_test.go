@@ -0,0 +1,40 @@
+package events
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tigerhall-kittens/pkg/models"
+	"github.com/tigerhall-kittens/pkg/utils"
+)
+
+func TestNew_Correlation(t *testing.T) {
+	occurredAt := time.Date(2023, time.July, 21, 18, 0, 0, 0, time.FixedZone("IST", 5*3600+1800))
+
+	sighting, err := NewSightingCreated(&models.Tiger{ID: 1, Name: "Sher Khan"}, &models.TigerSighting{ID: 2, TigerID: 1}, occurredAt)
+	assert.NoError(t, err)
+	emails, err := NewEmailRequested([]utils.EmailTemplate{{Recipient: "a@example.com"}}, occurredAt, sighting.CorrelationID)
+	assert.NoError(t, err)
+
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), sighting.ID)
+	assert.Equal(t, sighting.ID, sighting.CorrelationID, "An event should start a new correlation by default")
+	assert.NotEqual(t, sighting.ID, emails.ID)
+	assert.Equal(t, sighting.CorrelationID, emails.CorrelationID, "The emails should share the correlation of the sighting")
+	assert.Equal(t, time.UTC, sighting.OccurredAt.Location())
+	assert.Equal(t, Version, sighting.Version)
+}
+
+func TestEnvelope_Decode(t *testing.T) {
+	event, err := NewUserSignedUp(&models.User{ID: 3, Username: "ranger", Email: "ranger@example.com", Password: "secret"}, time.Now())
+	assert.NoError(t, err)
+	assert.NotContains(t, string(event.Data), "secret", "The password should not be published")
+
+	var data UserSignedUpData
+	assert.NoError(t, event.Decode(&data))
+	assert.Equal(t, UserSignedUpData{UserID: 3, Username: "ranger", Email: "ranger@example.com"}, data)
+
+	event.Version = Version + 1
+	assert.Error(t, event.Decode(&data), "Unknown versions should be refused")
+}
@@ -0,0 +1,289 @@
+// Package exif reads the GPS position and capture time that cameras embed in images, and
+// strips that metadata before images are stored.
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	conf "github.com/tigerhall-kittens/config"
+	"github.com/tigerhall-kittens/pkg/models"
+	"github.com/tigerhall-kittens/pkg/utils"
+)
+
+// ErrNoExif is returned for images without EXIF data.
+var ErrNoExif = errors.New("image has no EXIF data")
+
+const (
+	tagExifIFD            = 0x8769
+	tagGPSIFD             = 0x8825
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagGPSLatitudeRef     = 0x0001
+	tagGPSLatitude        = 0x0002
+	tagGPSLongitudeRef    = 0x0003
+	tagGPSLongitude       = 0x0004
+
+	// dateTimeLayout is the format of EXIF dates, which carry no time zone
+	dateTimeLayout = "2006:01:02 15:04:05"
+)
+
+// typeSizes are the sizes in bytes of the TIFF field types, by type.
+var typeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+// Metadata is the part of the EXIF data of an image that describes where and when it was taken.
+type Metadata struct {
+	// Location is nil when the image has no GPS position
+	Location *models.Coordinates
+	// Taken is nil when the image has no capture time. Without a recorded offset the time is taken as UTC.
+	Taken *time.Time
+}
+
+// Parse reads the EXIF metadata of a JPEG image.
+func Parse(image []byte) (*Metadata, error) {
+	tiff, err := exifSegment(image)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := newReader(tiff)
+	if err != nil {
+		return nil, err
+	}
+	ifd0, err := r.ifd(r.order.Uint32(tiff[4:8]))
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &Metadata{}
+	if offset, ok := r.uint32(ifd0[tagExifIFD]); ok {
+		exifIFD, err := r.ifd(offset)
+		if err != nil {
+			return nil, err
+		}
+		meta.Taken = r.taken(exifIFD)
+	}
+	if offset, ok := r.uint32(ifd0[tagGPSIFD]); ok {
+		gpsIFD, err := r.ifd(offset)
+		if err != nil {
+			return nil, err
+		}
+		meta.Location = r.location(gpsIFD)
+	}
+	return meta, nil
+}
+
+// exifSegment returns the TIFF structure stored in the APP1 segment of a JPEG image.
+func exifSegment(image []byte) ([]byte, error) {
+	if len(image) < 2 || image[0] != 0xFF || image[1] != 0xD8 {
+		return nil, ErrNoExif
+	}
+
+	for pos := 2; pos+4 <= len(image); {
+		if image[pos] != 0xFF {
+			return nil, errors.New("malformed JPEG segment")
+		}
+		marker := image[pos+1]
+		// The image data starts after the start of scan marker, so EXIF data cannot follow
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(image[pos+2 : pos+4]))
+		if length < 2 || pos+2+length > len(image) {
+			return nil, errors.New("malformed JPEG segment")
+		}
+		segment := image[pos+4 : pos+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+		pos += 2 + length
+	}
+	return nil, ErrNoExif
+}
+
+type entry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+type reader struct {
+	tiff  []byte
+	order binary.ByteOrder
+}
+
+func newReader(tiff []byte) (*reader, error) {
+	if len(tiff) < 8 {
+		return nil, errors.New("malformed EXIF header")
+	}
+	r := &reader{tiff: tiff}
+	switch string(tiff[:2]) {
+	case "II":
+		r.order = binary.LittleEndian
+	case "MM":
+		r.order = binary.BigEndian
+	default:
+		return nil, errors.New("malformed EXIF byte order")
+	}
+	if r.order.Uint16(tiff[2:4]) != 42 {
+		return nil, errors.New("malformed EXIF header")
+	}
+	return r, nil
+}
+
+// ifd reads the entries of the image file directory at offset, by tag.
+func (r *reader) ifd(offset uint32) (map[uint16]entry, error) {
+	if uint64(offset)+2 > uint64(len(r.tiff)) {
+		return nil, fmt.Errorf("EXIF directory offset %d out of range", offset)
+	}
+	count := uint32(r.order.Uint16(r.tiff[offset:]))
+	start := offset + 2
+	if uint64(start)+uint64(count)*12 > uint64(len(r.tiff)) {
+		return nil, fmt.Errorf("EXIF directory at %d out of range", offset)
+	}
+
+	entries := map[uint16]entry{}
+	for i := uint32(0); i < count; i++ {
+		raw := r.tiff[start+i*12 : start+i*12+12]
+		e := entry{typ: r.order.Uint16(raw[2:4]), count: r.order.Uint32(raw[4:8])}
+		size, ok := typeSizes[e.typ]
+		if !ok {
+			continue
+		}
+
+		// Values of up to four bytes are stored in the entry itself
+		length := uint64(size) * uint64(e.count)
+		if length <= 4 {
+			e.value = raw[8 : 8+length]
+		} else {
+			valueOffset := uint64(r.order.Uint32(raw[8:12]))
+			if valueOffset+length > uint64(len(r.tiff)) {
+				continue
+			}
+			e.value = r.tiff[valueOffset : valueOffset+length]
+		}
+		entries[r.order.Uint16(raw[0:2])] = e
+	}
+	return entries, nil
+}
+
+func (r *reader) uint32(e entry) (uint32, bool) {
+	switch {
+	case e.typ == 4 && e.count >= 1:
+		return r.order.Uint32(e.value), true
+	case e.typ == 3 && e.count >= 1:
+		return uint32(r.order.Uint16(e.value)), true
+	}
+	return 0, false
+}
+
+func (r *reader) ascii(e entry) string {
+	if e.typ != 2 {
+		return ""
+	}
+	return strings.TrimRight(string(e.value), "\x00 ")
+}
+
+// degrees converts a GPS coordinate stored as degrees, minutes and seconds.
+func (r *reader) degrees(e entry) (float64, bool) {
+	if e.typ != 5 || e.count != 3 {
+		return 0, false
+	}
+	var parts [3]float64
+	for i := range parts {
+		numerator := r.order.Uint32(e.value[i*8:])
+		denominator := r.order.Uint32(e.value[i*8+4:])
+		if denominator == 0 {
+			return 0, false
+		}
+		parts[i] = float64(numerator) / float64(denominator)
+	}
+	return parts[0] + parts[1]/60 + parts[2]/3600, true
+}
+
+func (r *reader) location(gps map[uint16]entry) *models.Coordinates {
+	lat, ok := r.degrees(gps[tagGPSLatitude])
+	if !ok {
+		return nil
+	}
+	long, ok := r.degrees(gps[tagGPSLongitude])
+	if !ok {
+		return nil
+	}
+	if r.ascii(gps[tagGPSLatitudeRef]) == "S" {
+		lat = -lat
+	}
+	if r.ascii(gps[tagGPSLongitudeRef]) == "W" {
+		long = -long
+	}
+	return &models.Coordinates{Lat: lat, Long: long}
+}
+
+func (r *reader) taken(exifIFD map[uint16]entry) *time.Time {
+	value := r.ascii(exifIFD[tagDateTimeOriginal])
+	if value == "" {
+		return nil
+	}
+
+	location := time.UTC
+	if offset := r.ascii(exifIFD[tagOffsetTimeOriginal]); offset != "" {
+		if t, err := time.Parse("-07:00", offset); err == nil {
+			location = t.Location()
+		}
+	}
+	taken, err := time.ParseInLocation(dateTimeLayout, value, location)
+	if err != nil {
+		return nil
+	}
+	return &taken
+}
+
+// Check decides when the reported location and time of a sighting disagree with the EXIF data of its image.
+type Check struct {
+	MaxDistanceKm     float64
+	MaxTimeDifference time.Duration
+}
+
+// DefaultCheck flags sightings more than 1 km or an hour away from the EXIF data of their image.
+var DefaultCheck = Check{MaxDistanceKm: 1, MaxTimeDifference: time.Hour}
+
+// FromConfig builds the check from the configuration.
+func FromConfig(config conf.ExifCheck) Check {
+	return Check{MaxDistanceKm: config.MaxDistanceKm, MaxTimeDifference: config.MaxTimeDifference}
+}
+
+// Apply fills in the location and time of the sighting from the metadata when they were not
+// reported, and returns the reasons to flag the sighting when the reported values disagree with it.
+func (c Check) Apply(sighting *models.TigerSighting, meta *Metadata) []string {
+	var mismatches []string
+
+	if meta.Location != nil {
+		if sighting.Lat == 0 && sighting.Long == 0 {
+			sighting.Lat, sighting.Long = meta.Location.Lat, meta.Location.Long
+		} else {
+			reported := models.Coordinates{Lat: sighting.Lat, Long: sighting.Long}
+			if distance := utils.CalculateDistance(reported, *meta.Location); distance > c.MaxDistanceKm {
+				mismatches = append(mismatches, fmt.Sprintf("location is %.2f km from the image GPS position", distance))
+			}
+		}
+	}
+
+	if meta.Taken != nil {
+		if sighting.Timestamp.IsZero() {
+			sighting.Timestamp = *meta.Taken
+		} else {
+			difference := sighting.Timestamp.Sub(*meta.Taken)
+			if difference < 0 {
+				difference = -difference
+			}
+			if difference > c.MaxTimeDifference {
+				mismatches = append(mismatches, fmt.Sprintf("timestamp is %v from the image capture time", difference))
+			}
+		}
+	}
+	return mismatches
+}
@@ -0,0 +1,171 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tigerhall-kittens/pkg/models"
+)
+
+type testEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+func ascii(s string) testEntry {
+	return testEntry{typ: 2, count: uint32(len(s) + 1), value: append([]byte(s), 0)}
+}
+
+func rational(degrees, minutes, secondsTimes100 uint32) testEntry {
+	value := make([]byte, 24)
+	for i, part := range [][2]uint32{{degrees, 1}, {minutes, 1}, {secondsTimes100, 100}} {
+		binary.LittleEndian.PutUint32(value[i*8:], part[0])
+		binary.LittleEndian.PutUint32(value[i*8+4:], part[1])
+	}
+	return testEntry{typ: 5, count: 3, value: value}
+}
+
+func longValue(v uint32) testEntry {
+	value := make([]byte, 4)
+	binary.LittleEndian.PutUint32(value, v)
+	return testEntry{typ: 4, count: 1, value: value}
+}
+
+func tagged(tag uint16, e testEntry) testEntry {
+	e.tag = tag
+	return e
+}
+
+// ifdSize is the size of an IFD together with its values that do not fit in the entries.
+func ifdSize(entries []testEntry) uint32 {
+	size := uint32(2 + 12*len(entries) + 4)
+	for _, e := range entries {
+		if len(e.value) > 4 {
+			size += uint32(len(e.value))
+		}
+	}
+	return size
+}
+
+func writeIFD(buf *bytes.Buffer, entries []testEntry) {
+	offset := uint32(buf.Len())
+	valueOffset := offset + uint32(2+12*len(entries)+4)
+	var values []byte
+
+	binary.Write(buf, binary.LittleEndian, uint16(len(entries)))
+	for _, e := range entries {
+		binary.Write(buf, binary.LittleEndian, e.tag)
+		binary.Write(buf, binary.LittleEndian, e.typ)
+		binary.Write(buf, binary.LittleEndian, e.count)
+		if len(e.value) > 4 {
+			binary.Write(buf, binary.LittleEndian, valueOffset+uint32(len(values)))
+			values = append(values, e.value...)
+		} else {
+			inline := make([]byte, 4)
+			copy(inline, e.value)
+			buf.Write(inline)
+		}
+	}
+	binary.Write(buf, binary.LittleEndian, uint32(0))
+	buf.Write(values)
+}
+
+// testJPEG returns a JPEG image whose EXIF data holds the given IFDs.
+func testJPEG(t *testing.T, exifIFD, gpsIFD []testEntry) []byte {
+	exifOffset := 8 + ifdSize(make([]testEntry, 2))
+	gpsOffset := exifOffset + ifdSize(exifIFD)
+	ifd0 := []testEntry{tagged(tagExifIFD, longValue(exifOffset)), tagged(tagGPSIFD, longValue(gpsOffset))}
+
+	return testJPEGWithIFD0(t, ifd0, exifIFD, gpsIFD)
+}
+
+// testJPEGWithIFD0 returns a JPEG image whose EXIF data holds the given IFDs, the first of which is IFD0.
+func testJPEGWithIFD0(t *testing.T, ifds ...[]testEntry) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("II")
+	binary.Write(&tiff, binary.LittleEndian, uint16(42))
+	binary.Write(&tiff, binary.LittleEndian, uint32(8))
+	for _, ifd := range ifds {
+		writeIFD(&tiff, ifd)
+	}
+
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewRGBA(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Insert the APP1 segment right after the start of image marker
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	var out bytes.Buffer
+	out.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(segment)+2))
+	out.Write(segment)
+	out.Write(img.Bytes()[2:])
+	return out.Bytes()
+}
+
+func TestParse(t *testing.T) {
+	data := testJPEG(t,
+		[]testEntry{
+			tagged(tagDateTimeOriginal, ascii("2023:07:21 17:30:00")),
+			tagged(tagOffsetTimeOriginal, ascii("+05:30")),
+		},
+		[]testEntry{
+			tagged(tagGPSLatitudeRef, ascii("N")),
+			tagged(tagGPSLatitude, rational(12, 20, 2400)),
+			tagged(tagGPSLongitudeRef, ascii("W")),
+			tagged(tagGPSLongitude, rational(56, 47, 0)),
+		},
+	)
+
+	meta, err := Parse(data)
+	assert.NoError(t, err)
+	assert.InDelta(t, 12.34, meta.Location.Lat, 1e-9)
+	assert.InDelta(t, -(56 + 47.0/60), meta.Location.Long, 1e-9)
+	assert.True(t, time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC).Equal(*meta.Taken))
+}
+
+func TestParse_NoExif(t *testing.T) {
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewRGBA(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Parse(img.Bytes())
+	assert.ErrorIs(t, err, ErrNoExif)
+
+	_, err = Parse([]byte("not an image"))
+	assert.ErrorIs(t, err, ErrNoExif)
+}
+
+func TestCheck_Apply(t *testing.T) {
+	taken := time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC)
+	meta := &Metadata{Location: &models.Coordinates{Lat: 12.34, Long: 56.78}, Taken: &taken}
+
+	// Missing values are filled in from the EXIF data
+	sighting := &models.TigerSighting{}
+	mismatches := DefaultCheck.Apply(sighting, meta)
+	assert.Empty(t, mismatches)
+	assert.Equal(t, 12.34, sighting.Lat)
+	assert.Equal(t, 56.78, sighting.Long)
+	assert.Equal(t, taken, sighting.Timestamp)
+
+	// Reported values close to the EXIF data are accepted as they are
+	sighting = &models.TigerSighting{Lat: 12.341, Long: 56.78, Timestamp: taken.Add(30 * time.Minute)}
+	assert.Empty(t, DefaultCheck.Apply(sighting, meta))
+	assert.Equal(t, 12.341, sighting.Lat)
+
+	// Reported values far from the EXIF data are flagged
+	sighting = &models.TigerSighting{Lat: 13.34, Long: 56.78, Timestamp: taken.Add(-2 * time.Hour)}
+	mismatches = DefaultCheck.Apply(sighting, meta)
+	assert.Len(t, mismatches, 2)
+	assert.Contains(t, mismatches[0], "km from the image GPS position")
+	assert.Contains(t, mismatches[1], "2h0m0s from the image capture time")
+}
@@ -0,0 +1,55 @@
+package exif
+
+import (
+	"image"
+
+	"github.com/disintegration/imaging"
+)
+
+const tagOrientation = 0x0112
+
+// Orientation returns the EXIF orientation of a JPEG image, from 1 to 8. Images without a valid
+// orientation are upright, which is 1.
+func Orientation(data []byte) int {
+	tiff, err := exifSegment(data)
+	if err != nil {
+		return 1
+	}
+	r, err := newReader(tiff)
+	if err != nil {
+		return 1
+	}
+	ifd0, err := r.ifd(r.order.Uint32(tiff[4:8]))
+	if err != nil {
+		return 1
+	}
+	orientation, ok := r.uint32(ifd0[tagOrientation])
+	if !ok || orientation < 1 || orientation > 8 {
+		return 1
+	}
+	return int(orientation)
+}
+
+// Orient turns the pixels of img upright according to its EXIF orientation, so that the image
+// displays the same once the orientation is stripped.
+func Orient(img image.Image, orientation int) image.Image {
+	// imaging rotates counter-clockwise
+	switch orientation {
+	case 2:
+		return imaging.FlipH(img)
+	case 3:
+		return imaging.Rotate180(img)
+	case 4:
+		return imaging.FlipV(img)
+	case 5:
+		return imaging.Transpose(img)
+	case 6:
+		return imaging.Rotate270(img)
+	case 7:
+		return imaging.Transverse(img)
+	case 8:
+		return imaging.Rotate90(img)
+	default:
+		return img
+	}
+}
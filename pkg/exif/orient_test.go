@@ -0,0 +1,42 @@
+package exif
+
+import (
+	"encoding/binary"
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func shortValue(v uint16) testEntry {
+	value := make([]byte, 2)
+	binary.LittleEndian.PutUint16(value, v)
+	return testEntry{typ: 3, count: 1, value: value}
+}
+
+func TestOrientation(t *testing.T) {
+	img := testJPEG(t, nil, nil)
+	assert.Equal(t, 1, Orientation(img), "Images without an orientation should be upright")
+	assert.Equal(t, 1, Orientation([]byte("not an image")))
+
+	assert.Equal(t, 6, Orientation(orientedJPEG(t, 6)))
+	assert.Equal(t, 1, Orientation(orientedJPEG(t, 9)), "Invalid orientations should be ignored")
+}
+
+// orientedJPEG returns a JPEG image whose EXIF data holds only the orientation.
+func orientedJPEG(t *testing.T, orientation uint16) []byte {
+	return testJPEGWithIFD0(t, []testEntry{tagged(tagOrientation, shortValue(orientation))})
+}
+
+func TestOrient(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 30, 20))
+
+	for orientation := 1; orientation <= 8; orientation++ {
+		bounds := Orient(img, orientation).Bounds()
+		if orientation >= 5 {
+			assert.Equal(t, image.Pt(20, 30), bounds.Size(), "Orientation %d should swap width and height", orientation)
+		} else {
+			assert.Equal(t, image.Pt(30, 20), bounds.Size(), "Orientation %d should keep width and height", orientation)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngMetadataChunks are the PNG chunks that carry EXIF data, free text or the modification time.
+var pngMetadataChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+// Strip removes EXIF, XMP, IPTC and comment metadata, including GPS positions and camera
+// details, from JPEG, PNG and WebP images without re-encoding them. Colour profiles are kept.
+// Images in other formats are returned unchanged. The EXIF orientation goes too, so callers that
+// keep displaying the image turn its pixels upright with Orient.
+func Strip(image []byte) ([]byte, error) {
+	switch {
+	case len(image) >= 2 && image[0] == 0xFF && image[1] == 0xD8:
+		return stripJPEG(image)
+	case bytes.HasPrefix(image, pngSignature):
+		return stripPNG(image)
+	case len(image) >= 12 && string(image[0:4]) == "RIFF" && string(image[8:12]) == "WEBP":
+		return stripWebP(image)
+	default:
+		return image, nil
+	}
+}
+
+// keepJPEGSegment reports whether a JPEG segment is needed to display the image. Of the
+// application segments only JFIF (APP0), ICC profiles (APP2) and Adobe colour transforms
+// (APP14) are kept.
+func keepJPEGSegment(marker byte) bool {
+	switch {
+	case marker == 0xFE:
+		return false
+	case marker >= 0xE0 && marker <= 0xEF:
+		return marker == 0xE0 || marker == 0xE2 || marker == 0xEE
+	default:
+		return true
+	}
+}
+
+func stripJPEG(image []byte) ([]byte, error) {
+	out := make([]byte, 0, len(image))
+	out = append(out, image[:2]...)
+
+	pos := 2
+	for {
+		if pos+4 > len(image) || image[pos] != 0xFF {
+			return nil, errors.New("malformed JPEG segment")
+		}
+		marker := image[pos+1]
+		// Everything from the start of scan on is image data
+		if marker == 0xDA {
+			return append(out, image[pos:]...), nil
+		}
+		length := int(binary.BigEndian.Uint16(image[pos+2 : pos+4]))
+		if length < 2 || pos+2+length > len(image) {
+			return nil, errors.New("malformed JPEG segment")
+		}
+		if keepJPEGSegment(marker) {
+			out = append(out, image[pos:pos+2+length]...)
+		}
+		pos += 2 + length
+	}
+}
+
+func stripPNG(image []byte) ([]byte, error) {
+	out := make([]byte, 0, len(image))
+	out = append(out, pngSignature...)
+
+	for pos := len(pngSignature); pos < len(image); {
+		if pos+8 > len(image) {
+			return nil, errors.New("malformed PNG chunk")
+		}
+		length := int(binary.BigEndian.Uint32(image[pos : pos+4]))
+		end := pos + 12 + length
+		if end > len(image) {
+			return nil, errors.New("malformed PNG chunk")
+		}
+		if !pngMetadataChunks[string(image[pos+4:pos+8])] {
+			out = append(out, image[pos:end]...)
+		}
+		pos = end
+	}
+	return out, nil
+}
+
+func stripWebP(image []byte) ([]byte, error) {
+	out := make([]byte, 0, len(image))
+	out = append(out, image[:12]...)
+
+	for pos := 12; pos < len(image); {
+		if pos+8 > len(image) {
+			return nil, errors.New("malformed WebP chunk")
+		}
+		fourCC := string(image[pos : pos+4])
+		length := int(binary.LittleEndian.Uint32(image[pos+4 : pos+8]))
+		// Chunks are padded to an even size
+		end := pos + 8 + length + length%2
+		if end > len(image) {
+			return nil, errors.New("malformed WebP chunk")
+		}
+
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			// Clear the flags announcing the removed EXIF and XMP chunks
+			start := len(out)
+			out = append(out, image[pos:end]...)
+			if length > 0 {
+				out[start+8] &^= 0x08 | 0x04
+			}
+		default:
+			out = append(out, image[pos:end]...)
+		}
+		pos = end
+	}
+
+	// The RIFF header holds the size of everything after it
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out, nil
+}
@@ -0,0 +1,89 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrip_JPEG(t *testing.T) {
+	data := testJPEG(t,
+		[]testEntry{tagged(tagDateTimeOriginal, ascii("2023:07:21 17:30:00"))},
+		[]testEntry{
+			tagged(tagGPSLatitudeRef, ascii("N")),
+			tagged(tagGPSLatitude, rational(12, 20, 2400)),
+			tagged(tagGPSLongitudeRef, ascii("E")),
+			tagged(tagGPSLongitude, rational(56, 47, 0)),
+		},
+	)
+
+	stripped, err := Strip(data)
+	assert.NoError(t, err)
+
+	_, err = Parse(stripped)
+	assert.ErrorIs(t, err, ErrNoExif, "EXIF data should be removed")
+	_, _, err = image.Decode(bytes.NewReader(stripped))
+	assert.NoError(t, err, "Stripped image should still decode")
+}
+
+func TestStrip_PNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	original := buf.Bytes()
+
+	// Insert a text chunk after the IHDR chunk, which is 25 bytes long
+	text := []byte("tEXtComment\x00taken at the waterhole")
+	var chunk bytes.Buffer
+	binary.Write(&chunk, binary.BigEndian, uint32(len(text)-4))
+	chunk.Write(text)
+	binary.Write(&chunk, binary.BigEndian, crc32.ChecksumIEEE(text))
+	ihdrEnd := len(pngSignature) + 25
+	data := append(append(append([]byte{}, original[:ihdrEnd]...), chunk.Bytes()...), original[ihdrEnd:]...)
+
+	stripped, err := Strip(data)
+	assert.NoError(t, err)
+	assert.Equal(t, original, stripped, "Only the text chunk should be removed")
+}
+
+func TestStrip_OtherFormats(t *testing.T) {
+	stripped, err := Strip([]byte("GIF89a"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("GIF89a"), stripped)
+}
+
+func TestStrip_WebP(t *testing.T) {
+	chunk := func(fourCC string, data []byte) []byte {
+		out := append([]byte(fourCC), 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(out[4:], uint32(len(data)))
+		out = append(out, data...)
+		if len(data)%2 == 1 {
+			out = append(out, 0)
+		}
+		return out
+	}
+	riff := func(chunks ...[]byte) []byte {
+		body := []byte("WEBP")
+		for _, c := range chunks {
+			body = append(body, c...)
+		}
+		out := append([]byte("RIFF"), 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(out[4:], uint32(len(body)))
+		return append(out, body...)
+	}
+
+	vp8x := make([]byte, 10)
+	vp8x[0] = 0x08 | 0x04
+	frame := []byte("frame-data")
+	data := riff(chunk("VP8X", vp8x), chunk("VP8 ", frame), chunk("EXIF", []byte("gps")), chunk("XMP ", []byte("<x/>")))
+
+	stripped, err := Strip(data)
+	assert.NoError(t, err)
+	assert.Equal(t, riff(chunk("VP8X", make([]byte, 10)), chunk("VP8 ", frame)), stripped, "EXIF and XMP chunks and their flags should be removed")
+}
@@ -0,0 +1,106 @@
+package geojson
+
+import (
+	"sort"
+	"time"
+
+	"github.com/tigerhall-kittens/pkg/models"
+)
+
+// ContentType is the media type of GeoJSON documents (RFC 7946).
+const ContentType = "application/geo+json"
+
+type FeatureCollection struct {
+	Type     string     `json:"type"`
+	Features []*Feature `json:"features"`
+}
+
+type Feature struct {
+	Type       string                 `json:"type"`
+	Geometry   Geometry               `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Geometry is a Point or a LineString. Positions are [longitude, latitude] as required by GeoJSON.
+type Geometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// TigerTracks renders sightings as a point per sighting followed by a
+// LineString track per tiger, both ordered by timestamp. Tigers are used for
+// the track properties and may be incomplete.
+func TigerTracks(tigers []*models.Tiger, sightings []*models.TigerSighting) *FeatureCollection {
+	names := map[int]string{}
+	for _, tiger := range tigers {
+		names[tiger.ID] = tiger.Name
+	}
+
+	ordered := make([]*models.TigerSighting, len(sightings))
+	copy(ordered, sightings)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Timestamp.Before(ordered[j].Timestamp) })
+
+	collection := &FeatureCollection{Type: "FeatureCollection", Features: []*Feature{}}
+	tracks := map[int][]*models.TigerSighting{}
+	var tigerIDs []int
+	for _, sighting := range ordered {
+		collection.Features = append(collection.Features, sightingPoint(sighting))
+		if _, ok := tracks[sighting.TigerID]; !ok {
+			tigerIDs = append(tigerIDs, sighting.TigerID)
+		}
+		tracks[sighting.TigerID] = append(tracks[sighting.TigerID], sighting)
+	}
+
+	for _, tigerID := range tigerIDs {
+		// A LineString needs at least two positions
+		if track := tracks[tigerID]; len(track) > 1 {
+			collection.Features = append(collection.Features, trackLine(tigerID, names[tigerID], track))
+		}
+	}
+
+	return collection
+}
+
+func sightingPoint(sighting *models.TigerSighting) *Feature {
+	properties := map[string]interface{}{
+		"sightingID": sighting.ID,
+		"tigerID":    sighting.TigerID,
+		"timestamp":  sighting.Timestamp.Format(time.RFC3339),
+	}
+	if len(sighting.Flags) > 0 {
+		properties["flags"] = sighting.Flags
+	}
+
+	return &Feature{
+		Type:       "Feature",
+		Geometry:   Geometry{Type: "Point", Coordinates: position(sighting)},
+		Properties: properties,
+	}
+}
+
+func trackLine(tigerID int, name string, track []*models.TigerSighting) *Feature {
+	positions := make([][2]float64, 0, len(track))
+	for _, sighting := range track {
+		positions = append(positions, position(sighting))
+	}
+
+	properties := map[string]interface{}{
+		"tigerID":   tigerID,
+		"sightings": len(track),
+		"from":      track[0].Timestamp.Format(time.RFC3339),
+		"to":        track[len(track)-1].Timestamp.Format(time.RFC3339),
+	}
+	if name != "" {
+		properties["name"] = name
+	}
+
+	return &Feature{
+		Type:       "Feature",
+		Geometry:   Geometry{Type: "LineString", Coordinates: positions},
+		Properties: properties,
+	}
+}
+
+func position(sighting *models.TigerSighting) [2]float64 {
+	return [2]float64{sighting.Long, sighting.Lat}
+}
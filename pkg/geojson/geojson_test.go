@@ -0,0 +1,36 @@
+package geojson
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tigerhall-kittens/pkg/models"
+)
+
+func TestTigerTracks(t *testing.T) {
+	tigers := []*models.Tiger{{ID: 1, Name: "Mufasa"}}
+	sightings := []*models.TigerSighting{
+		{ID: 2, TigerID: 1, Timestamp: time.Date(2023, time.July, 22, 12, 0, 0, 0, time.UTC), Lat: 12.5, Long: 77.5},
+		{ID: 1, TigerID: 1, Timestamp: time.Date(2023, time.July, 20, 12, 0, 0, 0, time.UTC), Lat: 12.0, Long: 77.0},
+		{ID: 3, TigerID: 2, Timestamp: time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC), Lat: 13.0, Long: 78.0},
+	}
+
+	collection := TigerTracks(tigers, sightings)
+
+	// Three points and a track for the only tiger seen more than once
+	assert.Equal(t, "FeatureCollection", collection.Type)
+	assert.Len(t, collection.Features, 4)
+	assert.Equal(t, 1, collection.Features[0].Properties["sightingID"], "Points should be ordered by timestamp")
+	assert.Equal(t, [2]float64{77.0, 12.0}, collection.Features[0].Geometry.Coordinates, "Positions should be longitude first")
+
+	track := collection.Features[3]
+	assert.Equal(t, "LineString", track.Geometry.Type)
+	assert.Equal(t, [][2]float64{{77.0, 12.0}, {77.5, 12.5}}, track.Geometry.Coordinates)
+	assert.Equal(t, "Mufasa", track.Properties["name"])
+
+	// The document must serialise as valid JSON
+	_, err := json.Marshal(collection)
+	assert.NoError(t, err)
+}
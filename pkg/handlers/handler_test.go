@@ -5,11 +5,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,18 +19,40 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/tigerhall-kittens/pkg/auth"
 	"github.com/tigerhall-kittens/pkg/models"
+	"github.com/tigerhall-kittens/pkg/service"
+	"github.com/tigerhall-kittens/pkg/upload"
 )
 
 // mockTigerService is a mock implementation of the TigerService interface.
 type mockTigerService struct {
 	signupService                func(user *models.User) error
 	loginService                 func(credentials models.LoginCredentials) (*models.User, error)
-	createTigerService           func(tiger models.Tiger) error
+	createTigerService           func(tiger models.Tiger, creatorEmail string) error
 	getAllTigersService          func(page, pageSize int) ([]*models.Tiger, int, error)
+	getTigerByIDService          func(tigerID int) (*models.TigerProfile, error)
+	updateTigerService           func(tigerID int, update models.TigerUpdate, requesterEmail string) (*models.Tiger, error)
+	deleteTigerService           func(tigerID int, requesterEmail string) error
+	setSightingRuleService       func(rule models.SightingRule, requesterEmail string) error
+	getTigerTrackService         func(tigerID int) (*models.Tiger, []*models.TigerSighting, error)
+	getSightingsTrackService     func(from, to time.Time) ([]*models.Tiger, []*models.TigerSighting, error)
+	getSightingsNearService      func(center models.Coordinates, radiusKm float64, since time.Time, limit int) (*models.AreaSearchResult, error)
+	getSightingsInBoxService     func(box models.BoundingBox, since time.Time, limit int) (*models.AreaSearchResult, error)
 	createTigerSighting          func(newSighting *models.TigerSighting) error
 	getAllTigerSightings         func(tigerID int) ([]*models.TigerSighting, error)
 	createTigerSightingService   func(newSighting *models.TigerSighting) error
 	getTigerSightingsByIDService func(tigerID, page, pageSize int) ([]*models.TigerSighting, int, error)
+	getSightingImageService      func(sightingID int, size models.ImageSize) (*models.SightingImage, error)
+	getSightingImageByIDService  func(sightingID, imageID int, size models.ImageSize) (*models.SightingImage, error)
+	getSightingImagesService     func(sightingID int) ([]*models.SightingImage, error)
+	addSightingImagesService     func(sightingID int, images [][]byte, requesterEmail string) ([]*models.SightingImage, error)
+	getSimilarImagesService      func(sightingID int) ([]*models.SimilarImage, error)
+	subscribeToTigerService      func(tigerID int, userEmail string) error
+	unsubscribeFromTigerService  func(tigerID int, userEmail string) error
+	createAreaSubscription       func(subscription models.AreaSubscription, userEmail string) (*models.AreaSubscription, error)
+	deleteAreaSubscription       func(subscriptionID int, userEmail string) error
+	getSubscriptionsService      func(userEmail string) (*models.Subscriptions, error)
+	getNotificationPreferences   func(userEmail string) (*models.NotificationPreferences, error)
+	setNotificationPreferences   func(prefs models.NotificationPreferences, userEmail string) (*models.NotificationPreferences, error)
 }
 
 func (m *mockTigerService) SignupService(user *models.User) error {
@@ -39,14 +63,46 @@ func (m *mockTigerService) LoginService(credentials models.LoginCredentials) (*m
 	return m.loginService(credentials)
 }
 
-func (m *mockTigerService) CreateTigerService(tiger models.Tiger) error {
-	return m.createTigerService(tiger)
+func (m *mockTigerService) CreateTigerService(tiger models.Tiger, creatorEmail string) error {
+	return m.createTigerService(tiger, creatorEmail)
 }
 
 func (m *mockTigerService) GetAllTigersService(page, pageSize int) ([]*models.Tiger, int, error) {
 	return m.getAllTigersService(page, pageSize)
 }
 
+func (m *mockTigerService) GetTigerByIDService(tigerID int) (*models.TigerProfile, error) {
+	return m.getTigerByIDService(tigerID)
+}
+
+func (m *mockTigerService) UpdateTigerService(tigerID int, update models.TigerUpdate, requesterEmail string) (*models.Tiger, error) {
+	return m.updateTigerService(tigerID, update, requesterEmail)
+}
+
+func (m *mockTigerService) DeleteTigerService(tigerID int, requesterEmail string) error {
+	return m.deleteTigerService(tigerID, requesterEmail)
+}
+
+func (m *mockTigerService) SetSightingRuleService(rule models.SightingRule, requesterEmail string) error {
+	return m.setSightingRuleService(rule, requesterEmail)
+}
+
+func (m *mockTigerService) GetTigerTrackService(tigerID int) (*models.Tiger, []*models.TigerSighting, error) {
+	return m.getTigerTrackService(tigerID)
+}
+
+func (m *mockTigerService) GetSightingsTrackService(from, to time.Time) ([]*models.Tiger, []*models.TigerSighting, error) {
+	return m.getSightingsTrackService(from, to)
+}
+
+func (m *mockTigerService) GetSightingsNearService(center models.Coordinates, radiusKm float64, since time.Time, limit int) (*models.AreaSearchResult, error) {
+	return m.getSightingsNearService(center, radiusKm, since, limit)
+}
+
+func (m *mockTigerService) GetSightingsInBoundingBoxService(box models.BoundingBox, since time.Time, limit int) (*models.AreaSearchResult, error) {
+	return m.getSightingsInBoxService(box, since, limit)
+}
+
 func (m *mockTigerService) CreateTigerSightingService(newSighting *models.TigerSighting) error {
 	return m.createTigerSightingService(newSighting)
 }
@@ -55,6 +111,54 @@ func (m *mockTigerService) GetTigerSightingsByIDService(tigerID, page, pageSize
 	return m.getTigerSightingsByIDService(tigerID, page, pageSize)
 }
 
+func (m *mockTigerService) GetSightingImageService(sightingID int, size models.ImageSize) (*models.SightingImage, error) {
+	return m.getSightingImageService(sightingID, size)
+}
+
+func (m *mockTigerService) GetSightingImageByIDService(sightingID, imageID int, size models.ImageSize) (*models.SightingImage, error) {
+	return m.getSightingImageByIDService(sightingID, imageID, size)
+}
+
+func (m *mockTigerService) GetSightingImagesService(sightingID int) ([]*models.SightingImage, error) {
+	return m.getSightingImagesService(sightingID)
+}
+
+func (m *mockTigerService) AddSightingImagesService(sightingID int, images [][]byte, requesterEmail string) ([]*models.SightingImage, error) {
+	return m.addSightingImagesService(sightingID, images, requesterEmail)
+}
+
+func (m *mockTigerService) GetSimilarSightingImagesService(sightingID int) ([]*models.SimilarImage, error) {
+	return m.getSimilarImagesService(sightingID)
+}
+
+func (m *mockTigerService) SubscribeToTigerService(tigerID int, userEmail string) error {
+	return m.subscribeToTigerService(tigerID, userEmail)
+}
+
+func (m *mockTigerService) UnsubscribeFromTigerService(tigerID int, userEmail string) error {
+	return m.unsubscribeFromTigerService(tigerID, userEmail)
+}
+
+func (m *mockTigerService) CreateAreaSubscriptionService(subscription models.AreaSubscription, userEmail string) (*models.AreaSubscription, error) {
+	return m.createAreaSubscription(subscription, userEmail)
+}
+
+func (m *mockTigerService) DeleteAreaSubscriptionService(subscriptionID int, userEmail string) error {
+	return m.deleteAreaSubscription(subscriptionID, userEmail)
+}
+
+func (m *mockTigerService) GetSubscriptionsService(userEmail string) (*models.Subscriptions, error) {
+	return m.getSubscriptionsService(userEmail)
+}
+
+func (m *mockTigerService) GetNotificationPreferencesService(userEmail string) (*models.NotificationPreferences, error) {
+	return m.getNotificationPreferences(userEmail)
+}
+
+func (m *mockTigerService) SetNotificationPreferencesService(prefs models.NotificationPreferences, userEmail string) (*models.NotificationPreferences, error) {
+	return m.setNotificationPreferences(prefs, userEmail)
+}
+
 func TestSignupHandler_Success(t *testing.T) {
 	// Arrange
 	user := models.User{
@@ -256,7 +360,7 @@ func TestCreateTigerHandler_Success(t *testing.T) {
 	}
 
 	mockService := &mockTigerService{
-		createTigerService: func(tiger models.Tiger) error {
+		createTigerService: func(tiger models.Tiger, creatorEmail string) error {
 			// Simulate a successful tiger creation
 			// We can assume that the tiger is added to the database here
 			return nil
@@ -272,6 +376,9 @@ func TestCreateTigerHandler_Success(t *testing.T) {
 		t.Fatal(err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+
+	// Add the email of the creator to the request context
+	req = req.WithContext(context.WithValue(req.Context(), "email", "creator@example.com"))
 	rr := httptest.NewRecorder()
 
 	// Act
@@ -324,7 +431,7 @@ func TestCreateTigerHandler_InternalServerError(t *testing.T) {
 	}
 
 	mockService := &mockTigerService{
-		createTigerService: func(tiger models.Tiger) error {
+		createTigerService: func(tiger models.Tiger, creatorEmail string) error {
 			// Simulate an error during tiger creation
 			return errors.New("failed to create tiger")
 		},
@@ -339,6 +446,9 @@ func TestCreateTigerHandler_InternalServerError(t *testing.T) {
 		t.Fatal(err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+
+	// Add the email of the creator to the request context
+	req = req.WithContext(context.WithValue(req.Context(), "email", "creator@example.com"))
 	rr := httptest.NewRecorder()
 
 	// Act
@@ -429,20 +539,26 @@ func TestGetAllTigersHandler_InternalServerError(t *testing.T) {
 	assert.NotEmpty(t, response["error"], "Error should not be empty")
 }
 
-func TestCreateTigerSightingHandler_ValidationError(t *testing.T) {
+func TestCreateTigerSightingHandler_WithoutImage(t *testing.T) {
 	// Arrange
-	mockService := &mockTigerService{}
+	var received *models.TigerSighting
+	mockService := &mockTigerService{
+		createTigerSightingService: func(sighting *models.TigerSighting) error {
+			received = sighting
+			sighting.ID = 42
+			return nil
+		},
+	}
 
 	auth := auth.NewAuth("test_secret_key")
 	handler := NewHandlers(mockService, log.Default(), auth)
 
-	// Create an invalid tiger sighting request (missing required fields)
+	// Create a tiger sighting request without an image, as for pugmarks
 	tigerSighting := models.TigerSighting{
-		TigerID:       1,
-		Timestamp:     time.Now(),
-		Lat:           12.345,
-		Long:          67.890,
-		ReporterEmail: "", // Missing reporter email
+		TigerID:   1,
+		Timestamp: time.Now(),
+		Lat:       12.345,
+		Long:      67.890,
 	}
 
 	// Create a form data payload
@@ -476,11 +592,14 @@ func TestCreateTigerSightingHandler_ValidationError(t *testing.T) {
 	handler.CreateTigerSightingHandler(rr, req)
 
 	// Assert
-	assert.Equal(t, http.StatusBadRequest, rr.Code, "Status code should be 400")
+	assert.Equal(t, http.StatusCreated, rr.Code, "Status code should be 201")
+	assert.Empty(t, received.Images, "Sightings without images should be accepted")
+	assert.Equal(t, "rajnish.kumar@gmail.com", received.ReporterEmail)
 	var response map[string]interface{}
 	err = json.Unmarshal(rr.Body.Bytes(), &response)
 	assert.NoError(t, err, "Error while unmarshaling response")
-	assert.Contains(t, response["error"], "Failed to get image file", "Error should mention missing reporterEmail")
+	assert.Equal(t, float64(42), response["id"], "Response should identify the new sighting")
+	assert.Equal(t, "/sightings/42/images", response["imagesURL"], "Response should say where to add images later")
 }
 
 func TestCreateTigerSightingHandler_InternalServerError(t *testing.T) {
@@ -553,6 +672,7 @@ func TestGetAllTigerSightingsHandler_Success(t *testing.T) {
 					Timestamp: time.Now(),
 					Lat:       12.346,
 					Long:      67.891,
+					HasImage:  true,
 				},
 			}
 
@@ -585,6 +705,9 @@ func TestGetAllTigerSightingsHandler_Success(t *testing.T) {
 	err = json.Unmarshal(rr.Body.Bytes(), &response)
 	assert.NoError(t, err, "Error while unmarshaling response")
 	assert.Equal(t, float64(2), response["totalCount"], "Expected 2 tiger sightings in response")
+	sightings := response["tigerSightings"].([]interface{})
+	assert.Nil(t, sightings[0].(map[string]interface{})["imageURL"], "Sightings without an image should have no image URL")
+	assert.Equal(t, "/sightings/2/image", sightings[1].(map[string]interface{})["imageURL"], "Image should be served over HTTP")
 }
 
 func TestGetAllTigerSightingsHandler_InvalidID(t *testing.T) {
@@ -649,3 +772,1012 @@ func TestGetAllTigerSightingsHandler_InternalServerError(t *testing.T) {
 	assert.NoError(t, err, "Error while unmarshaling response")
 	assert.NotEmpty(t, response["error"], "Error should not be empty")
 }
+
+func TestGetTigerByIDHandler_Success(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{
+		getTigerByIDService: func(tigerID int) (*models.TigerProfile, error) {
+			// Simulate a successful retrieval of the tiger profile
+			return &models.TigerProfile{
+				Tiger:           models.Tiger{ID: tigerID, Name: "Mufasa"},
+				SightingSummary: models.SightingSummary{TotalSightings: 4, DistinctReporters: 2},
+			}, nil
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodGet, "/tiger/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+
+	// Act
+	handler.GetTigerByIDHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	var response map[string]interface{}
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err, "Error while unmarshaling response")
+	assert.Equal(t, "Mufasa", response["name"], "Tiger name should be in response")
+	summary := response["sightingSummary"].(map[string]interface{})
+	assert.Equal(t, float64(4), summary["totalSightings"], "Expected 4 sightings in summary")
+}
+
+func TestGetTigerByIDHandler_NotFound(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{
+		getTigerByIDService: func(tigerID int) (*models.TigerProfile, error) {
+			return nil, service.ErrTigerNotFound
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodGet, "/tiger/42", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	req = mux.SetURLVars(req, map[string]string{"id": "42"})
+
+	// Act
+	handler.GetTigerByIDHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Status code should be 404")
+}
+
+func TestUpdateTigerHandler_Patch(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{
+		updateTigerService: func(tigerID int, update models.TigerUpdate, requesterEmail string) (*models.Tiger, error) {
+			assert.Equal(t, "creator@example.com", requesterEmail, "Requester email should come from the context")
+			assert.Nil(t, update.DateOfBirth, "Date of birth should not be part of the update")
+			return &models.Tiger{ID: tigerID, Name: *update.Name}, nil
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodPatch, "/tiger/1", bytes.NewReader([]byte(`{"name":"Shere Khan"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	req = req.WithContext(context.WithValue(req.Context(), "email", "creator@example.com"))
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.UpdateTigerHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	var response map[string]interface{}
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err, "Error while unmarshaling response")
+	assert.Equal(t, "Shere Khan", response["name"], "Tiger name should be updated")
+}
+
+func TestUpdateTigerHandler_PutMissingFields(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodPut, "/tiger/1", bytes.NewReader([]byte(`{"name":"Shere Khan"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	req = req.WithContext(context.WithValue(req.Context(), "email", "creator@example.com"))
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.UpdateTigerHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Status code should be 400")
+}
+
+func TestDeleteTigerHandler_Forbidden(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{
+		deleteTigerService: func(tigerID int, requesterEmail string) error {
+			return service.ErrForbidden
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodDelete, "/tiger/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	req = req.WithContext(context.WithValue(req.Context(), "email", "someone@example.com"))
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.DeleteTigerHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusForbidden, rr.Code, "Status code should be 403")
+}
+
+func TestSetSightingRuleHandler_InvalidRule(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{
+		setSightingRuleService: func(rule models.SightingRule, requesterEmail string) error {
+			assert.Equal(t, 1, rule.TigerID, "Tiger ID should come from the path")
+			return service.ErrInvalidSightingRule
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodPut, "/tiger/1/sighting-rule", bytes.NewReader([]byte(`{"action":"ignore"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	req = req.WithContext(context.WithValue(req.Context(), "email", "creator@example.com"))
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.SetSightingRuleHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Status code should be 400")
+}
+
+func TestGetSightingsNearHandler_Success(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{
+		getSightingsNearService: func(center models.Coordinates, radiusKm float64, since time.Time, limit int) (*models.AreaSearchResult, error) {
+			assert.Equal(t, models.Coordinates{Lat: 12.5, Long: 77.25}, center, "Center should come from the query string")
+			assert.Equal(t, 10.0, radiusKm, "Radius should come from the query string")
+			assert.Equal(t, time.Date(2023, time.July, 20, 0, 0, 0, 0, time.UTC), since, "Since should come from the query string")
+			assert.Equal(t, DefaultSearchLimit, limit, "Limit should default")
+			return &models.AreaSearchResult{
+				Sightings: []*models.NearbySighting{{TigerSighting: models.TigerSighting{ID: 1, TigerID: 1}, DistanceKm: 1.2}},
+				Tigers:    []*models.Tiger{{ID: 1, Name: "Mufasa"}},
+			}, nil
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodGet, "/sightings/near?lat=12.5&long=77.25&radiusKm=10&since=2023-07-20T00:00:00Z", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.GetSightingsNearHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	var response map[string]interface{}
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err, "Error while unmarshaling response")
+	assert.Len(t, response["sightings"], 1, "Expected 1 sighting in response")
+	assert.Len(t, response["tigers"], 1, "Expected 1 tiger in response")
+	assert.NotContains(t, rr.Body.String(), "reporterEmail", "Anyone may search an area, so reporters should not be listed")
+}
+
+func TestGetSightingsNearHandler_InvalidRadius(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodGet, "/sightings/near?lat=12.5&long=77.25&radiusKm=-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.GetSightingsNearHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Status code should be 400")
+}
+
+func TestGetSightingsInBoundingBoxHandler_InvalidBoundingBox(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodGet, "/sightings?bbox=13,77,12,78", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.GetSightingsInBoundingBoxHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Status code should be 400")
+	assert.Contains(t, rr.Body.String(), "Invalid bbox latitudes", "Error should mention the latitudes")
+}
+
+func TestGetTigerSightingsByIDHandler_GeoJSON(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{
+		getTigerTrackService: func(tigerID int) (*models.Tiger, []*models.TigerSighting, error) {
+			return &models.Tiger{ID: tigerID, Name: "Mufasa"}, []*models.TigerSighting{
+				{ID: 1, TigerID: tigerID, Timestamp: time.Date(2023, time.July, 20, 12, 0, 0, 0, time.UTC), Lat: 12.0, Long: 77.0},
+				{ID: 2, TigerID: tigerID, Timestamp: time.Date(2023, time.July, 22, 12, 0, 0, 0, time.UTC), Lat: 12.5, Long: 77.5},
+			}, nil
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodGet, "/tiger/1/sightings", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/geo+json")
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.GetTigerSightingsByIDHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	assert.Equal(t, "application/geo+json", rr.Header().Get("Content-Type"), "Content type should be GeoJSON")
+	var response map[string]interface{}
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err, "Error while unmarshaling response")
+	assert.Equal(t, "FeatureCollection", response["type"], "Response should be a feature collection")
+	assert.Len(t, response["features"], 3, "Expected two points and a track")
+}
+
+func TestGetSightingsTrackHandler_InvalidPeriod(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodGet, "/sightings/track.geojson?from=2023-07-22T00:00:00Z&to=2023-07-20T00:00:00Z", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.GetSightingsTrackHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Status code should be 400")
+}
+
+func TestGetSightingImageHandler_Success(t *testing.T) {
+	// Arrange
+	jpegBytes := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00}
+	mockService := &mockTigerService{
+		getSightingImageService: func(sightingID int, size models.ImageSize) (*models.SightingImage, error) {
+			assert.Equal(t, DefaultImageSize, size, "Default size should be requested")
+			return &models.SightingImage{SightingID: sightingID, Data: jpegBytes, SHA256: "0123abcd"}, nil
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodGet, "/sightings/1/image", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.GetSightingImageHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	assert.Equal(t, "image/jpeg", rr.Header().Get("Content-Type"), "Content type should be sniffed")
+	assert.Equal(t, `"0123abcd"`, rr.Header().Get("ETag"), "ETag should be the content hash")
+	assert.Equal(t, SightingImageCacheControl, rr.Header().Get("Cache-Control"), "Image should be cacheable")
+	assert.Equal(t, jpegBytes, rr.Body.Bytes(), "Image bytes should be streamed")
+
+	// A conditional request with the same ETag is answered with 304 Not Modified
+	req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+	rr = httptest.NewRecorder()
+	handler.GetSightingImageHandler(rr, req)
+	assert.Equal(t, http.StatusNotModified, rr.Code, "Status code should be 304")
+}
+
+func TestGetSightingImageHandler_NotFound(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{
+		getSightingImageService: func(sightingID int, size models.ImageSize) (*models.SightingImage, error) {
+			return nil, service.ErrImageNotFound
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodGet, "/sightings/1/image", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.GetSightingImageHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Status code should be 404")
+}
+
+func TestGetSightingImageHandler_RedirectsToSignedURL(t *testing.T) {
+	// Arrange
+	signedURL := "https://tiger-sightings.s3.amazonaws.com/sightings/1/image.jpeg?X-Amz-Signature=abc"
+	mockService := &mockTigerService{
+		getSightingImageService: func(sightingID int, size models.ImageSize) (*models.SightingImage, error) {
+			return &models.SightingImage{SightingID: sightingID, Key: "sightings/1/image.jpeg", URL: signedURL}, nil
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodGet, "/sightings/1/image", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.GetSightingImageHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusFound, rr.Code, "Status code should be 302")
+	assert.Equal(t, signedURL, rr.Header().Get("Location"), "Client should be sent to the signed URL")
+}
+
+func TestGetSightingImageHandler_Size(t *testing.T) {
+	// Arrange
+	var requestedSize models.ImageSize
+	mockService := &mockTigerService{
+		getSightingImageService: func(sightingID int, size models.ImageSize) (*models.SightingImage, error) {
+			requestedSize = size
+			return &models.SightingImage{SightingID: sightingID, Data: []byte("image-bytes"), SHA256: "0123abcd"}, nil
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	tests := []struct {
+		query        string
+		expectedCode int
+		expectedSize models.ImageSize
+	}{
+		{"size=thumb", http.StatusOK, models.ImageSizeThumb},
+		{"size=original", http.StatusOK, models.ImageSizeOriginal},
+		{"size=huge", http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		requestedSize = ""
+		req, err := http.NewRequest(http.MethodGet, "/sightings/1/image?"+test.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		rr := httptest.NewRecorder()
+
+		// Act
+		handler.GetSightingImageHandler(rr, req)
+
+		// Assert
+		assert.Equal(t, test.expectedCode, rr.Code, test.query)
+		assert.Equal(t, test.expectedSize, requestedSize, test.query)
+	}
+}
+
+func TestCreateTigerSightingHandler_LocationFromImage(t *testing.T) {
+	// Arrange
+	var received *models.TigerSighting
+	mockService := &mockTigerService{
+		createTigerSightingService: func(sighting *models.TigerSighting) error {
+			received = sighting
+			// The image has no EXIF data to fill in the missing fields
+			return service.ErrIncompleteSighting
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	// Leave out the location and time, which camera traps record in the image
+	var requestBody bytes.Buffer
+	writer := multipart.NewWriter(&requestBody)
+	writer.WriteField("tigerID", "1")
+	part, err := writer.CreateFormFile("image", "tiger.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("image-bytes"))
+	writer.Close()
+
+	req, err := http.NewRequest(http.MethodPost, "/tiger-sighting/create", &requestBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req = req.WithContext(context.WithValue(req.Context(), "email", "reporter@example.com"))
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.CreateTigerSightingHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Status code should be 400")
+	assert.Zero(t, received.Lat, "Missing lat should be left for the image to fill in")
+	assert.True(t, received.Timestamp.IsZero(), "Missing timestamp should be left for the image to fill in")
+	assert.Equal(t, [][]byte{[]byte("image-bytes")}, received.Images, "Original upload should be passed on")
+}
+
+func TestCreateTigerSightingHandler_UploadTooLarge(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{
+		createTigerSightingService: func(sighting *models.TigerSighting) error {
+			t.Fatal("Oversized uploads should not reach the service")
+			return nil
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth, WithUploadLimits(upload.Limits{MaxBytes: 1024, MaxPixels: 100}))
+
+	var requestBody bytes.Buffer
+	writer := multipart.NewWriter(&requestBody)
+	writer.WriteField("tigerID", "1")
+	part, err := writer.CreateFormFile("image", "tiger.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(make([]byte, 2<<20))
+	writer.Close()
+
+	req, err := http.NewRequest(http.MethodPost, "/tiger-sighting/create", &requestBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req = req.WithContext(context.WithValue(req.Context(), "email", "reporter@example.com"))
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.CreateTigerSightingHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code, "Status code should be 413")
+}
+
+func TestCreateTigerSightingHandler_UnsupportedImage(t *testing.T) {
+	tests := []struct {
+		err          error
+		expectedCode int
+	}{
+		{upload.ErrUnsupportedFormat, http.StatusUnsupportedMediaType},
+		{upload.ErrTooManyPixels, http.StatusRequestEntityTooLarge},
+		{upload.ErrInvalidImage, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		// Arrange
+		mockService := &mockTigerService{
+			createTigerSightingService: func(sighting *models.TigerSighting) error {
+				return fmt.Errorf("%w: details", test.err)
+			},
+		}
+
+		auth := auth.NewAuth("test_secret_key")
+		handler := NewHandlers(mockService, log.Default(), auth)
+
+		var requestBody bytes.Buffer
+		writer := multipart.NewWriter(&requestBody)
+		writer.WriteField("tigerID", "1")
+		part, err := writer.CreateFormFile("image", "tiger.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte("image-bytes"))
+		writer.Close()
+
+		req, err := http.NewRequest(http.MethodPost, "/tiger-sighting/create", &requestBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req = req.WithContext(context.WithValue(req.Context(), "email", "reporter@example.com"))
+		rr := httptest.NewRecorder()
+
+		// Act
+		handler.CreateTigerSightingHandler(rr, req)
+
+		// Assert
+		assert.Equal(t, test.expectedCode, rr.Code, test.err.Error())
+	}
+}
+
+func TestCreateTigerSightingHandler_MultipleImages(t *testing.T) {
+	// Arrange
+	var received *models.TigerSighting
+	mockService := &mockTigerService{
+		createTigerSightingService: func(sighting *models.TigerSighting) error {
+			received = sighting
+			return nil
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	var requestBody bytes.Buffer
+	writer := multipart.NewWriter(&requestBody)
+	writer.WriteField("tigerID", "1")
+	writer.WriteField("timestamp", "2023-07-21T12:00:00Z")
+	writer.WriteField("lat", "13.35")
+	writer.WriteField("long", "56.79")
+	for _, name := range []string{"front.jpg", "side.jpg", "tracks.jpg"} {
+		part, err := writer.CreateFormFile("image", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(name))
+	}
+	writer.Close()
+
+	req, err := http.NewRequest(http.MethodPost, "/tiger-sighting/create", &requestBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req = req.WithContext(context.WithValue(req.Context(), "email", "reporter@example.com"))
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.CreateTigerSightingHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusCreated, rr.Code, "Status code should be 201")
+	assert.Equal(t, [][]byte{[]byte("front.jpg"), []byte("side.jpg"), []byte("tracks.jpg")}, received.Images, "Every image should be passed on in order")
+}
+
+func TestGetSightingImagesHandler(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{
+		getSightingImagesService: func(sightingID int) ([]*models.SightingImage, error) {
+			return []*models.SightingImage{
+				{SightingID: sightingID, TigerID: 1},
+				{ID: 10, SightingID: sightingID, TigerID: 1, Key: "sightings/1/image.jpeg", SHA256: "0123abcd", Width: 250, Height: 200},
+			}, nil
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodGet, "/sightings/7/images", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": "7"})
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.GetSightingImagesHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	var response struct {
+		Images []map[string]interface{} `json:"images"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Len(t, response.Images, 2)
+	assert.Equal(t, "/sightings/7/image", response.Images[0]["imageURL"], "Images kept in the database should be served as the sighting's image")
+	assert.Equal(t, "/sightings/7/images/10", response.Images[1]["imageURL"])
+	assert.NotContains(t, response.Images[1], "Key", "Store keys should not be exposed")
+}
+
+func TestGetSimilarSightingImagesHandler(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{
+		getSimilarImagesService: func(sightingID int) ([]*models.SimilarImage, error) {
+			return []*models.SimilarImage{
+				{SightingImage: models.SightingImage{ID: 10, SightingID: 3, TigerID: 2, Key: "sightings/2/image.jpeg"}, MatchedImageID: 20, Distance: 1},
+			}, nil
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodGet, "/sightings/7/similar", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": "7"})
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.GetSimilarSightingImagesHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	var response struct {
+		Similar []map[string]interface{} `json:"similar"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	if assert.Len(t, response.Similar, 1) {
+		assert.Equal(t, "/sightings/3/images/10", response.Similar[0]["imageURL"])
+		assert.Equal(t, float64(20), response.Similar[0]["matchedImageID"])
+		assert.Equal(t, float64(1), response.Similar[0]["distance"])
+	}
+}
+
+func TestAddSightingImagesHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		serviceErr   error
+		expectedCode int
+	}{
+		{"added", nil, http.StatusCreated},
+		{"not the reporter", service.ErrNotSightingReporter, http.StatusForbidden},
+		{"missing sighting", service.ErrSightingNotFound, http.StatusNotFound},
+		{"too many images", upload.ErrTooManyImages, http.StatusBadRequest},
+		{"duplicate image", fmt.Errorf("%w: looks like image 10 of sighting 3", service.ErrDuplicateImage), http.StatusConflict},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange
+			mockService := &mockTigerService{
+				addSightingImagesService: func(sightingID int, images [][]byte, requesterEmail string) ([]*models.SightingImage, error) {
+					assert.Equal(t, 7, sightingID)
+					assert.Equal(t, "reporter@example.com", requesterEmail)
+					assert.Len(t, images, 2)
+					if test.serviceErr != nil {
+						return nil, test.serviceErr
+					}
+					return []*models.SightingImage{{ID: 11, SightingID: sightingID}, {ID: 12, SightingID: sightingID}}, nil
+				},
+			}
+
+			auth := auth.NewAuth("test_secret_key")
+			handler := NewHandlers(mockService, log.Default(), auth)
+
+			var requestBody bytes.Buffer
+			writer := multipart.NewWriter(&requestBody)
+			for _, name := range []string{"front.jpg", "side.jpg"} {
+				part, err := writer.CreateFormFile("image", name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				part.Write([]byte(name))
+			}
+			writer.Close()
+
+			req, err := http.NewRequest(http.MethodPost, "/sightings/7/images", &requestBody)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			req = mux.SetURLVars(req, map[string]string{"id": "7"})
+			req = req.WithContext(context.WithValue(req.Context(), "email", "reporter@example.com"))
+			rr := httptest.NewRecorder()
+
+			// Act
+			handler.AddSightingImagesHandler(rr, req)
+
+			// Assert
+			assert.Equal(t, test.expectedCode, rr.Code)
+			if test.serviceErr == nil {
+				assert.Contains(t, rr.Body.String(), `"imageURL":"/sightings/7/images/12"`)
+			}
+		})
+	}
+}
+
+func TestAddSightingImagesHandler_NoImages(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{
+		addSightingImagesService: func(sightingID int, images [][]byte, requesterEmail string) ([]*models.SightingImage, error) {
+			t.Fatal("Requests without images should not reach the service")
+			return nil, nil
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	var requestBody bytes.Buffer
+	writer := multipart.NewWriter(&requestBody)
+	writer.WriteField("note", "forgot the photos")
+	writer.Close()
+
+	req, err := http.NewRequest(http.MethodPost, "/sightings/7/images", &requestBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req = mux.SetURLVars(req, map[string]string{"id": "7"})
+	req = req.WithContext(context.WithValue(req.Context(), "email", "reporter@example.com"))
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.AddSightingImagesHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Status code should be 400")
+}
+
+func TestCreateTigerSightingHandler_JSON(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedCode   int
+		expectedImages [][]byte
+	}{
+		{"without images", `{"tigerID": 1, "timestamp": "2023-07-21T12:00:00Z", "lat": 13.35, "long": 56.79}`, http.StatusCreated, nil},
+		{"with base64 images", `{"tigerID": 1, "timestamp": "2023-07-21T12:00:00Z", "lat": 13.35, "long": 56.79, "images": ["aW1hZ2UtMQ==", "aW1hZ2UtMg=="]}`, http.StatusCreated, [][]byte{[]byte("image-1"), []byte("image-2")}},
+		{"invalid base64", `{"tigerID": 1, "images": ["not base64!"]}`, http.StatusBadRequest, nil},
+		{"missing tiger", `{"timestamp": "2023-07-21T12:00:00Z", "lat": 13.35, "long": 56.79}`, http.StatusBadRequest, nil},
+		{"malformed", `{"tigerID": 1,`, http.StatusBadRequest, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange
+			var received *models.TigerSighting
+			mockService := &mockTigerService{
+				createTigerSightingService: func(sighting *models.TigerSighting) error {
+					received = sighting
+					return nil
+				},
+			}
+
+			auth := auth.NewAuth("test_secret_key")
+			handler := NewHandlers(mockService, log.Default(), auth)
+
+			req, err := http.NewRequest(http.MethodPost, "/tiger-sighting/create", strings.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json; charset=utf-8")
+			req = req.WithContext(context.WithValue(req.Context(), "email", "importer@example.com"))
+			rr := httptest.NewRecorder()
+
+			// Act
+			handler.CreateTigerSightingHandler(rr, req)
+
+			// Assert
+			assert.Equal(t, test.expectedCode, rr.Code)
+			if test.expectedCode != http.StatusCreated {
+				assert.Nil(t, received, "Invalid submissions should not reach the service")
+				return
+			}
+			assert.Equal(t, 1, received.TigerID)
+			assert.Equal(t, time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC), received.Timestamp)
+			assert.Equal(t, 13.35, received.Lat)
+			assert.Equal(t, "importer@example.com", received.ReporterEmail)
+			assert.Equal(t, test.expectedImages, received.Images)
+		})
+	}
+}
+
+func TestCreateTigerSightingHandler_JSONTooLarge(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{
+		createTigerSightingService: func(sighting *models.TigerSighting) error {
+			t.Fatal("Oversized submissions should not reach the service")
+			return nil
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth, WithUploadLimits(upload.Limits{MaxBytes: 1024, MaxPixels: 100, MaxImages: 1}))
+
+	body := `{"tigerID": 1, "images": ["` + strings.Repeat("A", 2<<20) + `"]}`
+	req, err := http.NewRequest(http.MethodPost, "/tiger-sighting/create", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(context.WithValue(req.Context(), "email", "importer@example.com"))
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.CreateTigerSightingHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code, "Status code should be 413")
+}
+
+func TestSubscribeToTigerHandler_Success(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{
+		subscribeToTigerService: func(tigerID int, userEmail string) error {
+			assert.Equal(t, 1, tigerID, "Tiger ID should come from the path")
+			assert.Equal(t, "fan@example.com", userEmail, "User should come from the token")
+			return nil
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodPost, "/tiger/1/subscribe", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	req = req.WithContext(context.WithValue(req.Context(), "email", "fan@example.com"))
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.SubscribeToTigerHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+}
+
+func TestSubscribeToTigerHandler_TigerNotFound(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{
+		subscribeToTigerService: func(tigerID int, userEmail string) error {
+			return service.ErrTigerNotFound
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodPost, "/tiger/9/subscribe", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": "9"})
+	req = req.WithContext(context.WithValue(req.Context(), "email", "fan@example.com"))
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.SubscribeToTigerHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Status code should be 404")
+}
+
+func TestCreateAreaSubscriptionHandler_Success(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{
+		createAreaSubscription: func(subscription models.AreaSubscription, userEmail string) (*models.AreaSubscription, error) {
+			assert.Equal(t, models.AreaSubscription{Lat: 12.5, Long: 77.25, RadiusKm: 20}, subscription)
+			subscription.ID = 3
+			return &subscription, nil
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodPost, "/subscriptions/areas", bytes.NewReader([]byte(`{"lat":12.5,"long":77.25,"radiusKm":20}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = req.WithContext(context.WithValue(req.Context(), "email", "fan@example.com"))
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.CreateAreaSubscriptionHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusCreated, rr.Code, "Status code should be 201")
+	var created models.AreaSubscription
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	assert.Equal(t, 3, created.ID)
+}
+
+func TestCreateAreaSubscriptionHandler_InvalidRadius(t *testing.T) {
+	// Arrange
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(&mockTigerService{}, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodPost, "/subscriptions/areas", bytes.NewReader([]byte(`{"lat":12.5,"long":77.25,"radiusKm":0}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = req.WithContext(context.WithValue(req.Context(), "email", "fan@example.com"))
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.CreateAreaSubscriptionHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Status code should be 400")
+}
+
+func TestDeleteAreaSubscriptionHandler_NotFound(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{
+		deleteAreaSubscription: func(subscriptionID int, userEmail string) error {
+			assert.Equal(t, 3, subscriptionID, "Subscription ID should come from the path")
+			return service.ErrSubscriptionNotFound
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodDelete, "/subscriptions/areas/3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": "3"})
+	req = req.WithContext(context.WithValue(req.Context(), "email", "fan@example.com"))
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.DeleteAreaSubscriptionHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Status code should be 404")
+}
+
+func TestSetNotificationPreferencesHandler_Invalid(t *testing.T) {
+	// Arrange
+	mockService := &mockTigerService{
+		setNotificationPreferences: func(prefs models.NotificationPreferences, userEmail string) (*models.NotificationPreferences, error) {
+			assert.Equal(t, "Mars/Olympus_Mons", prefs.Timezone)
+			return nil, service.ErrInvalidNotificationPreferences
+		},
+	}
+
+	auth := auth.NewAuth("test_secret_key")
+	handler := NewHandlers(mockService, log.Default(), auth)
+
+	req, err := http.NewRequest(http.MethodPut, "/notification-preferences", bytes.NewReader([]byte(`{"channels":["email"],"timezone":"Mars/Olympus_Mons"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = req.WithContext(context.WithValue(req.Context(), "email", "fan@example.com"))
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.SetNotificationPreferencesHandler(rr, req)
+
+	// Assert
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Status code should be 400")
+}
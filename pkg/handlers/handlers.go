@@ -3,41 +3,73 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"image"
-	"image/jpeg"
 	"io/ioutil"
 	"log"
 	"math"
-	"mime/multipart"
+	"mime"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/tigerhall-kittens/pkg/auth"
+	"github.com/tigerhall-kittens/pkg/geojson"
+	"github.com/tigerhall-kittens/pkg/imagestore"
 	"github.com/tigerhall-kittens/pkg/models"
+	"github.com/tigerhall-kittens/pkg/rules"
 	"github.com/tigerhall-kittens/pkg/service"
+	"github.com/tigerhall-kittens/pkg/upload"
 	"github.com/tigerhall-kittens/pkg/utils"
 )
 
 const DefaultPageSize = 10
 
+const (
+	// DefaultSearchLimit and MaxSearchLimit bound the number of sightings returned by area searches
+	DefaultSearchLimit = 100
+	MaxSearchLimit     = 500
+	// MaxSearchRadiusKm bounds the radius of the nearby sightings search
+	MaxSearchRadiusKm = 500
+	// DefaultTrackPeriod is exported by the all-tigers track when no period is given
+	DefaultTrackPeriod = 30 * 24 * time.Hour
+)
+
 type pagination map[string]interface{}
 
+// maxFormOverheadBytes is the room left in sighting uploads for the form fields besides the images.
+const maxFormOverheadBytes = 1 << 20
+
 type handlers struct {
 	Auth         *auth.Auth
 	Logger       *log.Logger
 	TigerService service.TigerService
+	uploadLimits upload.Limits
+}
+
+// Option configures optional behaviour of the handlers.
+type Option func(*handlers)
+
+// WithUploadLimits bounds the size of sighting uploads. The service checks the images themselves.
+func WithUploadLimits(limits upload.Limits) Option {
+	return func(h *handlers) {
+		h.uploadLimits = limits
+	}
 }
 
-func NewHandlers(tigerService service.TigerService, logger *log.Logger, auth *auth.Auth) *handlers {
-	return &handlers{
+func NewHandlers(tigerService service.TigerService, logger *log.Logger, auth *auth.Auth, opts ...Option) *handlers {
+	h := &handlers{
 		Auth:         auth,
 		Logger:       logger,
 		TigerService: tigerService,
+		uploadLimits: upload.DefaultLimits,
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
 }
 
 func (h *handlers) SignupHandler(w http.ResponseWriter, r *http.Request) {
@@ -98,7 +130,13 @@ func (h *handlers) CreateTigerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.TigerService.CreateTigerService(tiger)
+	creatorEmail, ok := auth.GetEmailFromContext(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve user email")
+		return
+	}
+
+	err := h.TigerService.CreateTigerService(tiger, creatorEmail)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -141,93 +179,875 @@ func (h *handlers) GetAllTigersHandler(w http.ResponseWriter, r *http.Request) {
 	utils.RespondWithJSON(w, http.StatusOK, paginationResponse)
 }
 
-func (h *handlers) CreateTigerSightingHandler(w http.ResponseWriter, r *http.Request) {
-	// Parse the request body to get the tiger sighting data
-	if err := r.ParseMultipartForm(10 << 20); err != nil { // Max memory of 10 MB for file uploads
-		utils.RespondWithError(w, http.StatusBadRequest, "Unable to parse form data")
+func (h *handlers) GetTigerByIDHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// Convert the tiger ID to an integer
+	tigerID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid tiger_id query parameter")
 		return
 	}
 
-	// Get the form values
-	tigerIDStr := r.FormValue("tigerID")
-	timestampStr := r.FormValue("timestamp")
-	latStr := r.FormValue("lat")
-	longStr := r.FormValue("long")
+	tigerProfile, err := h.TigerService.GetTigerByIDService(tigerID)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
 
-	// Convert the form values to appropriate types
-	tigerID, err := strconv.Atoi(tigerIDStr)
+	// Respond with the tiger and its sighting summary as JSON
+	utils.RespondWithJSON(w, http.StatusOK, tigerProfile)
+}
+
+// UpdateTigerHandler serves both PUT, which requires every correctable field,
+// and PATCH, which only changes the fields present in the body.
+func (h *handlers) UpdateTigerHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// Convert the tiger ID to an integer
+	tigerID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid tigerID value")
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid tiger_id query parameter")
+		return
+	}
+
+	// Parse the request body to get the tiger changes
+	var update models.TigerUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Failed to parse request body")
+		return
+	}
+
+	// Validate the tiger changes
+	if r.Method == http.MethodPut && (update.Name == nil || update.DateOfBirth == nil) {
+		utils.RespondWithError(w, http.StatusBadRequest, "name and date_of_birth are required")
+		return
+	}
+	if update.Name != nil && *update.Name == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "name must not be empty")
+		return
+	}
+
+	requesterEmail, ok := auth.GetEmailFromContext(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve user email")
 		return
 	}
 
-	timestamp, err := time.Parse(time.RFC3339, timestampStr)
+	tiger, err := h.TigerService.UpdateTigerService(tigerID, update, requesterEmail)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid timestamp value")
+		respondWithServiceError(w, err)
 		return
 	}
 
-	lat, err := strconv.ParseFloat(latStr, 64)
+	// Respond with the updated tiger as JSON
+	utils.RespondWithJSON(w, http.StatusOK, tiger)
+}
+
+func (h *handlers) DeleteTigerHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// Convert the tiger ID to an integer
+	tigerID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid lat value")
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid tiger_id query parameter")
+		return
+	}
+
+	requesterEmail, ok := auth.GetEmailFromContext(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve user email")
+		return
+	}
+
+	if err := h.TigerService.DeleteTigerService(tigerID, requesterEmail); err != nil {
+		respondWithServiceError(w, err)
 		return
 	}
 
-	long, err := strconv.ParseFloat(longStr, 64)
+	// Respond with success status
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"message": "success"})
+}
+
+func (h *handlers) SetSightingRuleHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// Convert the tiger ID to an integer
+	tigerID, err := strconv.Atoi(vars["id"])
 	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid tiger_id query parameter")
+		return
+	}
+
+	// Parse the request body to get the rule override
+	var rule models.SightingRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Failed to parse request body")
+		return
+	}
+	rule.TigerID = tigerID
+
+	requesterEmail, ok := auth.GetEmailFromContext(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve user email")
+		return
+	}
+
+	if err := h.TigerService.SetSightingRuleService(rule, requesterEmail); err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// Respond with the saved override as JSON
+	utils.RespondWithJSON(w, http.StatusOK, rule)
+}
+
+func (h *handlers) GetSightingsNearHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the search parameters from the query string
+	lat, err := strconv.ParseFloat(r.FormValue("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid lat value")
+		return
+	}
+
+	long, err := strconv.ParseFloat(r.FormValue("long"), 64)
+	if err != nil || long < -180 || long > 180 {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid long value")
 		return
 	}
 
-	reporterEmail, ok := auth.GetEmailFromContext(r.Context())
+	radiusKm, err := strconv.ParseFloat(r.FormValue("radiusKm"), 64)
+	if err != nil || radiusKm <= 0 || radiusKm > MaxSearchRadiusKm {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("radiusKm must be between 0 and %v", MaxSearchRadiusKm))
+		return
+	}
+
+	since, limit, ok := parseAreaSearchFilters(w, r)
 	if !ok {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve previous sighting")
 		return
 	}
 
-	newSighting := models.TigerSighting{TigerID: tigerID, Timestamp: timestamp, Lat: lat, Long: long, ReporterEmail: reporterEmail}
+	result, err := h.TigerService.GetSightingsNearService(models.Coordinates{Lat: lat, Long: long}, radiusKm, since, limit)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// Respond with the sightings and tigers as JSON
+	utils.RespondWithJSON(w, http.StatusOK, result)
+}
+
+func (h *handlers) GetSightingsInBoundingBoxHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse the bounding box as minLat,minLong,maxLat,maxLong
+	box, err := parseBoundingBox(r.FormValue("bbox"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	since, limit, ok := parseAreaSearchFilters(w, r)
+	if !ok {
+		return
+	}
 
-	imageFile, _, err := r.FormFile("image")
+	result, err := h.TigerService.GetSightingsInBoundingBoxService(box, since, limit)
 	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// Respond with the sightings and tigers as JSON
+	utils.RespondWithJSON(w, http.StatusOK, result)
+}
+
+// parseAreaSearchFilters reads the optional since and limit parameters of the area searches.
+// It responds with an error and reports false when they are invalid.
+func parseAreaSearchFilters(w http.ResponseWriter, r *http.Request) (time.Time, int, bool) {
+	var since time.Time
+	if sinceStr := r.FormValue("since"); sinceStr != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, sinceStr)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid since value")
+			return time.Time{}, 0, false
+		}
+	}
+
+	limit, err := strconv.Atoi(r.FormValue("limit"))
+	if err != nil || limit < 1 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	return since, limit, true
+}
+
+func parseBoundingBox(bbox string) (models.BoundingBox, error) {
+	parts := strings.Split(bbox, ",")
+	if len(parts) != 4 {
+		return models.BoundingBox{}, errors.New("bbox must be minLat,minLong,maxLat,maxLong")
+	}
+
+	var values [4]float64
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return models.BoundingBox{}, errors.New("bbox must be minLat,minLong,maxLat,maxLong")
+		}
+		values[i] = value
+	}
+
+	box := models.BoundingBox{MinLat: values[0], MinLong: values[1], MaxLat: values[2], MaxLong: values[3]}
+	if box.MinLat < -90 || box.MaxLat > 90 || box.MinLat > box.MaxLat {
+		return models.BoundingBox{}, errors.New("Invalid bbox latitudes")
+	}
+	if box.MinLong < -180 || box.MaxLong > 180 || box.MinLong > box.MaxLong {
+		return models.BoundingBox{}, errors.New("Invalid bbox longitudes")
+	}
+	return box, nil
+}
+
+func (h *handlers) GetTigerTrackHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// Convert the tiger ID to an integer
+	tigerID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid tiger_id query parameter")
+		return
+	}
+
+	tiger, sightings, err := h.TigerService.GetTigerTrackService(tigerID)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	respondWithGeoJSON(w, geojson.TigerTracks([]*models.Tiger{tiger}, sightings))
+}
+
+// GetSightingsTrackHandler exports the sightings of all tigers between from and to,
+// defaulting to the last DefaultTrackPeriod.
+func (h *handlers) GetSightingsTrackHandler(w http.ResponseWriter, r *http.Request) {
+	to := time.Now()
+	if toStr := r.FormValue("to"); toStr != "" {
+		var err error
+		to, err = time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid to value")
+			return
+		}
+	}
+
+	from := to.Add(-DefaultTrackPeriod)
+	if fromStr := r.FormValue("from"); fromStr != "" {
+		var err error
+		from, err = time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid from value")
+			return
+		}
+	}
+
+	if from.After(to) {
+		utils.RespondWithError(w, http.StatusBadRequest, "from must not be after to")
+		return
+	}
+
+	tigers, sightings, err := h.TigerService.GetSightingsTrackService(from, to)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	respondWithGeoJSON(w, geojson.TigerTracks(tigers, sightings))
+}
+
+func respondWithGeoJSON(w http.ResponseWriter, collection *geojson.FeatureCollection) {
+	response, err := json.Marshal(collection)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", geojson.ContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// DefaultImageSize is the size of sighting images served when the client does not ask for one.
+const DefaultImageSize = models.ImageSizeMedium
+
+// SightingImageCacheControl lets clients and proxies cache sighting images, which never change once stored.
+const SightingImageCacheControl = "public, max-age=86400"
+
+func (h *handlers) GetSightingImageHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// Convert the sighting ID to an integer
+	sightingID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid sighting_id query parameter")
+		return
+	}
+
+	size, ok := parseImageSize(w, r)
+	if !ok {
+		return
+	}
+
+	// The first image of the sighting stands for the sighting in listings
+	img, err := h.TigerService.GetSightingImageService(sightingID, size)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	serveSightingImage(w, r, img)
+}
+
+func (h *handlers) GetSightingImageByIDHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// Convert the sighting and image IDs to integers
+	sightingID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid sighting_id query parameter")
+		return
+	}
+	imageID, err := strconv.Atoi(vars["imageID"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid image_id query parameter")
+		return
+	}
+
+	size, ok := parseImageSize(w, r)
+	if !ok {
+		return
+	}
+
+	img, err := h.TigerService.GetSightingImageByIDService(sightingID, imageID, size)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	serveSightingImage(w, r, img)
+}
+
+// parseImageSize reads the optional size parameter of the image routes. Clients get the medium
+// rendition unless they ask for another size. It responds with an error and reports false when
+// the size is unknown.
+func parseImageSize(w http.ResponseWriter, r *http.Request) (models.ImageSize, bool) {
+	sizeStr := r.URL.Query().Get("size")
+	if sizeStr == "" {
+		return DefaultImageSize, true
+	}
+
+	size, err := imagestore.ParseSize(sizeStr)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+	return size, true
+}
+
+func serveSightingImage(w http.ResponseWriter, r *http.Request, img *models.SightingImage) {
+	// Images in stores that can serve them directly are fetched from there through a short-lived link
+	if img.URL != "" {
+		http.Redirect(w, r, img.URL, http.StatusFound)
+		return
+	}
+
+	// ServeContent answers conditional requests against the ETag with 304 Not Modified
+	w.Header().Set("Content-Type", http.DetectContentType(img.Data))
+	w.Header().Set("ETag", `"`+img.SHA256+`"`)
+	w.Header().Set("Cache-Control", SightingImageCacheControl)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(img.Data))
+}
+
+func (h *handlers) GetSightingImagesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// Convert the sighting ID to an integer
+	sightingID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid sighting_id query parameter")
+		return
+	}
+
+	images, err := h.TigerService.GetSightingImagesService(sightingID)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	setSightingImageURLs(images)
+
+	// Respond with the images of the sighting as JSON
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"images": images})
+}
+
+func (h *handlers) AddSightingImagesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// Convert the sighting ID to an integer
+	sightingID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid sighting_id query parameter")
+		return
+	}
+
+	if !h.parseImageUpload(w, r) {
+		return
+	}
+	images, ok := h.readImages(w, r)
+	if !ok {
+		return
+	}
+	if len(images) == 0 {
 		utils.RespondWithError(w, http.StatusBadRequest, "Failed to get image file")
 		return
 	}
-	defer imageFile.Close()
 
-	resizedImage, err := getProcessedImage(imageFile)
+	requesterEmail, ok := auth.GetEmailFromContext(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve user email")
+		return
+	}
+
+	added, err := h.TigerService.AddSightingImagesService(sightingID, images, requesterEmail)
+	if err != nil {
+		log.Println("[error] AddSightingImagesService " + err.Error())
+		respondWithServiceError(w, err)
+		return
+	}
+	setSightingImageURLs(added)
+
+	// Respond with the added images as JSON
+	utils.RespondWithJSON(w, http.StatusCreated, map[string]interface{}{"message": "success", "images": added})
+}
+
+// GetSimilarSightingImagesHandler lists the images of other sightings that look like the images of
+// the sighting, closest first, to help reviewers spot a camera-trap frame reported more than once.
+func (h *handlers) GetSimilarSightingImagesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// Convert the sighting ID to an integer
+	sightingID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid sighting_id query parameter")
+		return
+	}
+
+	similar, err := h.TigerService.GetSimilarSightingImagesService(sightingID)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	for _, img := range similar {
+		setSightingImageURLs([]*models.SightingImage{&img.SightingImage})
+	}
+
+	// Respond with the similar images as JSON
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"similar": similar})
+}
+
+// SubscribeToTigerHandler notifies the user of every new sighting of the tiger.
+func (h *handlers) SubscribeToTigerHandler(w http.ResponseWriter, r *http.Request) {
+	h.changeTigerSubscription(w, r, h.TigerService.SubscribeToTigerService)
+}
+
+// UnsubscribeFromTigerHandler stops the notifications for the tiger. Reporters of the tiger are still
+// notified for as long as their notification preferences allow.
+func (h *handlers) UnsubscribeFromTigerHandler(w http.ResponseWriter, r *http.Request) {
+	h.changeTigerSubscription(w, r, h.TigerService.UnsubscribeFromTigerService)
+}
+
+func (h *handlers) changeTigerSubscription(w http.ResponseWriter, r *http.Request, change func(tigerID int, userEmail string) error) {
+	vars := mux.Vars(r)
+
+	// Convert the tiger ID to an integer
+	tigerID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid tiger_id query parameter")
+		return
+	}
+
+	userEmail, ok := auth.GetEmailFromContext(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve user email")
+		return
+	}
+
+	if err := change(tigerID, userEmail); err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// Respond with success status
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"message": "success"})
+}
+
+func (h *handlers) GetSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	userEmail, ok := auth.GetEmailFromContext(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve user email")
+		return
+	}
+
+	subscriptions, err := h.TigerService.GetSubscriptionsService(userEmail)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// Respond with the subscriptions as JSON
+	utils.RespondWithJSON(w, http.StatusOK, subscriptions)
+}
+
+// CreateAreaSubscriptionHandler notifies the user of every sighting within radiusKm of a point,
+// except those of protected tigers.
+func (h *handlers) CreateAreaSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body to get the area
+	var subscription models.AreaSubscription
+	if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Failed to parse request body")
+		return
+	}
+
+	if subscription.Lat < -90 || subscription.Lat > 90 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid lat value")
+		return
+	}
+	if subscription.Long < -180 || subscription.Long > 180 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid long value")
+		return
+	}
+	// An area subscription is a standing nearby sightings search, so it has the same bounds
+	if subscription.RadiusKm <= 0 || subscription.RadiusKm > MaxSearchRadiusKm {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("radiusKm must be between 0 and %v", MaxSearchRadiusKm))
+		return
+	}
+
+	userEmail, ok := auth.GetEmailFromContext(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve user email")
+		return
+	}
+
+	created, err := h.TigerService.CreateAreaSubscriptionService(subscription, userEmail)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// Respond with the created subscription as JSON
+	utils.RespondWithJSON(w, http.StatusCreated, created)
+}
+
+func (h *handlers) DeleteAreaSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// Convert the subscription ID to an integer
+	subscriptionID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid subscription_id query parameter")
+		return
+	}
+
+	userEmail, ok := auth.GetEmailFromContext(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve user email")
+		return
+	}
+
+	if err := h.TigerService.DeleteAreaSubscriptionService(subscriptionID, userEmail); err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// Respond with success status
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"message": "success"})
+}
+
+func (h *handlers) GetNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	userEmail, ok := auth.GetEmailFromContext(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve user email")
+		return
+	}
+
+	prefs, err := h.TigerService.GetNotificationPreferencesService(userEmail)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// Respond with the preferences as JSON
+	utils.RespondWithJSON(w, http.StatusOK, prefs)
+}
+
+// SetNotificationPreferencesHandler replaces the notification preferences of the user. An empty list
+// of channels turns notifications off.
+func (h *handlers) SetNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body to get the preferences
+	var prefs models.NotificationPreferences
+	if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Failed to parse request body")
+		return
+	}
+
+	userEmail, ok := auth.GetEmailFromContext(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve user email")
+		return
+	}
+
+	saved, err := h.TigerService.SetNotificationPreferencesService(prefs, userEmail)
 	if err != nil {
-		h.Logger.Printf("Got Error Resizing Image: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// Respond with the saved preferences as JSON
+	utils.RespondWithJSON(w, http.StatusOK, saved)
+}
+
+// parseImageUpload parses a multipart form carrying sighting images, refusing bodies that cannot
+// hold acceptable images. It responds with an error and reports false when the form is invalid.
+func (h *handlers) parseImageUpload(w http.ResponseWriter, r *http.Request) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxImageBytes()+maxFormOverheadBytes)
+	if err := r.ParseMultipartForm(10 << 20); err != nil { // Max memory of 10 MB for file uploads
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			utils.RespondWithError(w, http.StatusRequestEntityTooLarge, upload.ErrTooLarge.Error())
+			return false
+		}
+		utils.RespondWithError(w, http.StatusBadRequest, "Unable to parse form data")
+		return false
+	}
+	return true
+}
+
+// maxImageBytes is the size of the largest set of images a sighting can have.
+func (h *handlers) maxImageBytes() int64 {
+	return int64(h.uploadLimits.MaxImages) * h.uploadLimits.MaxBytes
+}
+
+// readImages reads every image part of a parsed multipart form, in the order they were sent.
+// It responds with an error and reports false when one cannot be read.
+func (h *handlers) readImages(w http.ResponseWriter, r *http.Request) ([][]byte, bool) {
+	files := r.MultipartForm.File["image"]
+
+	// The original uploads are kept; smaller sizes are derived from them when they are stored
+	images := make([][]byte, 0, len(files))
+	for _, header := range files {
+		file, err := header.Open()
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Failed to get image file")
+			return nil, false
+		}
+		data, err := ioutil.ReadAll(file)
+		file.Close()
+		if err != nil {
+			h.Logger.Printf("Got Error Reading Image: %v", err)
+			utils.RespondWithError(w, http.StatusBadRequest, "Failed to read image file")
+			return nil, false
+		}
+		images = append(images, data)
+	}
+	return images, true
+}
+
+func sightingImageURL(sightingID int) string {
+	return fmt.Sprintf("/sightings/%d/image", sightingID)
+}
+
+func sightingImagesURL(sightingID int) string {
+	return fmt.Sprintf("/sightings/%d/images", sightingID)
+}
+
+// setSightingImageURLs points clients at the route serving each image. Images of older sightings
+// that are still kept in the database have no ID and are served as the sighting's image.
+func setSightingImageURLs(images []*models.SightingImage) {
+	for _, img := range images {
+		if img.ID == 0 {
+			img.ImageURL = sightingImageURL(img.SightingID)
+		} else {
+			img.ImageURL = fmt.Sprintf("%s/%d", sightingImagesURL(img.SightingID), img.ID)
+		}
+	}
+}
+
+// respondWithServiceError maps the errors returned by the service to HTTP status codes.
+func respondWithServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrTigerNotFound), errors.Is(err, service.ErrSightingNotFound), errors.Is(err, service.ErrImageNotFound),
+		errors.Is(err, service.ErrSubscriptionNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, upload.ErrTooLarge), errors.Is(err, upload.ErrTooManyPixels):
+		utils.RespondWithError(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, upload.ErrUnsupportedFormat):
+		utils.RespondWithError(w, http.StatusUnsupportedMediaType, err.Error())
+	case errors.Is(err, upload.ErrInvalidImage), errors.Is(err, upload.ErrTooManyImages):
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrForbidden), errors.Is(err, service.ErrNotSightingReporter):
+		utils.RespondWithError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrInvalidSightingRule), errors.Is(err, service.ErrIncompleteSighting),
+		errors.Is(err, service.ErrInvalidNotificationPreferences):
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.As(err, new(*rules.Violation)), errors.Is(err, service.ErrDuplicateImage):
+		utils.RespondWithError(w, http.StatusConflict, err.Error())
+	default:
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// sightingSubmission is the JSON variant of a sighting report, for clients such as import scripts
+// that cannot easily send multipart forms. Images are base64 encoded and optional; they can also
+// be uploaded to the sighting's images route once it is created.
+type sightingSubmission struct {
+	TigerID   int       `json:"tigerID"`
+	Timestamp time.Time `json:"timestamp"`
+	Lat       float64   `json:"lat"`
+	Long      float64   `json:"long"`
+	Images    [][]byte  `json:"images"`
+}
+
+// CreateTigerSightingHandler accepts a multipart form, with any number of image files, or a JSON
+// sightingSubmission. Sightings without images, such as pugmarks, are accepted as long as they
+// give their location and time.
+func (h *handlers) CreateTigerSightingHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body to get the tiger sighting data
+	var newSighting *models.TigerSighting
+	var ok bool
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		newSighting, ok = h.parseSightingJSON(w, r)
+	} else {
+		newSighting, ok = h.parseSightingForm(w, r)
+	}
+	if !ok {
+		return
+	}
+
+	reporterEmail, ok := auth.GetEmailFromContext(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve previous sighting")
 		return
 	}
+	newSighting.ReporterEmail = reporterEmail
 
-	newSighting.Image = resizedImage
-	err = h.TigerService.CreateTigerSightingService(&newSighting)
+	err := h.TigerService.CreateTigerSightingService(newSighting)
 	if err != nil {
 		log.Println("[error] CreateTigerSightingService " + err.Error())
-		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusCreated, map[string]interface{}{"message": "success"})
+	// Let the reporter know when the sighting was accepted but flagged for review, and where to add photos later
+	response := map[string]interface{}{"message": "success", "id": newSighting.ID, "imagesURL": sightingImagesURL(newSighting.ID)}
+	if len(newSighting.Flags) > 0 {
+		response["flags"] = newSighting.Flags
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, response)
 }
 
-func getProcessedImage(imageFile multipart.File) ([]byte, error) {
-	// Read the image data into a byte slice
-	imageData, err := ioutil.ReadAll(imageFile)
-	if err != nil {
-		return nil, err
+// parseSightingForm reads a sighting from a multipart form. It responds with an error and reports
+// false when the form is invalid.
+func (h *handlers) parseSightingForm(w http.ResponseWriter, r *http.Request) (*models.TigerSighting, bool) {
+	if !h.parseImageUpload(w, r) {
+		return nil, false
 	}
 
-	// Resize the image to 250x200
-	resizedImage, err := utils.ResizeImage(imageData, 250, 200)
+	// Get the form values
+	tigerIDStr := r.FormValue("tigerID")
+	timestampStr := r.FormValue("timestamp")
+	latStr := r.FormValue("lat")
+	longStr := r.FormValue("long")
+
+	// Convert the form values to appropriate types
+	tigerID, err := strconv.Atoi(tigerIDStr)
 	if err != nil {
-		return nil, err
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid tigerID value")
+		return nil, false
+	}
+
+	// The location and time may be left out when the images carry them in their EXIF data
+	var timestamp time.Time
+	if timestampStr != "" {
+		timestamp, err = time.Parse(time.RFC3339, timestampStr)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid timestamp value")
+			return nil, false
+		}
+	}
+
+	var lat, long float64
+	if latStr != "" || longStr != "" {
+		lat, err = strconv.ParseFloat(latStr, 64)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid lat value")
+			return nil, false
+		}
+
+		long, err = strconv.ParseFloat(longStr, 64)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid long value")
+			return nil, false
+		}
+	}
+
+	newSighting := &models.TigerSighting{TigerID: tigerID, Timestamp: timestamp, Lat: lat, Long: long}
+
+	// A sighting can be reported with several photos of the same animal, or none
+	var ok bool
+	newSighting.Images, ok = h.readImages(w, r)
+	if !ok {
+		return nil, false
+	}
+	return newSighting, true
+}
+
+// parseSightingJSON reads a sighting from a JSON sightingSubmission. It responds with an error
+// and reports false when the body is invalid.
+func (h *handlers) parseSightingJSON(w http.ResponseWriter, r *http.Request) (*models.TigerSighting, bool) {
+	// Base64 takes four bytes for every three bytes of image
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxImageBytes()*4/3+maxFormOverheadBytes)
+
+	var submission sightingSubmission
+	if err := json.NewDecoder(r.Body).Decode(&submission); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			utils.RespondWithError(w, http.StatusRequestEntityTooLarge, upload.ErrTooLarge.Error())
+			return nil, false
+		}
+		utils.RespondWithError(w, http.StatusBadRequest, "Failed to parse request body")
+		return nil, false
+	}
+
+	if submission.TigerID < 1 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid tigerID value")
+		return nil, false
 	}
-	return resizedImage, nil
+
+	return &models.TigerSighting{
+		TigerID:   submission.TigerID,
+		Timestamp: submission.Timestamp,
+		Lat:       submission.Lat,
+		Long:      submission.Long,
+		Images:    submission.Images,
+	}, true
 }
 
 func (h *handlers) GetTigerSightingsByIDHandler(w http.ResponseWriter, r *http.Request) {
+	// GeoJSON clients get the whole track instead of a page of sightings
+	if strings.Contains(r.Header.Get("Accept"), geojson.ContentType) {
+		h.GetTigerTrackHandler(w, r)
+		return
+	}
+
 	vars := mux.Vars(r)
 	tigerID := vars["id"]
 	if tigerID == "" {
@@ -262,30 +1082,11 @@ func (h *handlers) GetTigerSightingsByIDHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	// Point clients at the image route instead of embedding the image bytes
 	for _, t := range tigerSightings {
-		img, _, err := image.Decode(bytes.NewReader(t.Image))
-		if err != nil {
-			fmt.Errorf("Error decoding image data: %v", err)
+		if t.HasImage {
+			t.ImageURL = sightingImageURL(t.ID)
 		}
-
-		// Save the image to a new file
-		fileName := fmt.Sprintf("%v_%v_%v_%v.jpeg", t.TigerID, t.Lat, t.Long, t.ReporterEmail)
-		outputFile, err := os.Create(fileName) // we could have store it in S3 bucket, for simplicity storing it here.
-		if err != nil {
-			fmt.Errorf("Error creating output file: %v", err)
-		}
-		defer outputFile.Close()
-
-		// Save the image in JPEG format
-		if img != nil {
-			err = jpeg.Encode(outputFile, img, nil)
-			if err != nil {
-				fmt.Errorf("Error encoding image data to file: %v", err)
-			}
-		}
-
-		t.ImageFile = fileName
-		t.Image = nil
 	}
 
 	// Construct pagination response
@@ -0,0 +1,40 @@
+package imagestore
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	conf "github.com/tigerhall-kittens/config"
+)
+
+var (
+	// ErrNotFound is returned when no image is stored under the key.
+	ErrNotFound = errors.New("image not found")
+	// ErrSignedURLUnsupported is returned by stores that cannot hand out direct links to images.
+	ErrSignedURLUnsupported = errors.New("signed URLs are not supported by this image store")
+)
+
+// ImageStore keeps sighting images outside of the database.
+type ImageStore interface {
+	// Put stores data under key, replacing any image already stored there.
+	Put(key string, data []byte, contentType string) error
+	// Get returns the image stored under key, or ErrNotFound.
+	Get(key string) ([]byte, error)
+	// Delete removes the image stored under key. Deleting a missing image is not an error.
+	Delete(key string) error
+	// SignedURL returns a link that gives read access to the image until it expires.
+	SignedURL(key string, expires time.Duration) (string, error)
+}
+
+// FromConfig builds the image store selected in the configuration.
+func FromConfig(config conf.ImageStore) (ImageStore, error) {
+	switch config.Driver {
+	case "local":
+		return NewLocalStore(config.Dir)
+	case "s3":
+		return NewS3Store(config.S3)
+	default:
+		return nil, fmt.Errorf("image store driver must be %q or %q, got %q", "local", "s3", config.Driver)
+	}
+}
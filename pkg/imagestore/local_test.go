@@ -0,0 +1,43 @@
+package imagestore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStore_PutGetDelete(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	err = store.Put("sightings/1/image.jpg", []byte("image-bytes"), "image/jpeg")
+	assert.NoError(t, err)
+
+	data, err := store.Get("sightings/1/image.jpg")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("image-bytes"), data)
+
+	assert.NoError(t, store.Delete("sightings/1/image.jpg"))
+	_, err = store.Get("sightings/1/image.jpg")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Deleting a missing image is not an error
+	assert.NoError(t, store.Delete("sightings/1/image.jpg"))
+}
+
+func TestLocalStore_RejectsKeysOutsideDirectory(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	err = store.Put("../escape.jpg", []byte("image-bytes"), "image/jpeg")
+	assert.Error(t, err)
+}
+
+func TestLocalStore_SignedURLUnsupported(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	_, err = store.SignedURL("sightings/1/image.jpg", time.Minute)
+	assert.ErrorIs(t, err, ErrSignedURLUnsupported)
+}
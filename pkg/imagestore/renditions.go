@@ -0,0 +1,57 @@
+package imagestore
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"path"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/tigerhall-kittens/pkg/models"
+)
+
+// renditions derive the smaller sizes of a sighting image from the original.
+var renditions = map[models.ImageSize]func(image.Image) image.Image{
+	models.ImageSizeMedium: func(img image.Image) image.Image {
+		// Fit never enlarges images that are already small enough
+		return imaging.Fit(img, 1024, 1024, imaging.Lanczos)
+	},
+	models.ImageSizeThumb: func(img image.Image) image.Image {
+		return imaging.Fill(img, 250, 200, imaging.Center, imaging.Lanczos)
+	},
+}
+
+// Sizes lists every size stored for an image, original first.
+var Sizes = []models.ImageSize{models.ImageSizeOriginal, models.ImageSizeMedium, models.ImageSizeThumb}
+
+// ParseSize returns the image size with the given name.
+func ParseSize(name string) (models.ImageSize, error) {
+	for _, size := range Sizes {
+		if string(size) == name {
+			return size, nil
+		}
+	}
+	return "", fmt.Errorf("image size must be one of %v, got %q", Sizes, name)
+}
+
+// RenditionKey returns the key of the given size of the image stored under key.
+func RenditionKey(key string, size models.ImageSize) string {
+	if size == models.ImageSizeOriginal {
+		return key
+	}
+	return strings.TrimSuffix(key, path.Ext(key)) + "_" + string(size) + ".jpeg"
+}
+
+// Renditions encodes every derived size of img as JPEG.
+func Renditions(img image.Image) (map[models.ImageSize][]byte, error) {
+	encoded := map[models.ImageSize][]byte{}
+	for size, render := range renditions {
+		var buf bytes.Buffer
+		if err := imaging.Encode(&buf, render(img), imaging.JPEG, imaging.JPEGQuality(85)); err != nil {
+			return nil, fmt.Errorf("failed to encode %s image: %v", size, err)
+		}
+		encoded[size] = buf.Bytes()
+	}
+	return encoded, nil
+}
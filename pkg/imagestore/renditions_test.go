@@ -0,0 +1,41 @@
+package imagestore
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tigerhall-kittens/pkg/models"
+)
+
+func TestRenditions_PreserveAspectRatio(t *testing.T) {
+	original := image.NewRGBA(image.Rect(0, 0, 4000, 3000))
+
+	encoded, err := Renditions(original)
+	assert.NoError(t, err)
+
+	medium, _, err := image.DecodeConfig(bytes.NewReader(encoded[models.ImageSizeMedium]))
+	assert.NoError(t, err)
+	assert.Equal(t, 1024, medium.Width)
+	assert.Equal(t, 768, medium.Height)
+
+	thumb, _, err := image.DecodeConfig(bytes.NewReader(encoded[models.ImageSizeThumb]))
+	assert.NoError(t, err)
+	assert.Equal(t, 250, thumb.Width)
+	assert.Equal(t, 200, thumb.Height)
+}
+
+func TestRenditionKey(t *testing.T) {
+	assert.Equal(t, "sightings/1/abc.png", RenditionKey("sightings/1/abc.png", models.ImageSizeOriginal))
+	assert.Equal(t, "sightings/1/abc_thumb.jpeg", RenditionKey("sightings/1/abc.png", models.ImageSizeThumb))
+}
+
+func TestParseSize(t *testing.T) {
+	size, err := ParseSize("medium")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ImageSizeMedium, size)
+
+	_, err = ParseSize("huge")
+	assert.Error(t, err)
+}
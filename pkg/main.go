@@ -1,17 +1,44 @@
 package pkg
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"time"
 
 	conf "github.com/tigerhall-kittens/config"
-	"github.com/tigerhall-kittens/pkg/auth"
+	"github.com/tigerhall-kittens/pkg/dhash"
+	"github.com/tigerhall-kittens/pkg/exif"
+	"github.com/tigerhall-kittens/pkg/imagestore"
 	"github.com/tigerhall-kittens/pkg/messaging"
+	"github.com/tigerhall-kittens/pkg/notifier"
+	"github.com/tigerhall-kittens/pkg/outbox"
 	"github.com/tigerhall-kittens/pkg/repository"
-	"github.com/tigerhall-kittens/pkg/server"
+	"github.com/tigerhall-kittens/pkg/rules"
 	"github.com/tigerhall-kittens/pkg/service"
+	"github.com/tigerhall-kittens/pkg/upload"
 )
 
-func InitializeService(config *conf.Config) (service.TigerService, error) {
+// InitializeService builds the service, and publishes the outbox events until ctx is cancelled.
+func InitializeService(ctx context.Context, config *conf.Config) (service.TigerService, error) {
+	// Build the default proximity rule for new sightings
+	sightingRule, err := rules.FromConfig(config.Sightings)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sightings configuration: %v", err)
+	}
+
+	// Build the check for near-duplicate sighting images
+	duplicates, err := dhash.FromConfig(config.Sightings.Duplicates)
+	if err != nil {
+		return nil, fmt.Errorf("invalid duplicate image configuration: %v", err)
+	}
+
+	// Initialize the store for sighting images
+	images, err := imagestore.FromConfig(config.ImageStore)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image store configuration: %v", err)
+	}
+
 	// Initialize the database connection
 	dbConnectionString := conf.BuildDBConnectionString(config.Database)
 
@@ -20,43 +47,101 @@ func InitializeService(config *conf.Config) (service.TigerService, error) {
 		return nil, err
 	}
 
-	// Initialize the RabbitMQ message broker
-	messageBroker, err := messaging.NewMessageBroker(config.RabbitMq.AmqpURL, config.RabbitMq.QueueName)
+	// Initialize the message broker
+	messageBroker, err := messaging.FromConfig(config.RabbitMq)
 	if err != nil {
 		return nil, err
 	}
 
-	// Start the message consumer in a separate Goroutine
-	go messageBroker.ConsumeMessages(messaging.ProcessMessage)
+	// Publish the events that the service writes to the outbox
+	relay := outbox.NewRelay(store, messageBroker, outbox.RetryPolicy{
+		Backoff:    config.Outbox.RetryBackoff,
+		MaxBackoff: config.Outbox.MaxBackoff,
+	}, config.Outbox.BatchSize, config.Outbox.Lease)
+	go relay.Run(ctx, config.Outbox.PollInterval)
+
+	// The in-memory broker only reaches consumers in this process, so the notifications are sent from
+	// here instead of by the worker command
+	if messaging.InProcess(config.RabbitMq) {
+		emails, err := newNotifier(config, store)
+		if err != nil {
+			return nil, err
+		}
+		go emails.RunScheduler(ctx, config.Notifications.ScheduleInterval)
+		go messageBroker.ConsumeMessages(ctx, emails.ProcessMessage, messaging.WithConcurrency(config.Worker.Concurrency))
+	}
 
 	// Initialize the service
-	service := service.NewTigerService(store, messageBroker)
+	opts := []service.Option{
+		service.WithSightingRule(sightingRule),
+		service.WithExifCheck(exif.FromConfig(config.Sightings.Exif)),
+		service.WithDuplicateCheck(duplicates),
+		service.WithImageStore(images),
+		service.WithUploadLimits(upload.FromConfig(config.Uploads)),
+		service.WithPublicURL(config.Server.PublicURL),
+	}
+	if config.Privacy.CoarsenProtectedTigers {
+		opts = append(opts, service.WithProtectedCoordinateDecimals(config.Privacy.CoordinateDecimals))
+	}
+	service := service.NewTigerService(store, opts...)
 
 	return service, nil
 }
 
-func main() {
-	// Read the configuration from server.yml
-	config, err := conf.ReadConfig("config/local/server.yml")
+// RunWorker emails the reporters and subscribers of each new sighting until ctx is cancelled. It then
+// stops taking messages and waits up to the drain timeout for the messages in progress.
+func RunWorker(ctx context.Context, config *conf.Config) error {
+	if messaging.InProcess(config.RabbitMq) {
+		return fmt.Errorf("the %s message broker is not shared between processes; the serve command sends the notifications", config.RabbitMq.Driver)
+	}
+
+	// Initialize the database connection, which keeps a record of every email
+	store, err := repository.NewPostgresRepository(conf.BuildDBConnectionString(config.Database))
 	if err != nil {
-		log.Fatalf("Failed to read configuration: %v", err)
+		return err
 	}
 
-	// Initialize the service
-	service, err := InitializeService(config)
+	emails, err := newNotifier(config, store)
 	if err != nil {
-		log.Fatalf("Failed to initialize the service: %v", err)
+		return err
 	}
 
-	// Initialize the server
-	srv := server.NewServer()
+	// Initialize the message broker
+	messageBroker, err := messaging.FromConfig(config.RabbitMq)
+	if err != nil {
+		return err
+	}
+	defer messageBroker.Close()
+
+	// Send the emails held back for quiet hours and daily digests once they are due
+	go emails.RunScheduler(ctx, config.Notifications.ScheduleInterval)
+
+	consumed := make(chan struct{})
+	go func() {
+		defer close(consumed)
+		messageBroker.ConsumeMessages(ctx, emails.ProcessMessage,
+			messaging.WithConcurrency(config.Worker.Concurrency),
+			messaging.WithPrefetch(config.Worker.Prefetch),
+		)
+	}()
 
-	// Set up the routes and handlers
-	srv.SetupRoutes(service, auth.NewAuth(config.JWT.SecretKey))
+	<-ctx.Done()
+	log.Printf("Draining the messages in progress for up to %s", config.Worker.DrainTimeout)
+	select {
+	case <-consumed:
+	case <-time.After(config.Worker.DrainTimeout):
+		log.Println("Stopped before the messages in progress were done; they will be delivered again")
+	}
+	return nil
+}
 
-	// Start the server
-	err = srv.Start(config.Server.Port)
+// newNotifier builds the notifier that emails the reporters and subscribers of each new sighting.
+func newNotifier(config *conf.Config, deliveries notifier.Deliveries) (*notifier.Notifier, error) {
+	sender, err := notifier.FromConfig(config.Notifications)
 	if err != nil {
-		log.Fatalf("Failed to start the server: %v", err)
+		return nil, fmt.Errorf("invalid notifications configuration: %v", err)
 	}
+	return notifier.NewNotifier(sender, deliveries, notifier.RetryPolicy{
+		MaxAttempts: config.Notifications.MaxAttempts,
+	}, config.Notifications.Lease), nil
 }
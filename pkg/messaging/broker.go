@@ -0,0 +1,62 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+
+	conf "github.com/tigerhall-kittens/config"
+	"github.com/tigerhall-kittens/pkg/events"
+)
+
+// Publisher sends events to the consumers bound to their type.
+type Publisher interface {
+	PublishEvent(event events.Envelope) error
+}
+
+// Subscriber hands the messages of the queue to processMessage until ctx is cancelled or the broker
+// is closed. Messages are delivered at least once, so processMessage must tolerate repeats.
+type Subscriber interface {
+	ConsumeMessages(ctx context.Context, processMessage func([]byte) error, opts ...ConsumeOption)
+}
+
+// Broker publishes and consumes messages.
+type Broker interface {
+	Publisher
+	Subscriber
+	Close()
+}
+
+// InProcess tells whether the configured broker only reaches consumers in the same process, so that
+// the messages must be consumed by the server instead of a separate worker.
+func InProcess(config conf.RabbitMq) bool {
+	return config.Driver == "memory"
+}
+
+// FromConfig builds the broker selected in the configuration.
+func FromConfig(config conf.RabbitMq) (Broker, error) {
+	switch config.Driver {
+	case "amqp":
+		return NewMessageBroker(config)
+	case "memory":
+		return NewMemoryBroker(config), nil
+	case "noop":
+		return NoopBroker{}, nil
+	default:
+		return nil, fmt.Errorf("message broker driver must be %q, %q or %q, got %q", "amqp", "memory", "noop", config.Driver)
+	}
+}
+
+// NoopBroker drops the events it is given and never delivers a message, for running the API without
+// notifications.
+type NoopBroker struct{}
+
+func (NoopBroker) PublishEvent(event events.Envelope) error {
+	return nil
+}
+
+// ConsumeMessages waits for ctx to be cancelled, as no message ever arrives.
+func (NoopBroker) ConsumeMessages(ctx context.Context, processMessage func([]byte) error, opts ...ConsumeOption) {
+	<-ctx.Done()
+}
+
+func (NoopBroker) Close() {}
@@ -0,0 +1,107 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// DeadLetter is a message that was moved to the dead-letter queue after failing every attempt.
+type DeadLetter struct {
+	MessageID      string    `json:"messageID"`
+	Type           string    `json:"type"`
+	CorrelationID  string    `json:"correlationID"`
+	Attempts       int       `json:"attempts"`
+	LastError      string    `json:"lastError"`
+	DeadLetteredAt time.Time `json:"deadLetteredAt"`
+	Body           string    `json:"body"`
+}
+
+func newDeadLetter(msg amqp.Delivery) DeadLetter {
+	letter := DeadLetter{
+		MessageID:     msg.MessageId,
+		Type:          msg.Type,
+		CorrelationID: msg.CorrelationId,
+		Attempts:      attemptsOf(msg.Headers),
+		Body:          string(msg.Body),
+	}
+	letter.LastError, _ = msg.Headers[lastErrorHeader].(string)
+	letter.DeadLetteredAt, _ = msg.Headers[deadLetteredAtHeader].(time.Time)
+	return letter
+}
+
+// DeadLetters returns up to limit messages from the head of the dead-letter queue, leaving them in
+// the queue.
+func (mb *MessageBroker) DeadLetters(limit int) ([]DeadLetter, error) {
+	letters := []DeadLetter{}
+	err := mb.readDeadLetters(limit, func(msg amqp.Delivery) error {
+		letters = append(letters, newDeadLetter(msg))
+		return nil
+	})
+	return letters, err
+}
+
+// ReplayDeadLetters moves messages from the dead-letter queue back to the queue, with their attempts
+// reset, and returns how many it moved. Only the messages with the given IDs are moved, or all of the
+// first limit messages if no IDs are given.
+func (mb *MessageBroker) ReplayDeadLetters(messageIDs []string, limit int) (int, error) {
+	wanted := map[string]bool{}
+	for _, id := range messageIDs {
+		wanted[id] = true
+	}
+
+	replayed := 0
+	err := mb.readDeadLetters(limit, func(msg amqp.Delivery) error {
+		if len(wanted) > 0 && !wanted[msg.MessageId] {
+			return nil
+		}
+
+		publishing := republish(msg)
+		delete(publishing.Headers, attemptsHeader)
+		delete(publishing.Headers, lastErrorHeader)
+		delete(publishing.Headers, deadLetteredAtHeader)
+		if err := mb.publish("", mb.config.QueueName, publishing); err != nil {
+			return fmt.Errorf("failed to replay message %s: %v", msg.MessageId, err)
+		}
+		// Only acknowledged once the copy is confirmed, so that the message is never lost
+		if err := msg.Ack(false); err != nil {
+			return fmt.Errorf("failed to remove replayed message %s from the dead-letter queue: %v", msg.MessageId, err)
+		}
+		replayed++
+		return nil
+	})
+	return replayed, err
+}
+
+// readDeadLetters passes up to limit messages from the head of the dead-letter queue to fn. The
+// messages that fn does not acknowledge go back to the queue in their order.
+func (mb *MessageBroker) readDeadLetters(limit int, fn func(amqp.Delivery) error) error {
+	conn := mb.waitForConnection(context.Background())
+	if conn == nil {
+		return ErrClosed
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open RabbitMQ channel: %v", err)
+	}
+	// Closing the channel returns the unacknowledged messages to the queue
+	defer channel.Close()
+
+	for i := 0; i < limit; i++ {
+		msg, ok, err := channel.Get(mb.config.DeadLetterQueue, false)
+		if err != nil {
+			return fmt.Errorf("failed to read the dead-letter queue: %v", err)
+		}
+		if !ok {
+			// The queue is empty
+			return nil
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
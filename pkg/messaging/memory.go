@@ -0,0 +1,191 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	conf "github.com/tigerhall-kittens/config"
+	"github.com/tigerhall-kittens/pkg/events"
+)
+
+// memoryQueueSize bounds the messages waiting in a MemoryBroker. Publishing fails once it is full,
+// and the outbox relay tries again later.
+const memoryQueueSize = 1000
+
+// MemoryBroker delivers events to consumers in the same process through a Go channel. It routes,
+// retries and dead-letters messages like the RabbitMQ broker, but the messages still queued are lost
+// when the process exits, so it is meant for tests and local development.
+type MemoryBroker struct {
+	config    conf.RabbitMq
+	queue     chan memoryMessage
+	closed    chan struct{}
+	closeOnce sync.Once
+	now       func() time.Time
+
+	mu          sync.Mutex
+	deadLetters []DeadLetter
+}
+
+type memoryMessage struct {
+	event    events.Envelope
+	body     []byte
+	attempts int
+}
+
+func NewMemoryBroker(config conf.RabbitMq) *MemoryBroker {
+	return &MemoryBroker{
+		config: withDefaults(config),
+		queue:  make(chan memoryMessage, memoryQueueSize),
+		closed: make(chan struct{}),
+		now:    time.Now,
+	}
+}
+
+// PublishEvent queues the event if its type matches one of the bindings, and drops it otherwise, as
+// RabbitMQ does with messages that no queue is bound to.
+func (b *MemoryBroker) PublishEvent(event events.Envelope) error {
+	if !b.routes(event.Type) {
+		return nil
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %v", event.Type, err)
+	}
+
+	select {
+	case <-b.closed:
+		return ErrClosed
+	default:
+	}
+	return b.enqueue(memoryMessage{event: event, body: body})
+}
+
+func (b *MemoryBroker) enqueue(msg memoryMessage) error {
+	select {
+	case b.queue <- msg:
+		return nil
+	default:
+		return errors.New("in-memory message queue is full")
+	}
+}
+
+func (b *MemoryBroker) routes(key string) bool {
+	for _, pattern := range b.config.Bindings {
+		if topicMatches(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// topicMatches tells whether the routing key matches the binding pattern of a topic exchange, where
+// "*" stands for exactly one word and "#" for zero or more.
+func topicMatches(pattern, key string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(key, "."))
+}
+
+func matchWords(pattern, key []string) bool {
+	if len(pattern) == 0 {
+		return len(key) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(key); i++ {
+			if matchWords(pattern[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(key) > 0 && matchWords(pattern[1:], key[1:])
+	default:
+		return len(key) > 0 && pattern[0] == key[0] && matchWords(pattern[1:], key[1:])
+	}
+}
+
+// ConsumeMessages processes the queued messages until ctx is cancelled or the broker is closed. The
+// messages in progress are finished before it returns. Prefetching has no effect in memory.
+func (b *MemoryBroker) ConsumeMessages(ctx context.Context, processMessage func([]byte) error, opts ...ConsumeOption) {
+	options := newConsumeOptions(opts)
+
+	var wg sync.WaitGroup
+	for i := 0; i < options.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-b.closed:
+					return
+				case msg := <-b.queue:
+					b.process(msg, processMessage)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (b *MemoryBroker) process(msg memoryMessage, processMessage func([]byte) error) {
+	err := processMessage(msg.body)
+	if err == nil {
+		return
+	}
+	log.Printf("failed to process message %s: %v", msg.event.ID, err)
+
+	msg.attempts++
+	if msg.attempts >= b.config.MaxDeliveryAttempts {
+		b.deadLetter(msg, err)
+		return
+	}
+	time.AfterFunc(retryDelay(b.config, msg.attempts), func() {
+		if err := b.enqueue(msg); err != nil {
+			b.deadLetter(msg, err)
+		}
+	})
+}
+
+func (b *MemoryBroker) deadLetter(msg memoryMessage, err error) {
+	log.Printf("moved message %s to the dead-letter queue after %d attempts", msg.event.ID, msg.attempts)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deadLetters = append(b.deadLetters, DeadLetter{
+		MessageID:      msg.event.ID,
+		Type:           msg.event.Type,
+		CorrelationID:  msg.event.CorrelationID,
+		Attempts:       msg.attempts,
+		LastError:      err.Error(),
+		DeadLetteredAt: b.now().UTC(),
+		Body:           string(msg.body),
+	})
+}
+
+// DeadLetters returns up to limit of the messages that failed every attempt, oldest first.
+func (b *MemoryBroker) DeadLetters(limit int) ([]DeadLetter, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if limit < 0 {
+		limit = 0
+	}
+	if limit > len(b.deadLetters) {
+		limit = len(b.deadLetters)
+	}
+	return append([]DeadLetter{}, b.deadLetters[:limit]...), nil
+}
+
+// Close stops the consumers. The messages still queued are dropped.
+func (b *MemoryBroker) Close() {
+	b.closeOnce.Do(func() {
+		close(b.closed)
+	})
+}
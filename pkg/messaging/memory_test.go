@@ -0,0 +1,141 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	conf "github.com/tigerhall-kittens/config"
+	"github.com/tigerhall-kittens/pkg/events"
+	"github.com/tigerhall-kittens/pkg/models"
+	"github.com/tigerhall-kittens/pkg/utils"
+)
+
+func TestFromConfig(t *testing.T) {
+	broker, err := FromConfig(conf.RabbitMq{Driver: "memory"})
+	assert.NoError(t, err)
+	assert.IsType(t, &MemoryBroker{}, broker)
+
+	broker, err = FromConfig(conf.RabbitMq{Driver: "noop"})
+	assert.NoError(t, err)
+	assert.Equal(t, NoopBroker{}, broker)
+
+	_, err = FromConfig(conf.RabbitMq{Driver: "kafka"})
+	assert.EqualError(t, err, `message broker driver must be "amqp", "memory" or "noop", got "kafka"`)
+}
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		pattern, key string
+		expected     bool
+	}{
+		{"notification.#", "notification.email_requested", true},
+		{"notification.#", "notification", true},
+		{"notification.#", "sighting.created", false},
+		{"*.created", "tiger.created", true},
+		{"*.created", "tiger.sighting.created", false},
+		{"#.created", "tiger.sighting.created", true},
+		{"#", "user.signed_up", true},
+		{"sighting.created", "sighting.created", true},
+		{"sighting.created", "sighting.deleted", false},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, topicMatches(test.pattern, test.key), "%s against %s", test.key, test.pattern)
+	}
+}
+
+func newEmailRequested(t *testing.T) events.Envelope {
+	event, err := events.NewEmailRequested([]utils.EmailTemplate{{Recipient: "a@example.com"}}, time.Now(), "")
+	assert.NoError(t, err)
+	return event
+}
+
+func TestMemoryBroker_DeliversBoundEvents(t *testing.T) {
+	broker := NewMemoryBroker(conf.RabbitMq{Bindings: []string{"notification.#"}})
+	defer broker.Close()
+
+	tigerCreated, err := events.NewTigerCreated(&models.Tiger{ID: 1, Name: "Sher Khan"}, time.Now())
+	assert.NoError(t, err)
+	assert.NoError(t, broker.PublishEvent(tigerCreated))
+	emailRequested := newEmailRequested(t)
+	assert.NoError(t, broker.PublishEvent(emailRequested))
+
+	received := make(chan []byte, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		broker.ConsumeMessages(ctx, func(message []byte) error {
+			received <- message
+			return nil
+		}, WithConcurrency(2))
+	}()
+
+	select {
+	case message := <-received:
+		assert.Contains(t, string(message), emailRequested.ID)
+	case <-time.After(time.Second):
+		t.Fatal("The bound event should be delivered")
+	}
+	cancel()
+	<-done
+	assert.Empty(t, received, "The event that no binding matches should be dropped")
+}
+
+func TestMemoryBroker_DeadLettersAfterLastAttempt(t *testing.T) {
+	broker := NewMemoryBroker(conf.RabbitMq{
+		Bindings:            []string{"notification.#"},
+		MaxDeliveryAttempts: 3,
+		RetryBackoff:        time.Millisecond,
+	})
+	defer broker.Close()
+	event := newEmailRequested(t)
+	assert.NoError(t, broker.PublishEvent(event))
+
+	var mu sync.Mutex
+	attempts := 0
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go broker.ConsumeMessages(ctx, func(message []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		return errors.New("smtp server down")
+	})
+
+	assert.Eventually(t, func() bool {
+		letters, _ := broker.DeadLetters(10)
+		return len(letters) == 1
+	}, time.Second, time.Millisecond)
+
+	letters, err := broker.DeadLetters(10)
+	assert.NoError(t, err)
+	assert.Equal(t, event.ID, letters[0].MessageID)
+	assert.Equal(t, 3, letters[0].Attempts)
+	assert.Equal(t, "smtp server down", letters[0].LastError)
+	mu.Lock()
+	assert.Equal(t, 3, attempts)
+	mu.Unlock()
+}
+
+func TestMemoryBroker_Close(t *testing.T) {
+	broker := NewMemoryBroker(conf.RabbitMq{Bindings: []string{"#"}})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		broker.ConsumeMessages(context.Background(), func([]byte) error { return nil })
+	}()
+	broker.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("ConsumeMessages should return once the broker is closed")
+	}
+	assert.ErrorIs(t, broker.PublishEvent(newEmailRequested(t)), ErrClosed)
+}
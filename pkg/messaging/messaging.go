@@ -1,22 +1,104 @@
 package messaging
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/streadway/amqp"
+	conf "github.com/tigerhall-kittens/config"
+	"github.com/tigerhall-kittens/pkg/events"
 )
 
-// MessageBroker represents the messaging service using RabbitMQ.
+var (
+	// ErrNotConnected is returned by PublishEvent while the broker is reconnecting to RabbitMQ.
+	ErrNotConnected = errors.New("not connected to RabbitMQ")
+	// ErrNotConfirmed is returned by PublishEvent when RabbitMQ does not confirm the message in time.
+	ErrNotConfirmed = errors.New("RabbitMQ did not confirm the message")
+	// ErrClosed is returned once the broker has been closed.
+	ErrClosed = errors.New("message broker is closed")
+)
+
+// MessageBroker represents the messaging service using RabbitMQ. Events are published to a topic
+// exchange with their type as the routing key; the queue of the broker receives the events matching
+// its bindings.
+//
+// The broker reconnects on its own when the connection drops, such as during a restart of RabbitMQ.
+// Published messages are only reported as sent once RabbitMQ confirms them.
 type MessageBroker struct {
-	conn    *amqp.Connection
-	channel *amqp.Channel
-	queue   amqp.Queue
+	config conf.RabbitMq
+
+	// mu guards the connection state; cond signals a new connection or the broker being closed
+	mu        sync.Mutex
+	cond      *sync.Cond
+	conn      *amqp.Connection
+	publisher *publishChannel
+	closed    bool
+
+	// publishMu serializes publishing, so that every message waits for its own confirmation
+	publishMu sync.Mutex
+}
+
+// publishChannel is the channel of a connection that messages are published on, in confirm mode.
+type publishChannel struct {
+	channel  *amqp.Channel
+	confirms chan amqp.Confirmation
+	// lastTag is the delivery tag of the last message published on the channel
+	lastTag uint64
+}
+
+// NewMessageBroker connects to RabbitMQ and declares the exchange, the queue and its bindings. It
+// fails if RabbitMQ cannot be reached now; later connection failures are retried in the background.
+func NewMessageBroker(config conf.RabbitMq) (*MessageBroker, error) {
+	config = withDefaults(config)
+	mb := &MessageBroker{config: config}
+	mb.cond = sync.NewCond(&mb.mu)
+
+	lost, err := mb.connect()
+	if err != nil {
+		return nil, err
+	}
+	go mb.supervise(lost)
+
+	return mb, nil
+}
+
+// withDefaults fills in the settings that the configuration left out or set out of range.
+func withDefaults(config conf.RabbitMq) conf.RabbitMq {
+	if config.ReconnectBackoff <= 0 {
+		config.ReconnectBackoff = time.Second
+	}
+	if config.MaxReconnectBackoff < config.ReconnectBackoff {
+		config.MaxReconnectBackoff = config.ReconnectBackoff
+	}
+	if config.PublishTimeout <= 0 {
+		config.PublishTimeout = 5 * time.Second
+	}
+	if config.MaxDeliveryAttempts < 1 {
+		config.MaxDeliveryAttempts = 1
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = time.Second
+	}
+	if config.MaxRetryBackoff < config.RetryBackoff {
+		config.MaxRetryBackoff = config.RetryBackoff
+	}
+	if config.DeadLetterQueue == "" {
+		config.DeadLetterQueue = config.QueueName + ".dead"
+	}
+	return config
 }
 
-// NewMessageBroker creates a new MessageBroker instance.
-func NewMessageBroker(amqpURL, queueName string) (*MessageBroker, error) {
-	conn, err := amqp.Dial(amqpURL)
+// connect opens a connection with its publish channel and declares the topology on it. The returned
+// channel receives an error when either of them closes.
+func (mb *MessageBroker) connect() (<-chan *amqp.Error, error) {
+	conn, err := amqp.Dial(mb.config.AmqpURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to RabbitMQ: %v", err)
 	}
@@ -27,8 +109,63 @@ func NewMessageBroker(amqpURL, queueName string) (*MessageBroker, error) {
 		return nil, fmt.Errorf("failed to open RabbitMQ channel: %v", err)
 	}
 
+	if err := mb.declare(channel); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := channel.Confirm(false); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to put RabbitMQ channel in confirm mode: %v", err)
+	}
+
+	// The library blocks until these channels are read, so they are buffered
+	confirms := channel.NotifyPublish(make(chan amqp.Confirmation, 1))
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	channelClosed := channel.NotifyClose(make(chan *amqp.Error, 1))
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if mb.closed {
+		conn.Close()
+		return nil, ErrClosed
+	}
+	mb.conn = conn
+	mb.publisher = &publishChannel{channel: channel, confirms: confirms}
+	mb.cond.Broadcast()
+
+	lost := make(chan *amqp.Error, 1)
+	go func() {
+		select {
+		case err := <-connClosed:
+			lost <- err
+		case err := <-channelClosed:
+			// Without its publish channel the connection is of no use, so it is replaced as a whole
+			conn.Close()
+			lost <- err
+		}
+	}()
+	return lost, nil
+}
+
+// declare declares the exchange, the queue and its bindings. Declaring them again after a reconnect
+// is harmless and recreates them if RabbitMQ lost them.
+func (mb *MessageBroker) declare(channel *amqp.Channel) error {
+	err := channel.ExchangeDeclare(
+		mb.config.Exchange,
+		amqp.ExchangeTopic,
+		true,  // durable
+		false, // autoDelete
+		false, // internal
+		false, // noWait
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare RabbitMQ exchange: %v", err)
+	}
+
 	queue, err := channel.QueueDeclare(
-		queueName,
+		mb.config.QueueName,
 		true,  // durable
 		false, // autoDelete
 		false, // exclusive
@@ -36,73 +173,434 @@ func NewMessageBroker(amqpURL, queueName string) (*MessageBroker, error) {
 		nil,
 	)
 	if err != nil {
-		channel.Close()
-		conn.Close()
-		return nil, fmt.Errorf("failed to declare RabbitMQ queue: %v", err)
+		return fmt.Errorf("failed to declare RabbitMQ queue: %v", err)
 	}
 
-	return &MessageBroker{
-		conn:    conn,
-		channel: channel,
-		queue:   queue,
-	}, nil
+	for _, key := range mb.config.Bindings {
+		if err := channel.QueueBind(queue.Name, key, mb.config.Exchange, false, nil); err != nil {
+			return fmt.Errorf("failed to bind RabbitMQ queue to %q: %v", key, err)
+		}
+	}
+
+	if _, err := channel.QueueDeclare(mb.config.DeadLetterQueue, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare RabbitMQ dead-letter queue: %v", err)
+	}
+
+	// Failed messages wait in a retry queue until its TTL expires, when RabbitMQ moves them back to the
+	// queue. Every wait has a queue of its own, as messages only expire at the head of a queue.
+	declared := map[string]bool{}
+	for attempts := 1; attempts < mb.config.MaxDeliveryAttempts; attempts++ {
+		delay := retryDelay(mb.config, attempts)
+		name := retryQueueName(mb.config.QueueName, delay)
+		if declared[name] {
+			continue
+		}
+		_, err := channel.QueueDeclare(name, true, false, false, false, amqp.Table{
+			"x-message-ttl":             delay.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": mb.config.QueueName,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to declare RabbitMQ retry queue %s: %v", name, err)
+		}
+		declared[name] = true
+	}
+	return nil
+}
+
+// supervise reconnects whenever the connection is lost, until the broker is closed.
+func (mb *MessageBroker) supervise(lost <-chan *amqp.Error) {
+	for {
+		err := <-lost
+
+		mb.mu.Lock()
+		mb.conn = nil
+		mb.publisher = nil
+		closed := mb.closed
+		mb.mu.Unlock()
+		if closed {
+			return
+		}
+		log.Printf("lost connection to RabbitMQ, reconnecting: %v", err)
+
+		backoff := mb.config.ReconnectBackoff
+		for {
+			time.Sleep(backoff)
+
+			var connectErr error
+			lost, connectErr = mb.connect()
+			if connectErr == nil {
+				log.Println("reconnected to RabbitMQ")
+				break
+			}
+			if errors.Is(connectErr, ErrClosed) {
+				return
+			}
+			backoff = nextBackoff(backoff, mb.config.MaxReconnectBackoff)
+			log.Printf("failed to reconnect to RabbitMQ, retrying in %s: %v", backoff, connectErr)
+		}
+	}
+}
+
+// nextBackoff doubles the wait up to max.
+func nextBackoff(current, max time.Duration) time.Duration {
+	next := current * 2
+	if next > max {
+		next = max
+	}
+	return next
 }
 
-// PublishMessage publishes a message to the RabbitMQ queue.
-func (mb *MessageBroker) PublishMessage(message []byte) error {
-	err := mb.channel.Publish(
-		"",            // exchange
-		mb.queue.Name, // routing key
-		false,         // mandatory
-		false,         // immediate
-		amqp.Publishing{
-			ContentType: "text/plain",
-			Body:        message,
-		},
+// PublishEvent publishes the event to the exchange, routed by its type, and waits for RabbitMQ to
+// confirm it. It is safe for concurrent use. An event that was not confirmed may still have been
+// delivered, so consumers drop repeated events by their ID.
+func (mb *MessageBroker) PublishEvent(event events.Envelope) error {
+	publishing, err := NewPublishing(event)
+	if err != nil {
+		return err
+	}
+	return mb.publish(mb.config.Exchange, event.Type, publishing)
+}
+
+// publish sends the message and waits for RabbitMQ to confirm it.
+func (mb *MessageBroker) publish(exchange, key string, publishing amqp.Publishing) error {
+	mb.publishMu.Lock()
+	defer mb.publishMu.Unlock()
+
+	mb.mu.Lock()
+	publisher, closed := mb.publisher, mb.closed
+	mb.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	if publisher == nil {
+		return ErrNotConnected
+	}
+
+	err := publisher.channel.Publish(
+		exchange,
+		key,   // routing key
+		false, // mandatory
+		false, // immediate
+		publishing,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to publish message to RabbitMQ: %v", err)
 	}
+	publisher.lastTag++
 
-	return nil
+	return awaitConfirm(publisher.confirms, publisher.lastTag, mb.config.PublishTimeout)
+}
+
+// awaitConfirm waits for the confirmation of the message with the delivery tag. Late confirmations
+// of earlier messages, which already timed out, are skipped.
+func awaitConfirm(confirms <-chan amqp.Confirmation, tag uint64, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case confirm, ok := <-confirms:
+			if !ok {
+				return fmt.Errorf("%w: the channel closed before the confirmation", ErrNotConfirmed)
+			}
+			if confirm.DeliveryTag < tag {
+				continue
+			}
+			if !confirm.Ack {
+				return errors.New("RabbitMQ refused the message")
+			}
+			return nil
+		case <-timer.C:
+			return fmt.Errorf("%w within %s", ErrNotConfirmed, timeout)
+		}
+	}
+}
+
+// NewPublishing encodes the event as a persistent message. The envelope fields are repeated in the
+// message properties, so that consumers can route and trace messages without decoding their body.
+func NewPublishing(event events.Envelope) (amqp.Publishing, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return amqp.Publishing{}, fmt.Errorf("failed to encode %s event: %v", event.Type, err)
+	}
+
+	return amqp.Publishing{
+		ContentType:   "application/json",
+		DeliveryMode:  amqp.Persistent,
+		MessageId:     event.ID,
+		CorrelationId: event.CorrelationID,
+		Type:          event.Type,
+		Timestamp:     event.OccurredAt,
+		Headers:       amqp.Table{"version": int32(event.Version)},
+		Body:          body,
+	}, nil
+}
+
+// ConsumeOption configures how ConsumeMessages processes messages.
+type ConsumeOption func(*consumeOptions)
+
+type consumeOptions struct {
+	concurrency int
+	prefetch    int
+}
+
+// WithConcurrency processes up to n messages at the same time.
+func WithConcurrency(n int) ConsumeOption {
+	return func(o *consumeOptions) {
+		o.concurrency = n
+	}
+}
+
+// WithPrefetch lets RabbitMQ send up to n messages ahead of their acknowledgement. It is raised to the
+// concurrency if lower, so that no goroutine is kept waiting for messages.
+func WithPrefetch(n int) ConsumeOption {
+	return func(o *consumeOptions) {
+		o.prefetch = n
+	}
+}
+
+func newConsumeOptions(opts []ConsumeOption) consumeOptions {
+	options := consumeOptions{concurrency: 1}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.concurrency < 1 {
+		options.concurrency = 1
+	}
+	if options.prefetch < options.concurrency {
+		options.prefetch = options.concurrency
+	}
+	return options
 }
 
 // ConsumeMessages starts consuming messages from the RabbitMQ queue.
 // It takes a message processing function as an argument to handle each message received.
-func (mb *MessageBroker) ConsumeMessages(processMessage func([]byte) error) {
-	msgs, err := mb.channel.Consume(
-		mb.queue.Name, // queue
-		"",            // consumer
-		false,         // auto-ack
-		false,         // exclusive
-		false,         // no-local
-		false,         // no-wait
-		nil,
-	)
+//
+// A message that fails is processed again after a backoff, and moved to the dead-letter queue once it
+// has failed MaxDeliveryAttempts times. Consuming resumes on the new connection after a reconnect.
+//
+// ConsumeMessages returns once the broker is closed, or once ctx is cancelled and the messages being
+// processed are done; the messages prefetched but not started yet go back to the queue.
+func (mb *MessageBroker) ConsumeMessages(ctx context.Context, processMessage func([]byte) error, opts ...ConsumeOption) {
+	options := newConsumeOptions(opts)
+
+	for {
+		conn := mb.waitForConnection(ctx)
+		if conn == nil {
+			return
+		}
+
+		channel, tag, msgs, err := mb.consume(conn, options.prefetch)
+		if err != nil {
+			log.Printf("failed to register a consumer, retrying in %s: %v", mb.config.ReconnectBackoff, err)
+			select {
+			case <-time.After(mb.config.ReconnectBackoff):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		// Stop the deliveries when ctx is cancelled, letting the messages in progress finish
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				if err := channel.Cancel(tag, false); err != nil {
+					log.Printf("failed to cancel the consumer: %v", err)
+				}
+			case <-done:
+			}
+		}()
+
+		var wg sync.WaitGroup
+		for i := 0; i < options.concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for msg := range msgs {
+					mb.process(msg, processMessage)
+				}
+			}()
+		}
+		// The deliveries end when the consumer is cancelled, or when the channel or the connection closes;
+		// unacknowledged messages are delivered again once the consumer is back
+		wg.Wait()
+		close(done)
+		channel.Close()
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (mb *MessageBroker) process(msg amqp.Delivery, processMessage func([]byte) error) {
+	err := processMessage(msg.Body)
 	if err != nil {
-		log.Fatalf("failed to register a consumer: %v", err)
+		log.Printf("failed to process message %s: %v", msg.MessageId, err)
+		mb.retryLater(msg, err)
+	} else {
+		// Acknowledge the successful processing of the message
+		msg.Ack(false)
 	}
+}
 
-	for msg := range msgs {
-		err := processMessage(msg.Body)
-		if err != nil {
-			log.Printf("failed to process message: %v", err)
-			// Requeue the message to be processed later
-			msg.Nack(false, true)
-		} else {
-			// Acknowledge the successful processing of the message
-			msg.Ack(false)
+// retryLater moves the failed message to a retry queue, or to the dead-letter queue once it is out of
+// attempts. Should that fail, the message is requeued to be processed again right away.
+func (mb *MessageBroker) retryLater(msg amqp.Delivery, processErr error) {
+	queue, publishing := mb.failureRoute(msg, processErr, time.Now())
+	if err := mb.publish("", queue, publishing); err != nil {
+		log.Printf("failed to move message %s to %s, requeueing it: %v", msg.MessageId, queue, err)
+		msg.Nack(false, true)
+		return
+	}
+	if queue == mb.config.DeadLetterQueue {
+		log.Printf("moved message %s to the dead-letter queue after %d attempts", msg.MessageId, attemptsOf(publishing.Headers))
+	}
+	msg.Ack(false)
+}
+
+// failureRoute returns the queue that the failed message goes to, and the message to publish there
+// with its attempts counted.
+func (mb *MessageBroker) failureRoute(msg amqp.Delivery, processErr error, now time.Time) (string, amqp.Publishing) {
+	attempts := attemptsOf(msg.Headers) + 1
+	publishing := republish(msg)
+	publishing.Headers[attemptsHeader] = int32(attempts)
+
+	if attempts >= mb.config.MaxDeliveryAttempts {
+		publishing.Headers[lastErrorHeader] = processErr.Error()
+		publishing.Headers[deadLetteredAtHeader] = now.UTC()
+		return mb.config.DeadLetterQueue, publishing
+	}
+	return retryQueueName(mb.config.QueueName, retryDelay(mb.config, attempts)), publishing
+}
+
+// retryDelay is the wait after the given number of failed attempts, doubling from RetryBackoff up to
+// MaxRetryBackoff.
+func retryDelay(config conf.RabbitMq, attempts int) time.Duration {
+	delay := config.RetryBackoff
+	for i := 1; i < attempts && delay < config.MaxRetryBackoff; i++ {
+		delay = nextBackoff(delay, config.MaxRetryBackoff)
+	}
+	return delay
+}
+
+// retryQueueName names the retry queue by its wait, so that changing the backoff declares new queues
+// instead of conflicting with the TTL of the existing ones.
+func retryQueueName(queue string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", queue, delay)
+}
+
+// Headers that count and explain the failed attempts of a message.
+const (
+	attemptsHeader       = "attempts"
+	lastErrorHeader      = "lastError"
+	deadLetteredAtHeader = "deadLetteredAt"
+)
+
+// attemptsOf returns the number of failed attempts recorded in the headers.
+func attemptsOf(headers amqp.Table) int {
+	switch attempts := headers[attemptsHeader].(type) {
+	case int32:
+		return int(attempts)
+	case int64:
+		return int(attempts)
+	case int:
+		return attempts
+	default:
+		return 0
+	}
+}
+
+// republish copies the delivered message, so that it can be published again unchanged.
+func republish(msg amqp.Delivery) amqp.Publishing {
+	headers := amqp.Table{}
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+	return amqp.Publishing{
+		Headers:       headers,
+		ContentType:   msg.ContentType,
+		DeliveryMode:  amqp.Persistent,
+		MessageId:     msg.MessageId,
+		CorrelationId: msg.CorrelationId,
+		Type:          msg.Type,
+		Timestamp:     msg.Timestamp,
+		Body:          msg.Body,
+	}
+}
+
+// waitForConnection returns the current connection, waiting while the broker reconnects. It returns
+// nil once the broker is closed or ctx is cancelled.
+func (mb *MessageBroker) waitForConnection(ctx context.Context) *amqp.Connection {
+	// Wake the wait below when ctx is cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			mb.mu.Lock()
+			mb.cond.Broadcast()
+			mb.mu.Unlock()
+		case <-done:
 		}
+	}()
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	for !mb.closed && ctx.Err() == nil && (mb.conn == nil || mb.conn.IsClosed()) {
+		mb.cond.Wait()
 	}
+	if mb.closed || ctx.Err() != nil {
+		return nil
+	}
+	return mb.conn
 }
 
-// Close closes the connection and channel to the RabbitMQ broker.
-func (mb *MessageBroker) Close() {
-	mb.channel.Close()
-	mb.conn.Close()
+// consume opens a channel of its own for consuming, so that a failing consumer does not take the
+// publish channel down with it. It returns the channel, the consumer tag and the deliveries.
+func (mb *MessageBroker) consume(conn *amqp.Connection, prefetch int) (*amqp.Channel, string, <-chan amqp.Delivery, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	if err := channel.Qos(prefetch, 0, false); err != nil {
+		channel.Close()
+		return nil, "", nil, err
+	}
+
+	tag := fmt.Sprintf("%s-%d-%d", mb.config.QueueName, os.Getpid(), atomic.AddUint64(&consumerCount, 1))
+	msgs, err := channel.Consume(
+		mb.config.QueueName, // queue
+		tag,                 // consumer
+		false,               // auto-ack
+		false,               // exclusive
+		false,               // no-local
+		false,               // no-wait
+		nil,
+	)
+	if err != nil {
+		channel.Close()
+		return nil, "", nil, err
+	}
+	return channel, tag, msgs, nil
 }
 
-func ProcessMessage(message []byte) error {
-	log.Printf("Following list of email are sent: %s\n", message)
-	return nil
+// consumerCount keeps the consumer tags of a process unique.
+var consumerCount uint64
+
+// Close closes the connection and channel to the RabbitMQ broker and stops reconnecting.
+func (mb *MessageBroker) Close() {
+	mb.mu.Lock()
+	mb.closed = true
+	conn := mb.conn
+	mb.cond.Broadcast()
+	mb.mu.Unlock()
+
+	if conn != nil {
+		conn.Close()
+	}
 }
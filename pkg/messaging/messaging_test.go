@@ -1,35 +1,174 @@
 package messaging
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/streadway/amqp"
 	"github.com/stretchr/testify/assert"
+	conf "github.com/tigerhall-kittens/config"
+	"github.com/tigerhall-kittens/pkg/events"
+	"github.com/tigerhall-kittens/pkg/models"
 )
 
 // mockMessageBroker is a mock implementation of the MessageBroker interface.
 type mockMessageBroker struct {
-	publishedMessage []byte
-	consumeFunc      func([]byte) error
+	publishedEvent events.Envelope
+	consumeFunc    func([]byte) error
 }
 
-func (m *mockMessageBroker) PublishMessage(message []byte) error {
-	m.publishedMessage = message
+func (m *mockMessageBroker) PublishEvent(event events.Envelope) error {
+	m.publishedEvent = event
 	return nil
 }
 
-func (m *mockMessageBroker) ConsumeMessages(processMessage func([]byte) error) {
+func (m *mockMessageBroker) ConsumeMessages(ctx context.Context, processMessage func([]byte) error, opts ...ConsumeOption) {
 	m.consumeFunc = processMessage
 }
 
-func TestMessageBroker_PublishMessage(t *testing.T) {
+func TestMessageBroker_PublishEvent(t *testing.T) {
 	// Create the mock message broker
 	mockBroker := &mockMessageBroker{}
 
-	// Publish a test message
-	message := []byte("Test Message")
-	err := mockBroker.PublishMessage(message)
+	// Publish a test event
+	event, err := events.NewTigerCreated(&models.Tiger{ID: 1, Name: "Sher Khan"}, time.Now())
 	assert.NoError(t, err)
+	err = mockBroker.PublishEvent(event)
+	assert.NoError(t, err)
+
+	// Assert that the event was published correctly
+	assert.Equal(t, event, mockBroker.publishedEvent)
+}
+
+func TestNewPublishing(t *testing.T) {
+	occurredAt := time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC)
+	event, err := events.NewSightingCreated(&models.Tiger{ID: 1, Name: "Sher Khan"}, &models.TigerSighting{ID: 2, TigerID: 1}, occurredAt)
+	assert.NoError(t, err)
+
+	publishing, err := NewPublishing(event)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json", publishing.ContentType)
+	assert.Equal(t, amqp.Persistent, publishing.DeliveryMode)
+	assert.Equal(t, event.ID, publishing.MessageId)
+	assert.Equal(t, event.CorrelationID, publishing.CorrelationId)
+	assert.Equal(t, events.SightingCreated, publishing.Type)
+	assert.Equal(t, occurredAt, publishing.Timestamp)
+	assert.Equal(t, int32(events.Version), publishing.Headers["version"])
+
+	var decoded events.Envelope
+	assert.NoError(t, json.Unmarshal(publishing.Body, &decoded))
+	var data events.SightingCreatedData
+	assert.NoError(t, decoded.Decode(&data))
+	assert.Equal(t, 2, data.SightingID)
+	assert.Equal(t, "Sher Khan", data.TigerName)
+}
+
+func TestAwaitConfirm(t *testing.T) {
+	t.Run("acknowledged", func(t *testing.T) {
+		confirms := make(chan amqp.Confirmation, 1)
+		confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: true}
+
+		assert.NoError(t, awaitConfirm(confirms, 1, time.Second))
+	})
+
+	t.Run("skips late confirmations of earlier messages", func(t *testing.T) {
+		confirms := make(chan amqp.Confirmation, 2)
+		confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: false}
+		confirms <- amqp.Confirmation{DeliveryTag: 2, Ack: true}
+
+		assert.NoError(t, awaitConfirm(confirms, 2, time.Second))
+	})
+
+	t.Run("refused", func(t *testing.T) {
+		confirms := make(chan amqp.Confirmation, 1)
+		confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: false}
+
+		assert.EqualError(t, awaitConfirm(confirms, 1, time.Second), "RabbitMQ refused the message")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		confirms := make(chan amqp.Confirmation)
+
+		err := awaitConfirm(confirms, 1, 10*time.Millisecond)
+
+		assert.ErrorIs(t, err, ErrNotConfirmed)
+	})
+
+	t.Run("channel closed", func(t *testing.T) {
+		confirms := make(chan amqp.Confirmation)
+		close(confirms)
+
+		err := awaitConfirm(confirms, 1, time.Second)
+
+		assert.ErrorIs(t, err, ErrNotConfirmed)
+	})
+}
+
+func TestNextBackoff(t *testing.T) {
+	assert.Equal(t, 2*time.Second, nextBackoff(time.Second, 30*time.Second))
+	assert.Equal(t, 30*time.Second, nextBackoff(20*time.Second, 30*time.Second))
+	assert.Equal(t, 30*time.Second, nextBackoff(30*time.Second, 30*time.Second))
+}
+
+func TestMessageBroker_FailureRoute(t *testing.T) {
+	mb := &MessageBroker{config: conf.RabbitMq{
+		QueueName:           "notifications",
+		DeadLetterQueue:     "notifications.dead",
+		MaxDeliveryAttempts: 3,
+		RetryBackoff:        time.Second,
+		MaxRetryBackoff:     time.Minute,
+	}}
+	now := time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC)
+	msg := amqp.Delivery{
+		MessageId: "event-1",
+		Type:      events.EmailRequested,
+		Headers:   amqp.Table{"version": int32(1)},
+		Body:      []byte(`{"id":"event-1"}`),
+	}
+
+	queue, publishing := mb.failureRoute(msg, errors.New("boom"), now)
+
+	assert.Equal(t, "notifications.retry.1s", queue)
+	assert.Equal(t, int32(1), publishing.Headers["attempts"])
+	assert.Equal(t, int32(1), publishing.Headers["version"], "The other headers should be kept")
+	assert.Equal(t, "event-1", publishing.MessageId)
+	assert.Equal(t, msg.Body, publishing.Body)
+	assert.NotContains(t, msg.Headers, "attempts", "The delivered message should not change")
+
+	msg.Headers = publishing.Headers
+	queue, publishing = mb.failureRoute(msg, errors.New("boom"), now)
+
+	assert.Equal(t, "notifications.retry.2s", queue, "The wait should double")
+	assert.Equal(t, int32(2), publishing.Headers["attempts"])
+
+	msg.Headers = publishing.Headers
+	queue, publishing = mb.failureRoute(msg, errors.New("boom"), now)
+
+	assert.Equal(t, "notifications.dead", queue, "The message should be dead-lettered after the last attempt")
+	letter := newDeadLetter(amqp.Delivery{MessageId: "event-1", Headers: publishing.Headers, Body: publishing.Body})
+	assert.Equal(t, 3, letter.Attempts)
+	assert.Equal(t, "boom", letter.LastError)
+	assert.Equal(t, now, letter.DeadLetteredAt)
+	assert.Equal(t, `{"id":"event-1"}`, letter.Body)
+}
+
+func TestRetryDelay(t *testing.T) {
+	config := conf.RabbitMq{RetryBackoff: 5 * time.Second, MaxRetryBackoff: 30 * time.Second}
+
+	assert.Equal(t, 5*time.Second, retryDelay(config, 1))
+	assert.Equal(t, 10*time.Second, retryDelay(config, 2))
+	assert.Equal(t, 20*time.Second, retryDelay(config, 3))
+	assert.Equal(t, 30*time.Second, retryDelay(config, 4))
+	assert.Equal(t, 30*time.Second, retryDelay(config, 10))
+}
 
-	// Assert that the message was published correctly
-	assert.Equal(t, message, mockBroker.publishedMessage)
+func TestAttemptsOf(t *testing.T) {
+	assert.Equal(t, 0, attemptsOf(nil))
+	assert.Equal(t, 0, attemptsOf(amqp.Table{"attempts": "two"}))
+	assert.Equal(t, 2, attemptsOf(amqp.Table{"attempts": int32(2)}))
+	assert.Equal(t, 2, attemptsOf(amqp.Table{"attempts": int64(2)}))
 }
@@ -0,0 +1,182 @@
+// Package migrate applies the SQL migrations in the migrations directory. It reads the goose file
+// format and records the applied versions in the goose_db_version table, so that databases migrated
+// with the goose command line tool and with this package stay interchangeable.
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migration is one migration file.
+type Migration struct {
+	Version int64
+	Name    string
+	// Up is the SQL of the Up section
+	Up string
+}
+
+// fileName matches migration files such as 20230730004420_create_all_tables.sql.
+var fileName = regexp.MustCompile(`^(\d+)_.+\.sql$`)
+
+// Load reads the migrations in dir, ordered by version.
+func Load(dir string) ([]Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %v", err)
+	}
+
+	var migrations []Migration
+	for _, file := range files {
+		match := fileName.FindStringSubmatch(file.Name())
+		if file.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version of migration %s: %v", file.Name(), err)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %v", file.Name(), err)
+		}
+		up, err := upSection(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration %s: %v", file.Name(), err)
+		}
+		migrations = append(migrations, Migration{Version: version, Name: file.Name(), Up: up})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", migrations[i-1].Name, migrations[i].Name)
+		}
+	}
+	return migrations, nil
+}
+
+// upSection returns the lines between the "-- +goose Up" and "-- +goose Down" annotations.
+func upSection(data []byte) (string, error) {
+	var up strings.Builder
+	inUp, found := false, false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch strings.TrimSpace(line) {
+		case "-- +goose Up":
+			inUp, found = true, true
+			continue
+		case "-- +goose Down":
+			inUp = false
+			continue
+		}
+		if inUp {
+			up.WriteString(line)
+			up.WriteString("\n")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("missing %q annotation", "-- +goose Up")
+	}
+	return up.String(), nil
+}
+
+// Up applies the migrations in dir that are not applied yet, each in a transaction of its own, and
+// returns the versions it applied.
+func Up(db *sql.DB, dir string) ([]int64, error) {
+	migrations, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(`
+        CREATE TABLE IF NOT EXISTS goose_db_version (
+            id SERIAL PRIMARY KEY,
+            version_id BIGINT NOT NULL,
+            is_applied BOOLEAN NOT NULL,
+            tstamp TIMESTAMP DEFAULT NOW()
+        )
+    `); err != nil {
+		return nil, fmt.Errorf("failed to create migration version table: %v", err)
+	}
+
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int64
+	for _, migration := range migrations {
+		if applied[migration.Version] {
+			continue
+		}
+		if err := apply(db, migration); err != nil {
+			return done, err
+		}
+		done = append(done, migration.Version)
+	}
+	return done, nil
+}
+
+// appliedVersions returns the versions whose latest record marks them applied. Goose records a
+// rollback as a new row instead of deleting the earlier one.
+func appliedVersions(db *sql.DB) (map[int64]bool, error) {
+	rows, err := db.Query(`SELECT version_id, is_applied FROM goose_db_version ORDER BY id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %v", err)
+	}
+	defer rows.Close()
+
+	seen := map[int64]bool{}
+	applied := map[int64]bool{}
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		if err := rows.Scan(&version, &isApplied); err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %v", err)
+		}
+		if seen[version] {
+			continue
+		}
+		seen[version] = true
+		applied[version] = isApplied
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %v", err)
+	}
+	return applied, nil
+}
+
+func apply(db *sql.DB, migration Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Without arguments the whole section is sent at once, so it may hold several statements
+	if _, err := tx.Exec(migration.Up); err != nil {
+		return fmt.Errorf("failed to apply migration %s: %v", migration.Name, err)
+	}
+	if _, err := tx.Exec(`INSERT INTO goose_db_version (version_id, is_applied) VALUES ($1, TRUE)`, migration.Version); err != nil {
+		return fmt.Errorf("failed to record migration %s: %v", migration.Name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %s: %v", migration.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package migrate
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeMigrations(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write migration: %v", err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeMigrations(t, map[string]string{
+		"2_add_index.sql": "-- +goose Up\nCREATE INDEX idx ON t (a);\n\n-- +goose Down\nDROP INDEX idx;\n",
+		"1_create.sql":    "-- +goose Up\nCREATE TABLE t (a INT);\n-- +goose Down\nDROP TABLE t;\n",
+		"dbconf.yml":      "development:\n  driver: postgres\n",
+	})
+
+	migrations, err := Load(dir)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Migration{
+		{Version: 1, Name: "1_create.sql", Up: "CREATE TABLE t (a INT);\n"},
+		{Version: 2, Name: "2_add_index.sql", Up: "CREATE INDEX idx ON t (a);\n\n"},
+	}, migrations)
+}
+
+func TestLoad_MissingUpSection(t *testing.T) {
+	dir := writeMigrations(t, map[string]string{"1_create.sql": "CREATE TABLE t (a INT);\n"})
+
+	_, err := Load(dir)
+
+	assert.EqualError(t, err, `invalid migration 1_create.sql: missing "-- +goose Up" annotation`)
+}
+
+func TestLoad_RepositoryMigrations(t *testing.T) {
+	migrations, err := Load("../../migrations")
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrations)
+	for _, migration := range migrations {
+		assert.NotContains(t, migration.Up, "DROP TABLE IF EXISTS users", "The Down section should be left out of %s", migration.Name)
+	}
+}
+
+func TestUp(t *testing.T) {
+	dir := writeMigrations(t, map[string]string{
+		"1_create.sql":     "-- +goose Up\nCREATE TABLE t (a INT);\n",
+		"2_add_index.sql":  "-- +goose Up\nCREATE INDEX idx ON t (a);\n",
+		"3_add_column.sql": "-- +goose Up\nALTER TABLE t ADD COLUMN b INT;\n",
+	})
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS goose_db_version").WillReturnResult(sqlmock.NewResult(0, 0))
+	// Version 2 was applied and rolled back again
+	mock.ExpectQuery("SELECT version_id, is_applied FROM goose_db_version").
+		WillReturnRows(sqlmock.NewRows([]string{"version_id", "is_applied"}).
+			AddRow(2, false).
+			AddRow(2, true).
+			AddRow(1, true))
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE INDEX idx").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO goose_db_version").WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("ALTER TABLE t ADD COLUMN b").WillReturnError(errors.New("column b already exists"))
+	mock.ExpectRollback()
+
+	applied, err := Up(db, dir)
+
+	assert.EqualError(t, err, "failed to apply migration 3_add_column.sql: column b already exists")
+	assert.Equal(t, []int64{2}, applied, "The migrations before the failure should stay applied")
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+package models
+
+// BoundingBox is an area between two latitudes and two longitudes.
+type BoundingBox struct {
+	MinLat  float64 `json:"minLat"`
+	MinLong float64 `json:"minLong"`
+	MaxLat  float64 `json:"maxLat"`
+	MaxLong float64 `json:"maxLong"`
+}
+
+// Center returns the middle of the bounding box.
+func (b BoundingBox) Center() Coordinates {
+	return Coordinates{Lat: (b.MinLat + b.MaxLat) / 2, Long: (b.MinLong + b.MaxLong) / 2}
+}
+
+// NearbySighting is a sighting found by an area search with its distance from the search center.
+type NearbySighting struct {
+	TigerSighting
+	DistanceKm float64 `json:"distanceKm"`
+}
+
+// AreaSearchResult holds the sightings found in an area, nearest first, and the distinct tigers they belong to.
+type AreaSearchResult struct {
+	Sightings []*NearbySighting `json:"sightings"`
+	Tigers    []*Tiger          `json:"tigers"`
+}
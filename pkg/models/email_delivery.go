@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// DeliveryStatus is the outcome of sending a notification email.
+type DeliveryStatus string
+
+const (
+	// DeliveryScheduled emails are held back for quiet hours or a digest until DeliverAfter
+	DeliveryScheduled DeliveryStatus = "scheduled"
+	// DeliveryPending emails are being sent, or failed for a reason given by LastError and are tried
+	// again when the message broker delivers their message again
+	DeliveryPending DeliveryStatus = "pending"
+	DeliverySent    DeliveryStatus = "sent"
+	// DeliveryFailed means every attempt failed, or the mail server refused the email for good
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// EmailDelivery records a notification email sent to one recipient.
+type EmailDelivery struct {
+	ID int `json:"id"`
+	// EventID is the event that requested the email; it is empty for messages published before events
+	EventID   string `json:"-"`
+	Recipient string `json:"recipient"`
+	Subject   string `json:"subject"`
+	// Body, Link and Reason are kept for scheduled emails, which are rendered when they are sent
+	Body      string         `json:"-"`
+	Link      string         `json:"-"`
+	Reason    string         `json:"-"`
+	Status    DeliveryStatus `json:"status"`
+	Attempts  int            `json:"attempts"`
+	LastError string         `json:"lastError,omitempty"`
+	CreatedAt time.Time      `json:"createdAt"`
+	// DeliverAfter is when a scheduled email is due
+	DeliverAfter *time.Time `json:"deliverAfter,omitempty"`
+	SentAt       *time.Time `json:"sentAt,omitempty"`
+}
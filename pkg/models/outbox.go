@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// OutboxStatus tells whether an event in the outbox has been published.
+type OutboxStatus string
+
+const (
+	OutboxPending   OutboxStatus = "pending"
+	OutboxPublished OutboxStatus = "published"
+)
+
+// OutboxMessage is an event waiting in the outbox to be published to the message broker.
+type OutboxMessage struct {
+	ID        int64  `json:"id"`
+	EventID   string `json:"eventID"`
+	EventType string `json:"eventType"`
+	// Payload is the JSON encoded events.Envelope
+	Payload   []byte       `json:"-"`
+	Status    OutboxStatus `json:"status"`
+	Attempts  int          `json:"attempts"`
+	LastError string       `json:"lastError,omitempty"`
+	// NextAttemptAt is when the relay tries to publish a pending event again
+	NextAttemptAt time.Time  `json:"nextAttemptAt"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	PublishedAt   *time.Time `json:"publishedAt,omitempty"`
+}
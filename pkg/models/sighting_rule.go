@@ -0,0 +1,10 @@
+package models
+
+// SightingRule overrides the configured proximity rule for a single tiger.
+// Nil fields fall back to the configured defaults.
+type SightingRule struct {
+	TigerID           int      `json:"tigerID"`
+	MinDistanceKm     *float64 `json:"minDistanceKm,omitempty"`
+	TimeWindowSeconds *int     `json:"timeWindowSeconds,omitempty"`
+	Action            *string  `json:"action,omitempty"`
+}
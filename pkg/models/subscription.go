@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// AreaSubscription asks for a notification of any sighting within RadiusKm of a point.
+type AreaSubscription struct {
+	ID     int `json:"id"`
+	UserID int `json:"-"`
+	// Email is the address of the subscriber, filled in when looking up who to notify of a sighting
+	Email     string    `json:"-"`
+	Lat       float64   `json:"lat"`
+	Long      float64   `json:"long"`
+	RadiusKm  float64   `json:"radiusKm"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Subscriptions lists the tigers and areas a user is notified about.
+type Subscriptions struct {
+	TigerIDs []int               `json:"tigerIDs"`
+	Areas    []*AreaSubscription `json:"areas"`
+}
+
+// ChannelEmail sends notifications by email.
+const ChannelEmail = "email"
+
+// NotificationPreferences decide how and when a user is notified of sightings.
+type NotificationPreferences struct {
+	UserID int    `json:"-"`
+	Email  string `json:"-"`
+	// Channels lists where notifications are sent; an empty list turns them off
+	Channels []string `json:"channels"`
+	// Timezone is the IANA time zone of the quiet hours and the digest time
+	Timezone string `json:"timezone"`
+	// QuietHoursStart and QuietHoursEnd are "HH:MM" times between which notifications are held
+	// back until the end of the quiet hours. Both are empty when there are none.
+	QuietHoursStart string `json:"quietHoursStart,omitempty"`
+	QuietHoursEnd   string `json:"quietHoursEnd,omitempty"`
+	// Digest collects the notifications of a day into one email sent at DigestTime
+	Digest     bool   `json:"digest"`
+	DigestTime string `json:"digestTime"`
+}
+
+// DefaultNotificationPreferences apply to users who have not set their own.
+func DefaultNotificationPreferences() NotificationPreferences {
+	return NotificationPreferences{Channels: []string{ChannelEmail}, Timezone: "UTC", DigestTime: "08:00"}
+}
@@ -9,9 +9,35 @@ type Tiger struct {
 	LastSeen    time.Time `json:"last_seen"`
 	Lat         float64   `json:"lat"`
 	Long        float64   `json:"long"`
+	CreatedBy   int       `json:"created_by,omitempty"`
+	// Protected tigers have their coordinates and those of their sightings coarsened in public responses
+	Protected bool `json:"protected"`
+}
+
+// TigerUpdate holds the tiger fields that can be corrected after creation.
+// Nil fields are left unchanged.
+type TigerUpdate struct {
+	Name        *string    `json:"name"`
+	DateOfBirth *time.Time `json:"date_of_birth"`
+	Protected   *bool      `json:"protected"`
 }
 
 type Coordinates struct {
 	Lat  float64 `json:"lat"`
 	Long float64 `json:"long"`
 }
+
+// SightingSummary aggregates the sightings reported for a single tiger.
+type SightingSummary struct {
+	TotalSightings    int         `json:"totalSightings"`
+	FirstSighting     *time.Time  `json:"firstSighting,omitempty"`
+	LatestSighting    *time.Time  `json:"latestSighting,omitempty"`
+	DistinctReporters int         `json:"distinctReporters"`
+	LastKnownLocation Coordinates `json:"lastKnownLocation"`
+}
+
+// TigerProfile is a tiger together with a summary of its sightings.
+type TigerProfile struct {
+	Tiger
+	SightingSummary SightingSummary `json:"sightingSummary"`
+}
@@ -5,12 +5,62 @@ import (
 )
 
 type TigerSighting struct {
-	ID            int       `json:"id"`
-	TigerID       int       `json:"tigerID"`
-	Timestamp     time.Time `json:"timestamp"`
-	Lat           float64   `json:"lat"`
-	Long          float64   `json:"long"`
-	Image         []byte    `json:"image,omitempty"`
-	ImageFile     string    `json:"imageFile,omitempty"`
-	ReporterEmail string    `json:"reporterEmail"`
+	ID        int       `json:"id"`
+	TigerID   int       `json:"tigerID"`
+	Timestamp time.Time `json:"timestamp"`
+	Lat       float64   `json:"lat"`
+	Long      float64   `json:"long"`
+	// Images hold the uploaded images until they are written to the image store
+	Images     [][]byte `json:"-"`
+	HasImage   bool     `json:"hasImage"`
+	ImageCount int      `json:"imageCount"`
+	// ImageURL links to the first image of the sighting
+	ImageURL string `json:"imageURL,omitempty"`
+	// StoredImages locate the uploaded images once they are in the image store
+	StoredImages []*SightingImage `json:"-"`
+	// ReporterEmail is left empty, and out of the JSON, where the caller may not see who reported the sighting
+	ReporterEmail string `json:"reporterEmail,omitempty"`
+	// Flags records why the sighting was accepted but marked for review
+	Flags []string `json:"flags,omitempty"`
 }
+
+// SightingImage locates an image of a sighting in the image store.
+type SightingImage struct {
+	// ID is zero for images of older sightings that are still kept in the database
+	ID         int    `json:"id"`
+	SightingID int    `json:"sightingID"`
+	TigerID    int    `json:"tigerID"`
+	Key        string `json:"-"`
+	SHA256     string `json:"sha256"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	// DHash is the difference hash of the image, zero until it has been computed
+	DHash uint64 `json:"-"`
+	// Data holds the image bytes, either read from the image store or kept in the
+	// database by sightings created before images were moved out of it
+	Data []byte `json:"-"`
+	// URL is a signed link to the image, for stores that can serve it directly
+	URL string `json:"-"`
+	// ImageURL is the route that serves the image
+	ImageURL string `json:"imageURL,omitempty"`
+}
+
+// SimilarImage is an image of another sighting that looks like one of the images of a sighting.
+type SimilarImage struct {
+	SightingImage
+	// MatchedImageID is the image of the sighting that it looks like
+	MatchedImageID int `json:"matchedImageID"`
+	// Distance is the number of differing bits of the two image hashes, out of 64
+	Distance int `json:"distance"`
+}
+
+// ImageSize selects the original upload of a sighting image or one of the renditions derived from it.
+type ImageSize string
+
+const (
+	ImageSizeOriginal ImageSize = "original"
+	// ImageSizeMedium fits within 1024x1024 pixels, keeping the aspect ratio
+	ImageSizeMedium ImageSize = "medium"
+	// ImageSizeThumb is cropped to fill 250x200 pixels
+	ImageSizeThumb ImageSize = "thumb"
+)
@@ -0,0 +1,318 @@
+// Package notifier sends the notification emails that the service publishes to the message broker
+// and records the outcome of every delivery.
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/textproto"
+	"strings"
+	"time"
+
+	conf "github.com/tigerhall-kittens/config"
+	"github.com/tigerhall-kittens/pkg/events"
+	"github.com/tigerhall-kittens/pkg/models"
+	"github.com/tigerhall-kittens/pkg/utils"
+)
+
+// Email is a rendered notification for a single recipient.
+type Email struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// EmailSender delivers emails.
+type EmailSender interface {
+	Send(email Email) error
+}
+
+// Deliveries keeps a record of every email sent.
+type Deliveries interface {
+	CreateEmailDelivery(delivery *models.EmailDelivery) error
+	GetEmailDeliveries(eventID string) ([]*models.EmailDelivery, error)
+	UpdateEmailDelivery(delivery *models.EmailDelivery) error
+	ClaimDueEmailDeliveries(now, leaseUntil time.Time, limit int) ([]*models.EmailDelivery, error)
+}
+
+// scheduledBatchSize bounds the number of scheduled emails sent per run of the scheduler.
+const scheduledBatchSize = 500
+
+// DefaultLease is used when the configuration leaves the lease out.
+const DefaultLease = 5 * time.Minute
+
+// FromConfig builds the email sender selected in the configuration.
+func FromConfig(config conf.Notifications) (EmailSender, error) {
+	switch config.Driver {
+	case "smtp":
+		return NewSMTPSender(config.SMTP)
+	case "log":
+		return LogSender{}, nil
+	default:
+		return nil, fmt.Errorf("notification driver must be %q or %q, got %q", "smtp", "log", config.Driver)
+	}
+}
+
+// RetryPolicy decides how often a scheduled email is tried, once per run of the scheduler. The emails
+// sent as their message arrives are tried again when the message broker delivers it again.
+type RetryPolicy struct {
+	MaxAttempts int
+}
+
+// Notifier turns the messages published for new sightings into emails.
+type Notifier struct {
+	sender     EmailSender
+	deliveries Deliveries
+	retry      RetryPolicy
+	lease      time.Duration
+	now        func() time.Time
+}
+
+// NewNotifier builds a notifier. The scheduled emails claimed by a run of the scheduler are kept from
+// other runs for the lease, after which the ones whose outcome was not recorded are claimed again.
+func NewNotifier(sender EmailSender, deliveries Deliveries, retry RetryPolicy, lease time.Duration) *Notifier {
+	if retry.MaxAttempts < 1 {
+		retry.MaxAttempts = 1
+	}
+	if lease <= 0 {
+		lease = DefaultLease
+	}
+	return &Notifier{
+		sender:     sender,
+		deliveries: deliveries,
+		retry:      retry,
+		lease:      lease,
+		now:        time.Now,
+	}
+}
+
+// ProcessMessage sends one email for each utils.EmailTemplate of an events.EmailRequested event. It is
+// meant to be passed to messaging.Subscriber.ConsumeMessages.
+//
+// Each email is tried once. The message fails when an email failed for a reason that may pass, so
+// that the message broker delivers it again after its retry delay; the deliveries recorded for the
+// event then tell which recipients got their email already, and only the others are tried again.
+func (n *Notifier) ProcessMessage(message []byte) error {
+	eventID, templates, err := decodeEmails(message)
+	if err != nil {
+		// A malformed message can never be processed, so it is dropped instead of being requeued forever
+		log.Printf("dropping malformed notification message: %v", err)
+		return nil
+	}
+
+	earlier := map[string]*models.EmailDelivery{}
+	if eventID != "" {
+		deliveries, err := n.deliveries.GetEmailDeliveries(eventID)
+		if err != nil {
+			return fmt.Errorf("failed to get the email deliveries of event %s: %v", eventID, err)
+		}
+		for _, delivery := range deliveries {
+			earlier[strings.ToLower(delivery.Recipient)] = delivery
+		}
+	}
+
+	var failed []string
+	for _, tmpl := range templates {
+		if tmpl.Recipient == "" {
+			continue
+		}
+		delivery := earlier[strings.ToLower(tmpl.Recipient)]
+		if delivery != nil && delivery.Status != models.DeliveryPending {
+			continue
+		}
+		if err := n.deliver(eventID, tmpl, delivery); err != nil && !isPermanent(err) {
+			failed = append(failed, tmpl.Recipient)
+		}
+	}
+
+	// Without an event ID the emails that were sent cannot be told apart, so the message is not retried
+	if len(failed) > 0 && eventID != "" {
+		return fmt.Errorf("failed to send the emails to %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// decodeEmails reads the ID of the event and the emails it requests. Other events bound to the queue
+// carry no emails. Bare arrays of emails, as published before events were introduced, are still read
+// so that the messages queued during an upgrade are not lost; they have no event ID.
+func decodeEmails(message []byte) (string, []utils.EmailTemplate, error) {
+	if trimmed := bytes.TrimSpace(message); len(trimmed) > 0 && trimmed[0] == '[' {
+		var templates []utils.EmailTemplate
+		err := json.Unmarshal(trimmed, &templates)
+		return "", templates, err
+	}
+
+	var event events.Envelope
+	if err := json.Unmarshal(message, &event); err != nil {
+		return "", nil, err
+	}
+	if event.Type != events.EmailRequested {
+		return "", nil, nil
+	}
+	var data events.EmailRequestedData
+	if err := event.Decode(&data); err != nil {
+		return "", nil, err
+	}
+	return event.ID, data.Emails, nil
+}
+
+// deliver renders and sends the email once, recording its delivery, and returns why it was not sent.
+// The delivery of an earlier attempt is reused. Emails held back for the quiet hours or the digest of
+// the recipient are only recorded, and sent by SendScheduled once they are due.
+func (n *Notifier) deliver(eventID string, tmpl utils.EmailTemplate, delivery *models.EmailDelivery) error {
+	if delivery == nil && tmpl.DeliverAfter != nil && tmpl.DeliverAfter.After(n.now()) && n.schedule(eventID, tmpl) {
+		return nil
+	}
+
+	if delivery == nil {
+		delivery = &models.EmailDelivery{EventID: eventID, Recipient: tmpl.Recipient, Subject: tmpl.Sub, Status: models.DeliveryPending}
+		if err := n.deliveries.CreateEmailDelivery(delivery); err != nil {
+			// The email matters more to the reporter than the record of it
+			log.Printf("failed to record email delivery to %s: %v", tmpl.Recipient, err)
+		}
+	}
+
+	email, err := Render(tmpl)
+	if err == nil {
+		err = n.send(delivery, email)
+	}
+
+	// The email is tried again when the message is, which only happens for events
+	retryStatus := models.DeliveryPending
+	if eventID == "" {
+		retryStatus = models.DeliveryFailed
+	}
+	n.finish([]*models.EmailDelivery{delivery}, err, retryStatus)
+	return err
+}
+
+// schedule records the email to be sent later and reports whether it was recorded.
+func (n *Notifier) schedule(eventID string, tmpl utils.EmailTemplate) bool {
+	delivery := &models.EmailDelivery{
+		EventID:      eventID,
+		Recipient:    tmpl.Recipient,
+		Subject:      tmpl.Sub,
+		Body:         tmpl.Body,
+		Link:         tmpl.Link,
+		Reason:       tmpl.Reason,
+		Status:       models.DeliveryScheduled,
+		DeliverAfter: tmpl.DeliverAfter,
+	}
+	if err := n.deliveries.CreateEmailDelivery(delivery); err != nil {
+		// Without the record the email would be lost, so it is sent right away instead
+		log.Printf("failed to schedule email to %s, sending it now: %v", tmpl.Recipient, err)
+		return false
+	}
+	return true
+}
+
+// SendScheduled sends the scheduled emails that are due. The emails due to the same recipient are
+// combined into a single digest.
+func (n *Notifier) SendScheduled() error {
+	now := n.now()
+	due, err := n.deliveries.ClaimDueEmailDeliveries(now, now.Add(n.lease), scheduledBatchSize)
+	if err != nil {
+		return err
+	}
+
+	var recipients []string
+	byRecipient := map[string][]*models.EmailDelivery{}
+	for _, delivery := range due {
+		recipient := strings.ToLower(delivery.Recipient)
+		if _, ok := byRecipient[recipient]; !ok {
+			recipients = append(recipients, recipient)
+		}
+		byRecipient[recipient] = append(byRecipient[recipient], delivery)
+	}
+
+	for _, recipient := range recipients {
+		deliveries := byRecipient[recipient]
+		email, err := RenderDigest(deliveries)
+		if err == nil {
+			err = n.send(deliveries[0], email)
+		}
+		for _, delivery := range deliveries[1:] {
+			delivery.Attempts = deliveries[0].Attempts
+		}
+
+		// A digest that failed is tried again by a later run, until the attempts run out
+		retryStatus := models.DeliveryScheduled
+		if deliveries[0].Attempts >= n.retry.MaxAttempts {
+			retryStatus = models.DeliveryFailed
+		}
+		n.finish(deliveries, err, retryStatus)
+	}
+	return nil
+}
+
+// RunScheduler sends the scheduled emails that are due every interval until ctx is cancelled.
+func (n *Notifier) RunScheduler(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := n.SendScheduled(); err != nil {
+			log.Printf("failed to send scheduled emails: %v", err)
+		}
+	}
+}
+
+// finish records the outcome of sending an email for each of the deliveries it covers. An email that
+// failed for a reason that may pass gets retryStatus.
+func (n *Notifier) finish(deliveries []*models.EmailDelivery, err error, retryStatus models.DeliveryStatus) {
+	sentAt := n.now()
+	for _, delivery := range deliveries {
+		if err != nil {
+			log.Printf("attempt %d to send email to %s failed: %v", delivery.Attempts, delivery.Recipient, err)
+			delivery.Status = retryStatus
+			if isPermanent(err) {
+				delivery.Status = models.DeliveryFailed
+			}
+			delivery.LastError = err.Error()
+		} else {
+			delivery.Status = models.DeliverySent
+			delivery.SentAt = &sentAt
+		}
+
+		if delivery.ID == 0 {
+			continue
+		}
+		if err := n.deliveries.UpdateEmailDelivery(delivery); err != nil {
+			log.Printf("failed to update email delivery %d: %v", delivery.ID, err)
+		}
+	}
+}
+
+// send makes one attempt to send the email.
+func (n *Notifier) send(delivery *models.EmailDelivery, email Email) error {
+	delivery.Attempts++
+	return n.sender.Send(email)
+}
+
+// isPermanent reports whether the mail server refused the email in a way that retrying cannot fix,
+// such as an unknown mailbox.
+func isPermanent(err error) bool {
+	var smtpErr *textproto.Error
+	return errors.As(err, &smtpErr) && smtpErr.Code >= 500
+}
+
+// LogSender only logs emails, for development without a mail server.
+type LogSender struct{}
+
+func (LogSender) Send(email Email) error {
+	log.Printf("email to %s: %s\n%s", email.To, email.Subject, email.Text)
+	return nil
+}
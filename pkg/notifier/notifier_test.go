@@ -0,0 +1,302 @@
+package notifier
+
+import (
+	"encoding/json"
+	"errors"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tigerhall-kittens/pkg/events"
+	"github.com/tigerhall-kittens/pkg/models"
+	"github.com/tigerhall-kittens/pkg/utils"
+)
+
+// fakeSender fails the first failures emails to each recipient with err.
+type fakeSender struct {
+	failures map[string]int
+	err      error
+	sent     []Email
+}
+
+func (f *fakeSender) Send(email Email) error {
+	if f.failures[email.To] > 0 {
+		f.failures[email.To]--
+		return f.err
+	}
+	f.sent = append(f.sent, email)
+	return nil
+}
+
+// fakeDeliveries keeps the latest state of every delivery record, and when the claim of each
+// pending one runs out.
+type fakeDeliveries struct {
+	records []models.EmailDelivery
+	leases  map[int]time.Time
+}
+
+func (f *fakeDeliveries) CreateEmailDelivery(delivery *models.EmailDelivery) error {
+	delivery.ID = len(f.records) + 1
+	f.records = append(f.records, *delivery)
+	return nil
+}
+
+func (f *fakeDeliveries) GetEmailDeliveries(eventID string) ([]*models.EmailDelivery, error) {
+	var deliveries []*models.EmailDelivery
+	for _, record := range f.records {
+		if record.EventID == eventID {
+			delivery := record
+			deliveries = append(deliveries, &delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (f *fakeDeliveries) UpdateEmailDelivery(delivery *models.EmailDelivery) error {
+	f.records[delivery.ID-1] = *delivery
+	delete(f.leases, delivery.ID)
+	return nil
+}
+
+func (f *fakeDeliveries) ClaimDueEmailDeliveries(now, leaseUntil time.Time, limit int) ([]*models.EmailDelivery, error) {
+	if f.leases == nil {
+		f.leases = map[int]time.Time{}
+	}
+	var due []*models.EmailDelivery
+	for i := range f.records {
+		record := &f.records[i]
+		lease, claimed := f.leases[record.ID]
+		scheduled := record.Status == models.DeliveryScheduled && !record.DeliverAfter.After(now)
+		expired := record.Status == models.DeliveryPending && claimed && !lease.After(now)
+		if (scheduled || expired) && len(due) < limit {
+			record.Status = models.DeliveryPending
+			f.leases[record.ID] = leaseUntil
+			delivery := *record
+			due = append(due, &delivery)
+		}
+	}
+	return due, nil
+}
+
+func testMessage(t *testing.T, recipients ...string) []byte {
+	var templates []utils.EmailTemplate
+	for _, recipient := range recipients {
+		templates = append(templates, utils.EmailTemplate{Sub: "Tiger Sights", Body: "Tiger_1 is found", Recipient: recipient})
+	}
+	return emailMessage(t, templates)
+}
+
+// emailMessage publishes the emails as the service does.
+func emailMessage(t *testing.T, templates []utils.EmailTemplate) []byte {
+	event, err := events.NewEmailRequested(templates, time.Now(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func TestNotifier_ProcessMessage_RetriesTemporaryFailures(t *testing.T) {
+	sender := &fakeSender{failures: map[string]int{"a@example.com": 2}, err: errors.New("connection refused")}
+	deliveries := &fakeDeliveries{}
+	notifier := NewNotifier(sender, deliveries, RetryPolicy{MaxAttempts: 3}, time.Minute)
+	message := testMessage(t, "a@example.com", "b@example.com")
+
+	// The message fails until every email is sent, so that the message broker delivers it again
+	assert.EqualError(t, notifier.ProcessMessage(message), "failed to send the emails to a@example.com")
+	assert.Error(t, notifier.ProcessMessage(message))
+	assert.NoError(t, notifier.ProcessMessage(message))
+
+	assert.Len(t, sender.sent, 2, "Each recipient should get the email once")
+	if assert.Len(t, deliveries.records, 2, "A delivery should be recorded once per recipient") {
+		assert.Equal(t, models.DeliverySent, deliveries.records[0].Status)
+		assert.Equal(t, 3, deliveries.records[0].Attempts)
+		assert.NotNil(t, deliveries.records[0].SentAt)
+		assert.Equal(t, 1, deliveries.records[1].Attempts)
+	}
+}
+
+func TestNotifier_ProcessMessage_RecordsFailures(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus models.DeliveryStatus
+		expectedErr    bool
+	}{
+		{"temporary failure", errors.New("connection refused"), models.DeliveryPending, true},
+		{"refused mailbox", &textproto.Error{Code: 550, Msg: "no such mailbox"}, models.DeliveryFailed, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sender := &fakeSender{failures: map[string]int{"a@example.com": 5}, err: test.err}
+			deliveries := &fakeDeliveries{}
+			notifier := NewNotifier(sender, deliveries, RetryPolicy{MaxAttempts: 3}, time.Minute)
+
+			err := notifier.ProcessMessage(testMessage(t, "a@example.com", "b@example.com"))
+
+			// A refused mailbox cannot be fixed by delivering the message again
+			assert.Equal(t, test.expectedErr, err != nil)
+			assert.Len(t, sender.sent, 1)
+			if assert.Len(t, deliveries.records, 2) {
+				assert.Equal(t, test.expectedStatus, deliveries.records[0].Status)
+				assert.Equal(t, 1, deliveries.records[0].Attempts, "An email should be tried once per message")
+				assert.Equal(t, test.err.Error(), deliveries.records[0].LastError)
+				assert.Equal(t, models.DeliverySent, deliveries.records[1].Status)
+			}
+		})
+	}
+}
+
+func TestNotifier_ProcessMessage_DropsMalformedMessage(t *testing.T) {
+	sender := &fakeSender{}
+	deliveries := &fakeDeliveries{}
+	notifier := NewNotifier(sender, deliveries, RetryPolicy{MaxAttempts: 3}, time.Minute)
+
+	err := notifier.ProcessMessage([]byte("Following list of email are sent"))
+
+	assert.NoError(t, err, "A message that can never be processed should not be requeued")
+	assert.Empty(t, sender.sent)
+	assert.Empty(t, deliveries.records)
+}
+
+func TestNotifier_ProcessMessage_IgnoresOtherEvents(t *testing.T) {
+	sender := &fakeSender{}
+	notifier := NewNotifier(sender, &fakeDeliveries{}, RetryPolicy{MaxAttempts: 1}, time.Minute)
+
+	event, err := events.NewSightingCreated(&models.Tiger{ID: 1, Name: "Sher Khan"}, &models.TigerSighting{ID: 2, TigerID: 1}, time.Now())
+	assert.NoError(t, err)
+	message, err := json.Marshal(event)
+	assert.NoError(t, err)
+
+	assert.NoError(t, notifier.ProcessMessage(message))
+	assert.Empty(t, sender.sent, "Events other than email requests should not send emails")
+}
+
+func TestNotifier_ProcessMessage_ReadsLegacyMessages(t *testing.T) {
+	sender := &fakeSender{}
+	notifier := NewNotifier(sender, &fakeDeliveries{}, RetryPolicy{MaxAttempts: 1}, time.Minute)
+
+	// Messages queued before the upgrade are bare arrays of emails
+	message, err := json.Marshal([]utils.EmailTemplate{{Sub: "Tiger Sights", Body: "Tiger_1 is found", Recipient: "a@example.com"}})
+	assert.NoError(t, err)
+
+	assert.NoError(t, notifier.ProcessMessage(message))
+	assert.Len(t, sender.sent, 1)
+}
+
+func TestRender(t *testing.T) {
+	email, err := Render(utils.EmailTemplate{Sub: "Tiger Sights", Body: "Tiger_<b>1</b> is found", Recipient: "a@example.com"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "a@example.com", email.To)
+	assert.Equal(t, "Tiger Sights", email.Subject)
+	assert.Contains(t, email.Text, "Tiger_<b>1</b> is found")
+	assert.Contains(t, email.HTML, "Tiger_&lt;b&gt;1&lt;/b&gt; is found", "The HTML version should escape the body")
+}
+
+func TestRender_Link(t *testing.T) {
+	email, err := Render(utils.EmailTemplate{Sub: "New sighting of Sher Khan", Body: "Sher Khan was sighted", Recipient: "a@example.com", Link: "http://localhost:8080/tiger/1/sightings"})
+
+	assert.NoError(t, err)
+	assert.Contains(t, email.Text, "See the sightings of this tiger: http://localhost:8080/tiger/1/sightings")
+	assert.Contains(t, email.HTML, `<a href="http://localhost:8080/tiger/1/sightings">`)
+}
+
+func TestNotifier_SendScheduled_CombinesDigest(t *testing.T) {
+	sender := &fakeSender{}
+	deliveries := &fakeDeliveries{}
+	notifier := NewNotifier(sender, deliveries, RetryPolicy{MaxAttempts: 3}, time.Minute)
+	now := time.Date(2023, time.July, 21, 23, 0, 0, 0, time.UTC)
+	notifier.now = func() time.Time { return now }
+
+	// Two sightings during the quiet hours of a@example.com, which end at 07:00
+	deliverAfter := time.Date(2023, time.July, 22, 7, 0, 0, 0, time.UTC)
+	for _, body := range []string{"Sher Khan was sighted", "Bagheera was sighted"} {
+		message := emailMessage(t, []utils.EmailTemplate{
+			{Sub: "New sighting", Body: body, Recipient: "a@example.com", Link: "http://localhost:8080/tiger/1/sightings", DeliverAfter: &deliverAfter},
+			{Sub: "New sighting", Body: body, Recipient: "b@example.com"},
+		})
+		assert.NoError(t, notifier.ProcessMessage(message))
+	}
+	assert.Len(t, sender.sent, 2, "Only the emails that are not held back should be sent right away")
+
+	// Nothing is due before the quiet hours end
+	assert.NoError(t, notifier.SendScheduled())
+	assert.Len(t, sender.sent, 2)
+
+	now = deliverAfter
+	assert.NoError(t, notifier.SendScheduled())
+
+	if assert.Len(t, sender.sent, 3, "The held back emails should be combined into one") {
+		digest := sender.sent[2]
+		assert.Equal(t, "a@example.com", digest.To)
+		assert.Equal(t, "2 new tiger sightings", digest.Subject)
+		assert.Contains(t, digest.Text, "- Sher Khan was sighted")
+		assert.Contains(t, digest.Text, "- Bagheera was sighted")
+		assert.Contains(t, digest.HTML, "<li>Bagheera was sighted")
+	}
+	for _, record := range deliveries.records {
+		assert.Equal(t, models.DeliverySent, record.Status, "Every delivery should be recorded as sent")
+	}
+}
+
+func TestNotifier_SendScheduled_RetriesOnLaterRuns(t *testing.T) {
+	sender := &fakeSender{failures: map[string]int{"a@example.com": 5}, err: errors.New("connection refused")}
+	deliveries := &fakeDeliveries{}
+	notifier := NewNotifier(sender, deliveries, RetryPolicy{MaxAttempts: 2}, time.Minute)
+	now := time.Date(2023, time.July, 21, 23, 0, 0, 0, time.UTC)
+	notifier.now = func() time.Time { return now }
+
+	deliverAfter := now.Add(time.Hour)
+	message := emailMessage(t, []utils.EmailTemplate{{Sub: "New sighting", Body: "Sher Khan was sighted", Recipient: "a@example.com", DeliverAfter: &deliverAfter}})
+	assert.NoError(t, notifier.ProcessMessage(message))
+	now = deliverAfter
+
+	assert.NoError(t, notifier.SendScheduled())
+	assert.Equal(t, models.DeliveryScheduled, deliveries.records[0].Status, "The email should be tried again by the next run")
+	assert.NoError(t, notifier.SendScheduled())
+	assert.Equal(t, models.DeliveryFailed, deliveries.records[0].Status, "The email should fail once the attempts run out")
+	assert.Equal(t, 2, deliveries.records[0].Attempts)
+
+	assert.NoError(t, notifier.SendScheduled())
+	assert.Equal(t, 2, deliveries.records[0].Attempts, "A failed email should not be tried again")
+}
+
+func TestNotifier_SendScheduled_ReclaimsAfterLease(t *testing.T) {
+	sender := &fakeSender{}
+	deliveries := &fakeDeliveries{}
+	notifier := NewNotifier(sender, deliveries, RetryPolicy{MaxAttempts: 3}, time.Minute)
+	now := time.Date(2023, time.July, 21, 23, 0, 0, 0, time.UTC)
+	notifier.now = func() time.Time { return now }
+
+	deliverAfter := now.Add(time.Hour)
+	message := emailMessage(t, []utils.EmailTemplate{{Sub: "New sighting", Body: "Sher Khan was sighted", Recipient: "a@example.com", DeliverAfter: &deliverAfter}})
+	assert.NoError(t, notifier.ProcessMessage(message))
+	now = deliverAfter
+
+	// A run that stops after claiming the email never records whether it was sent
+	claimed, err := deliveries.ClaimDueEmailDeliveries(now, now.Add(time.Minute), scheduledBatchSize)
+	assert.NoError(t, err)
+	assert.Len(t, claimed, 1)
+
+	assert.NoError(t, notifier.SendScheduled())
+	assert.Empty(t, sender.sent, "The email should be left to the run that claimed it while the lease lasts")
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, notifier.SendScheduled())
+	assert.Len(t, sender.sent, 1, "The email should be claimed again once the lease runs out")
+	assert.Equal(t, models.DeliverySent, deliveries.records[0].Status)
+}
+
+func TestRender_Reason(t *testing.T) {
+	email, err := Render(utils.EmailTemplate{Sub: "New sighting of Sher Khan", Body: "Sher Khan was sighted", Recipient: "a@example.com", Reason: "you subscribed to this tiger"})
+
+	assert.NoError(t, err)
+	assert.Contains(t, email.Text, "You receive this email because you subscribed to this tiger.")
+	assert.Contains(t, email.HTML, "You receive this email because you subscribed to this tiger.")
+}
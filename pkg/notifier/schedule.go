@@ -0,0 +1,102 @@
+package notifier
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tigerhall-kittens/pkg/models"
+)
+
+// clockLayout is the format of the times of day in notification preferences.
+const clockLayout = "15:04"
+
+// ValidatePreferences checks that the channels are known and that the time zone and times of day can be read.
+func ValidatePreferences(prefs models.NotificationPreferences) error {
+	for _, channel := range prefs.Channels {
+		if channel != models.ChannelEmail {
+			return fmt.Errorf("unknown channel %q, the only channel is %q", channel, models.ChannelEmail)
+		}
+	}
+	if _, err := time.LoadLocation(prefs.Timezone); err != nil || prefs.Timezone == "" {
+		return fmt.Errorf("unknown time zone %q", prefs.Timezone)
+	}
+	if (prefs.QuietHoursStart == "") != (prefs.QuietHoursEnd == "") {
+		return errors.New("quiet hours need both a start and an end")
+	}
+	clocks := []string{prefs.DigestTime}
+	if prefs.QuietHoursStart != "" {
+		clocks = append(clocks, prefs.QuietHoursStart, prefs.QuietHoursEnd)
+	}
+	for _, clock := range clocks {
+		if _, err := time.Parse(clockLayout, clock); err != nil {
+			return fmt.Errorf("times must be given as HH:MM, got %q", clock)
+		}
+	}
+	return nil
+}
+
+// HasChannel reports whether the user wants notifications sent over the channel.
+func HasChannel(prefs models.NotificationPreferences, channel string) bool {
+	for _, c := range prefs.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// DeliverAfter returns when a notification created at now may be sent to the user: the next digest
+// time for digests, the end of the quiet hours during them, and the zero time when it can be sent
+// right away. Preferences that cannot be read send it right away.
+func DeliverAfter(prefs models.NotificationPreferences, now time.Time) time.Time {
+	loc, err := time.LoadLocation(prefs.Timezone)
+	if err != nil {
+		return time.Time{}
+	}
+	local := now.In(loc)
+
+	if prefs.Digest {
+		digestTime, err := time.Parse(clockLayout, prefs.DigestTime)
+		if err != nil {
+			return time.Time{}
+		}
+		return nextClock(local, digestTime)
+	}
+
+	if prefs.QuietHoursStart == "" {
+		return time.Time{}
+	}
+	start, err := time.Parse(clockLayout, prefs.QuietHoursStart)
+	if err != nil {
+		return time.Time{}
+	}
+	end, err := time.Parse(clockLayout, prefs.QuietHoursEnd)
+	if err != nil {
+		return time.Time{}
+	}
+
+	// Quiet hours such as 22:00 to 07:00 run past midnight
+	minute, startMinute, endMinute := minuteOfDay(local), minuteOfDay(start), minuteOfDay(end)
+	quiet := minute >= startMinute && minute < endMinute
+	if startMinute > endMinute {
+		quiet = minute >= startMinute || minute < endMinute
+	}
+	if !quiet {
+		return time.Time{}
+	}
+	return nextClock(local, end)
+}
+
+// nextClock returns the first time after local at the time of day of clock, in UTC.
+func nextClock(local, clock time.Time) time.Time {
+	next := time.Date(local.Year(), local.Month(), local.Day(), clock.Hour(), clock.Minute(), 0, 0, local.Location())
+	if !next.After(local) {
+		next = time.Date(local.Year(), local.Month(), local.Day()+1, clock.Hour(), clock.Minute(), 0, 0, local.Location())
+	}
+	return next.UTC()
+}
+
+func minuteOfDay(t time.Time) int {
+	return t.Hour()*60 + t.Minute()
+}
@@ -0,0 +1,81 @@
+package notifier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tigerhall-kittens/pkg/models"
+)
+
+func TestDeliverAfter(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	quiet := models.DefaultNotificationPreferences()
+	quiet.Timezone = "Asia/Kolkata"
+	quiet.QuietHoursStart = "22:00"
+	quiet.QuietHoursEnd = "07:00"
+
+	daytime := models.DefaultNotificationPreferences()
+	daytime.QuietHoursStart = "12:00"
+	daytime.QuietHoursEnd = "14:00"
+
+	digest := models.DefaultNotificationPreferences()
+	digest.Timezone = "Asia/Kolkata"
+	digest.Digest = true
+
+	tests := []struct {
+		name     string
+		prefs    models.NotificationPreferences
+		now      time.Time
+		expected time.Time
+	}{
+		{"no quiet hours", models.DefaultNotificationPreferences(), time.Date(2023, time.July, 21, 3, 0, 0, 0, time.UTC), time.Time{}},
+		{"before midnight in quiet hours", quiet, time.Date(2023, time.July, 21, 23, 0, 0, 0, kolkata), time.Date(2023, time.July, 22, 7, 0, 0, 0, kolkata).UTC()},
+		{"after midnight in quiet hours", quiet, time.Date(2023, time.July, 22, 6, 59, 0, 0, kolkata), time.Date(2023, time.July, 22, 7, 0, 0, 0, kolkata).UTC()},
+		{"outside quiet hours", quiet, time.Date(2023, time.July, 22, 7, 0, 0, 0, kolkata), time.Time{}},
+		{"in daytime quiet hours", daytime, time.Date(2023, time.July, 21, 13, 0, 0, 0, time.UTC), time.Date(2023, time.July, 21, 14, 0, 0, 0, time.UTC)},
+		{"after daytime quiet hours", daytime, time.Date(2023, time.July, 21, 14, 30, 0, 0, time.UTC), time.Time{}},
+		{"digest later today", digest, time.Date(2023, time.July, 21, 6, 0, 0, 0, kolkata), time.Date(2023, time.July, 21, 8, 0, 0, 0, kolkata).UTC()},
+		{"digest tomorrow", digest, time.Date(2023, time.July, 21, 9, 0, 0, 0, kolkata), time.Date(2023, time.July, 22, 8, 0, 0, 0, kolkata).UTC()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, DeliverAfter(test.prefs, test.now))
+		})
+	}
+}
+
+func TestValidatePreferences(t *testing.T) {
+	valid := models.DefaultNotificationPreferences()
+	valid.QuietHoursStart = "22:00"
+	valid.QuietHoursEnd = "07:00"
+	assert.NoError(t, ValidatePreferences(valid))
+
+	off := models.DefaultNotificationPreferences()
+	off.Channels = []string{}
+	assert.NoError(t, ValidatePreferences(off), "Notifications can be turned off")
+
+	tests := []struct {
+		name   string
+		change func(*models.NotificationPreferences)
+	}{
+		{"unknown channel", func(p *models.NotificationPreferences) { p.Channels = []string{"sms"} }},
+		{"unknown time zone", func(p *models.NotificationPreferences) { p.Timezone = "Mars/Olympus_Mons" }},
+		{"quiet hours without end", func(p *models.NotificationPreferences) { p.QuietHoursStart = "22:00" }},
+		{"invalid time", func(p *models.NotificationPreferences) { p.QuietHoursStart, p.QuietHoursEnd = "10pm", "07:00" }},
+		{"missing digest time", func(p *models.NotificationPreferences) { p.DigestTime = "" }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prefs := models.DefaultNotificationPreferences()
+			test.change(&prefs)
+			assert.Error(t, ValidatePreferences(prefs))
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package notifier
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	conf "github.com/tigerhall-kittens/config"
+)
+
+// SMTPSender sends emails through a mail server. The connection is upgraded with STARTTLS when the
+// server offers it.
+type SMTPSender struct {
+	addr string
+	auth smtp.Auth
+	from *mail.Address
+	now  func() time.Time
+}
+
+func NewSMTPSender(config conf.SMTP) (*SMTPSender, error) {
+	if config.Host == "" || config.Port == 0 {
+		return nil, errors.New("SMTP sender needs a host and a port")
+	}
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP sender address %q: %v", config.From, err)
+	}
+
+	// net/smtp refuses to send the password without TLS, except to localhost
+	var auth smtp.Auth
+	if config.Username != "" {
+		auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+
+	return &SMTPSender{
+		addr: net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+		auth: auth,
+		from: from,
+		now:  time.Now,
+	}, nil
+}
+
+func (s *SMTPSender) Send(email Email) error {
+	to, err := mail.ParseAddress(email.To)
+	if err != nil {
+		// Retrying cannot fix the address, so this is reported like a refused mailbox
+		return &textproto.Error{Code: 553, Msg: fmt.Sprintf("invalid recipient address %q", email.To)}
+	}
+
+	message, err := s.buildMessage(to, email)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(s.addr, s.auth, s.from.Address, []string{to.Address}, message)
+}
+
+// buildMessage writes the email as a multipart/alternative message, so that mail clients show the
+// HTML version and fall back to the plain text one.
+func (s *SMTPSender) buildMessage(to *mail.Address, email Email) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", email.Text},
+		{"text/html; charset=utf-8", email.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", s.from.String())
+	fmt.Fprintf(&message, "To: %s\r\n", to.String())
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", s.now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/alternative; boundary=%s\r\n", parts.Boundary())
+	fmt.Fprintf(&message, "\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
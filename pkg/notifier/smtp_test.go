@@ -0,0 +1,178 @@
+package notifier
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	conf "github.com/tigerhall-kittens/config"
+)
+
+// fakeSMTP is a minimal SMTP server that keeps the messages it receives. Mail to recipients in
+// rejected is refused with a permanent error.
+type fakeSMTP struct {
+	listener net.Listener
+	rejected map[string]bool
+	mu       sync.Mutex
+	messages []receivedMail
+}
+
+type receivedMail struct {
+	from string
+	to   []string
+	data string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeSMTP{listener: listener, rejected: map[string]bool{}}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost fake SMTP")
+
+	var current receivedMail
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			tp.PrintfLine("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			current = receivedMail{from: strings.Trim(line[len("MAIL FROM:"):], "<>")}
+			tp.PrintfLine("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			recipient := strings.Trim(line[len("RCPT TO:"):], "<>")
+			if f.rejected[recipient] {
+				tp.PrintfLine("550 no such mailbox")
+				continue
+			}
+			current.to = append(current.to, recipient)
+			tp.PrintfLine("250 OK")
+		case command == "DATA":
+			tp.PrintfLine("354 end data with <CR><LF>.<CR><LF>")
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			current.data = string(data)
+			f.mu.Lock()
+			f.messages = append(f.messages, current)
+			f.mu.Unlock()
+			tp.PrintfLine("250 OK")
+		case command == "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func (f *fakeSMTP) config() conf.SMTP {
+	addr := f.listener.Addr().(*net.TCPAddr)
+	return conf.SMTP{Host: addr.IP.String(), Port: addr.Port, From: "Tigerhall Kittens <no-reply@example.com>"}
+}
+
+func TestSMTPSender_Send(t *testing.T) {
+	server := newFakeSMTP(t)
+	sender, err := NewSMTPSender(server.config())
+	assert.NoError(t, err)
+
+	err = sender.Send(Email{To: "reporter@example.com", Subject: "Tiger Sights", Text: "Tiger_1 is found", HTML: "<p>Tiger_1 is found</p>"})
+	assert.NoError(t, err)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if !assert.Len(t, server.messages, 1) {
+		return
+	}
+	received := server.messages[0]
+	assert.Equal(t, "no-reply@example.com", received.from)
+	assert.Equal(t, []string{"reporter@example.com"}, received.to)
+
+	// Both versions of the email should arrive as alternatives
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(received.data)))
+	assert.NoError(t, err)
+	assert.Equal(t, "Tiger Sights", msg.Header.Get("Subject"))
+	assert.Equal(t, `"Tigerhall Kittens" <no-reply@example.com>`, msg.Header.Get("From"))
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	var contentTypes, contents []string
+	for {
+		part, err := parts.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.NoError(t, err)
+		content, err := io.ReadAll(part)
+		assert.NoError(t, err)
+		contentTypes = append(contentTypes, part.Header.Get("Content-Type"))
+		contents = append(contents, string(content))
+	}
+	assert.Equal(t, []string{"text/plain; charset=utf-8", "text/html; charset=utf-8"}, contentTypes)
+	assert.Equal(t, []string{"Tiger_1 is found", "<p>Tiger_1 is found</p>"}, contents)
+}
+
+func TestSMTPSender_RejectedRecipientIsPermanent(t *testing.T) {
+	server := newFakeSMTP(t)
+	server.rejected["gone@example.com"] = true
+	sender, err := NewSMTPSender(server.config())
+	assert.NoError(t, err)
+
+	err = sender.Send(Email{To: "gone@example.com", Subject: "Tiger Sights", Text: "text", HTML: "html"})
+	assert.Error(t, err)
+	assert.True(t, isPermanent(err), "A refused mailbox should not be retried")
+}
+
+func TestSMTPSender_UnreachableServerIsTemporary(t *testing.T) {
+	server := newFakeSMTP(t)
+	config := server.config()
+	server.listener.Close()
+	sender, err := NewSMTPSender(config)
+	assert.NoError(t, err)
+
+	err = sender.Send(Email{To: "reporter@example.com", Subject: "Tiger Sights", Text: "text", HTML: "html"})
+	assert.Error(t, err)
+	assert.False(t, isPermanent(err), "A mail server that is down should be retried")
+}
+
+func TestNewSMTPSender_InvalidConfig(t *testing.T) {
+	_, err := NewSMTPSender(conf.SMTP{Port: 25, From: "no-reply@example.com"})
+	assert.Error(t, err, "A host is required")
+
+	_, err = NewSMTPSender(conf.SMTP{Host: "localhost", Port: 25, From: "not an address"})
+	assert.Error(t, err, "The sender address must be valid")
+}
@@ -0,0 +1,58 @@
+package notifier
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+
+	"github.com/tigerhall-kittens/pkg/models"
+	"github.com/tigerhall-kittens/pkg/utils"
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+var (
+	textTemplate       = texttemplate.Must(texttemplate.ParseFS(templateFiles, "templates/notification.txt.tmpl"))
+	digestTextTemplate = texttemplate.Must(texttemplate.ParseFS(templateFiles, "templates/digest.txt.tmpl"))
+	// The HTML templates escape the subjects and bodies, which include user input such as tiger names
+	htmlTemplate       = htmltemplate.Must(htmltemplate.ParseFS(templateFiles, "templates/notification.html.tmpl"))
+	digestHTMLTemplate = htmltemplate.Must(htmltemplate.ParseFS(templateFiles, "templates/digest.html.tmpl"))
+)
+
+// Render builds the plain text and HTML versions of a notification email.
+func Render(tmpl utils.EmailTemplate) (Email, error) {
+	var text, html bytes.Buffer
+	if err := textTemplate.Execute(&text, tmpl); err != nil {
+		return Email{}, err
+	}
+	if err := htmlTemplate.Execute(&html, tmpl); err != nil {
+		return Email{}, err
+	}
+	return Email{To: tmpl.Recipient, Subject: tmpl.Sub, Text: text.String(), HTML: html.String()}, nil
+}
+
+// RenderDigest builds a single email from scheduled emails to the same recipient. A single email is
+// rendered as it would have been sent right away.
+func RenderDigest(deliveries []*models.EmailDelivery) (Email, error) {
+	if len(deliveries) == 1 {
+		delivery := deliveries[0]
+		return Render(utils.EmailTemplate{Sub: delivery.Subject, Body: delivery.Body, Recipient: delivery.Recipient, Link: delivery.Link, Reason: delivery.Reason})
+	}
+
+	digest := struct {
+		Sub   string
+		Items []*models.EmailDelivery
+	}{Sub: fmt.Sprintf("%d new tiger sightings", len(deliveries)), Items: deliveries}
+
+	var text, html bytes.Buffer
+	if err := digestTextTemplate.Execute(&text, digest); err != nil {
+		return Email{}, err
+	}
+	if err := digestHTMLTemplate.Execute(&html, digest); err != nil {
+		return Email{}, err
+	}
+	return Email{To: deliveries[0].Recipient, Subject: digest.Sub, Text: text.String(), HTML: html.String()}, nil
+}
@@ -0,0 +1,172 @@
+// Package outbox delivers events at least once. The service writes each event to the outbox table in
+// the same transaction as the change it describes, and the Relay publishes the pending events to the
+// message broker, retrying with backoff until the broker takes them.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/tigerhall-kittens/pkg/events"
+	"github.com/tigerhall-kittens/pkg/models"
+	"github.com/tigerhall-kittens/pkg/repository"
+)
+
+// Publisher sends events to the message broker.
+type Publisher interface {
+	PublishEvent(event events.Envelope) error
+}
+
+// Enqueue writes the event to the outbox of the transaction behind repo. The event is published once
+// the transaction commits, and never if it is rolled back.
+func Enqueue(repo repository.Queries, event events.Envelope) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %v", event.Type, err)
+	}
+
+	msg := &models.OutboxMessage{EventID: event.ID, EventType: event.Type, Payload: payload}
+	if err := repo.CreateOutboxMessage(msg); err != nil {
+		log.Println("error on DB outbox message create " + err.Error())
+		return errors.New("failed to record event")
+	}
+	return nil
+}
+
+// RetryPolicy decides when the relay tries to publish an event again.
+type RetryPolicy struct {
+	// Backoff is the wait before the second attempt; it doubles with every further attempt
+	Backoff time.Duration
+	// MaxBackoff caps the wait, so that events are still published soon after a long outage
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is used when the configuration leaves the backoff out.
+var DefaultRetryPolicy = RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Minute}
+
+// wait returns the wait after the given number of failed attempts.
+func (p RetryPolicy) wait(attempts int) time.Duration {
+	wait := p.Backoff
+	for i := 1; i < attempts && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	return wait
+}
+
+// DefaultLease is used when the configuration leaves the lease out.
+const DefaultLease = time.Minute
+
+// Relay publishes the events waiting in the outbox.
+type Relay struct {
+	repo      repository.TigerRepository
+	publisher Publisher
+	retry     RetryPolicy
+	batchSize int
+	lease     time.Duration
+	now       func() time.Time
+}
+
+// NewRelay builds a relay that publishes up to batchSize events per run. The events of a run are kept
+// from the relays of other instances for lease, which must outlast publishing a batch; an event that
+// is not done by then may be published twice.
+func NewRelay(repo repository.TigerRepository, publisher Publisher, retry RetryPolicy, batchSize int, lease time.Duration) *Relay {
+	if retry.Backoff <= 0 {
+		retry.Backoff = DefaultRetryPolicy.Backoff
+	}
+	if retry.MaxBackoff < retry.Backoff {
+		retry.MaxBackoff = retry.Backoff
+	}
+	if batchSize < 1 {
+		batchSize = 100
+	}
+	if lease <= 0 {
+		lease = DefaultLease
+	}
+	return &Relay{repo: repo, publisher: publisher, retry: retry, batchSize: batchSize, lease: lease, now: time.Now}
+}
+
+// PublishPending publishes the events that are due and returns how many were published. The events
+// are claimed for the lease before they are published, so relays in other instances skip them without
+// a transaction staying open while the broker confirms them.
+func (r *Relay) PublishPending() (int, error) {
+	now := r.now()
+	due, err := r.repo.ClaimDueOutboxMessages(now, now.Add(r.lease), r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+	if len(due) == 0 {
+		return 0, nil
+	}
+
+	published := 0
+	for _, msg := range due {
+		if err := r.publish(msg); err != nil {
+			msg.Attempts++
+			msg.LastError = err.Error()
+			msg.NextAttemptAt = r.now().Add(r.retry.wait(msg.Attempts))
+			log.Printf("failed to publish %s event %s (attempt %d), retrying at %s: %v",
+				msg.EventType, msg.EventID, msg.Attempts, msg.NextAttemptAt.Format(time.RFC3339), err)
+		} else {
+			publishedAt := r.now()
+			msg.Attempts++
+			msg.Status = models.OutboxPublished
+			msg.PublishedAt = &publishedAt
+			published++
+		}
+	}
+
+	err = r.repo.WithTx(func(repo repository.TigerRepository) error {
+		for _, msg := range due {
+			if err := repo.UpdateOutboxMessage(msg); err != nil {
+				// The events are published again once the lease runs out, which at-least-once delivery allows
+				return err
+			}
+		}
+		return nil
+	})
+	return published, err
+}
+
+func (r *Relay) publish(msg *models.OutboxMessage) error {
+	var event events.Envelope
+	if err := json.Unmarshal(msg.Payload, &event); err != nil {
+		return fmt.Errorf("failed to decode event: %v", err)
+	}
+	return r.publisher.PublishEvent(event)
+}
+
+// Run publishes the pending events every interval until ctx is cancelled. The events left pending are
+// published by the next relay that runs.
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Keep going while full batches come back, so that a backlog drains without waiting for the ticker
+		for ctx.Err() == nil {
+			published, err := r.PublishPending()
+			if err != nil {
+				log.Printf("failed to relay outbox events: %v", err)
+				break
+			}
+			if published < r.batchSize {
+				break
+			}
+		}
+	}
+}
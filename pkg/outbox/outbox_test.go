@@ -0,0 +1,189 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tigerhall-kittens/pkg/events"
+	"github.com/tigerhall-kittens/pkg/models"
+	"github.com/tigerhall-kittens/pkg/repository"
+)
+
+// fakeOutbox keeps the outbox in memory. The methods the relay does not use are left to the embedded
+// nil repository.
+type fakeOutbox struct {
+	repository.TigerRepository
+	messages []*models.OutboxMessage
+	inTx     bool
+}
+
+func (f *fakeOutbox) WithTx(fn func(repository.TigerRepository) error) error {
+	f.inTx = true
+	defer func() { f.inTx = false }()
+	return fn(f)
+}
+
+func (f *fakeOutbox) CreateOutboxMessage(msg *models.OutboxMessage) error {
+	msg.ID = int64(len(f.messages) + 1)
+	msg.Status = models.OutboxPending
+	stored := *msg
+	f.messages = append(f.messages, &stored)
+	return nil
+}
+
+func (f *fakeOutbox) ClaimDueOutboxMessages(now, leaseUntil time.Time, limit int) ([]*models.OutboxMessage, error) {
+	var due []*models.OutboxMessage
+	for _, msg := range f.messages {
+		if msg.Status == models.OutboxPending && !msg.NextAttemptAt.After(now) && len(due) < limit {
+			msg.NextAttemptAt = leaseUntil
+			claimed := *msg
+			due = append(due, &claimed)
+		}
+	}
+	return due, nil
+}
+
+func (f *fakeOutbox) UpdateOutboxMessage(msg *models.OutboxMessage) error {
+	stored := *msg
+	f.messages[msg.ID-1] = &stored
+	return nil
+}
+
+// fakePublisher fails while err is set, and calls onPublish first if it is set.
+type fakePublisher struct {
+	err       error
+	published []events.Envelope
+	onPublish func()
+}
+
+func (f *fakePublisher) PublishEvent(event events.Envelope) error {
+	if f.onPublish != nil {
+		f.onPublish()
+	}
+	if f.err != nil {
+		return f.err
+	}
+	f.published = append(f.published, event)
+	return nil
+}
+
+func TestRelay_PublishPending_RetriesWithBackoff(t *testing.T) {
+	repo := &fakeOutbox{}
+	publisher := &fakePublisher{err: errors.New("connection refused")}
+	relay := NewRelay(repo, publisher, RetryPolicy{Backoff: time.Second, MaxBackoff: 3 * time.Second}, 10, time.Minute)
+	now := time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC)
+	relay.now = func() time.Time { return now }
+
+	event, err := events.NewTigerCreated(&models.Tiger{ID: 1, Name: "Sher Khan"}, now)
+	assert.NoError(t, err)
+	assert.NoError(t, Enqueue(repo, event))
+
+	// The broker is down: the wait doubles with every attempt up to the maximum
+	for _, wait := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		published, err := relay.PublishPending()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, published)
+		assert.Equal(t, now.Add(wait), repo.messages[0].NextAttemptAt)
+		assert.Equal(t, "connection refused", repo.messages[0].LastError)
+
+		// Nothing is attempted before the event is due again
+		published, err = relay.PublishPending()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, published)
+		now = now.Add(wait)
+	}
+
+	// The broker is back
+	publisher.err = nil
+	published, err := relay.PublishPending()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, published)
+	if assert.Len(t, publisher.published, 1) {
+		assert.Equal(t, event.ID, publisher.published[0].ID)
+	}
+	assert.Equal(t, models.OutboxPublished, repo.messages[0].Status)
+	assert.Equal(t, 4, repo.messages[0].Attempts, "Every attempt should be recorded")
+	assert.Equal(t, now, *repo.messages[0].PublishedAt)
+
+	// Published events are not published again
+	published, err = relay.PublishPending()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, published)
+}
+
+func TestRelay_PublishPending_InOrder(t *testing.T) {
+	repo := &fakeOutbox{}
+	publisher := &fakePublisher{}
+	relay := NewRelay(repo, publisher, DefaultRetryPolicy, 2, DefaultLease)
+
+	for i := 1; i <= 3; i++ {
+		event, err := events.NewTigerCreated(&models.Tiger{ID: i}, time.Now())
+		assert.NoError(t, err)
+		assert.NoError(t, Enqueue(repo, event))
+	}
+
+	published, err := relay.PublishPending()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, published, "A run should publish at most a batch")
+	published, err = relay.PublishPending()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, published)
+
+	for i, msg := range repo.messages {
+		assert.Equal(t, msg.EventID, publisher.published[i].ID, "Events should be published in the order they were written")
+	}
+}
+
+func TestRelay_PublishPending_LeasesClaimedEvents(t *testing.T) {
+	repo := &fakeOutbox{}
+	now := time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC)
+	other := NewRelay(repo, &fakePublisher{}, DefaultRetryPolicy, 10, time.Minute)
+	other.now = func() time.Time { return now }
+
+	publisher := &fakePublisher{}
+	publisher.onPublish = func() {
+		assert.False(t, repo.inTx, "No transaction should stay open while the event is published")
+		published, err := other.PublishPending()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, published, "Another relay should skip the claimed event")
+	}
+	relay := NewRelay(repo, publisher, DefaultRetryPolicy, 10, time.Minute)
+	relay.now = func() time.Time { return now }
+
+	event, err := events.NewTigerCreated(&models.Tiger{ID: 1, Name: "Sher Khan"}, now)
+	assert.NoError(t, err)
+	assert.NoError(t, Enqueue(repo, event))
+
+	published, err := relay.PublishPending()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.Equal(t, models.OutboxPublished, repo.messages[0].Status)
+}
+
+func TestRelay_Run_StopsWhenCancelled(t *testing.T) {
+	repo := &fakeOutbox{}
+	publisher := &fakePublisher{}
+	relay := NewRelay(repo, publisher, DefaultRetryPolicy, 10, DefaultLease)
+
+	event, err := events.NewTigerCreated(&models.Tiger{ID: 1, Name: "Sher Khan"}, time.Now())
+	assert.NoError(t, err)
+	assert.NoError(t, Enqueue(repo, event))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	publisher.onPublish = cancel
+	go func() {
+		defer close(done)
+		relay.Run(ctx, time.Millisecond)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run should return once ctx is cancelled")
+	}
+	assert.Len(t, publisher.published, 1, "The events claimed before the cancellation should still be published")
+}
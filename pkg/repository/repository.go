@@ -1,22 +1,116 @@
 package repository
 
 import (
+	"database/sql"
+	"fmt"
+	"time"
+
 	"github.com/tigerhall-kittens/pkg/models"
 	"github.com/tigerhall-kittens/pkg/repository/store"
 )
 
-type TigerRepository interface {
+// ErrUserNotFound is returned by GetUserByEmail when no user has the email.
+var ErrUserNotFound = store.ErrUserNotFound
+
+// Queries are the data access methods shared by the repository and the
+// repositories handed out by WithTx.
+type Queries interface {
 	CreateUser(user *models.User) error
 	GetUserByEmail(email string) (*models.User, error)
 	CreateTiger(tiger *models.Tiger) error
+	GetTigerByID(tigerID int) (*models.Tiger, error)
+	GetTigersByIDs(tigerIDs []int) ([]*models.Tiger, error)
+	LockTiger(tigerID int) (*models.Tiger, error)
+	UpdateTiger(tiger *models.Tiger) error
+	DeleteTiger(tigerID int) error
 	GetAllTigersWithPagination(page, pageSize int) ([]*models.Tiger, int, error)
 	CreateTigerSighting(tigerSighting *models.TigerSighting) error
 	GetTigerSightingsByID(tigerID int) ([]*models.TigerSighting, error)
+	GetSighting(sightingID int) (*models.TigerSighting, error)
+	GetSightingImage(sightingID int) (*models.SightingImage, error)
+	GetSightingImageByID(sightingID, imageID int) (*models.SightingImage, error)
+	GetSightingImages(sightingID int) ([]*models.SightingImage, error)
+	AddSightingImages(sightingID int, images []*models.SightingImage, flags []string) error
+	FindSimilarImages(hash uint64, maxDistance, limit int) ([]*models.SimilarImage, error)
+	GetUnhashedSightingImages(afterID, limit int) ([]*models.SightingImage, error)
+	SetSightingImageHash(imageID int, hash uint64) error
+	GetSightingImageKeys(tigerID int) ([]string, error)
+	GetLegacySightingImages(afterID, limit int) ([]*models.SightingImage, error)
+	SetSightingImage(image *models.SightingImage) error
 	GetPreviousTigerSighting(tigerID int) (*models.TigerSighting, error)
+	GetTigerSightingsBetween(tigerID int, from, to time.Time) ([]*models.TigerSighting, error)
+	GetTigerSightingSummary(tigerID int) (*models.SightingSummary, error)
 	GetTigerSightingsByIDWithPagination(tigerID, page, pageSize int) ([]*models.TigerSighting, int, error)
+	GetSightingsBetween(from, to time.Time) ([]*models.TigerSighting, error)
+	// GetSightingsNear and GetSightingsInBoundingBox match protected tigers on their coordinates rounded
+	// to protectedDecimals, and return them so; a negative protectedDecimals matches the exact coordinates
+	GetSightingsNear(center models.Coordinates, radiusKm float64, since time.Time, limit, protectedDecimals int) ([]*models.NearbySighting, error)
+	GetSightingsInBoundingBox(box models.BoundingBox, since time.Time, limit, protectedDecimals int) ([]*models.NearbySighting, error)
+	GetSightingRule(tigerID int) (*models.SightingRule, error)
+	UpsertSightingRule(rule *models.SightingRule) error
+	CreateEmailDelivery(delivery *models.EmailDelivery) error
+	GetEmailDeliveries(eventID string) ([]*models.EmailDelivery, error)
+	UpdateEmailDelivery(delivery *models.EmailDelivery) error
+	ClaimDueEmailDeliveries(now, leaseUntil time.Time, limit int) ([]*models.EmailDelivery, error)
+	SubscribeToTiger(userID, tigerID int) error
+	UnsubscribeFromTiger(userID, tigerID int) error
+	GetTigerSubscriptions(userID int) ([]int, error)
+	GetTigerSubscriberEmails(tigerID int) ([]string, error)
+	CreateAreaSubscription(subscription *models.AreaSubscription) error
+	GetAreaSubscriptions(userID int) ([]*models.AreaSubscription, error)
+	DeleteAreaSubscription(userID, subscriptionID int) (bool, error)
+	GetAreaSubscriptionsContaining(point models.Coordinates) ([]*models.AreaSubscription, error)
+	GetNotificationPreferences(emails []string) ([]*models.NotificationPreferences, error)
+	UpsertNotificationPreferences(prefs *models.NotificationPreferences) error
+	CreateOutboxMessage(msg *models.OutboxMessage) error
+	ClaimDueOutboxMessages(now, leaseUntil time.Time, limit int) ([]*models.OutboxMessage, error)
+	UpdateOutboxMessage(msg *models.OutboxMessage) error
+}
+
+type TigerRepository interface {
+	Queries
+
+	// WithTx runs fn as a single unit of work. The repository passed to fn is
+	// bound to one database transaction, which is committed when fn returns
+	// nil and rolled back otherwise.
+	WithTx(fn func(TigerRepository) error) error
 }
 
 func NewPostgresRepository(connection string) (TigerRepository, error) {
 	db, err := store.NewPostgresDB(connection)
-	return store.NewPostgresRepository(db), err
+	if err != nil {
+		return nil, err
+	}
+	return postgresRepository{Queries: store.NewPostgresRepository(db), db: db}, nil
+}
+
+type postgresRepository struct {
+	Queries
+	db *sql.DB
+}
+
+func (r postgresRepository) WithTx(fn func(TigerRepository) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(txRepository{Queries: store.NewPostgresRepository(tx)}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// txRepository is bound to an open transaction; nested units of work join it.
+type txRepository struct {
+	Queries
+}
+
+func (r txRepository) WithTx(fn func(TigerRepository) error) error {
+	return fn(r)
 }
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tigerhall-kittens/pkg/repository/store"
+)
+
+func TestPostgresRepository_WithTx_Commit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := postgresRepository{Queries: store.NewPostgresRepository(db), db: db}
+
+	// Both statements run in one transaction which is committed
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM tigers").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM tigers").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = repo.WithTx(func(tx TigerRepository) error {
+		if err := tx.DeleteTiger(1); err != nil {
+			return err
+		}
+		// Nested units of work join the open transaction
+		return tx.WithTx(func(nested TigerRepository) error {
+			return nested.DeleteTiger(2)
+		})
+	})
+	assert.NoError(t, err)
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestPostgresRepository_WithTx_Rollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := postgresRepository{Queries: store.NewPostgresRepository(db), db: db}
+
+	// The transaction is rolled back when the unit of work fails
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM tigers").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	errAbort := errors.New("abort")
+	err = repo.WithTx(func(tx TigerRepository) error {
+		if err := tx.DeleteTiger(1); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	assert.ErrorIs(t, err, errAbort)
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
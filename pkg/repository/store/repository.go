@@ -2,25 +2,68 @@ package store
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/tigerhall-kittens/pkg/models"
+	"github.com/tigerhall-kittens/pkg/utils"
 )
 
+// ErrUserNotFound is returned by GetUserByEmail when no user has the email.
+var ErrUserNotFound = errors.New("user not found")
+
+// DBTX is satisfied by both *sql.DB and *sql.Tx, so the repository can run
+// inside or outside of a transaction.
+type DBTX interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 type postgresRepository struct {
-	db *sql.DB
+	db DBTX
 }
 
-func NewPostgresRepository(db *sql.DB) *postgresRepository {
+func NewPostgresRepository(db DBTX) *postgresRepository {
 	return &postgresRepository{db: db}
 }
 
+// inTx runs fn in a transaction, joining the repository's transaction when it
+// is already bound to one.
+func (p *postgresRepository) inTx(fn func(db DBTX) error) error {
+	db, ok := p.db.(*sql.DB)
+	if !ok {
+		return fn(p.db)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
 func (p *postgresRepository) CreateUser(user *models.User) error {
 	query := `
 		INSERT INTO users (username, email, password)
 		VALUES ($1, $2, $3)
+		RETURNING id
 	`
-	_, err := p.db.Exec(query, user.Username, user.Email, user.Password)
+	err := p.db.QueryRow(query, user.Username, user.Email, user.Password).Scan(&user.ID)
 	if err != nil {
 		return err
 	}
@@ -30,10 +73,11 @@ func (p *postgresRepository) CreateUser(user *models.User) error {
 
 func (p *postgresRepository) CreateTiger(tiger *models.Tiger) error {
 	query := `
-		INSERT INTO tigers (name, date_of_birth, last_seen, lat, long)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO tigers (name, date_of_birth, last_seen, lat, long, created_by, protected)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
 	`
-	_, err := p.db.Exec(query, tiger.Name, tiger.DateOfBirth, tiger.LastSeen, tiger.Lat, tiger.Long)
+	err := p.db.QueryRow(query, tiger.Name, tiger.DateOfBirth, tiger.LastSeen, tiger.Lat, tiger.Long, nullableInt(tiger.CreatedBy), tiger.Protected).Scan(&tiger.ID)
 	if err != nil {
 		return err
 	}
@@ -41,9 +85,81 @@ func (p *postgresRepository) CreateTiger(tiger *models.Tiger) error {
 	return nil
 }
 
+func (p *postgresRepository) GetTigerByID(tigerID int) (*models.Tiger, error) {
+	query := `
+		SELECT id, name, date_of_birth, last_seen, lat, long, created_by, protected
+		FROM tigers
+		WHERE id = $1
+	`
+
+	tiger := &models.Tiger{}
+	var createdBy sql.NullInt64
+	err := p.db.QueryRow(query, tigerID).Scan(&tiger.ID, &tiger.Name, &tiger.DateOfBirth, &tiger.LastSeen, &tiger.Lat, &tiger.Long, &createdBy, &tiger.Protected)
+	if err == sql.ErrNoRows {
+		// No tiger found for the given tigerID
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get tiger: %v", err)
+	}
+	tiger.CreatedBy = int(createdBy.Int64)
+
+	return tiger, nil
+}
+
+// LockTiger returns the tiger like GetTigerByID and holds a row lock on it
+// until the surrounding transaction ends, serialising writers of the same tiger.
+func (p *postgresRepository) LockTiger(tigerID int) (*models.Tiger, error) {
+	query := `
+		SELECT id, name, date_of_birth, last_seen, lat, long, created_by, protected
+		FROM tigers
+		WHERE id = $1
+		FOR UPDATE
+	`
+
+	tiger := &models.Tiger{}
+	var createdBy sql.NullInt64
+	err := p.db.QueryRow(query, tigerID).Scan(&tiger.ID, &tiger.Name, &tiger.DateOfBirth, &tiger.LastSeen, &tiger.Lat, &tiger.Long, &createdBy, &tiger.Protected)
+	if err == sql.ErrNoRows {
+		// No tiger found for the given tigerID
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to lock tiger: %v", err)
+	}
+	tiger.CreatedBy = int(createdBy.Int64)
+
+	return tiger, nil
+}
+
+func (p *postgresRepository) UpdateTiger(tiger *models.Tiger) error {
+	query := `
+		UPDATE tigers
+		SET name = $1, date_of_birth = $2, protected = $3
+		WHERE id = $4
+	`
+	_, err := p.db.Exec(query, tiger.Name, tiger.DateOfBirth, tiger.Protected, tiger.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update tiger: %v", err)
+	}
+
+	return nil
+}
+
+func (p *postgresRepository) DeleteTiger(tigerID int) error {
+	// Sightings of the tiger are removed by the ON DELETE CASCADE on tiger_sightings
+	query := `
+		DELETE FROM tigers WHERE id = $1
+	`
+	_, err := p.db.Exec(query, tigerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete tiger: %v", err)
+	}
+
+	return nil
+}
+
 func (p *postgresRepository) GetAllTigersWithPagination(page, pageSize int) ([]*models.Tiger, int, error) {
 	query := `
-		SELECT id, name, date_of_birth, last_seen, lat, long
+		SELECT id, name, date_of_birth, last_seen, lat, long, created_by, protected
 		FROM tigers
 		ORDER BY last_seen DESC
 		LIMIT $1 OFFSET $2
@@ -60,10 +176,12 @@ func (p *postgresRepository) GetAllTigersWithPagination(page, pageSize int) ([]*
 	var tigers []*models.Tiger
 	for rows.Next() {
 		tiger := &models.Tiger{}
-		err := rows.Scan(&tiger.ID, &tiger.Name, &tiger.DateOfBirth, &tiger.LastSeen, &tiger.Lat, &tiger.Long)
+		var createdBy sql.NullInt64
+		err := rows.Scan(&tiger.ID, &tiger.Name, &tiger.DateOfBirth, &tiger.LastSeen, &tiger.Lat, &tiger.Long, &createdBy, &tiger.Protected)
 		if err != nil {
 			return nil, 0, err
 		}
+		tiger.CreatedBy = int(createdBy.Int64)
 		tigers = append(tigers, tiger)
 	}
 
@@ -92,16 +210,16 @@ func (p *postgresRepository) GetTotalTigerCount() (int, error) {
 
 func (p *postgresRepository) GetUserByEmail(email string) (*models.User, error) {
 	query := `
-        SELECT id, username, email, password
+        SELECT id, username, email, password, role
         FROM users
         WHERE email = $1
     `
 
 	user := &models.User{}
-	err := p.db.QueryRow(query, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password)
+	err := p.db.QueryRow(query, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Role)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -110,21 +228,45 @@ func (p *postgresRepository) GetUserByEmail(email string) (*models.User, error)
 }
 
 func (p *postgresRepository) CreateTigerSighting(tigerSighting *models.TigerSighting) error {
-	query := `
-       INSERT INTO tiger_sightings (tiger_id, timestamp, lat, long, image, reporter_Email)
-       VALUES ($1, $2, $3, $4, $5,$6)
-       RETURNING id
-   `
-	err := p.db.QueryRow(query, tigerSighting.TigerID, tigerSighting.Timestamp, tigerSighting.Lat, tigerSighting.Long, tigerSighting.Image, tigerSighting.ReporterEmail).Scan(&tigerSighting.ID)
-	if err != nil {
-		return fmt.Errorf("failed to create tiger sighting: %v", err)
+	// A nil slice would be written as NULL
+	flags := tigerSighting.Flags
+	if flags == nil {
+		flags = []string{}
 	}
 
-	return nil
+	return p.inTx(func(db DBTX) error {
+		query := `
+			INSERT INTO tiger_sightings (tiger_id, timestamp, lat, long, reporter_Email, flags)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id
+		`
+		err := db.QueryRow(query, tigerSighting.TigerID, tigerSighting.Timestamp, tigerSighting.Lat, tigerSighting.Long,
+			tigerSighting.ReporterEmail, pq.Array(flags)).Scan(&tigerSighting.ID)
+		if err != nil {
+			return fmt.Errorf("failed to create tiger sighting: %v", err)
+		}
+
+		if err := insertSightingImages(db, tigerSighting.ID, tigerSighting.StoredImages); err != nil {
+			return err
+		}
+
+		// Move the tiger to the new sighting unless a later sighting has already been recorded
+		query = `
+			UPDATE tigers
+			SET last_seen = $2, lat = $3, long = $4
+			WHERE id = $1 AND last_seen <= $2
+		`
+		_, err = db.Exec(query, tigerSighting.TigerID, tigerSighting.Timestamp, tigerSighting.Lat, tigerSighting.Long)
+		if err != nil {
+			return fmt.Errorf("failed to update tiger last seen: %v", err)
+		}
+
+		return nil
+	})
 }
 
 func (p *postgresRepository) GetTigerSightingsByID(tigerID int) ([]*models.TigerSighting, error) {
-	query := "SELECT id, tiger_id, timestamp, lat, long, image, reporter_Email FROM tiger_sightings WHERE tiger_id = $1 ORDER BY timestamp DESC"
+	query := "SELECT id, tiger_id, timestamp, lat, long, " + imageCountSQL + ", reporter_Email, flags FROM tiger_sightings WHERE tiger_id = $1 ORDER BY timestamp DESC"
 
 	rows, err := p.db.Query(query, tigerID)
 	if err != nil {
@@ -135,10 +277,11 @@ func (p *postgresRepository) GetTigerSightingsByID(tigerID int) ([]*models.Tiger
 	var sightings []*models.TigerSighting
 	for rows.Next() {
 		var sighting models.TigerSighting
-		err := rows.Scan(&sighting.ID, &sighting.TigerID, &sighting.Timestamp, &sighting.Lat, &sighting.Long, &sighting.Image, &sighting.ReporterEmail)
+		err := rows.Scan(&sighting.ID, &sighting.TigerID, &sighting.Timestamp, &sighting.Lat, &sighting.Long, &sighting.ImageCount, &sighting.ReporterEmail, pq.Array(&sighting.Flags))
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan tiger sighting: %v", err)
 		}
+		sighting.HasImage = sighting.ImageCount > 0
 		sightings = append(sightings, &sighting)
 	}
 
@@ -149,9 +292,359 @@ func (p *postgresRepository) GetTigerSightingsByID(tigerID int) ([]*models.Tiger
 	return sightings, nil
 }
 
+// imageCountSQL counts the images of a sighting, including an image that is still kept in the database.
+const imageCountSQL = `((SELECT COUNT(*) FROM sighting_images WHERE sighting_images.sighting_id = tiger_sightings.id) + CASE WHEN tiger_sightings.image IS NULL THEN 0 ELSE 1 END)`
+
+func (p *postgresRepository) GetSighting(sightingID int) (*models.TigerSighting, error) {
+	query := `
+		SELECT id, tiger_id, timestamp, lat, long, ` + imageCountSQL + `, reporter_Email, flags
+		FROM tiger_sightings
+		WHERE id = $1
+	`
+
+	var sighting models.TigerSighting
+	err := p.db.QueryRow(query, sightingID).Scan(&sighting.ID, &sighting.TigerID, &sighting.Timestamp, &sighting.Lat, &sighting.Long, &sighting.ImageCount, &sighting.ReporterEmail, pq.Array(&sighting.Flags))
+	if err == sql.ErrNoRows {
+		// No sighting found for the given sightingID
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get tiger sighting: %v", err)
+	}
+	sighting.HasImage = sighting.ImageCount > 0
+
+	return &sighting, nil
+}
+
+// GetSightingImage returns the first image of the sighting. The bytes are only read for an image
+// that is still kept in the database.
+func (p *postgresRepository) GetSightingImage(sightingID int) (*models.SightingImage, error) {
+	query := `
+		SELECT ts.id, ts.tiger_id, first.id, first.image_key, first.image_sha256, first.image_width, first.image_height,
+			CASE WHEN first.id IS NULL THEN ts.image END
+		FROM tiger_sightings ts
+		LEFT JOIN LATERAL (
+			SELECT id, image_key, image_sha256, image_width, image_height
+			FROM sighting_images
+			WHERE sighting_id = ts.id
+			ORDER BY id
+			LIMIT 1
+		) AS first ON TRUE
+		WHERE ts.id = $1
+	`
+
+	image := &models.SightingImage{}
+	var id, width, height sql.NullInt64
+	var key, sha256 sql.NullString
+	err := p.db.QueryRow(query, sightingID).Scan(&image.SightingID, &image.TigerID, &id, &key, &sha256, &width, &height, &image.Data)
+	if err == sql.ErrNoRows {
+		// No sighting found for the given sightingID
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get sighting image: %v", err)
+	}
+	image.ID = int(id.Int64)
+	image.Key = key.String
+	image.SHA256 = sha256.String
+	image.Width = int(width.Int64)
+	image.Height = int(height.Int64)
+
+	return image, nil
+}
+
+func (p *postgresRepository) GetSightingImageByID(sightingID, imageID int) (*models.SightingImage, error) {
+	query := `
+		SELECT si.id, si.sighting_id, ts.tiger_id, si.image_key, si.image_sha256, si.image_width, si.image_height
+		FROM sighting_images si
+		JOIN tiger_sightings ts ON ts.id = si.sighting_id
+		WHERE si.sighting_id = $1 AND si.id = $2
+	`
+
+	image := &models.SightingImage{}
+	var width, height sql.NullInt64
+	err := p.db.QueryRow(query, sightingID, imageID).Scan(&image.ID, &image.SightingID, &image.TigerID, &image.Key, &image.SHA256, &width, &height)
+	if err == sql.ErrNoRows {
+		// No image found for the given sightingID and imageID
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get sighting image: %v", err)
+	}
+	image.Width = int(width.Int64)
+	image.Height = int(height.Int64)
+
+	return image, nil
+}
+
+// GetSightingImages lists the images of a sighting in upload order, without their bytes. An image
+// that is still kept in the database comes first, with a zero ID.
+func (p *postgresRepository) GetSightingImages(sightingID int) ([]*models.SightingImage, error) {
+	query := `
+		SELECT 0, id, tiger_id, '', '', NULL, NULL, NULL
+		FROM tiger_sightings
+		WHERE id = $1 AND image IS NOT NULL
+		UNION ALL
+		SELECT si.id, si.sighting_id, ts.tiger_id, si.image_key, si.image_sha256, si.image_width, si.image_height, si.dhash
+		FROM sighting_images si
+		JOIN tiger_sightings ts ON ts.id = si.sighting_id
+		WHERE si.sighting_id = $1
+		ORDER BY 1
+	`
+
+	rows, err := p.db.Query(query, sightingID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sighting images: %v", err)
+	}
+	defer rows.Close()
+
+	var images []*models.SightingImage
+	for rows.Next() {
+		image := &models.SightingImage{}
+		var width, height, dhash sql.NullInt64
+		if err := rows.Scan(&image.ID, &image.SightingID, &image.TigerID, &image.Key, &image.SHA256, &width, &height, &dhash); err != nil {
+			return nil, fmt.Errorf("failed to scan sighting image: %v", err)
+		}
+		image.Width = int(width.Int64)
+		image.Height = int(height.Int64)
+		image.DHash = uint64(dhash.Int64)
+		images = append(images, image)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error processing sighting image rows: %v", err)
+	}
+
+	return images, nil
+}
+
+// AddSightingImages records images in the image store as belonging to the sighting, sets their IDs
+// and adds the flags to the sighting.
+func (p *postgresRepository) AddSightingImages(sightingID int, images []*models.SightingImage, flags []string) error {
+	return p.inTx(func(db DBTX) error {
+		if err := insertSightingImages(db, sightingID, images); err != nil {
+			return err
+		}
+		if len(flags) == 0 {
+			return nil
+		}
+
+		query := `
+			UPDATE tiger_sightings SET flags = flags || $1 WHERE id = $2
+		`
+		if _, err := db.Exec(query, pq.Array(flags), sightingID); err != nil {
+			return fmt.Errorf("failed to flag tiger sighting: %v", err)
+		}
+		return nil
+	})
+}
+
+func insertSightingImages(db DBTX, sightingID int, images []*models.SightingImage) error {
+	query := `
+		INSERT INTO sighting_images (sighting_id, image_key, image_sha256, image_width, image_height, dhash)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+	for _, image := range images {
+		err := db.QueryRow(query, sightingID, image.Key, image.SHA256, nullableInt(image.Width), nullableInt(image.Height), nullableHash(image.DHash)).Scan(&image.ID)
+		if err != nil {
+			return fmt.Errorf("failed to add sighting image: %v", err)
+		}
+		image.SightingID = sightingID
+	}
+
+	return nil
+}
+
+// hashDistanceSQL counts the bits in which the hash of a sighting image differs from $1.
+const hashDistanceSQL = `length(replace((si.dhash # $1)::bit(64)::text, '0', ''))`
+
+// hashBands is the number of bytes of a hash that are indexed on their own. Two hashes that differ in
+// fewer bits than that have at least one byte in common.
+const hashBands = 8
+
+// hashBandsSQL matches the images that have a byte of their hash in common with the hash whose bytes
+// are $4 to $11, from the highest. The indexes on each byte find them without reading every image.
+func hashBandsSQL() string {
+	bands := make([]string, hashBands)
+	for i := range bands {
+		bands[i] = fmt.Sprintf("((si.dhash >> %d) & 255) = $%d", 56-8*i, i+4)
+	}
+	return "(" + strings.Join(bands, " OR ") + ")"
+}
+
+// FindSimilarImages returns up to limit images of any sighting whose hash is within maxDistance
+// bits of the given hash, closest first. Distances of 8 bits and more cannot use the indexes and
+// compare every image.
+func (p *postgresRepository) FindSimilarImages(hash uint64, maxDistance, limit int) ([]*models.SimilarImage, error) {
+	args := []interface{}{int64(hash), maxDistance, limit}
+	prefilter := "TRUE"
+	if maxDistance < hashBands {
+		prefilter = hashBandsSQL()
+		for i := 0; i < hashBands; i++ {
+			args = append(args, int64(hash>>(56-8*i)&255))
+		}
+	}
+
+	query := `
+		SELECT si.id, si.sighting_id, ts.tiger_id, si.image_key, si.image_sha256, si.image_width, si.image_height, si.dhash, ` + hashDistanceSQL + ` AS distance
+		FROM sighting_images si
+		JOIN tiger_sightings ts ON ts.id = si.sighting_id
+		WHERE si.dhash IS NOT NULL AND ` + prefilter + ` AND ` + hashDistanceSQL + ` <= $2
+		ORDER BY distance, si.id
+		LIMIT $3
+	`
+
+	rows, err := p.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find similar sighting images: %v", err)
+	}
+	defer rows.Close()
+
+	var images []*models.SimilarImage
+	for rows.Next() {
+		image := &models.SimilarImage{}
+		var width, height sql.NullInt64
+		var dhash int64
+		if err := rows.Scan(&image.ID, &image.SightingID, &image.TigerID, &image.Key, &image.SHA256, &width, &height, &dhash, &image.Distance); err != nil {
+			return nil, fmt.Errorf("failed to scan similar sighting image: %v", err)
+		}
+		image.Width = int(width.Int64)
+		image.Height = int(height.Int64)
+		image.DHash = uint64(dhash)
+		images = append(images, image)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error processing similar sighting image rows: %v", err)
+	}
+
+	return images, nil
+}
+
+// GetUnhashedSightingImages returns up to limit images in the image store after afterID that have no hash yet.
+func (p *postgresRepository) GetUnhashedSightingImages(afterID, limit int) ([]*models.SightingImage, error) {
+	query := `
+		SELECT si.id, si.sighting_id, ts.tiger_id, si.image_key
+		FROM sighting_images si
+		JOIN tiger_sightings ts ON ts.id = si.sighting_id
+		WHERE si.dhash IS NULL AND si.id > $1
+		ORDER BY si.id
+		LIMIT $2
+	`
+
+	rows, err := p.db.Query(query, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unhashed sighting images: %v", err)
+	}
+	defer rows.Close()
+
+	var images []*models.SightingImage
+	for rows.Next() {
+		image := &models.SightingImage{}
+		if err := rows.Scan(&image.ID, &image.SightingID, &image.TigerID, &image.Key); err != nil {
+			return nil, fmt.Errorf("failed to scan unhashed sighting image: %v", err)
+		}
+		images = append(images, image)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error processing unhashed sighting image rows: %v", err)
+	}
+
+	return images, nil
+}
+
+func (p *postgresRepository) SetSightingImageHash(imageID int, hash uint64) error {
+	query := `
+		UPDATE sighting_images SET dhash = $1 WHERE id = $2
+	`
+	if _, err := p.db.Exec(query, int64(hash), imageID); err != nil {
+		return fmt.Errorf("failed to set sighting image hash: %v", err)
+	}
+	return nil
+}
+
+func (p *postgresRepository) GetSightingImageKeys(tigerID int) ([]string, error) {
+	query := `
+		SELECT si.image_key
+		FROM sighting_images si
+		JOIN tiger_sightings ts ON ts.id = si.sighting_id
+		WHERE ts.tiger_id = $1
+	`
+
+	rows, err := p.db.Query(query, tigerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sighting image keys: %v", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("failed to scan sighting image key: %v", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error processing sighting image key rows: %v", err)
+	}
+
+	return keys, nil
+}
+
+// GetLegacySightingImages returns up to limit images that are still stored in the database, of the
+// sightings after afterID.
+func (p *postgresRepository) GetLegacySightingImages(afterID, limit int) ([]*models.SightingImage, error) {
+	query := `
+		SELECT id, tiger_id, image
+		FROM tiger_sightings
+		WHERE image IS NOT NULL AND id > $1
+		ORDER BY id
+		LIMIT $2
+	`
+
+	rows, err := p.db.Query(query, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get legacy sighting images: %v", err)
+	}
+	defer rows.Close()
+
+	var images []*models.SightingImage
+	for rows.Next() {
+		image := &models.SightingImage{}
+		if err := rows.Scan(&image.SightingID, &image.TigerID, &image.Data); err != nil {
+			return nil, fmt.Errorf("failed to scan legacy sighting image: %v", err)
+		}
+		images = append(images, image)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error processing legacy sighting image rows: %v", err)
+	}
+
+	return images, nil
+}
+
+// SetSightingImage adds the image in the image store to the sighting and drops the bytes kept in the database.
+func (p *postgresRepository) SetSightingImage(image *models.SightingImage) error {
+	return p.inTx(func(db DBTX) error {
+		if err := insertSightingImages(db, image.SightingID, []*models.SightingImage{image}); err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE tiger_sightings SET image = NULL WHERE id = $1
+		`
+		if _, err := db.Exec(query, image.SightingID); err != nil {
+			return fmt.Errorf("failed to set sighting image: %v", err)
+		}
+		return nil
+	})
+}
+
 func (p *postgresRepository) GetTigerSightingsByIDWithPagination(tigerID, page, pageSize int) ([]*models.TigerSighting, int, error) {
 	query := `
-		SELECT id, tiger_id, timestamp, lat, long, image, reporter_Email
+		SELECT id, tiger_id, timestamp, lat, long, ` + imageCountSQL + `, reporter_Email, flags
 		FROM tiger_sightings
 		WHERE tiger_id = $1
 		ORDER BY timestamp DESC
@@ -170,10 +663,11 @@ func (p *postgresRepository) GetTigerSightingsByIDWithPagination(tigerID, page,
 	var sightings []*models.TigerSighting
 	for rows.Next() {
 		var sighting models.TigerSighting
-		err := rows.Scan(&sighting.ID, &sighting.TigerID, &sighting.Timestamp, &sighting.Lat, &sighting.Long, &sighting.Image, &sighting.ReporterEmail)
+		err := rows.Scan(&sighting.ID, &sighting.TigerID, &sighting.Timestamp, &sighting.Lat, &sighting.Long, &sighting.ImageCount, &sighting.ReporterEmail, pq.Array(&sighting.Flags))
 		if err != nil {
 			return nil, 0, fmt.Errorf("failed to scan tiger sighting: %v", err)
 		}
+		sighting.HasImage = sighting.ImageCount > 0
 		sightings = append(sightings, &sighting)
 	}
 
@@ -207,7 +701,7 @@ func (p *postgresRepository) GetTigerSightingsCountByID(tigerID int) (int, error
 func (p *postgresRepository) GetPreviousTigerSighting(tigerID int) (*models.TigerSighting, error) {
 	// Query the database to get the previous tiger sighting based on tigerID
 	query := `
-		SELECT id, tiger_id, timestamp, lat, long, image, reporter_Email
+		SELECT id, tiger_id, timestamp, lat, long, ` + imageCountSQL + `, reporter_Email, flags
 		FROM tiger_sightings
 		WHERE tiger_id = $1
 		ORDER BY timestamp DESC
@@ -221,8 +715,9 @@ func (p *postgresRepository) GetPreviousTigerSighting(tigerID int) (*models.Tige
 		&previousSighting.Timestamp,
 		&previousSighting.Lat,
 		&previousSighting.Long,
-		&previousSighting.Image,
+		&previousSighting.ImageCount,
 		&previousSighting.ReporterEmail,
+		pq.Array(&previousSighting.Flags),
 	)
 
 	if err == sql.ErrNoRows {
@@ -232,6 +727,681 @@ func (p *postgresRepository) GetPreviousTigerSighting(tigerID int) (*models.Tige
 		// Some other error occurred during the query
 		return nil, err
 	}
+	previousSighting.HasImage = previousSighting.ImageCount > 0
 
 	return &previousSighting, nil
 }
+
+func (p *postgresRepository) GetTigerSightingSummary(tigerID int) (*models.SightingSummary, error) {
+	query := `
+		SELECT COUNT(*), MIN(timestamp), MAX(timestamp), COUNT(DISTINCT reporter_email)
+		FROM tiger_sightings
+		WHERE tiger_id = $1
+	`
+
+	summary := &models.SightingSummary{}
+	var firstSighting, latestSighting sql.NullTime
+	err := p.db.QueryRow(query, tigerID).Scan(&summary.TotalSightings, &firstSighting, &latestSighting, &summary.DistinctReporters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tiger sighting summary: %v", err)
+	}
+
+	// MIN and MAX are NULL when the tiger has not been sighted yet
+	if firstSighting.Valid {
+		summary.FirstSighting = &firstSighting.Time
+	}
+	if latestSighting.Valid {
+		summary.LatestSighting = &latestSighting.Time
+	}
+
+	return summary, nil
+}
+
+// nullableInt maps the zero value of an optional foreign key to NULL.
+func nullableInt(v int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(v), Valid: v != 0}
+}
+
+// nullableHash maps an image hash that has not been computed to NULL. Postgres has no unsigned
+// integers, so the hash is stored with the same bits in a BIGINT.
+func nullableHash(hash uint64) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(hash), Valid: hash != 0}
+}
+
+func (p *postgresRepository) GetTigerSightingsBetween(tigerID int, from, to time.Time) ([]*models.TigerSighting, error) {
+	query := `
+		SELECT id, tiger_id, timestamp, lat, long, reporter_Email, flags
+		FROM tiger_sightings
+		WHERE tiger_id = $1 AND timestamp BETWEEN $2 AND $3
+		ORDER BY timestamp DESC
+	`
+
+	rows, err := p.db.Query(query, tigerID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tiger sightings: %v", err)
+	}
+	defer rows.Close()
+
+	var sightings []*models.TigerSighting
+	for rows.Next() {
+		var sighting models.TigerSighting
+		err := rows.Scan(&sighting.ID, &sighting.TigerID, &sighting.Timestamp, &sighting.Lat, &sighting.Long, &sighting.ReporterEmail, pq.Array(&sighting.Flags))
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan tiger sighting: %v", err)
+		}
+		sightings = append(sightings, &sighting)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error processing tiger sightings rows: %v", err)
+	}
+
+	return sightings, nil
+}
+
+func (p *postgresRepository) GetSightingsBetween(from, to time.Time) ([]*models.TigerSighting, error) {
+	query := `
+		SELECT id, tiger_id, timestamp, lat, long, reporter_Email, flags
+		FROM tiger_sightings
+		WHERE timestamp BETWEEN $1 AND $2
+		ORDER BY timestamp
+	`
+
+	rows, err := p.db.Query(query, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tiger sightings: %v", err)
+	}
+	defer rows.Close()
+
+	var sightings []*models.TigerSighting
+	for rows.Next() {
+		var sighting models.TigerSighting
+		err := rows.Scan(&sighting.ID, &sighting.TigerID, &sighting.Timestamp, &sighting.Lat, &sighting.Long, &sighting.ReporterEmail, pq.Array(&sighting.Flags))
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan tiger sighting: %v", err)
+		}
+		sightings = append(sightings, &sighting)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error processing tiger sightings rows: %v", err)
+	}
+
+	return sightings, nil
+}
+
+func (p *postgresRepository) GetSightingRule(tigerID int) (*models.SightingRule, error) {
+	query := `
+		SELECT tiger_id, min_distance_km, time_window_seconds, action
+		FROM tiger_sighting_rules
+		WHERE tiger_id = $1
+	`
+
+	rule := &models.SightingRule{}
+	var minDistanceKm sql.NullFloat64
+	var timeWindowSeconds sql.NullInt64
+	var action sql.NullString
+	err := p.db.QueryRow(query, tigerID).Scan(&rule.TigerID, &minDistanceKm, &timeWindowSeconds, &action)
+	if err == sql.ErrNoRows {
+		// The tiger uses the configured rule
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get sighting rule: %v", err)
+	}
+
+	if minDistanceKm.Valid {
+		rule.MinDistanceKm = &minDistanceKm.Float64
+	}
+	if timeWindowSeconds.Valid {
+		seconds := int(timeWindowSeconds.Int64)
+		rule.TimeWindowSeconds = &seconds
+	}
+	if action.Valid {
+		rule.Action = &action.String
+	}
+
+	return rule, nil
+}
+
+func (p *postgresRepository) UpsertSightingRule(rule *models.SightingRule) error {
+	query := `
+		INSERT INTO tiger_sighting_rules (tiger_id, min_distance_km, time_window_seconds, action)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tiger_id) DO UPDATE
+		SET min_distance_km = EXCLUDED.min_distance_km,
+			time_window_seconds = EXCLUDED.time_window_seconds,
+			action = EXCLUDED.action
+	`
+	_, err := p.db.Exec(query, rule.TigerID, rule.MinDistanceKm, rule.TimeWindowSeconds, rule.Action)
+	if err != nil {
+		return fmt.Errorf("failed to save sighting rule: %v", err)
+	}
+
+	return nil
+}
+
+// distanceKmSQL is the haversine distance in kilometres between a sighting and the point ($1, $2),
+// matching utils.CalculateDistance.
+const distanceKmSQL = `
+	6371 * 2 * ASIN(SQRT(
+		POWER(SIN(RADIANS(lat - $1) / 2), 2) +
+		COS(RADIANS($1)) * COS(RADIANS(lat)) * POWER(SIN(RADIANS(long - $2) / 2), 2)
+	))`
+
+// searchableSightingsSQL selects the sightings since $7 in the box from ($3, $5) to ($4, $6) widened by
+// $9, with the coordinates of protected tigers rounded to $8 decimals unless $8 is negative. Area
+// searches match on these coordinates, so that they never tell more about a protected tiger than its
+// rounded coordinates. The widening lets the lat/long index find the sightings whose rounded
+// coordinates fall in the box.
+const searchableSightingsSQL = `
+	SELECT ts.id, ts.tiger_id, ts.timestamp, ts.flags,
+		CASE WHEN t.protected AND $8 >= 0 THEN ROUND(ts.lat::NUMERIC, $8)::DOUBLE PRECISION ELSE ts.lat END AS lat,
+		CASE WHEN t.protected AND $8 >= 0 THEN ROUND(ts.long::NUMERIC, $8)::DOUBLE PRECISION ELSE ts.long END AS long
+	FROM tiger_sightings ts
+	JOIN tigers t ON t.id = ts.tiger_id
+	WHERE ts.lat BETWEEN $3 - $9 AND $4 + $9 AND ts.long BETWEEN $5 - $9 AND $6 + $9 AND ts.timestamp >= $7`
+
+// roundingMargin is the furthest that rounding to the given decimals moves a coordinate.
+func roundingMargin(decimals int) float64 {
+	if decimals < 0 {
+		return 0
+	}
+	return 0.5 * math.Pow(10, -float64(decimals))
+}
+
+func (p *postgresRepository) GetSightingsNear(center models.Coordinates, radiusKm float64, since time.Time, limit, protectedDecimals int) ([]*models.NearbySighting, error) {
+	// The bounding box prefilter can use the lat/long index; the exact distance is refined afterwards
+	box := utils.BoundingBoxAround(center, radiusKm)
+	query := `
+		SELECT id, tiger_id, timestamp, lat, long, flags, distance_km
+		FROM (
+			SELECT id, tiger_id, timestamp, lat, long, flags, ` + distanceKmSQL + ` AS distance_km
+			FROM (` + searchableSightingsSQL + `
+			) AS searchable
+		) AS nearby
+		WHERE distance_km <= $10
+		ORDER BY distance_km, timestamp DESC
+		LIMIT $11
+	`
+
+	return p.queryNearbySightings(query, center.Lat, center.Long, box.MinLat, box.MaxLat, box.MinLong, box.MaxLong, since,
+		protectedDecimals, roundingMargin(protectedDecimals), radiusKm, limit)
+}
+
+func (p *postgresRepository) GetSightingsInBoundingBox(box models.BoundingBox, since time.Time, limit, protectedDecimals int) ([]*models.NearbySighting, error) {
+	// Sightings are ordered by their distance from the center of the box
+	center := box.Center()
+	query := `
+		SELECT id, tiger_id, timestamp, lat, long, flags, ` + distanceKmSQL + ` AS distance_km
+		FROM (` + searchableSightingsSQL + `
+		) AS searchable
+		WHERE lat BETWEEN $3 AND $4 AND long BETWEEN $5 AND $6
+		ORDER BY distance_km, timestamp DESC
+		LIMIT $10
+	`
+
+	return p.queryNearbySightings(query, center.Lat, center.Long, box.MinLat, box.MaxLat, box.MinLong, box.MaxLong, since,
+		protectedDecimals, roundingMargin(protectedDecimals), limit)
+}
+
+// queryNearbySightings leaves the reporters out, as anyone may search an area.
+func (p *postgresRepository) queryNearbySightings(query string, args ...interface{}) ([]*models.NearbySighting, error) {
+	rows, err := p.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search tiger sightings: %v", err)
+	}
+	defer rows.Close()
+
+	var sightings []*models.NearbySighting
+	for rows.Next() {
+		var sighting models.NearbySighting
+		err := rows.Scan(&sighting.ID, &sighting.TigerID, &sighting.Timestamp, &sighting.Lat, &sighting.Long, pq.Array(&sighting.Flags), &sighting.DistanceKm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan tiger sighting: %v", err)
+		}
+		sightings = append(sightings, &sighting)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error processing tiger sightings rows: %v", err)
+	}
+
+	return sightings, nil
+}
+
+func (p *postgresRepository) GetTigersByIDs(tigerIDs []int) ([]*models.Tiger, error) {
+	query := `
+		SELECT id, name, date_of_birth, last_seen, lat, long, created_by, protected
+		FROM tigers
+		WHERE id = ANY($1)
+	`
+
+	rows, err := p.db.Query(query, pq.Array(tigerIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tigers: %v", err)
+	}
+	defer rows.Close()
+
+	var tigers []*models.Tiger
+	for rows.Next() {
+		tiger := &models.Tiger{}
+		var createdBy sql.NullInt64
+		err := rows.Scan(&tiger.ID, &tiger.Name, &tiger.DateOfBirth, &tiger.LastSeen, &tiger.Lat, &tiger.Long, &createdBy, &tiger.Protected)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan tiger: %v", err)
+		}
+		tiger.CreatedBy = int(createdBy.Int64)
+		tigers = append(tigers, tiger)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error processing tiger rows: %v", err)
+	}
+
+	return tigers, nil
+}
+
+func (p *postgresRepository) CreateEmailDelivery(delivery *models.EmailDelivery) error {
+	query := `
+		INSERT INTO email_deliveries (event_id, recipient, subject, body, link, reason, status, attempts, deliver_after)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at
+	`
+	err := p.db.QueryRow(query, nullableString(delivery.EventID), delivery.Recipient, delivery.Subject, nullableString(delivery.Body), nullableString(delivery.Link), nullableString(delivery.Reason),
+		delivery.Status, delivery.Attempts, delivery.DeliverAfter).Scan(&delivery.ID, &delivery.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create email delivery: %v", err)
+	}
+	return nil
+}
+
+// GetEmailDeliveries returns the emails recorded for the event.
+func (p *postgresRepository) GetEmailDeliveries(eventID string) ([]*models.EmailDelivery, error) {
+	query := `
+		SELECT id, recipient, subject, status, attempts, COALESCE(last_error, ''), created_at, sent_at
+		FROM email_deliveries
+		WHERE event_id = $1
+		ORDER BY id
+	`
+
+	rows, err := p.db.Query(query, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get email deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	var deliveries []*models.EmailDelivery
+	for rows.Next() {
+		delivery := &models.EmailDelivery{EventID: eventID}
+		if err := rows.Scan(&delivery.ID, &delivery.Recipient, &delivery.Subject, &delivery.Status, &delivery.Attempts, &delivery.LastError, &delivery.CreatedAt, &delivery.SentAt); err != nil {
+			return nil, fmt.Errorf("failed to scan email delivery: %v", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error processing email delivery rows: %v", err)
+	}
+
+	return deliveries, nil
+}
+
+func (p *postgresRepository) UpdateEmailDelivery(delivery *models.EmailDelivery) error {
+	query := `
+		UPDATE email_deliveries
+		SET status = $1, attempts = $2, last_error = $3, sent_at = $4, claimed_until = NULL
+		WHERE id = $5
+	`
+	_, err := p.db.Exec(query, delivery.Status, delivery.Attempts, nullableString(delivery.LastError), delivery.SentAt, delivery.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update email delivery: %v", err)
+	}
+	return nil
+}
+
+// ClaimDueEmailDeliveries returns up to limit scheduled emails that are due by now, oldest first, and
+// marks them as pending until leaseUntil so that no other instance sends them too. Emails whose lease
+// ran out before their outcome was recorded are claimed again.
+func (p *postgresRepository) ClaimDueEmailDeliveries(now, leaseUntil time.Time, limit int) ([]*models.EmailDelivery, error) {
+	query := `
+		UPDATE email_deliveries
+		SET status = $1, claimed_until = $2
+		WHERE id IN (
+			SELECT id
+			FROM email_deliveries
+			WHERE (status = $3 AND deliver_after <= $4) OR (status = $1 AND claimed_until <= $4)
+			ORDER BY deliver_after, id
+			LIMIT $5
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, recipient, subject, body, link, reason, attempts, created_at, deliver_after
+	`
+
+	rows, err := p.db.Query(query, models.DeliveryPending, leaseUntil, models.DeliveryScheduled, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim due email deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	var deliveries []*models.EmailDelivery
+	for rows.Next() {
+		delivery := &models.EmailDelivery{Status: models.DeliveryPending}
+		var body, link, reason sql.NullString
+		var deliverAfter time.Time
+		if err := rows.Scan(&delivery.ID, &delivery.Recipient, &delivery.Subject, &body, &link, &reason, &delivery.Attempts, &delivery.CreatedAt, &deliverAfter); err != nil {
+			return nil, fmt.Errorf("failed to scan email delivery: %v", err)
+		}
+		delivery.Body = body.String
+		delivery.Link = link.String
+		delivery.Reason = reason.String
+		delivery.DeliverAfter = &deliverAfter
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error processing email delivery rows: %v", err)
+	}
+
+	// RETURNING does not keep the order of the subquery
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID < deliveries[j].ID })
+	return deliveries, nil
+}
+
+// nullableString maps an empty optional text to NULL.
+func nullableString(v string) sql.NullString {
+	return sql.NullString{String: v, Valid: v != ""}
+}
+
+func (p *postgresRepository) SubscribeToTiger(userID, tigerID int) error {
+	query := `
+		INSERT INTO tiger_subscriptions (tiger_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (tiger_id, user_id) DO NOTHING
+	`
+	if _, err := p.db.Exec(query, tigerID, userID); err != nil {
+		return fmt.Errorf("failed to subscribe to tiger: %v", err)
+	}
+	return nil
+}
+
+func (p *postgresRepository) UnsubscribeFromTiger(userID, tigerID int) error {
+	query := `
+		DELETE FROM tiger_subscriptions WHERE tiger_id = $1 AND user_id = $2
+	`
+	if _, err := p.db.Exec(query, tigerID, userID); err != nil {
+		return fmt.Errorf("failed to unsubscribe from tiger: %v", err)
+	}
+	return nil
+}
+
+func (p *postgresRepository) GetTigerSubscriptions(userID int) ([]int, error) {
+	query := `
+		SELECT tiger_id
+		FROM tiger_subscriptions
+		WHERE user_id = $1
+		ORDER BY created_at, tiger_id
+	`
+
+	rows, err := p.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tiger subscriptions: %v", err)
+	}
+	defer rows.Close()
+
+	var tigerIDs []int
+	for rows.Next() {
+		var tigerID int
+		if err := rows.Scan(&tigerID); err != nil {
+			return nil, fmt.Errorf("failed to scan tiger subscription: %v", err)
+		}
+		tigerIDs = append(tigerIDs, tigerID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error processing tiger subscription rows: %v", err)
+	}
+
+	return tigerIDs, nil
+}
+
+func (p *postgresRepository) GetTigerSubscriberEmails(tigerID int) ([]string, error) {
+	query := `
+		SELECT u.email
+		FROM tiger_subscriptions ts
+		JOIN users u ON u.id = ts.user_id
+		WHERE ts.tiger_id = $1
+		ORDER BY ts.created_at, u.id
+	`
+
+	rows, err := p.db.Query(query, tigerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tiger subscribers: %v", err)
+	}
+	defer rows.Close()
+
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, fmt.Errorf("failed to scan tiger subscriber: %v", err)
+		}
+		emails = append(emails, email)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error processing tiger subscriber rows: %v", err)
+	}
+
+	return emails, nil
+}
+
+func (p *postgresRepository) CreateAreaSubscription(subscription *models.AreaSubscription) error {
+	query := `
+		INSERT INTO area_subscriptions (user_id, lat, long, radius_km)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+	err := p.db.QueryRow(query, subscription.UserID, subscription.Lat, subscription.Long, subscription.RadiusKm).Scan(&subscription.ID, &subscription.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create area subscription: %v", err)
+	}
+	return nil
+}
+
+func (p *postgresRepository) GetAreaSubscriptions(userID int) ([]*models.AreaSubscription, error) {
+	query := `
+		SELECT a.id, a.user_id, a.lat, a.long, a.radius_km, a.created_at, u.email
+		FROM area_subscriptions a
+		JOIN users u ON u.id = a.user_id
+		WHERE a.user_id = $1
+		ORDER BY a.id
+	`
+	return p.queryAreaSubscriptions(query, userID)
+}
+
+// DeleteAreaSubscription deletes the subscription of the user and reports whether it existed.
+func (p *postgresRepository) DeleteAreaSubscription(userID, subscriptionID int) (bool, error) {
+	query := `
+		DELETE FROM area_subscriptions WHERE id = $1 AND user_id = $2
+	`
+	result, err := p.db.Exec(query, subscriptionID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete area subscription: %v", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete area subscription: %v", err)
+	}
+	return deleted > 0, nil
+}
+
+// GetAreaSubscriptionsContaining returns the area subscriptions whose circle contains the point,
+// with the email address of their subscriber.
+func (p *postgresRepository) GetAreaSubscriptionsContaining(point models.Coordinates) ([]*models.AreaSubscription, error) {
+	query := `
+		SELECT a.id, a.user_id, a.lat, a.long, a.radius_km, a.created_at, u.email
+		FROM (
+			SELECT id, user_id, lat, long, radius_km, created_at, ` + distanceKmSQL + ` AS distance_km
+			FROM area_subscriptions
+		) AS a
+		JOIN users u ON u.id = a.user_id
+		WHERE a.distance_km <= a.radius_km
+		ORDER BY a.id
+	`
+	return p.queryAreaSubscriptions(query, point.Lat, point.Long)
+}
+
+func (p *postgresRepository) queryAreaSubscriptions(query string, args ...interface{}) ([]*models.AreaSubscription, error) {
+	rows, err := p.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get area subscriptions: %v", err)
+	}
+	defer rows.Close()
+
+	var subscriptions []*models.AreaSubscription
+	for rows.Next() {
+		subscription := &models.AreaSubscription{}
+		err := rows.Scan(&subscription.ID, &subscription.UserID, &subscription.Lat, &subscription.Long, &subscription.RadiusKm, &subscription.CreatedAt, &subscription.Email)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan area subscription: %v", err)
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error processing area subscription rows: %v", err)
+	}
+
+	return subscriptions, nil
+}
+
+// GetNotificationPreferences returns the preferences of the users with the given email addresses.
+// Users who have not set their own are left out.
+func (p *postgresRepository) GetNotificationPreferences(emails []string) ([]*models.NotificationPreferences, error) {
+	query := `
+		SELECT np.user_id, u.email, np.channels, np.timezone,
+			COALESCE(to_char(np.quiet_hours_start, 'HH24:MI'), ''), COALESCE(to_char(np.quiet_hours_end, 'HH24:MI'), ''),
+			np.digest, to_char(np.digest_time, 'HH24:MI')
+		FROM notification_preferences np
+		JOIN users u ON u.id = np.user_id
+		WHERE LOWER(u.email) = ANY($1)
+	`
+
+	lowered := make([]string, len(emails))
+	for i, email := range emails {
+		lowered[i] = strings.ToLower(email)
+	}
+
+	rows, err := p.db.Query(query, pq.Array(lowered))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification preferences: %v", err)
+	}
+	defer rows.Close()
+
+	var preferences []*models.NotificationPreferences
+	for rows.Next() {
+		prefs := &models.NotificationPreferences{}
+		err := rows.Scan(&prefs.UserID, &prefs.Email, pq.Array(&prefs.Channels), &prefs.Timezone, &prefs.QuietHoursStart, &prefs.QuietHoursEnd, &prefs.Digest, &prefs.DigestTime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification preferences: %v", err)
+		}
+		preferences = append(preferences, prefs)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error processing notification preferences rows: %v", err)
+	}
+
+	return preferences, nil
+}
+
+func (p *postgresRepository) UpsertNotificationPreferences(prefs *models.NotificationPreferences) error {
+	query := `
+		INSERT INTO notification_preferences (user_id, channels, timezone, quiet_hours_start, quiet_hours_end, digest, digest_time)
+		VALUES ($1, $2, $3, $4::time, $5::time, $6, $7::time)
+		ON CONFLICT (user_id) DO UPDATE
+		SET channels = EXCLUDED.channels, timezone = EXCLUDED.timezone, quiet_hours_start = EXCLUDED.quiet_hours_start,
+			quiet_hours_end = EXCLUDED.quiet_hours_end, digest = EXCLUDED.digest, digest_time = EXCLUDED.digest_time
+	`
+	channels := prefs.Channels
+	if channels == nil {
+		channels = []string{}
+	}
+	_, err := p.db.Exec(query, prefs.UserID, pq.Array(channels), prefs.Timezone, nullableString(prefs.QuietHoursStart), nullableString(prefs.QuietHoursEnd), prefs.Digest, prefs.DigestTime)
+	if err != nil {
+		return fmt.Errorf("failed to save notification preferences: %v", err)
+	}
+	return nil
+}
+
+func (p *postgresRepository) CreateOutboxMessage(msg *models.OutboxMessage) error {
+	query := `
+		INSERT INTO outbox (event_id, event_type, payload)
+		VALUES ($1, $2, $3)
+		RETURNING id, status, next_attempt_at, created_at
+	`
+	// A []byte would be sent as bytea, which a JSONB column does not accept
+	err := p.db.QueryRow(query, msg.EventID, msg.EventType, string(msg.Payload)).Scan(&msg.ID, &msg.Status, &msg.NextAttemptAt, &msg.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create outbox message: %v", err)
+	}
+	return nil
+}
+
+// ClaimDueOutboxMessages returns up to limit pending events whose next attempt is due by now, oldest
+// first, and moves their next attempt to leaseUntil. Other relays skip them until then, without the
+// rows staying locked while the events are published.
+func (p *postgresRepository) ClaimDueOutboxMessages(now, leaseUntil time.Time, limit int) ([]*models.OutboxMessage, error) {
+	query := `
+		WITH due AS (
+			SELECT id
+			FROM outbox
+			WHERE status = $1 AND next_attempt_at <= $2
+			ORDER BY id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE outbox o
+		SET next_attempt_at = $4
+		FROM due
+		WHERE o.id = due.id
+		RETURNING o.id, o.event_id, o.event_type, o.payload, o.status, o.attempts, COALESCE(o.last_error, ''), o.next_attempt_at, o.created_at
+	`
+
+	rows, err := p.db.Query(query, models.OutboxPending, now, limit, leaseUntil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim due outbox messages: %v", err)
+	}
+	defer rows.Close()
+
+	var messages []*models.OutboxMessage
+	for rows.Next() {
+		msg := &models.OutboxMessage{}
+		err := rows.Scan(&msg.ID, &msg.EventID, &msg.EventType, &msg.Payload, &msg.Status, &msg.Attempts, &msg.LastError, &msg.NextAttemptAt, &msg.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan outbox message: %v", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error processing outbox message rows: %v", err)
+	}
+
+	// RETURNING does not keep the order of the subquery
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	return messages, nil
+}
+
+func (p *postgresRepository) UpdateOutboxMessage(msg *models.OutboxMessage) error {
+	query := `
+		UPDATE outbox
+		SET status = $1, attempts = $2, last_error = $3, next_attempt_at = $4, published_at = $5
+		WHERE id = $6
+	`
+	_, err := p.db.Exec(query, msg.Status, msg.Attempts, nullableString(msg.LastError), msg.NextAttemptAt, msg.PublishedAt, msg.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update outbox message: %v", err)
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package store
 
 import (
+	"database/sql"
+	"fmt"
 	"testing"
 	"time"
 
@@ -29,12 +31,13 @@ func TestPostgresRepository_CreateUser(t *testing.T) {
 	}
 
 	// Expect the INSERT query to be executed
-	mock.ExpectExec("INSERT INTO users").
+	mock.ExpectQuery("INSERT INTO users").
 		WithArgs(user.Username, user.Email, user.Password).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 
 	err = repo.CreateUser(user)
 	assert.NoError(t, err)
+	assert.Equal(t, 1, user.ID, "The ID of the new user should be filled in")
 
 	// Check if all expectations were met
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -58,13 +61,14 @@ func TestPostgresRepository_GetUserByEmail(t *testing.T) {
 		Username: "testuser",
 		Email:    email,
 		Password: "testpassword",
+		Role:     models.RoleUser,
 	}
 
 	// Mock the SELECT query to return the test case data
-	mock.ExpectQuery("SELECT id, username, email, password").
+	mock.ExpectQuery("SELECT id, username, email, password, role").
 		WithArgs(email).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "password"}).
-			AddRow(user.ID, user.Username, user.Email, user.Password))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "password", "role"}).
+			AddRow(user.ID, user.Username, user.Email, user.Password, user.Role))
 
 	resultUser, err := repo.GetUserByEmail(email)
 	assert.NoError(t, err)
@@ -76,6 +80,29 @@ func TestPostgresRepository_GetUserByEmail(t *testing.T) {
 	}
 }
 
+func TestPostgresRepository_GetUserByEmail_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	mock.ExpectQuery("SELECT id, username, email, password, role").
+		WithArgs("nobody@example.com").
+		WillReturnError(sql.ErrNoRows)
+
+	resultUser, err := repo.GetUserByEmail("nobody@example.com")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	assert.Nil(t, resultUser)
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
 func TestPostgresRepository_CreateTiger(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -92,15 +119,18 @@ func TestPostgresRepository_CreateTiger(t *testing.T) {
 		LastSeen:    time.Now(),
 		Lat:         12.3456,
 		Long:        78.91011,
+		CreatedBy:   3,
+		Protected:   true,
 	}
 
 	// Mock the INSERT query to return success
-	mock.ExpectExec("INSERT INTO tigers").
-		WithArgs(tiger.Name, tiger.DateOfBirth, tiger.LastSeen, tiger.Lat, tiger.Long).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("INSERT INTO tigers").
+		WithArgs(tiger.Name, tiger.DateOfBirth, tiger.LastSeen, tiger.Lat, tiger.Long, tiger.CreatedBy, tiger.Protected).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 
 	err = repo.CreateTiger(tiger)
 	assert.NoError(t, err)
+	assert.Equal(t, 1, tiger.ID, "The ID of the new tiger should be filled in")
 
 	// Check if all expectations were met
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -117,23 +147,74 @@ func TestPostgresRepository_CreateTigerSighting(t *testing.T) {
 
 	repo := NewPostgresRepository(db)
 
+	// Test case data
+	tigerSighting := &models.TigerSighting{
+		TigerID:   1,
+		Timestamp: time.Now(),
+		Lat:       12.3456,
+		Long:      78.91011,
+		StoredImages: []*models.SightingImage{
+			{Key: "sightings/1/image-1.jpeg", SHA256: "0123abcd", Width: 250, Height: 200, DHash: 0xf0f0f0f0f0f0f0f0},
+			{Key: "sightings/1/image-2.jpeg", SHA256: "4567cdef", Width: 1024, Height: 768},
+		},
+		ReporterEmail: "testuser@example.com",
+	}
+
+	// Mock the INSERT queries to return the test case data and the tiger to be moved in the same transaction
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO tiger_sightings").
+		WithArgs(tigerSighting.TigerID, tigerSighting.Timestamp, tigerSighting.Lat, tigerSighting.Long, tigerSighting.ReporterEmail, "{}").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("INSERT INTO sighting_images").
+		WithArgs(1, "sightings/1/image-1.jpeg", "0123abcd", 250, 200, int64(-0x0f0f0f0f0f0f0f10)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	mock.ExpectQuery("INSERT INTO sighting_images").
+		WithArgs(1, "sightings/1/image-2.jpeg", "4567cdef", 1024, 768, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+	mock.ExpectExec("UPDATE tigers SET last_seen").
+		WithArgs(tigerSighting.TigerID, tigerSighting.Timestamp, tigerSighting.Lat, tigerSighting.Long).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = repo.CreateTigerSighting(tigerSighting)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, tigerSighting.StoredImages[0].ID)
+	assert.Equal(t, 1, tigerSighting.StoredImages[1].SightingID)
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestPostgresRepository_CreateTigerSighting_RollsBackOnTigerUpdateFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
 	// Test case data
 	tigerSighting := &models.TigerSighting{
 		TigerID:       1,
 		Timestamp:     time.Now(),
 		Lat:           12.3456,
 		Long:          78.91011,
-		Image:         []byte("test image data"),
 		ReporterEmail: "testuser@example.com",
 	}
 
-	// Mock the INSERT query to return the test case data
+	// The sighting must not be kept when the tiger cannot be updated
+	mock.ExpectBegin()
 	mock.ExpectQuery("INSERT INTO tiger_sightings").
-		WithArgs(tigerSighting.TigerID, tigerSighting.Timestamp, tigerSighting.Lat, tigerSighting.Long, tigerSighting.Image, tigerSighting.ReporterEmail).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec("UPDATE tigers SET last_seen").
+		WillReturnError(fmt.Errorf("connection reset"))
+	mock.ExpectRollback()
 
 	err = repo.CreateTigerSighting(tigerSighting)
-	assert.NoError(t, err)
+	assert.Error(t, err)
 
 	// Check if all expectations were met
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -158,15 +239,16 @@ func TestPostgresRepository_GetPreviousTigerSighting(t *testing.T) {
 		Timestamp:     time.Now(),
 		Lat:           12.3456,
 		Long:          78.91011,
-		Image:         []byte("sample-image"),
+		HasImage:      true,
+		ImageCount:    3,
 		ReporterEmail: "reporter@example.com",
 	}
 
 	// Mock the query to return a single row result
-	mock.ExpectQuery("SELECT id, tiger_id, timestamp, lat, long, image, reporter_Email FROM tiger_sightings").
+	mock.ExpectQuery(`SELECT id, tiger_id, timestamp, lat, long, \(\(SELECT COUNT\(\*\) FROM sighting_images (.+)\), reporter_Email, flags FROM tiger_sightings`).
 		WithArgs(tigerID).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "tiger_id", "timestamp", "lat", "long", "image", "reporter_Email"}).
-			AddRow(tigerSighting.ID, tigerSighting.TigerID, tigerSighting.Timestamp, tigerSighting.Lat, tigerSighting.Long, tigerSighting.Image, tigerSighting.ReporterEmail))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tiger_id", "timestamp", "lat", "long", "image_count", "reporter_Email", "flags"}).
+			AddRow(tigerSighting.ID, tigerSighting.TigerID, tigerSighting.Timestamp, tigerSighting.Lat, tigerSighting.Long, tigerSighting.ImageCount, tigerSighting.ReporterEmail, "{}"))
 
 	// Call the function
 	previousSighting, err := repo.GetPreviousTigerSighting(tigerID)
@@ -179,7 +261,8 @@ func TestPostgresRepository_GetPreviousTigerSighting(t *testing.T) {
 	assert.Equal(t, tigerSighting.Timestamp, previousSighting.Timestamp)
 	assert.Equal(t, tigerSighting.Lat, previousSighting.Lat)
 	assert.Equal(t, tigerSighting.Long, previousSighting.Long)
-	assert.Equal(t, tigerSighting.Image, previousSighting.Image)
+	assert.Equal(t, tigerSighting.HasImage, previousSighting.HasImage)
+	assert.Equal(t, tigerSighting.ImageCount, previousSighting.ImageCount)
 	assert.Equal(t, tigerSighting.ReporterEmail, previousSighting.ReporterEmail)
 
 	// Check if all expectations were met
@@ -187,3 +270,678 @@ func TestPostgresRepository_GetPreviousTigerSighting(t *testing.T) {
 		t.Errorf("failed to meet expectations: %v", err)
 	}
 }
+
+func TestPostgresRepository_GetTigerByID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	// Test case data
+	tiger := &models.Tiger{
+		ID:          1,
+		Name:        "Tiger 1",
+		DateOfBirth: time.Date(2018, 1, 15, 0, 0, 0, 0, time.UTC),
+		LastSeen:    time.Date(2023, 7, 20, 12, 0, 0, 0, time.UTC),
+		Lat:         12.3456,
+		Long:        78.91011,
+		CreatedBy:   3,
+	}
+
+	// Mock the SELECT query to return the test case data
+	mock.ExpectQuery("SELECT id, name, date_of_birth, last_seen, lat, long, created_by, protected FROM tigers WHERE id").
+		WithArgs(tiger.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "date_of_birth", "last_seen", "lat", "long", "created_by", "protected"}).
+			AddRow(tiger.ID, tiger.Name, tiger.DateOfBirth, tiger.LastSeen, tiger.Lat, tiger.Long, tiger.CreatedBy, tiger.Protected))
+
+	resultTiger, err := repo.GetTigerByID(tiger.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tiger, resultTiger)
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestPostgresRepository_GetTigerSightingSummary(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	// Test case data
+	tigerID := 1
+	firstSighting := time.Date(2023, 7, 20, 12, 0, 0, 0, time.UTC)
+	latestSighting := time.Date(2023, 7, 22, 12, 0, 0, 0, time.UTC)
+
+	// Mock the aggregate query to return the test case data
+	mock.ExpectQuery("SELECT COUNT").
+		WithArgs(tigerID).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "min", "max", "count"}).
+			AddRow(3, firstSighting, latestSighting, 2))
+
+	summary, err := repo.GetTigerSightingSummary(tigerID)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, summary.TotalSightings)
+	assert.Equal(t, 2, summary.DistinctReporters)
+	assert.Equal(t, firstSighting, *summary.FirstSighting)
+	assert.Equal(t, latestSighting, *summary.LatestSighting)
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestPostgresRepository_DeleteTiger(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	// Expect the DELETE query to be executed
+	mock.ExpectExec("DELETE FROM tigers").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = repo.DeleteTiger(1)
+	assert.NoError(t, err)
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestPostgresRepository_CreateTigerSighting_InTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	// Test case data
+	tigerSighting := &models.TigerSighting{
+		TigerID:       1,
+		Timestamp:     time.Now(),
+		Lat:           12.3456,
+		Long:          78.91011,
+		ReporterEmail: "testuser@example.com",
+	}
+
+	// The tiger is locked and the sighting created in the caller's transaction
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id = \\$1 FOR UPDATE").
+		WithArgs(tigerSighting.TigerID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "date_of_birth", "last_seen", "lat", "long", "created_by", "protected"}).
+			AddRow(1, "Tiger 1", time.Now(), time.Now(), 12.0, 78.0, nil, false))
+	mock.ExpectQuery("INSERT INTO tiger_sightings").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec("UPDATE tigers SET last_seen").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	repo := NewPostgresRepository(tx)
+
+	tiger, err := repo.LockTiger(tigerSighting.TigerID)
+	assert.NoError(t, err)
+	assert.NotNil(t, tiger)
+	assert.NoError(t, repo.CreateTigerSighting(tigerSighting))
+	assert.NoError(t, tx.Commit())
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestPostgresRepository_GetSightingRule(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	// Only the distance is overridden for the tiger
+	mock.ExpectQuery("SELECT tiger_id, min_distance_km, time_window_seconds, action FROM tiger_sighting_rules").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"tiger_id", "min_distance_km", "time_window_seconds", "action"}).
+			AddRow(1, 12.5, nil, nil))
+
+	rule, err := repo.GetSightingRule(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 12.5, *rule.MinDistanceKm)
+	assert.Nil(t, rule.TimeWindowSeconds)
+	assert.Nil(t, rule.Action)
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestPostgresRepository_GetSightingsNear(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	// Test case data
+	center := models.Coordinates{Lat: 12.3456, Long: 78.91011}
+	since := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	timestamp := time.Date(2023, 7, 20, 12, 0, 0, 0, time.UTC)
+
+	// Mock the search query to return a single nearby sighting
+	mock.ExpectQuery("SELECT (.+) FROM tiger_sightings ts JOIN tigers t (.+) WHERE ts.lat BETWEEN (.+) WHERE distance_km <= (.+) ORDER BY distance_km").
+		WithArgs(center.Lat, center.Long, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), since, -1, 0.0, 5.0, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tiger_id", "timestamp", "lat", "long", "flags", "distance_km"}).
+			AddRow(3, 1, timestamp, 12.35, 78.92, "{}", 1.2))
+
+	sightings, err := repo.GetSightingsNear(center, 5, since, 10, -1)
+	assert.NoError(t, err)
+	assert.Len(t, sightings, 1)
+	assert.Equal(t, 3, sightings[0].ID)
+	assert.Equal(t, 1.2, sightings[0].DistanceKm)
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestPostgresRepository_AreaSearchMatchesProtectedTigersOnRoundedCoordinates(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	// A box whose edge lies between the exact position of a protected tiger and its rounded coordinates
+	// must not include the tiger because of its exact position. The distance and the box are therefore
+	// checked against the rounded coordinates, and the index prefilter is widened by the half cell that
+	// rounding moves a coordinate at most.
+	box := models.BoundingBox{MinLat: 12.31, MinLong: 78.91, MaxLat: 12.34, MaxLong: 78.94}
+	rounded := `CASE WHEN t.protected AND \$8 >= 0 THEN ROUND\(ts.lat::NUMERIC, \$8\)::DOUBLE PRECISION ELSE ts.lat END AS lat, ` +
+		`CASE WHEN t.protected AND \$8 >= 0 THEN ROUND\(ts.long::NUMERIC, \$8\)::DOUBLE PRECISION ELSE ts.long END AS long`
+	prefilter := `WHERE ts.lat BETWEEN \$3 - \$9 AND \$4 \+ \$9 AND ts.long BETWEEN \$5 - \$9 AND \$6 \+ \$9`
+	mock.ExpectQuery(rounded+` FROM tiger_sightings ts JOIN tigers t ON t.id = ts.tiger_id `+prefilter+` (.+) `+
+		`\) AS searchable WHERE lat BETWEEN \$3 AND \$4 AND long BETWEEN \$5 AND \$6 ORDER BY distance_km`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), box.MinLat, box.MaxLat, box.MinLong, box.MaxLong, time.Time{}, 1, 0.05, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tiger_id", "timestamp", "lat", "long", "flags", "distance_km"}))
+
+	_, err = repo.GetSightingsInBoundingBox(box, time.Time{}, 10, 1)
+	assert.NoError(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestRoundingMargin(t *testing.T) {
+	assert.Equal(t, 0.0, roundingMargin(-1), "Exact coordinates should not widen the search")
+	assert.Equal(t, 0.5, roundingMargin(0))
+	assert.InDelta(t, 0.05, roundingMargin(1), 1e-12)
+	assert.InDelta(t, 0.005, roundingMargin(2), 1e-12)
+}
+
+func TestPostgresRepository_GetSightingImage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	// Mock the SELECT query to return the location of the first image in the image store
+	mock.ExpectQuery("SELECT ts.id, ts.tiger_id, first.id, first.image_key, (.+) FROM tiger_sightings ts LEFT JOIN LATERAL").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tiger_id", "image_id", "image_key", "image_sha256", "image_width", "image_height", "image"}).
+			AddRow(1, 2, 10, "sightings/2/image.jpeg", "0123abcd", 250, 200, nil))
+
+	image, err := repo.GetSightingImage(1)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.SightingImage{ID: 10, SightingID: 1, TigerID: 2, Key: "sightings/2/image.jpeg", SHA256: "0123abcd", Width: 250, Height: 200}, image)
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestPostgresRepository_SetSightingImage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	// The image bytes are dropped from the row once the image is in the image store
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO sighting_images").
+		WithArgs(1, "sightings/2/1-0123abcd.jpeg", "0123abcd", 250, 200, 42).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	mock.ExpectExec("UPDATE tiger_sightings SET image = NULL").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	image := &models.SightingImage{SightingID: 1, TigerID: 2, Key: "sightings/2/1-0123abcd.jpeg", SHA256: "0123abcd", Width: 250, Height: 200, DHash: 42}
+	err = repo.SetSightingImage(image)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, image.ID)
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestPostgresRepository_GetSightingImages(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	// An image still kept in the database is listed first, without an ID
+	mock.ExpectQuery("SELECT 0, id, tiger_id, (.+) UNION ALL SELECT si.id, si.sighting_id, ts.tiger_id, (.+) FROM sighting_images si").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sighting_id", "tiger_id", "image_key", "image_sha256", "image_width", "image_height", "dhash"}).
+			AddRow(0, 1, 2, "", "", nil, nil, nil).
+			AddRow(10, 1, 2, "sightings/2/image.jpeg", "0123abcd", 250, 200, 42))
+
+	images, err := repo.GetSightingImages(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.SightingImage{
+		{SightingID: 1, TigerID: 2},
+		{ID: 10, SightingID: 1, TigerID: 2, Key: "sightings/2/image.jpeg", SHA256: "0123abcd", Width: 250, Height: 200, DHash: 42},
+	}, images)
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestPostgresRepository_AddSightingImages(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	// A failed insert leaves none of the images added
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO sighting_images").
+		WithArgs(1, "sightings/2/image-1.jpeg", "0123abcd", 250, 200, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	mock.ExpectQuery("INSERT INTO sighting_images").
+		WithArgs(1, "sightings/2/image-2.jpeg", "4567cdef", 250, 200, nil).
+		WillReturnError(fmt.Errorf("connection reset"))
+	mock.ExpectRollback()
+
+	err = repo.AddSightingImages(1, []*models.SightingImage{
+		{Key: "sightings/2/image-1.jpeg", SHA256: "0123abcd", Width: 250, Height: 200},
+		{Key: "sightings/2/image-2.jpeg", SHA256: "4567cdef", Width: 250, Height: 200},
+	}, nil)
+	assert.ErrorContains(t, err, "failed to add sighting image")
+
+	// The flags are added with the images
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO sighting_images").
+		WithArgs(1, "sightings/2/image-3.jpeg", "89abef01", 250, 200, int64(42)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+	mock.ExpectExec("UPDATE tiger_sightings SET flags = flags \\|\\| \\$1 WHERE id = \\$2").
+		WithArgs("{\"looks like image 10 of sighting 3\"}", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = repo.AddSightingImages(1, []*models.SightingImage{
+		{Key: "sightings/2/image-3.jpeg", SHA256: "89abef01", Width: 250, Height: 200, DHash: 42},
+	}, []string{"looks like image 10 of sighting 3"})
+	assert.NoError(t, err)
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestPostgresRepository_FindSimilarImages(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	// Hashes are compared with the same bits as the signed column, after the indexed bytes of the hash
+	// narrowed the images down
+	hash := uint64(0xff0102030405060f)
+	mock.ExpectQuery(`SELECT si.id, si.sighting_id, ts.tiger_id, (.+) FROM sighting_images si (.+) WHERE si.dhash IS NOT NULL `+
+		`AND \(\(\(si.dhash >> 56\) & 255\) = \$4 OR (.+) OR \(\(si.dhash >> 0\) & 255\) = \$11\) AND (.+) <= \$2 ORDER BY distance, si.id LIMIT \$3`).
+		WithArgs(int64(hash), 4, 20, int64(0xff), int64(1), int64(2), int64(3), int64(4), int64(5), int64(6), int64(0x0f)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sighting_id", "tiger_id", "image_key", "image_sha256", "image_width", "image_height", "dhash", "distance"}).
+			AddRow(10, 1, 2, "sightings/2/image.jpeg", "0123abcd", 250, 200, int64(-2), 1))
+
+	images, err := repo.FindSimilarImages(hash, 4, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.SimilarImage{
+		{
+			SightingImage: models.SightingImage{ID: 10, SightingID: 1, TigerID: 2, Key: "sightings/2/image.jpeg", SHA256: "0123abcd", Width: 250, Height: 200, DHash: ^uint64(1)},
+			Distance:      1,
+		},
+	}, images)
+
+	// Hashes 8 bits apart may have no byte in common, so every image is compared
+	mock.ExpectQuery(`WHERE si.dhash IS NOT NULL AND TRUE AND (.+) <= \$2`).
+		WithArgs(int64(hash), 8, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sighting_id", "tiger_id", "image_key", "image_sha256", "image_width", "image_height", "dhash", "distance"}))
+
+	_, err = repo.FindSimilarImages(hash, 8, 20)
+	assert.NoError(t, err)
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestPostgresRepository_GetUnhashedSightingImages(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	mock.ExpectQuery("SELECT si.id, si.sighting_id, ts.tiger_id, si.image_key FROM sighting_images si (.+) WHERE si.dhash IS NULL AND si.id > \\$1").
+		WithArgs(10, 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sighting_id", "tiger_id", "image_key"}).
+			AddRow(11, 1, 2, "sightings/2/image.jpeg"))
+	mock.ExpectExec("UPDATE sighting_images SET dhash").
+		WithArgs(int64(42), 11).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	images, err := repo.GetUnhashedSightingImages(10, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.SightingImage{{ID: 11, SightingID: 1, TigerID: 2, Key: "sightings/2/image.jpeg"}}, images)
+
+	err = repo.SetSightingImageHash(11, 42)
+	assert.NoError(t, err)
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestPostgresRepository_GetLegacySightingImages(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	mock.ExpectQuery("SELECT id, tiger_id, image FROM tiger_sightings WHERE image IS NOT NULL AND id > \\$1 ORDER BY id LIMIT \\$2").
+		WithArgs(4, 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tiger_id", "image"}).
+			AddRow(5, 2, []byte("image-bytes")))
+
+	images, err := repo.GetLegacySightingImages(4, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.SightingImage{{SightingID: 5, TigerID: 2, Data: []byte("image-bytes")}}, images)
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestPostgresRepository_EmailDelivery(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	createdAt := time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC)
+	sentAt := createdAt.Add(time.Minute)
+	mock.ExpectQuery("INSERT INTO email_deliveries").
+		WithArgs("0b6f4c1e-52a1-4d7e-9a43-3c6f0e0c2b11", "reporter@example.com", "Tiger Sights", nil, nil, nil, models.DeliveryPending, 0, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(5, createdAt))
+	mock.ExpectExec("UPDATE email_deliveries SET status = (.+) WHERE id = (.+)").
+		WithArgs(models.DeliverySent, 2, nil, &sentAt, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT (.+) FROM email_deliveries WHERE event_id = \\$1").
+		WithArgs("0b6f4c1e-52a1-4d7e-9a43-3c6f0e0c2b11").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "recipient", "subject", "status", "attempts", "last_error", "created_at", "sent_at"}).
+			AddRow(5, "reporter@example.com", "Tiger Sights", "sent", 2, "", createdAt, sentAt))
+
+	delivery := &models.EmailDelivery{EventID: "0b6f4c1e-52a1-4d7e-9a43-3c6f0e0c2b11", Recipient: "reporter@example.com", Subject: "Tiger Sights", Status: models.DeliveryPending}
+	err = repo.CreateEmailDelivery(delivery)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, delivery.ID)
+	assert.Equal(t, createdAt, delivery.CreatedAt)
+
+	delivery.Status = models.DeliverySent
+	delivery.Attempts = 2
+	delivery.SentAt = &sentAt
+	err = repo.UpdateEmailDelivery(delivery)
+	assert.NoError(t, err)
+
+	deliveries, err := repo.GetEmailDeliveries(delivery.EventID)
+	assert.NoError(t, err)
+	if assert.Len(t, deliveries, 1) {
+		assert.Equal(t, models.DeliverySent, deliveries[0].Status)
+		assert.Equal(t, &sentAt, deliveries[0].SentAt)
+	}
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestPostgresRepository_ClaimDueEmailDeliveries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	now := time.Date(2023, time.July, 22, 8, 0, 0, 0, time.UTC)
+	createdAt := now.Add(-10 * time.Hour)
+	leaseUntil := now.Add(5 * time.Minute)
+	mock.ExpectQuery("UPDATE email_deliveries SET status = \\$1, claimed_until = \\$2 (.+) WHERE \\(status = \\$3 AND deliver_after <= \\$4\\) OR \\(status = \\$1 AND claimed_until <= \\$4\\) (.+) FOR UPDATE SKIP LOCKED (.+) RETURNING").
+		WithArgs(models.DeliveryPending, leaseUntil, models.DeliveryScheduled, now, 500).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "recipient", "subject", "body", "link", "reason", "attempts", "created_at", "deliver_after"}).
+			AddRow(7, "a@example.com", "New sighting", "Bagheera was sighted", nil, nil, 0, createdAt, now).
+			AddRow(6, "a@example.com", "New sighting", "Sher Khan was sighted", "http://localhost:8080/tiger/1/sightings", "you subscribed to this tiger", 0, createdAt, now))
+
+	deliveries, err := repo.ClaimDueEmailDeliveries(now, leaseUntil, 500)
+	assert.NoError(t, err)
+	if assert.Len(t, deliveries, 2) {
+		assert.Equal(t, 6, deliveries[0].ID, "Deliveries should be returned in the order they were recorded")
+		assert.Equal(t, "you subscribed to this tiger", deliveries[0].Reason)
+		assert.Equal(t, models.DeliveryPending, deliveries[0].Status)
+		assert.Equal(t, "", deliveries[1].Link)
+	}
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestPostgresRepository_Subscriptions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	createdAt := time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC)
+	mock.ExpectExec("INSERT INTO tiger_subscriptions (.+) ON CONFLICT").
+		WithArgs(1, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT u.email FROM tiger_subscriptions").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("fan@example.com"))
+	mock.ExpectQuery("INSERT INTO area_subscriptions").
+		WithArgs(7, 12.5, 77.25, 20.0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(3, createdAt))
+	mock.ExpectQuery("SELECT (.+) FROM area_subscriptions (.+) WHERE a.distance_km <= a.radius_km").
+		WithArgs(12.6, 77.3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "lat", "long", "radius_km", "created_at", "email"}).
+			AddRow(3, 7, 12.5, 77.25, 20.0, createdAt, "fan@example.com"))
+	mock.ExpectExec("DELETE FROM area_subscriptions").
+		WithArgs(4, 7).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = repo.SubscribeToTiger(7, 1)
+	assert.NoError(t, err)
+
+	emails, err := repo.GetTigerSubscriberEmails(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"fan@example.com"}, emails)
+
+	subscription := &models.AreaSubscription{UserID: 7, Lat: 12.5, Long: 77.25, RadiusKm: 20}
+	err = repo.CreateAreaSubscription(subscription)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, subscription.ID)
+
+	containing, err := repo.GetAreaSubscriptionsContaining(models.Coordinates{Lat: 12.6, Long: 77.3})
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.AreaSubscription{{ID: 3, UserID: 7, Email: "fan@example.com", Lat: 12.5, Long: 77.25, RadiusKm: 20, CreatedAt: createdAt}}, containing)
+
+	deleted, err := repo.DeleteAreaSubscription(7, 4)
+	assert.NoError(t, err)
+	assert.False(t, deleted, "Deleting another user's subscription should report that it does not exist")
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestPostgresRepository_NotificationPreferences(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	mock.ExpectExec("INSERT INTO notification_preferences (.+) ON CONFLICT \\(user_id\\) DO UPDATE").
+		WithArgs(7, "{\"email\"}", "Asia/Kolkata", "22:00", "07:00", false, "08:00").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT (.+) FROM notification_preferences np (.+) WHERE LOWER\\(u.email\\) = ANY").
+		WithArgs("{\"fan@example.com\"}").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "email", "channels", "timezone", "quiet_hours_start", "quiet_hours_end", "digest", "digest_time"}).
+			AddRow(7, "Fan@example.com", "{email}", "Asia/Kolkata", "22:00", "07:00", false, "08:00"))
+
+	prefs := &models.NotificationPreferences{UserID: 7, Channels: []string{"email"}, Timezone: "Asia/Kolkata", QuietHoursStart: "22:00", QuietHoursEnd: "07:00", DigestTime: "08:00"}
+	err = repo.UpsertNotificationPreferences(prefs)
+	assert.NoError(t, err)
+
+	saved, err := repo.GetNotificationPreferences([]string{"FAN@example.com"})
+	assert.NoError(t, err)
+	if assert.Len(t, saved, 1) {
+		assert.Equal(t, "Fan@example.com", saved[0].Email)
+		assert.Equal(t, []string{"email"}, saved[0].Channels)
+		assert.Equal(t, "07:00", saved[0].QuietHoursEnd)
+	}
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestPostgresRepository_Outbox(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	now := time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC)
+	payload := `{"id":"0b6f4c1e-52a1-4d7e-9a43-3c6f0e0c2b11","type":"tiger.created"}`
+	mock.ExpectQuery("INSERT INTO outbox").
+		WithArgs("0b6f4c1e-52a1-4d7e-9a43-3c6f0e0c2b11", "tiger.created", payload).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "next_attempt_at", "created_at"}).AddRow(1, "pending", now, now))
+	leaseUntil := now.Add(time.Minute)
+	mock.ExpectQuery("WITH due AS \\( SELECT id FROM outbox WHERE status = (.+) FOR UPDATE SKIP LOCKED \\) UPDATE outbox o SET next_attempt_at = \\$4 (.+) RETURNING").
+		WithArgs(models.OutboxPending, now, 100, leaseUntil).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "event_id", "event_type", "payload", "status", "attempts", "last_error", "next_attempt_at", "created_at"}).
+			AddRow(2, "5d1c7a2e-0f4b-4c8e-b1a6-7e2f9d3c4a50", "tiger.created", []byte(payload), "pending", 0, "", leaseUntil, now).
+			AddRow(1, "0b6f4c1e-52a1-4d7e-9a43-3c6f0e0c2b11", "tiger.created", []byte(payload), "pending", 0, "", leaseUntil, now))
+	mock.ExpectExec("UPDATE outbox SET status = (.+) WHERE id = (.+)").
+		WithArgs(models.OutboxPublished, 1, nil, now, &now, int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	msg := &models.OutboxMessage{EventID: "0b6f4c1e-52a1-4d7e-9a43-3c6f0e0c2b11", EventType: "tiger.created", Payload: []byte(payload)}
+	err = repo.CreateOutboxMessage(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), msg.ID)
+	assert.Equal(t, models.OutboxPending, msg.Status)
+
+	due, err := repo.ClaimDueOutboxMessages(now, leaseUntil, 100)
+	assert.NoError(t, err)
+	if assert.Len(t, due, 2) {
+		assert.Equal(t, int64(1), due[0].ID, "Claimed events should be returned oldest first")
+		assert.JSONEq(t, payload, string(due[0].Payload))
+		assert.Equal(t, leaseUntil, due[0].NextAttemptAt)
+	}
+
+	msg.Status = models.OutboxPublished
+	msg.Attempts = 1
+	msg.PublishedAt = &now
+	err = repo.UpdateOutboxMessage(msg)
+	assert.NoError(t, err)
+
+	// Check if all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package rules
+
+import (
+	"fmt"
+	"time"
+
+	conf "github.com/tigerhall-kittens/config"
+	"github.com/tigerhall-kittens/pkg/models"
+	"github.com/tigerhall-kittens/pkg/utils"
+)
+
+// Action is what happens to a sighting that breaks the proximity rule.
+type Action string
+
+const (
+	ActionReject Action = "reject"
+	ActionFlag   Action = "flag"
+)
+
+// DefaultRule rejects a sighting within 5 km of the latest sighting of the tiger.
+var DefaultRule = Rule{MinDistanceKm: 5, Action: ActionReject}
+
+// Rule decides whether a new sighting is too close to earlier sightings of the same tiger.
+type Rule struct {
+	MinDistanceKm float64
+	// TimeWindow limits the check to sightings this close in time; zero compares against the latest sighting only
+	TimeWindow time.Duration
+	Action     Action
+}
+
+// FromConfig builds the default rule from the configuration.
+func FromConfig(config conf.Sightings) (Rule, error) {
+	rule := Rule{
+		MinDistanceKm: config.MinDistanceKm,
+		TimeWindow:    config.TimeWindow,
+		Action:        Action(config.Action),
+	}
+	return rule, rule.Validate()
+}
+
+// Validate checks that the rule can be evaluated.
+func (r Rule) Validate() error {
+	if r.MinDistanceKm < 0 {
+		return fmt.Errorf("minimum distance must not be negative, got %v", r.MinDistanceKm)
+	}
+	if r.TimeWindow < 0 {
+		return fmt.Errorf("time window must not be negative, got %v", r.TimeWindow)
+	}
+	if r.Action != ActionReject && r.Action != ActionFlag {
+		return fmt.Errorf("action must be %q or %q, got %q", ActionReject, ActionFlag, r.Action)
+	}
+	return nil
+}
+
+// WithOverride returns the rule with the fields set in the tiger's override applied.
+func (r Rule) WithOverride(override *models.SightingRule) Rule {
+	if override == nil {
+		return r
+	}
+	if override.MinDistanceKm != nil {
+		r.MinDistanceKm = *override.MinDistanceKm
+	}
+	if override.TimeWindowSeconds != nil {
+		r.TimeWindow = time.Duration(*override.TimeWindowSeconds) * time.Second
+	}
+	if override.Action != nil {
+		r.Action = Action(*override.Action)
+	}
+	return r
+}
+
+// Window returns the period in which earlier sightings are compared with a
+// sighting at timestamp. It reports false when the rule has no time window.
+func (r Rule) Window(timestamp time.Time) (time.Time, time.Time, bool) {
+	if r.TimeWindow == 0 {
+		return time.Time{}, time.Time{}, false
+	}
+	return timestamp.Add(-r.TimeWindow), timestamp.Add(r.TimeWindow), true
+}
+
+// Evaluate returns the violation caused by the first earlier sighting the new
+// sighting is too close to, or nil if the new sighting passes the rule.
+func (r Rule) Evaluate(newSighting *models.TigerSighting, earlierSightings []*models.TigerSighting) *Violation {
+	currentCoordinates := models.Coordinates{Lat: newSighting.Lat, Long: newSighting.Long}
+	for _, earlier := range earlierSightings {
+		if r.TimeWindow > 0 && absDuration(newSighting.Timestamp.Sub(earlier.Timestamp)) > r.TimeWindow {
+			continue
+		}
+
+		earlierCoordinates := models.Coordinates{Lat: earlier.Lat, Long: earlier.Long}
+		distance := utils.CalculateDistance(earlierCoordinates, currentCoordinates)
+		if distance <= r.MinDistanceKm {
+			return &Violation{Rule: r, Earlier: earlier, DistanceKm: distance}
+		}
+	}
+	return nil
+}
+
+// Violation is returned as an error when a sighting is rejected by a rule.
+type Violation struct {
+	Rule       Rule
+	Earlier    *models.TigerSighting
+	DistanceKm float64
+}
+
+func (v *Violation) Error() string {
+	if v.Rule.TimeWindow > 0 {
+		return fmt.Sprintf("A tiger sighting within %v kilometers and %v already exists", v.Rule.MinDistanceKm, v.Rule.TimeWindow)
+	}
+	return fmt.Sprintf("A tiger sighting within %v kilometers already exists", v.Rule.MinDistanceKm)
+}
+
+// Reason describes the violation for a flagged sighting.
+func (v *Violation) Reason() string {
+	return fmt.Sprintf("within %.2f km of sighting %d", v.DistanceKm, v.Earlier.ID)
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,52 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	conf "github.com/tigerhall-kittens/config"
+	"github.com/tigerhall-kittens/pkg/models"
+)
+
+func TestFromConfig(t *testing.T) {
+	rule, err := FromConfig(conf.Sightings{MinDistanceKm: 2, TimeWindow: time.Hour, Action: "flag"})
+	assert.NoError(t, err)
+	assert.Equal(t, Rule{MinDistanceKm: 2, TimeWindow: time.Hour, Action: ActionFlag}, rule)
+
+	_, err = FromConfig(conf.Sightings{MinDistanceKm: 2, Action: "ignore"})
+	assert.Error(t, err)
+}
+
+func TestRule_WithOverride(t *testing.T) {
+	distance := 20.0
+	seconds := 1800
+	override := &models.SightingRule{TigerID: 1, MinDistanceKm: &distance, TimeWindowSeconds: &seconds}
+
+	rule := DefaultRule.WithOverride(override)
+
+	// Fields missing from the override keep the default
+	assert.Equal(t, Rule{MinDistanceKm: 20, TimeWindow: 30 * time.Minute, Action: ActionReject}, rule)
+	assert.Equal(t, DefaultRule, DefaultRule.WithOverride(nil))
+}
+
+func TestRule_Evaluate(t *testing.T) {
+	newSighting := &models.TigerSighting{Timestamp: time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC), Lat: 12.35, Long: 56.79}
+	nearAndRecent := &models.TigerSighting{ID: 1, Timestamp: newSighting.Timestamp.Add(-30 * time.Minute), Lat: 12.34, Long: 56.78}
+	nearButOld := &models.TigerSighting{ID: 2, Timestamp: newSighting.Timestamp.Add(-3 * time.Hour), Lat: 12.34, Long: 56.78}
+	far := &models.TigerSighting{ID: 3, Timestamp: newSighting.Timestamp, Lat: 13.35, Long: 56.79}
+
+	// Without a time window any near sighting is a violation
+	violation := DefaultRule.Evaluate(newSighting, []*models.TigerSighting{nearButOld})
+	assert.NotNil(t, violation)
+	assert.Equal(t, "A tiger sighting within 5 kilometers already exists", violation.Error())
+
+	// With a time window old sightings are ignored
+	rule := Rule{MinDistanceKm: 5, TimeWindow: time.Hour, Action: ActionFlag}
+	assert.Nil(t, rule.Evaluate(newSighting, []*models.TigerSighting{nearButOld, far}))
+
+	violation = rule.Evaluate(newSighting, []*models.TigerSighting{far, nearAndRecent})
+	assert.NotNil(t, violation)
+	assert.Equal(t, nearAndRecent, violation.Earlier)
+	assert.Contains(t, violation.Reason(), "of sighting 1")
+}
@@ -1,9 +1,11 @@
 package server
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/tigerhall-kittens/pkg/auth"
@@ -24,22 +26,65 @@ func NewServer() *server {
 	}
 }
 
-func (s *server) SetupRoutes(tigerService service.TigerService, auth *auth.Auth) {
-	handlers := handlers.NewHandlers(tigerService, s.logger, auth)
+func (s *server) SetupRoutes(tigerService service.TigerService, auth *auth.Auth, opts ...handlers.Option) {
+	handlers := handlers.NewHandlers(tigerService, s.logger, auth, opts...)
 
 	// Public routes
 	s.router.HandleFunc("/signup", handlers.SignupHandler).Methods("POST")
 	s.router.HandleFunc("/login", handlers.LoginHandler).Methods("POST")
 
 	s.router.HandleFunc("/tigers", handlers.GetAllTigersHandler).Methods("GET")
+	s.router.HandleFunc("/tiger/{id}", handlers.GetTigerByIDHandler).Methods("GET")
+	s.router.HandleFunc("/tiger/{id}/track.geojson", handlers.GetTigerTrackHandler).Methods("GET")
+	s.router.HandleFunc("/sightings/track.geojson", handlers.GetSightingsTrackHandler).Methods("GET")
+	s.router.HandleFunc("/sightings/{id}/image", handlers.GetSightingImageHandler).Methods("GET")
+	s.router.HandleFunc("/sightings/{id}/images", handlers.GetSightingImagesHandler).Methods("GET")
+	s.router.HandleFunc("/sightings/{id}/images/{imageID}", handlers.GetSightingImageByIDHandler).Methods("GET")
+	s.router.HandleFunc("/sightings/{id}/similar", handlers.GetSimilarSightingImagesHandler).Methods("GET")
+	s.router.HandleFunc("/sightings/near", handlers.GetSightingsNearHandler).Methods("GET")
+	s.router.HandleFunc("/sightings", handlers.GetSightingsInBoundingBoxHandler).Methods("GET")
 	s.router.HandleFunc("/tiger/{id}/sightings", handlers.GetTigerSightingsByIDHandler).Methods("GET")
 
 	// Protected routes (require authentication)
 	s.router.Handle("/tiger/create", middleware.AuthMiddleware(auth, http.HandlerFunc(handlers.CreateTigerHandler))).Methods("POST")
+	s.router.Handle("/tiger/{id}", middleware.AuthMiddleware(auth, http.HandlerFunc(handlers.UpdateTigerHandler))).Methods("PUT", "PATCH")
+	s.router.Handle("/tiger/{id}", middleware.AuthMiddleware(auth, http.HandlerFunc(handlers.DeleteTigerHandler))).Methods("DELETE")
+	s.router.Handle("/tiger/{id}/sighting-rule", middleware.AuthMiddleware(auth, http.HandlerFunc(handlers.SetSightingRuleHandler))).Methods("PUT")
 	s.router.Handle("/tiger-sighting/create", middleware.AuthMiddleware(auth, http.HandlerFunc(handlers.CreateTigerSightingHandler))).Methods("POST")
+	s.router.Handle("/sightings/{id}/images", middleware.AuthMiddleware(auth, http.HandlerFunc(handlers.AddSightingImagesHandler))).Methods("POST")
+	s.router.Handle("/tiger/{id}/subscribe", middleware.AuthMiddleware(auth, http.HandlerFunc(handlers.SubscribeToTigerHandler))).Methods("POST")
+	s.router.Handle("/tiger/{id}/subscribe", middleware.AuthMiddleware(auth, http.HandlerFunc(handlers.UnsubscribeFromTigerHandler))).Methods("DELETE")
+	s.router.Handle("/subscriptions", middleware.AuthMiddleware(auth, http.HandlerFunc(handlers.GetSubscriptionsHandler))).Methods("GET")
+	s.router.Handle("/subscriptions/areas", middleware.AuthMiddleware(auth, http.HandlerFunc(handlers.CreateAreaSubscriptionHandler))).Methods("POST")
+	s.router.Handle("/subscriptions/areas/{id}", middleware.AuthMiddleware(auth, http.HandlerFunc(handlers.DeleteAreaSubscriptionHandler))).Methods("DELETE")
+	s.router.Handle("/notification-preferences", middleware.AuthMiddleware(auth, http.HandlerFunc(handlers.GetNotificationPreferencesHandler))).Methods("GET")
+	s.router.Handle("/notification-preferences", middleware.AuthMiddleware(auth, http.HandlerFunc(handlers.SetNotificationPreferencesHandler))).Methods("PUT")
 }
 
 func (s *server) Start(port string) error {
 	s.logger.Printf("Starting server on port %s...", port)
 	return http.ListenAndServe(":"+port, s.router)
 }
+
+// Run serves the API on the port until ctx is cancelled. It then stops taking requests and waits up to
+// shutdownTimeout for the requests in progress.
+func (s *server) Run(ctx context.Context, port string, shutdownTimeout time.Duration) error {
+	httpServer := &http.Server{Addr: ":" + port, Handler: s.router}
+
+	s.logger.Printf("Starting server on port %s...", port)
+	served := make(chan error, 1)
+	go func() {
+		served <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.logger.Printf("Shutting down, waiting up to %s for the requests in progress", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return httpServer.Shutdown(shutdownCtx)
+}
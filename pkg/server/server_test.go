@@ -1,8 +1,10 @@
 package server_test
 
 import (
+	"context"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
@@ -15,7 +17,7 @@ import (
 type mockTigerService struct {
 	signupService               func(user *models.User) error
 	loginService                func(credentials models.LoginCredentials) (*models.User, error)
-	createTigerService          func(tiger models.Tiger) error
+	createTigerService          func(tiger models.Tiger, creatorEmail string) error
 	getAllTigersService         func() ([]*models.Tiger, error)
 	createTigerSightingService  func(newSighting *models.TigerSighting) error
 	getAllTigerSightingsService func(tigerID int) ([]*models.TigerSighting, error)
@@ -29,6 +31,79 @@ func (m *mockTigerService) GetTigerSightingsByIDService(tigerID, page, pageSize
 	return []*models.TigerSighting{}, 0, nil
 }
 
+func (m *mockTigerService) GetTigerByIDService(tigerID int) (*models.TigerProfile, error) {
+	return &models.TigerProfile{}, nil
+}
+
+func (m *mockTigerService) SetSightingRuleService(rule models.SightingRule, requesterEmail string) error {
+	return nil
+}
+
+func (m *mockTigerService) GetSightingsNearService(center models.Coordinates, radiusKm float64, since time.Time, limit int) (*models.AreaSearchResult, error) {
+	return &models.AreaSearchResult{}, nil
+}
+
+func (m *mockTigerService) GetSightingsInBoundingBoxService(box models.BoundingBox, since time.Time, limit int) (*models.AreaSearchResult, error) {
+	return &models.AreaSearchResult{}, nil
+}
+
+func (m *mockTigerService) GetTigerTrackService(tigerID int) (*models.Tiger, []*models.TigerSighting, error) {
+	return &models.Tiger{}, []*models.TigerSighting{}, nil
+}
+
+func (m *mockTigerService) GetSightingsTrackService(from, to time.Time) ([]*models.Tiger, []*models.TigerSighting, error) {
+	return []*models.Tiger{}, []*models.TigerSighting{}, nil
+}
+
+func (m *mockTigerService) GetSightingImageService(sightingID int, size models.ImageSize) (*models.SightingImage, error) {
+	return &models.SightingImage{}, nil
+}
+
+func (m *mockTigerService) GetSightingImageByIDService(sightingID, imageID int, size models.ImageSize) (*models.SightingImage, error) {
+	return &models.SightingImage{}, nil
+}
+
+func (m *mockTigerService) GetSightingImagesService(sightingID int) ([]*models.SightingImage, error) {
+	return []*models.SightingImage{}, nil
+}
+
+func (m *mockTigerService) AddSightingImagesService(sightingID int, images [][]byte, requesterEmail string) ([]*models.SightingImage, error) {
+	return []*models.SightingImage{}, nil
+}
+
+func (m *mockTigerService) GetSimilarSightingImagesService(sightingID int) ([]*models.SimilarImage, error) {
+	return []*models.SimilarImage{}, nil
+}
+
+func (m *mockTigerService) SubscribeToTigerService(tigerID int, userEmail string) error {
+	return nil
+}
+
+func (m *mockTigerService) UnsubscribeFromTigerService(tigerID int, userEmail string) error {
+	return nil
+}
+
+func (m *mockTigerService) CreateAreaSubscriptionService(subscription models.AreaSubscription, userEmail string) (*models.AreaSubscription, error) {
+	return &subscription, nil
+}
+
+func (m *mockTigerService) DeleteAreaSubscriptionService(subscriptionID int, userEmail string) error {
+	return nil
+}
+
+func (m *mockTigerService) GetSubscriptionsService(userEmail string) (*models.Subscriptions, error) {
+	return &models.Subscriptions{}, nil
+}
+
+func (m *mockTigerService) GetNotificationPreferencesService(userEmail string) (*models.NotificationPreferences, error) {
+	prefs := models.DefaultNotificationPreferences()
+	return &prefs, nil
+}
+
+func (m *mockTigerService) SetNotificationPreferencesService(prefs models.NotificationPreferences, userEmail string) (*models.NotificationPreferences, error) {
+	return &prefs, nil
+}
+
 func (m *mockTigerService) SignupService(user *models.User) error {
 	return m.signupService(user)
 }
@@ -37,8 +112,16 @@ func (m *mockTigerService) LoginService(credentials models.LoginCredentials) (*m
 	return m.loginService(credentials)
 }
 
-func (m *mockTigerService) CreateTigerService(tiger models.Tiger) error {
-	return m.createTigerService(tiger)
+func (m *mockTigerService) CreateTigerService(tiger models.Tiger, creatorEmail string) error {
+	return m.createTigerService(tiger, creatorEmail)
+}
+
+func (m *mockTigerService) UpdateTigerService(tigerID int, update models.TigerUpdate, requesterEmail string) (*models.Tiger, error) {
+	return &models.Tiger{}, nil
+}
+
+func (m *mockTigerService) DeleteTigerService(tigerID int, requesterEmail string) error {
+	return nil
 }
 
 func (m *mockTigerService) CreateTigerSightingService(newSighting *models.TigerSighting) error {
@@ -87,11 +170,58 @@ func TestServer_Start(t *testing.T) {
 	req, err := http.NewRequest(http.MethodGet, "http://localhost:8080", nil)
 	assert.NoError(t, err, "Error creating request")
 
+	// Retry until the server goroutine is listening
 	client := &http.Client{}
-	resp, err := client.Do(req)
-	assert.NoError(t, err, "Error sending request")
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		if resp, err = client.Do(req); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !assert.NoError(t, err, "Error sending request") {
+		return
+	}
+	defer resp.Body.Close()
 
 	// Assert
 	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "Expected status code 404")
 
 }
+
+func TestServer_Run_ShutsDownWhenCancelled(t *testing.T) {
+	// Arrange
+	srv := server.NewServer()
+	srv.SetupRoutes(&mockTigerService{}, auth.NewAuth("test_secret_key"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Run(ctx, "8081", time.Second)
+	}()
+
+	// Retry until the server goroutine is listening
+	var err error
+	for i := 0; i < 50; i++ {
+		var resp *http.Response
+		if resp, err = http.Get("http://localhost:8081"); err == nil {
+			resp.Body.Close()
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.NoError(t, err, "Error sending request")
+
+	// Act
+	cancel()
+
+	// Assert
+	select {
+	case err := <-done:
+		assert.NoError(t, err, "Run should shut down cleanly")
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run should return once ctx is cancelled")
+	}
+	_, err = http.Get("http://localhost:8081")
+	assert.Error(t, err, "The server should no longer take requests")
+}
@@ -1,37 +1,170 @@
 package service
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
 	"log"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/tigerhall-kittens/pkg/auth"
-	"github.com/tigerhall-kittens/pkg/messaging"
+	"github.com/tigerhall-kittens/pkg/dhash"
+	"github.com/tigerhall-kittens/pkg/events"
+	"github.com/tigerhall-kittens/pkg/exif"
+	"github.com/tigerhall-kittens/pkg/imagestore"
 	"github.com/tigerhall-kittens/pkg/models"
+	"github.com/tigerhall-kittens/pkg/notifier"
+	"github.com/tigerhall-kittens/pkg/outbox"
 	"github.com/tigerhall-kittens/pkg/repository"
+	"github.com/tigerhall-kittens/pkg/rules"
+	"github.com/tigerhall-kittens/pkg/upload"
 	"github.com/tigerhall-kittens/pkg/utils"
 )
 
+var (
+	// ErrTigerNotFound is returned when the requested tiger does not exist.
+	ErrTigerNotFound = errors.New("tiger not found")
+	// ErrForbidden is returned when the user is not allowed to change the requested resource.
+	ErrForbidden = errors.New("only the creator of the tiger or an admin can change it")
+	// ErrSightingNotFound is returned when the requested sighting does not exist.
+	ErrSightingNotFound = errors.New("tiger sighting not found")
+	// ErrImageNotFound is returned when the sighting does not exist or has no such image.
+	ErrImageNotFound = errors.New("sighting image not found")
+	// ErrNotSightingReporter is returned when the user is not allowed to add images to the requested sighting.
+	ErrNotSightingReporter = errors.New("only the reporter of the sighting or an admin can add images to it")
+	// ErrIncompleteSighting is returned when a sighting lacks fields that its image could not fill in either.
+	ErrIncompleteSighting = errors.New("latitude, longitude, timestamp and reporterEmail are required")
+	// ErrInvalidSightingRule is returned when a sighting rule override cannot be applied.
+	ErrInvalidSightingRule = errors.New("invalid sighting rule")
+	// ErrDuplicateImage is returned when an uploaded image looks like an image of an earlier sighting.
+	ErrDuplicateImage = errors.New("image is a near-duplicate of an earlier sighting image")
+	// ErrSubscriptionNotFound is returned when the user has no such area subscription.
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	// ErrInvalidNotificationPreferences is returned when notification preferences cannot be applied.
+	ErrInvalidNotificationPreferences = errors.New("invalid notification preferences")
+)
+
+// maxSimilarImages bounds the number of similar images listed for each image of a sighting.
+const maxSimilarImages = 20
+
+// signedImageURLExpiry is how long a link to a sighting image in the image store stays valid.
+const signedImageURLExpiry = 15 * time.Minute
+
 type service struct {
-	TigerRepo     repository.TigerRepository
-	messageBroker *messaging.MessageBroker
+	TigerRepo    repository.TigerRepository
+	sightingRule rules.Rule
+	exifCheck    exif.Check
+	duplicates   dhash.Check
+	images       imagestore.ImageStore
+	uploadLimits upload.Limits
+	// publicURL is where clients reach the API, for links in notification emails
+	publicURL string
+	// protectedDecimals is the precision of the coordinates of protected tigers in responses; nil leaves them exact
+	protectedDecimals *int
+}
+
+// Option configures optional behaviour of the service.
+type Option func(*service)
+
+// WithSightingRule sets the default proximity rule for new sightings.
+func WithSightingRule(rule rules.Rule) Option {
+	return func(s *service) {
+		s.sightingRule = rule
+	}
+}
+
+// WithExifCheck sets when sightings are flagged for disagreeing with the EXIF data of their image.
+func WithExifCheck(check exif.Check) Option {
+	return func(s *service) {
+		s.exifCheck = check
+	}
+}
+
+// WithDuplicateCheck sets when uploaded images are rejected or flagged as near-duplicates of earlier images.
+func WithDuplicateCheck(check dhash.Check) Option {
+	return func(s *service) {
+		s.duplicates = check
+	}
 }
 
-func NewTigerService(tigerRepository repository.TigerRepository, broker *messaging.MessageBroker) TigerService {
-	return service{
-		TigerRepo:     tigerRepository,
-		messageBroker: broker,
+// WithImageStore sets the store that keeps sighting images.
+func WithImageStore(images imagestore.ImageStore) Option {
+	return func(s *service) {
+		s.images = images
+	}
+}
+
+// WithUploadLimits sets the limits that uploaded sighting images must stay within.
+func WithUploadLimits(limits upload.Limits) Option {
+	return func(s *service) {
+		s.uploadLimits = limits
+	}
+}
+
+// WithPublicURL sets the address at which clients reach the API, for links in notification emails.
+func WithPublicURL(url string) Option {
+	return func(s *service) {
+		s.publicURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithProtectedCoordinateDecimals rounds the coordinates of protected tigers and their sightings
+// in responses to the given number of decimal places.
+func WithProtectedCoordinateDecimals(decimals int) Option {
+	return func(s *service) {
+		s.protectedDecimals = &decimals
+	}
+}
+
+func NewTigerService(tigerRepository repository.TigerRepository, opts ...Option) TigerService {
+	s := service{
+		TigerRepo:    tigerRepository,
+		sightingRule: rules.DefaultRule,
+		exifCheck:    exif.DefaultCheck,
+		duplicates:   dhash.DefaultCheck,
+		uploadLimits: upload.DefaultLimits,
+	}
+	for _, opt := range opts {
+		opt(&s)
 	}
+	return s
 }
 
 type TigerService interface {
 	SignupService(*models.User) error
 	LoginService(models.LoginCredentials) (*models.User, error)
-	CreateTigerService(tiger models.Tiger) error
+	CreateTigerService(tiger models.Tiger, creatorEmail string) error
 	GetAllTigersService(page, size int) ([]*models.Tiger, int, error)
+	GetTigerByIDService(tigerID int) (*models.TigerProfile, error)
+	UpdateTigerService(tigerID int, update models.TigerUpdate, requesterEmail string) (*models.Tiger, error)
+	DeleteTigerService(tigerID int, requesterEmail string) error
+	SetSightingRuleService(rule models.SightingRule, requesterEmail string) error
+	GetTigerTrackService(tigerID int) (*models.Tiger, []*models.TigerSighting, error)
+	GetSightingsTrackService(from, to time.Time) ([]*models.Tiger, []*models.TigerSighting, error)
+	GetSightingsNearService(center models.Coordinates, radiusKm float64, since time.Time, limit int) (*models.AreaSearchResult, error)
+	GetSightingsInBoundingBoxService(box models.BoundingBox, since time.Time, limit int) (*models.AreaSearchResult, error)
 	CreateTigerSightingService(*models.TigerSighting) error
 	GetTigerSightingsByIDService(tigerID, page, pageSize int) ([]*models.TigerSighting, int, error)
+	GetSightingImageService(sightingID int, size models.ImageSize) (*models.SightingImage, error)
+	GetSightingImageByIDService(sightingID, imageID int, size models.ImageSize) (*models.SightingImage, error)
+	GetSightingImagesService(sightingID int) ([]*models.SightingImage, error)
+	AddSightingImagesService(sightingID int, images [][]byte, requesterEmail string) ([]*models.SightingImage, error)
+	GetSimilarSightingImagesService(sightingID int) ([]*models.SimilarImage, error)
+	SubscribeToTigerService(tigerID int, userEmail string) error
+	UnsubscribeFromTigerService(tigerID int, userEmail string) error
+	CreateAreaSubscriptionService(subscription models.AreaSubscription, userEmail string) (*models.AreaSubscription, error)
+	DeleteAreaSubscriptionService(subscriptionID int, userEmail string) error
+	GetSubscriptionsService(userEmail string) (*models.Subscriptions, error)
+	GetNotificationPreferencesService(userEmail string) (*models.NotificationPreferences, error)
+	SetNotificationPreferencesService(prefs models.NotificationPreferences, userEmail string) (*models.NotificationPreferences, error)
 }
 
 func (s service) SignupService(user *models.User) error {
@@ -42,12 +175,19 @@ func (s service) SignupService(user *models.User) error {
 	}
 	user.Password = hashedPassword
 
-	// Create the user in the database
-	if err := s.TigerRepo.CreateUser(user); err != nil {
-		log.Println("error on DB user create " + err.Error())
-		return errors.New("failed to create user")
-	}
-	return err
+	// Create the user in the database, together with the event announcing them
+	return s.TigerRepo.WithTx(func(repo repository.TigerRepository) error {
+		if err := repo.CreateUser(user); err != nil {
+			log.Println("error on DB user create " + err.Error())
+			return errors.New("failed to create user")
+		}
+
+		event, err := events.NewUserSignedUp(user, time.Now())
+		if err != nil {
+			return err
+		}
+		return outbox.Enqueue(repo, event)
+	})
 }
 
 func (s service) LoginService(credentials models.LoginCredentials) (*models.User, error) {
@@ -64,12 +204,26 @@ func (s service) LoginService(credentials models.LoginCredentials) (*models.User
 	return user, nil
 }
 
-func (s service) CreateTigerService(tiger models.Tiger) error {
-	// Create the tiger in the database
-	if err := s.TigerRepo.CreateTiger(&tiger); err != nil {
-		return errors.New("failed to create tiger")
+func (s service) CreateTigerService(tiger models.Tiger, creatorEmail string) error {
+	// Record the user creating the tiger so that only they (or an admin) can change it later
+	creator, err := s.TigerRepo.GetUserByEmail(creatorEmail)
+	if err != nil {
+		return errors.New("failed to find creator of tiger")
 	}
-	return nil
+	tiger.CreatedBy = creator.ID
+
+	// Create the tiger in the database, together with the event announcing it
+	return s.TigerRepo.WithTx(func(repo repository.TigerRepository) error {
+		if err := repo.CreateTiger(&tiger); err != nil {
+			return errors.New("failed to create tiger")
+		}
+
+		event, err := events.NewTigerCreated(s.describeTiger(&tiger), time.Now())
+		if err != nil {
+			return err
+		}
+		return outbox.Enqueue(repo, event)
+	})
 }
 
 func (s service) GetAllTigersService(page, size int) ([]*models.Tiger, int, error) {
@@ -81,54 +235,559 @@ func (s service) GetAllTigersService(page, size int) ([]*models.Tiger, int, erro
 
 	// Sort the tigers by the last seen time
 	sort.Slice(tigers, func(i, j int) bool { return tigers[i].LastSeen.After(tigers[j].LastSeen) })
+	s.coarsenProtectedTigers(tigers)
 	return tigers, totalCount, nil
 }
 
+func (s service) GetTigerByIDService(tigerID int) (*models.TigerProfile, error) {
+	// Get the tiger from the database
+	tiger, err := s.TigerRepo.GetTigerByID(tigerID)
+	if err != nil {
+		log.Println("error on DB tiger fetch " + err.Error())
+		return nil, errors.New("failed to fetch tiger")
+	}
+	if tiger == nil {
+		return nil, ErrTigerNotFound
+	}
+
+	// Summarise the sightings reported for the tiger
+	summary, err := s.TigerRepo.GetTigerSightingSummary(tigerID)
+	if err != nil {
+		log.Println("error on DB sighting summary fetch " + err.Error())
+		return nil, errors.New("failed to fetch tiger sighting summary")
+	}
+
+	// The last known location is the latest sighting, falling back to the tiger's own coordinates
+	summary.LastKnownLocation = models.Coordinates{Lat: tiger.Lat, Long: tiger.Long}
+	latestSighting, err := s.TigerRepo.GetPreviousTigerSighting(tigerID)
+	if err != nil {
+		return nil, errors.New("failed to retrieve previous sighting")
+	}
+	if latestSighting != nil {
+		summary.LastKnownLocation = models.Coordinates{Lat: latestSighting.Lat, Long: latestSighting.Long}
+	}
+	if tiger.Protected {
+		s.coarsen(&tiger.Lat, &tiger.Long)
+		s.coarsen(&summary.LastKnownLocation.Lat, &summary.LastKnownLocation.Long)
+	}
+
+	return &models.TigerProfile{Tiger: *tiger, SightingSummary: *summary}, nil
+}
+
+func (s service) UpdateTigerService(tigerID int, update models.TigerUpdate, requesterEmail string) (*models.Tiger, error) {
+	tiger, err := s.authorizeTigerChange(tigerID, requesterEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply only the fields present in the update
+	if update.Name != nil {
+		tiger.Name = *update.Name
+	}
+	if update.DateOfBirth != nil {
+		tiger.DateOfBirth = *update.DateOfBirth
+	}
+	if update.Protected != nil {
+		tiger.Protected = *update.Protected
+	}
+
+	if err := s.TigerRepo.UpdateTiger(tiger); err != nil {
+		log.Println("error on DB tiger update " + err.Error())
+		return nil, errors.New("failed to update tiger")
+	}
+	return tiger, nil
+}
+
+func (s service) DeleteTigerService(tigerID int, requesterEmail string) error {
+	if _, err := s.authorizeTigerChange(tigerID, requesterEmail); err != nil {
+		return err
+	}
+
+	// The sightings are deleted with the tiger, so collect their images first
+	var imageKeys []string
+	if s.images != nil {
+		keys, err := s.TigerRepo.GetSightingImageKeys(tigerID)
+		if err != nil {
+			log.Println("error on DB sighting image keys fetch " + err.Error())
+			return errors.New("failed to fetch sighting images")
+		}
+		imageKeys = keys
+	}
+
+	if err := s.TigerRepo.DeleteTiger(tigerID); err != nil {
+		log.Println("error on DB tiger delete " + err.Error())
+		return errors.New("failed to delete tiger")
+	}
+
+	for _, key := range imageKeys {
+		s.deleteImage(key)
+	}
+	return nil
+}
+
+// authorizeTigerChange returns the tiger if the requester created it or is an admin.
+func (s service) authorizeTigerChange(tigerID int, requesterEmail string) (*models.Tiger, error) {
+	tiger, err := s.TigerRepo.GetTigerByID(tigerID)
+	if err != nil {
+		log.Println("error on DB tiger fetch " + err.Error())
+		return nil, errors.New("failed to fetch tiger")
+	}
+	if tiger == nil {
+		return nil, ErrTigerNotFound
+	}
+
+	requester, err := s.TigerRepo.GetUserByEmail(requesterEmail)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, ErrForbidden
+	}
+	if err != nil {
+		log.Println("error on DB user fetch " + err.Error())
+		return nil, errors.New("failed to fetch user")
+	}
+
+	// Tigers created before ownership was recorded can only be changed by admins
+	if requester.Role != models.RoleAdmin && (tiger.CreatedBy == 0 || tiger.CreatedBy != requester.ID) {
+		return nil, ErrForbidden
+	}
+	return tiger, nil
+}
+
 func (s service) CreateTigerSightingService(newSighting *models.TigerSighting) error {
+	// Reject images that are too large or in an unsupported format before anything decodes them,
+	// then prefill and cross-check the location and time with the images' EXIF data
+	if err := s.validateImages(0, newSighting.Images); err != nil {
+		return err
+	}
+	s.applyExif(newSighting)
+
 	// Check if the required fields are provided
 	if newSighting.Lat == 0 || newSighting.Long == 0 || newSighting.Timestamp.IsZero() || newSighting.ReporterEmail == "" {
-		return errors.New("latitude, longitude, timestamp and reporterEmail are required")
+		return ErrIncompleteSighting
+	}
+
+	// Upload the images before the transaction so that the row lock is not held during the upload
+	if len(newSighting.Images) > 0 {
+		stored, err := s.storeSightingImages(newSighting.TigerID, newSighting.Images)
+		if err != nil {
+			return err
+		}
+		newSighting.Images = nil
+		newSighting.StoredImages = stored
 	}
 
-	// Check if the tiger has a previous sighting
-	previousSighting, err := s.TigerRepo.GetPreviousTigerSighting(newSighting.TigerID)
+	// Check and insert under a lock on the tiger so that concurrent reports of the same tiger
+	// cannot both pass the distance and duplicate image checks
+	err := s.TigerRepo.WithTx(func(repo repository.TigerRepository) error {
+		locked, err := repo.LockTiger(newSighting.TigerID)
+		if err != nil {
+			log.Println("error on DB tiger lock " + err.Error())
+			return errors.New("failed to lock tiger")
+		}
+		if locked == nil {
+			return ErrTigerNotFound
+		}
+
+		// Reporters re-upload the same camera-trap frame as a new sighting
+		duplicates, err := s.checkDuplicates(repo, newSighting.StoredImages)
+		if err != nil {
+			return err
+		}
+		newSighting.Flags = append(newSighting.Flags, duplicates...)
+
+		// Check the new sighting against the tiger's proximity rule
+		violation, err := s.checkSightingRule(repo, newSighting)
+		if err != nil {
+			return err
+		}
+		if violation != nil {
+			if violation.Rule.Action == rules.ActionReject {
+				return violation
+			}
+			newSighting.Flags = append(newSighting.Flags, violation.Reason())
+		}
+
+		// Create the tiger sighting in the database
+		if err := repo.CreateTigerSighting(newSighting); err != nil {
+			log.Println("error on DB tiger sighting create " + err.Error())
+			return errors.New("failed to create tiger sighting")
+		}
+
+		// A repeated image does not notify the reporters of the tiger again
+		return s.enqueueSighting(repo, locked, newSighting, len(duplicates) == 0)
+	})
 	if err != nil {
-		return errors.New("failed to retrieve previous sighting")
+		// The sighting was not recorded, so nothing refers to its images
+		s.deleteImages(newSighting.StoredImages)
+		return err
 	}
+	return nil
+}
 
-	// If there is a previous sighting, calculate the distance between the coordinates
-	if previousSighting != nil {
-		previousCoordinates := models.Coordinates{Lat: previousSighting.Lat, Long: previousSighting.Long}
-		currentCoordinates := models.Coordinates{Lat: newSighting.Lat, Long: newSighting.Long}
-		distance := utils.CalculateDistance(previousCoordinates, currentCoordinates)
+// enqueueSighting writes the event announcing the new sighting to the outbox, followed by the emails
+// about it when notify is set. The location of a protected tiger is coarsened in both.
+func (s service) enqueueSighting(repo repository.TigerRepository, tiger *models.Tiger, newSighting *models.TigerSighting, notify bool) error {
+	described := s.describeSighting(tiger, newSighting)
 
-		// If the distance is less than or equal to 5 kilometers, reject the new sighting
-		if distance <= 5.0 {
-			return errors.New("A tiger sighting within 5 kilometers already exists")
+	now := time.Now()
+	sightingEvent, err := events.NewSightingCreated(s.describeTiger(tiger), described, now)
+	if err != nil {
+		return err
+	}
+	if err := outbox.Enqueue(repo, sightingEvent); err != nil {
+		return err
+	}
+	if !notify {
+		return nil
+	}
+
+	recipients, err := s.sightingRecipients(repo, tiger, newSighting)
+	if err != nil {
+		return err
+	}
+	emails := s.sightingMails(tiger, described, recipients)
+	if len(emails) == 0 {
+		return nil
+	}
+	emailEvent, err := events.NewEmailRequested(emails, now, sightingEvent.CorrelationID)
+	if err != nil {
+		return err
+	}
+	return outbox.Enqueue(repo, emailEvent)
+}
+
+// describeTiger returns the tiger as it may be described outside the service, with the location of a
+// protected tiger coarsened.
+func (s service) describeTiger(tiger *models.Tiger) *models.Tiger {
+	described := *tiger
+	if tiger.Protected {
+		s.coarsen(&described.Lat, &described.Long)
+	}
+	return &described
+}
+
+// describeSighting returns the sighting of the tiger as it may be described outside the service, with
+// the location of a protected tiger coarsened.
+func (s service) describeSighting(tiger *models.Tiger, sighting *models.TigerSighting) *models.TigerSighting {
+	described := *sighting
+	if tiger.Protected {
+		s.coarsen(&described.Lat, &described.Long)
+	}
+	return &described
+}
+
+// sightingRecipients lists who to notify of the new sighting: the other reporters of the tiger, its
+// subscribers and the subscribers of an area around the sighting, as their preferences allow.
+func (s service) sightingRecipients(repo repository.TigerRepository, tiger *models.Tiger, newSighting *models.TigerSighting) ([]utils.Recipient, error) {
+	previousSightings, err := repo.GetTigerSightingsByID(newSighting.TigerID)
+	if err != nil {
+		return nil, errors.New("failed to retrieve previous sightings")
+	}
+	var recipients []utils.Recipient
+	for _, sighting := range previousSightings {
+		recipients = append(recipients, utils.Recipient{Email: sighting.ReporterEmail, Reason: "you reported a sighting of this tiger"})
+	}
+
+	subscribers, err := repo.GetTigerSubscriberEmails(newSighting.TigerID)
+	if err != nil {
+		log.Println("error on DB tiger subscribers fetch " + err.Error())
+		return nil, errors.New("failed to retrieve tiger subscribers")
+	}
+	for _, email := range subscribers {
+		recipients = append(recipients, utils.Recipient{Email: email, Reason: "you subscribed to this tiger"})
+	}
+
+	// An area subscription would give away roughly where a protected tiger is, so only the
+	// subscribers of the tiger itself hear of it
+	if !tiger.Protected {
+		areas, err := repo.GetAreaSubscriptionsContaining(models.Coordinates{Lat: newSighting.Lat, Long: newSighting.Long})
+		if err != nil {
+			log.Println("error on DB area subscriptions fetch " + err.Error())
+			return nil, errors.New("failed to retrieve area subscriptions")
+		}
+		for _, area := range areas {
+			reason := fmt.Sprintf("you subscribed to sightings within %v km of {Lat: %v, Long: %v}", area.RadiusKm, area.Lat, area.Long)
+			recipients = append(recipients, utils.Recipient{Email: area.Email, Reason: reason})
 		}
 	}
 
-	// Create the tiger sighting in the database
-	err = s.TigerRepo.CreateTigerSighting(newSighting)
+	return s.applyPreferences(repo, recipients)
+}
+
+// applyPreferences drops the recipients who turned email notifications off and holds back the
+// emails of those in their quiet hours or receiving a daily digest.
+func (s service) applyPreferences(repo repository.TigerRepository, recipients []utils.Recipient) ([]utils.Recipient, error) {
+	if len(recipients) == 0 {
+		return nil, nil
+	}
+
+	emails := make([]string, len(recipients))
+	for i, recipient := range recipients {
+		emails[i] = recipient.Email
+	}
+	saved, err := repo.GetNotificationPreferences(emails)
 	if err != nil {
-		return errors.New("failed to create tiger sighting,err:" + err.Error())
+		log.Println("error on DB notification preferences fetch " + err.Error())
+		return nil, errors.New("failed to retrieve notification preferences")
+	}
+	preferences := make(map[string]models.NotificationPreferences, len(saved))
+	for _, prefs := range saved {
+		preferences[strings.ToLower(prefs.Email)] = *prefs
+	}
+
+	now := time.Now()
+	var allowed []utils.Recipient
+	for _, recipient := range recipients {
+		prefs, ok := preferences[strings.ToLower(recipient.Email)]
+		if !ok {
+			prefs = models.DefaultNotificationPreferences()
+		}
+		if !notifier.HasChannel(prefs, models.ChannelEmail) {
+			continue
+		}
+		recipient.DeliverAfter = notifier.DeliverAfter(prefs, now)
+		allowed = append(allowed, recipient)
+	}
+	return allowed, nil
+}
+
+// sightingMails describes the new sighting to the recipients, with a link to the sightings of the tiger.
+func (s service) sightingMails(tiger *models.Tiger, newSighting *models.TigerSighting, recipients []utils.Recipient) []utils.EmailTemplate {
+	var link string
+	if s.publicURL != "" {
+		link = fmt.Sprintf("%s/tiger/%d/sightings", s.publicURL, tiger.ID)
+	}
+	return utils.GetMails(tiger, newSighting, recipients, link)
+}
+
+// applyExif fills in the location and time missing from the sighting from the EXIF data of the
+// first image that has them, and flags the sighting when the images disagree with the reported
+// or prefilled values.
+func (s service) applyExif(sighting *models.TigerSighting) {
+	for i, data := range sighting.Images {
+		meta, err := exif.Parse(data)
+		if err != nil {
+			if !errors.Is(err, exif.ErrNoExif) {
+				log.Printf("failed to parse EXIF data of sighting image: %v", err)
+			}
+			continue
+		}
+
+		for _, mismatch := range s.exifCheck.Apply(sighting, meta) {
+			if len(sighting.Images) > 1 {
+				mismatch = fmt.Sprintf("image %d: %s", i+1, mismatch)
+			}
+			sighting.Flags = append(sighting.Flags, mismatch)
+		}
+	}
+}
+
+// checkDuplicates looks for earlier images that the stored images are near-duplicates of. It returns
+// ErrDuplicateImage when the check rejects them and the flags to record on the sighting otherwise.
+func (s service) checkDuplicates(repo repository.TigerRepository, images []*models.SightingImage) ([]string, error) {
+	var flags []string
+	for i, img := range images {
+		if img.DHash == 0 {
+			continue
+		}
+		matches, err := repo.FindSimilarImages(img.DHash, s.duplicates.MaxDistance, 1)
+		if err != nil {
+			log.Println("error on DB similar images fetch " + err.Error())
+			return nil, errors.New("failed to check for duplicate images")
+		}
+		if len(matches) == 0 {
+			continue
+		}
+
+		reason := fmt.Sprintf("looks like image %d of sighting %d", matches[0].ID, matches[0].SightingID)
+		if s.duplicates.Action == rules.ActionReject {
+			if len(images) > 1 {
+				return nil, fmt.Errorf("image %d: %w: %s", i+1, ErrDuplicateImage, reason)
+			}
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateImage, reason)
+		}
+		if len(images) > 1 {
+			reason = fmt.Sprintf("image %d: %s", i+1, reason)
+		}
+		flags = append(flags, reason)
 	}
+	return flags, nil
+}
 
-	previousSightings, err := s.TigerRepo.GetTigerSightingsByID(newSighting.TigerID)
+// validateImages checks the count, size and format of images added to a sighting that already has existing ones.
+func (s service) validateImages(existing int, images [][]byte) error {
+	if len(images) == 0 {
+		return nil
+	}
+	if err := s.uploadLimits.CheckCount(existing, len(images)); err != nil {
+		return err
+	}
+
+	for i, data := range images {
+		if _, err := s.uploadLimits.Validate(data); err != nil {
+			if len(images) > 1 {
+				return fmt.Errorf("image %d: %w", i+1, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSightingRule evaluates the new sighting against the configured rule and the tiger's override.
+func (s service) checkSightingRule(repo repository.TigerRepository, newSighting *models.TigerSighting) (*rules.Violation, error) {
+	override, err := repo.GetSightingRule(newSighting.TigerID)
 	if err != nil {
-		return errors.New("failed to retrieve previous sightings")
+		log.Println("error on DB sighting rule fetch " + err.Error())
+		return nil, errors.New("failed to retrieve sighting rule")
 	}
+	rule := s.sightingRule.WithOverride(override)
 
-	// Publish a new tiger sighting message
-	if s.messageBroker != nil {
-		if err := s.messageBroker.PublishMessage(utils.GetMails(previousSightings)); err != nil {
-			log.Printf("failed to publish message: %v", err)
+	// Without a time window only the latest sighting is compared
+	var earlierSightings []*models.TigerSighting
+	if from, to, ok := rule.Window(newSighting.Timestamp); ok {
+		earlierSightings, err = repo.GetTigerSightingsBetween(newSighting.TigerID, from, to)
+		if err != nil {
+			return nil, errors.New("failed to retrieve previous sightings")
 		}
+	} else {
+		previousSighting, err := repo.GetPreviousTigerSighting(newSighting.TigerID)
+		if err != nil {
+			return nil, errors.New("failed to retrieve previous sighting")
+		}
+		if previousSighting != nil {
+			earlierSightings = append(earlierSightings, previousSighting)
+		}
+	}
+
+	return rule.Evaluate(newSighting, earlierSightings), nil
+}
+
+func (s service) SetSightingRuleService(rule models.SightingRule, requesterEmail string) error {
+	if _, err := s.authorizeTigerChange(rule.TigerID, requesterEmail); err != nil {
+		return err
 	}
 
+	// Validate the override on top of the configured rule
+	if err := s.sightingRule.WithOverride(&rule).Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSightingRule, err)
+	}
+
+	if err := s.TigerRepo.UpsertSightingRule(&rule); err != nil {
+		log.Println("error on DB sighting rule save " + err.Error())
+		return errors.New("failed to save sighting rule")
+	}
 	return nil
 }
 
+func (s service) GetTigerTrackService(tigerID int) (*models.Tiger, []*models.TigerSighting, error) {
+	tiger, err := s.TigerRepo.GetTigerByID(tigerID)
+	if err != nil {
+		log.Println("error on DB tiger fetch " + err.Error())
+		return nil, nil, errors.New("failed to fetch tiger")
+	}
+	if tiger == nil {
+		return nil, nil, ErrTigerNotFound
+	}
+
+	sightings, err := s.TigerRepo.GetTigerSightingsByID(tigerID)
+	if err != nil {
+		return nil, nil, errors.New("failed to retrieve tiger sightings")
+	}
+
+	// A track runs forward in time
+	sort.Slice(sightings, func(i, j int) bool { return sightings[i].Timestamp.Before(sightings[j].Timestamp) })
+	s.coarsenProtectedSightings(s.coarsenProtectedTigers([]*models.Tiger{tiger}), sightings)
+	return tiger, sightings, nil
+}
+
+func (s service) GetSightingsTrackService(from, to time.Time) ([]*models.Tiger, []*models.TigerSighting, error) {
+	sightings, err := s.TigerRepo.GetSightingsBetween(from, to)
+	if err != nil {
+		log.Println("error on DB sightings fetch " + err.Error())
+		return nil, nil, errors.New("failed to retrieve tiger sightings")
+	}
+	if len(sightings) == 0 {
+		return []*models.Tiger{}, []*models.TigerSighting{}, nil
+	}
+
+	// Fetch each tiger seen in the period once
+	seen := map[int]bool{}
+	var tigerIDs []int
+	for _, sighting := range sightings {
+		if !seen[sighting.TigerID] {
+			seen[sighting.TigerID] = true
+			tigerIDs = append(tigerIDs, sighting.TigerID)
+		}
+	}
+
+	tigers, err := s.TigerRepo.GetTigersByIDs(tigerIDs)
+	if err != nil {
+		log.Println("error on DB tigers fetch " + err.Error())
+		return nil, nil, errors.New("failed to fetch tigers")
+	}
+	s.coarsenProtectedSightings(s.coarsenProtectedTigers(tigers), sightings)
+	return tigers, sightings, nil
+}
+
+func (s service) GetSightingsNearService(center models.Coordinates, radiusKm float64, since time.Time, limit int) (*models.AreaSearchResult, error) {
+	sightings, err := s.TigerRepo.GetSightingsNear(center, radiusKm, since, limit, s.searchDecimals())
+	if err != nil {
+		log.Println("error on DB sightings search " + err.Error())
+		return nil, errors.New("failed to search tiger sightings")
+	}
+	return s.areaSearchResult(sightings)
+}
+
+func (s service) GetSightingsInBoundingBoxService(box models.BoundingBox, since time.Time, limit int) (*models.AreaSearchResult, error) {
+	sightings, err := s.TigerRepo.GetSightingsInBoundingBox(box, since, limit, s.searchDecimals())
+	if err != nil {
+		log.Println("error on DB sightings search " + err.Error())
+		return nil, errors.New("failed to search tiger sightings")
+	}
+	return s.areaSearchResult(sightings)
+}
+
+// areaSearchResult adds the distinct tigers of the sightings, ordered by their nearest sighting.
+func (s service) areaSearchResult(sightings []*models.NearbySighting) (*models.AreaSearchResult, error) {
+	result := &models.AreaSearchResult{Sightings: sightings, Tigers: []*models.Tiger{}}
+	if len(sightings) == 0 {
+		result.Sightings = []*models.NearbySighting{}
+		return result, nil
+	}
+
+	// Sightings arrive nearest first, so the first sighting of a tiger is its nearest
+	nearest := map[int]int{}
+	var tigerIDs []int
+	for i, sighting := range sightings {
+		if _, ok := nearest[sighting.TigerID]; !ok {
+			nearest[sighting.TigerID] = i
+			tigerIDs = append(tigerIDs, sighting.TigerID)
+		}
+	}
+
+	tigers, err := s.TigerRepo.GetTigersByIDs(tigerIDs)
+	if err != nil {
+		log.Println("error on DB tigers fetch " + err.Error())
+		return nil, errors.New("failed to fetch tigers")
+	}
+	sort.Slice(tigers, func(i, j int) bool { return nearest[tigers[i].ID] < nearest[tigers[j].ID] })
+	result.Tigers = tigers
+
+	// The sightings of protected tigers were matched and returned on their coarsened coordinates already
+	s.coarsenProtectedTigers(tigers)
+
+	return result, nil
+}
+
+// searchDecimals is the precision that area searches match protected tigers on. Matching them on their
+// exact coordinates would let a caller narrow the search until it locates them to the metre.
+func (s service) searchDecimals() int {
+	if s.protectedDecimals == nil {
+		return -1
+	}
+	return *s.protectedDecimals
+}
+
 func (s service) GetTigerSightingsByIDService(tigerID, page, pageSize int) ([]*models.TigerSighting, int, error) {
 	// Get a list of all tiger sightings for the specific tiger from the database with pagination
 	tigerSightings, totalCount, err := s.TigerRepo.GetTigerSightingsByIDWithPagination(tigerID, page, pageSize)
@@ -141,5 +800,549 @@ func (s service) GetTigerSightingsByIDService(tigerID, page, pageSize int) ([]*m
 		return tigerSightings[i].Timestamp.After(tigerSightings[j].Timestamp)
 	})
 
+	if s.protectedDecimals != nil {
+		tiger, err := s.TigerRepo.GetTigerByID(tigerID)
+		if err != nil {
+			log.Println("error on DB tiger fetch " + err.Error())
+			return []*models.TigerSighting{}, totalCount, errors.New("failed to fetch tiger")
+		}
+		if tiger != nil {
+			s.coarsenProtectedSightings(s.coarsenProtectedTigers([]*models.Tiger{tiger}), tigerSightings)
+		}
+	}
+
 	return tigerSightings, totalCount, nil
 }
+
+func (s service) GetSightingImageService(sightingID int, size models.ImageSize) (*models.SightingImage, error) {
+	img, err := s.TigerRepo.GetSightingImage(sightingID)
+	if err != nil {
+		log.Println("error on DB sighting image fetch " + err.Error())
+		return nil, errors.New("failed to fetch sighting image")
+	}
+	if img == nil || (img.Key == "" && len(img.Data) == 0) {
+		return nil, ErrImageNotFound
+	}
+
+	// Images of older sightings are still kept in the database, in a single size
+	if img.Key == "" {
+		return stripServedImage(img)
+	}
+	return s.loadImage(img, size)
+}
+
+func (s service) GetSightingImageByIDService(sightingID, imageID int, size models.ImageSize) (*models.SightingImage, error) {
+	img, err := s.TigerRepo.GetSightingImageByID(sightingID, imageID)
+	if err != nil {
+		log.Println("error on DB sighting image fetch " + err.Error())
+		return nil, errors.New("failed to fetch sighting image")
+	}
+	if img == nil {
+		return nil, ErrImageNotFound
+	}
+	return s.loadImage(img, size)
+}
+
+// loadImage links to the image in the image store, or reads it when the store cannot serve it directly.
+func (s service) loadImage(img *models.SightingImage, size models.ImageSize) (*models.SightingImage, error) {
+	if s.images == nil {
+		return nil, errors.New("no image store configured")
+	}
+
+	// Link to the image when the store can serve it directly
+	key := imagestore.RenditionKey(img.Key, size)
+	url, err := s.images.SignedURL(key, signedImageURLExpiry)
+	if err == nil {
+		img.URL = url
+		return img, nil
+	}
+	if !errors.Is(err, imagestore.ErrSignedURLUnsupported) {
+		log.Println("error on image store sign " + err.Error())
+		return nil, errors.New("failed to fetch sighting image")
+	}
+
+	img.Data, err = s.images.Get(key)
+	if errors.Is(err, imagestore.ErrNotFound) {
+		return nil, ErrImageNotFound
+	} else if err != nil {
+		log.Println("error on image store fetch " + err.Error())
+		return nil, errors.New("failed to fetch sighting image")
+	}
+
+	return stripServedImage(img)
+}
+
+func (s service) GetSightingImagesService(sightingID int) ([]*models.SightingImage, error) {
+	if _, err := s.getSighting(sightingID); err != nil {
+		return nil, err
+	}
+
+	images, err := s.TigerRepo.GetSightingImages(sightingID)
+	if err != nil {
+		log.Println("error on DB sighting images fetch " + err.Error())
+		return nil, errors.New("failed to fetch sighting images")
+	}
+	if images == nil {
+		images = []*models.SightingImage{}
+	}
+	return images, nil
+}
+
+func (s service) AddSightingImagesService(sightingID int, images [][]byte, requesterEmail string) ([]*models.SightingImage, error) {
+	sighting, err := s.getSighting(sightingID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the reporter of the sighting, or an admin, can add to it
+	requester, err := s.TigerRepo.GetUserByEmail(requesterEmail)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, ErrNotSightingReporter
+	}
+	if err != nil {
+		log.Println("error on DB user fetch " + err.Error())
+		return nil, errors.New("failed to fetch user")
+	}
+	if requester.Role != models.RoleAdmin && requester.Email != sighting.ReporterEmail {
+		return nil, ErrNotSightingReporter
+	}
+
+	if err := s.validateImages(sighting.ImageCount, images); err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		return []*models.SightingImage{}, nil
+	}
+
+	stored, err := s.storeSightingImages(sighting.TigerID, images)
+	if err != nil {
+		return nil, err
+	}
+
+	// The reporters were notified of the sighting already, so a flagged duplicate only marks it for review
+	duplicates, err := s.checkDuplicates(s.TigerRepo, stored)
+	if err != nil {
+		s.deleteImages(stored)
+		return nil, err
+	}
+	if err := s.TigerRepo.AddSightingImages(sightingID, stored, duplicates); err != nil {
+		log.Println("error on DB sighting images add " + err.Error())
+		s.deleteImages(stored)
+		return nil, errors.New("failed to add sighting images")
+	}
+	return stored, nil
+}
+
+func (s service) GetSimilarSightingImagesService(sightingID int) ([]*models.SimilarImage, error) {
+	if _, err := s.getSighting(sightingID); err != nil {
+		return nil, err
+	}
+
+	images, err := s.TigerRepo.GetSightingImages(sightingID)
+	if err != nil {
+		log.Println("error on DB sighting images fetch " + err.Error())
+		return nil, errors.New("failed to fetch sighting images")
+	}
+
+	// An image can look like several images of the sighting; it is listed once, with its closest match
+	similar := []*models.SimilarImage{}
+	listed := map[int]*models.SimilarImage{}
+	for _, img := range images {
+		if img.DHash == 0 {
+			continue
+		}
+		matches, err := s.TigerRepo.FindSimilarImages(img.DHash, s.duplicates.MaxDistance, maxSimilarImages)
+		if err != nil {
+			log.Println("error on DB similar images fetch " + err.Error())
+			return nil, errors.New("failed to find similar sighting images")
+		}
+
+		for _, match := range matches {
+			if match.SightingID == sightingID {
+				continue
+			}
+			match.MatchedImageID = img.ID
+			if earlier, ok := listed[match.ID]; ok {
+				if match.Distance < earlier.Distance {
+					*earlier = *match
+				}
+				continue
+			}
+			listed[match.ID] = match
+			similar = append(similar, match)
+		}
+	}
+
+	sort.SliceStable(similar, func(i, j int) bool { return similar[i].Distance < similar[j].Distance })
+	return similar, nil
+}
+
+func (s service) SubscribeToTigerService(tigerID int, userEmail string) error {
+	tiger, err := s.TigerRepo.GetTigerByID(tigerID)
+	if err != nil {
+		log.Println("error on DB tiger fetch " + err.Error())
+		return errors.New("failed to fetch tiger")
+	}
+	if tiger == nil {
+		return ErrTigerNotFound
+	}
+
+	user, err := s.getUser(userEmail)
+	if err != nil {
+		return err
+	}
+
+	if err := s.TigerRepo.SubscribeToTiger(user.ID, tigerID); err != nil {
+		log.Println("error on DB tiger subscribe " + err.Error())
+		return errors.New("failed to subscribe to tiger")
+	}
+	return nil
+}
+
+// UnsubscribeFromTigerService succeeds whether or not the user was subscribed to the tiger.
+func (s service) UnsubscribeFromTigerService(tigerID int, userEmail string) error {
+	user, err := s.getUser(userEmail)
+	if err != nil {
+		return err
+	}
+
+	if err := s.TigerRepo.UnsubscribeFromTiger(user.ID, tigerID); err != nil {
+		log.Println("error on DB tiger unsubscribe " + err.Error())
+		return errors.New("failed to unsubscribe from tiger")
+	}
+	return nil
+}
+
+func (s service) CreateAreaSubscriptionService(subscription models.AreaSubscription, userEmail string) (*models.AreaSubscription, error) {
+	user, err := s.getUser(userEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription.UserID = user.ID
+	if err := s.TigerRepo.CreateAreaSubscription(&subscription); err != nil {
+		log.Println("error on DB area subscription create " + err.Error())
+		return nil, errors.New("failed to create area subscription")
+	}
+	return &subscription, nil
+}
+
+func (s service) DeleteAreaSubscriptionService(subscriptionID int, userEmail string) error {
+	user, err := s.getUser(userEmail)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.TigerRepo.DeleteAreaSubscription(user.ID, subscriptionID)
+	if err != nil {
+		log.Println("error on DB area subscription delete " + err.Error())
+		return errors.New("failed to delete area subscription")
+	}
+	if !deleted {
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+func (s service) GetSubscriptionsService(userEmail string) (*models.Subscriptions, error) {
+	user, err := s.getUser(userEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	tigerIDs, err := s.TigerRepo.GetTigerSubscriptions(user.ID)
+	if err != nil {
+		log.Println("error on DB tiger subscriptions fetch " + err.Error())
+		return nil, errors.New("failed to retrieve tiger subscriptions")
+	}
+	areas, err := s.TigerRepo.GetAreaSubscriptions(user.ID)
+	if err != nil {
+		log.Println("error on DB area subscriptions fetch " + err.Error())
+		return nil, errors.New("failed to retrieve area subscriptions")
+	}
+
+	// Respond with empty lists rather than null
+	subscriptions := &models.Subscriptions{TigerIDs: []int{}, Areas: []*models.AreaSubscription{}}
+	subscriptions.TigerIDs = append(subscriptions.TigerIDs, tigerIDs...)
+	subscriptions.Areas = append(subscriptions.Areas, areas...)
+	return subscriptions, nil
+}
+
+// GetNotificationPreferencesService returns the preferences of the user, or the defaults when they
+// have not set their own.
+func (s service) GetNotificationPreferencesService(userEmail string) (*models.NotificationPreferences, error) {
+	saved, err := s.TigerRepo.GetNotificationPreferences([]string{userEmail})
+	if err != nil {
+		log.Println("error on DB notification preferences fetch " + err.Error())
+		return nil, errors.New("failed to retrieve notification preferences")
+	}
+	if len(saved) > 0 {
+		return saved[0], nil
+	}
+
+	prefs := models.DefaultNotificationPreferences()
+	return &prefs, nil
+}
+
+func (s service) SetNotificationPreferencesService(prefs models.NotificationPreferences, userEmail string) (*models.NotificationPreferences, error) {
+	if prefs.Channels == nil {
+		prefs.Channels = []string{}
+	}
+	if prefs.Timezone == "" {
+		prefs.Timezone = "UTC"
+	}
+	if prefs.DigestTime == "" {
+		prefs.DigestTime = models.DefaultNotificationPreferences().DigestTime
+	}
+	if err := notifier.ValidatePreferences(prefs); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidNotificationPreferences, err)
+	}
+
+	user, err := s.getUser(userEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	prefs.UserID = user.ID
+	if err := s.TigerRepo.UpsertNotificationPreferences(&prefs); err != nil {
+		log.Println("error on DB notification preferences save " + err.Error())
+		return nil, errors.New("failed to save notification preferences")
+	}
+	return &prefs, nil
+}
+
+// getUser looks up the authenticated user.
+func (s service) getUser(email string) (*models.User, error) {
+	user, err := s.TigerRepo.GetUserByEmail(email)
+	if err != nil {
+		log.Println("error on DB user fetch " + err.Error())
+		return nil, errors.New("failed to fetch user")
+	}
+	return user, nil
+}
+
+// getSighting returns the sighting, or ErrSightingNotFound when it does not exist.
+func (s service) getSighting(sightingID int) (*models.TigerSighting, error) {
+	sighting, err := s.TigerRepo.GetSighting(sightingID)
+	if err != nil {
+		log.Println("error on DB tiger sighting fetch " + err.Error())
+		return nil, errors.New("failed to fetch tiger sighting")
+	}
+	if sighting == nil {
+		return nil, ErrSightingNotFound
+	}
+	return sighting, nil
+}
+
+// stripServedImage removes metadata that images stored before it was stripped on upload may still carry.
+func stripServedImage(img *models.SightingImage) (*models.SightingImage, error) {
+	data, err := exif.Strip(img.Data)
+	if err != nil {
+		log.Println("error on image strip " + err.Error())
+		return nil, errors.New("failed to fetch sighting image")
+	}
+	img.Data = data
+	img.SHA256 = sha256Hex(data)
+	return img, nil
+}
+
+// coarsenProtectedTigers coarsens the coordinates of the protected tigers and returns their IDs.
+func (s service) coarsenProtectedTigers(tigers []*models.Tiger) map[int]bool {
+	protected := map[int]bool{}
+	for _, tiger := range tigers {
+		if tiger.Protected {
+			protected[tiger.ID] = true
+			s.coarsen(&tiger.Lat, &tiger.Long)
+		}
+	}
+	return protected
+}
+
+// coarsenProtectedSightings coarsens the coordinates of the sightings of the given protected tigers.
+func (s service) coarsenProtectedSightings(protected map[int]bool, sightings []*models.TigerSighting) {
+	for _, sighting := range sightings {
+		if protected[sighting.TigerID] {
+			s.coarsen(&sighting.Lat, &sighting.Long)
+		}
+	}
+}
+
+// coarsen rounds the coordinates when the service is configured to hide the location of protected tigers.
+func (s service) coarsen(lat, long *float64) {
+	if s.protectedDecimals == nil {
+		return
+	}
+	coarse := utils.CoarsenCoordinates(models.Coordinates{Lat: *lat, Long: *long}, *s.protectedDecimals)
+	*lat, *long = coarse.Lat, coarse.Long
+}
+
+// storeSightingImages writes the uploaded images of a sighting of the tiger to the image store.
+// Nothing is left behind in the store when one of them fails.
+func (s service) storeSightingImages(tigerID int, images [][]byte) ([]*models.SightingImage, error) {
+	if s.images == nil {
+		return nil, errors.New("no image store configured")
+	}
+
+	// Keys are unique per upload so that deleting the image of one sighting never affects another
+	batch := strconv.FormatInt(time.Now().UnixNano(), 36)
+	stored := make([]*models.SightingImage, 0, len(images))
+	for i, data := range images {
+		img, err := putImage(s.images, tigerID, batch+"-"+strconv.Itoa(i), data)
+		if errors.Is(err, upload.ErrInvalidImage) {
+			s.deleteImages(stored)
+			return nil, err
+		}
+		if err != nil {
+			log.Println("error on image store put " + err.Error())
+			s.deleteImages(stored)
+			return nil, errors.New("failed to store sighting image")
+		}
+		stored = append(stored, img)
+	}
+	return stored, nil
+}
+
+// deleteImages removes images and their renditions once they are no longer referenced.
+func (s service) deleteImages(images []*models.SightingImage) {
+	for _, img := range images {
+		s.deleteImage(img.Key)
+	}
+}
+
+// deleteImage removes an image and its renditions once they are no longer referenced.
+// Failures only leave orphaned files behind.
+func (s service) deleteImage(key string) {
+	for _, size := range imagestore.Sizes {
+		renditionKey := imagestore.RenditionKey(key, size)
+		if err := s.images.Delete(renditionKey); err != nil {
+			log.Printf("failed to delete image %s: %v", renditionKey, err)
+		}
+	}
+}
+
+// putImage writes the original image and its renditions to the image store, under keys derived
+// from the tiger, name and content hash. Malformed images return upload.ErrInvalidImage.
+func putImage(images imagestore.ImageStore, tigerID int, name string, data []byte) (*models.SightingImage, error) {
+	// The orientation is stripped with the rest of the metadata, so it is read first
+	orientation := exif.Orientation(data)
+
+	// Images are public, so the GPS position and camera details they carry are removed first
+	data, err := exif.Strip(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", upload.ErrInvalidImage, err)
+	}
+
+	// The upload limits only read the header, so a truncated or corrupt image is only found here
+	decoded, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", upload.ErrInvalidImage, err)
+	}
+	if orientation != 1 {
+		// Turn the pixels upright and store them so, as the original no longer says how to display them
+		decoded = exif.Orient(decoded, orientation)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, decoded, &jpeg.Options{Quality: 95}); err != nil {
+			return nil, fmt.Errorf("failed to encode oriented image: %v", err)
+		}
+		data, format = buf.Bytes(), "jpeg"
+	}
+	renditions, err := imagestore.Renditions(decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256Hex(data)
+	img := &models.SightingImage{
+		TigerID: tigerID,
+		Key:     fmt.Sprintf("sightings/%d/%s-%s.%s", tigerID, name, sum[:16], format),
+		SHA256:  sum,
+		Width:   decoded.Bounds().Dx(),
+		Height:  decoded.Bounds().Dy(),
+		DHash:   dhash.Hash(decoded),
+	}
+
+	// The original is written last so that an image is only referenced once all of its sizes exist
+	for size, rendition := range renditions {
+		if err := images.Put(imagestore.RenditionKey(img.Key, size), rendition, "image/jpeg"); err != nil {
+			return nil, err
+		}
+	}
+	if err := images.Put(img.Key, data, "image/"+format); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// MigrateLegacyImages moves the images that older sightings keep in the database to the image
+// store, batchSize at a time, and returns how many were moved and how many were skipped because they
+// could not be read or stored. It is safe to run again after a failure.
+func MigrateLegacyImages(repo repository.TigerRepository, images imagestore.ImageStore, batchSize int) (int, int, error) {
+	moved, skipped, afterID := 0, 0, 0
+	for {
+		batch, err := repo.GetLegacySightingImages(afterID, batchSize)
+		if err != nil {
+			return moved, skipped, err
+		}
+		if len(batch) == 0 {
+			return moved, skipped, nil
+		}
+
+		for _, legacy := range batch {
+			afterID = legacy.SightingID
+			// The key only depends on the sighting and its content, so a retried upload overwrites the same file
+			img, err := putImage(images, legacy.TigerID, strconv.Itoa(legacy.SightingID), legacy.Data)
+			if err != nil {
+				// The image stays in the database, and is skipped by its ID so that the others still move
+				log.Printf("skipping image of sighting %d: %v", legacy.SightingID, err)
+				skipped++
+				continue
+			}
+			img.SightingID = legacy.SightingID
+
+			if err := repo.SetSightingImage(img); err != nil {
+				return moved, skipped, err
+			}
+			moved++
+		}
+	}
+}
+
+// BackfillImageHashes computes the hash of the images in the image store that were uploaded before
+// images were hashed, batchSize at a time, and returns how many were hashed. It is safe to run again
+// after a failure.
+func BackfillImageHashes(repo repository.TigerRepository, images imagestore.ImageStore, batchSize int) (int, error) {
+	hashed, afterID := 0, 0
+	for {
+		batch, err := repo.GetUnhashedSightingImages(afterID, batchSize)
+		if err != nil {
+			return hashed, err
+		}
+		if len(batch) == 0 {
+			return hashed, nil
+		}
+
+		for _, img := range batch {
+			afterID = img.ID
+			data, err := images.Get(img.Key)
+			if err != nil {
+				return hashed, fmt.Errorf("failed to read image %d of sighting %d: %v", img.ID, img.SightingID, err)
+			}
+			decoded, _, err := image.Decode(bytes.NewReader(data))
+			if err != nil {
+				// An image that cannot be decoded cannot be compared either
+				log.Printf("skipping image %d of sighting %d: %v", img.ID, img.SightingID, err)
+				continue
+			}
+
+			if err := repo.SetSightingImageHash(img.ID, dhash.Hash(decoded)); err != nil {
+				return hashed, err
+			}
+			hashed++
+		}
+	}
+}
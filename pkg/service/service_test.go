@@ -1,14 +1,34 @@
 package service
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
 	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"path/filepath"
 	"sort"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	"github.com/tigerhall-kittens/pkg/auth"
+	"github.com/tigerhall-kittens/pkg/dhash"
+	"github.com/tigerhall-kittens/pkg/events"
+	"github.com/tigerhall-kittens/pkg/imagestore"
 	"github.com/tigerhall-kittens/pkg/models"
+	"github.com/tigerhall-kittens/pkg/repository"
+	"github.com/tigerhall-kittens/pkg/repository/store"
+	"github.com/tigerhall-kittens/pkg/rules"
+	"github.com/tigerhall-kittens/pkg/upload"
+	"github.com/tigerhall-kittens/pkg/utils"
 )
 
 // mockTigerRepo is a mock implementation of the TigerRepository interface.
@@ -16,11 +36,53 @@ type mockTigerRepo struct {
 	createUser                          func(user *models.User) error
 	getUserByEmail                      func(email string) (*models.User, error)
 	createTiger                         func(tiger *models.Tiger) error
+	getTigerByID                        func(tigerID int) (*models.Tiger, error)
+	getTigersByIDs                      func(tigerIDs []int) ([]*models.Tiger, error)
+	lockTiger                           func(tigerID int) (*models.Tiger, error)
+	updateTiger                         func(tiger *models.Tiger) error
+	deleteTiger                         func(tigerID int) error
 	getAllTigersWithPagination          func(page, pageSize int) ([]*models.Tiger, int, error)
 	createTigerSighting                 func(newSighting *models.TigerSighting) error
 	getTigerSightingsByID               func(tigerID int) ([]*models.TigerSighting, error)
+	getSighting                         func(sightingID int) (*models.TigerSighting, error)
+	getSightingImage                    func(sightingID int) (*models.SightingImage, error)
+	getSightingImageByID                func(sightingID, imageID int) (*models.SightingImage, error)
+	getSightingImages                   func(sightingID int) ([]*models.SightingImage, error)
+	addSightingImages                   func(sightingID int, images []*models.SightingImage, flags []string) error
+	findSimilarImages                   func(hash uint64, maxDistance, limit int) ([]*models.SimilarImage, error)
+	getUnhashedSightingImages           func(afterID, limit int) ([]*models.SightingImage, error)
+	setSightingImageHash                func(imageID int, hash uint64) error
+	getSightingImageKeys                func(tigerID int) ([]string, error)
+	getLegacySightingImages             func(afterID, limit int) ([]*models.SightingImage, error)
+	setSightingImage                    func(image *models.SightingImage) error
 	getPreviousTigerSighting            func(tigerID int) (*models.TigerSighting, error)
+	getTigerSightingsBetween            func(tigerID int, from, to time.Time) ([]*models.TigerSighting, error)
+	getSightingsBetween                 func(from, to time.Time) ([]*models.TigerSighting, error)
+	getSightingsNear                    func(center models.Coordinates, radiusKm float64, since time.Time, limit, protectedDecimals int) ([]*models.NearbySighting, error)
+	getSightingsInBoundingBox           func(box models.BoundingBox, since time.Time, limit, protectedDecimals int) ([]*models.NearbySighting, error)
+	getSightingRule                     func(tigerID int) (*models.SightingRule, error)
+	upsertSightingRule                  func(rule *models.SightingRule) error
+	getTigerSightingSummary             func(tigerID int) (*models.SightingSummary, error)
 	getTigerSightingsByIDWithPagination func(tigerID, page, pageSize int) ([]*models.TigerSighting, int, error)
+	createEmailDelivery                 func(delivery *models.EmailDelivery) error
+	getEmailDeliveries                  func(eventID string) ([]*models.EmailDelivery, error)
+	updateEmailDelivery                 func(delivery *models.EmailDelivery) error
+	claimDueEmailDeliveries             func(now, leaseUntil time.Time, limit int) ([]*models.EmailDelivery, error)
+	subscribeToTiger                    func(userID, tigerID int) error
+	unsubscribeFromTiger                func(userID, tigerID int) error
+	getTigerSubscriptions               func(userID int) ([]int, error)
+	getTigerSubscriberEmails            func(tigerID int) ([]string, error)
+	createAreaSubscription              func(subscription *models.AreaSubscription) error
+	getAreaSubscriptions                func(userID int) ([]*models.AreaSubscription, error)
+	deleteAreaSubscription              func(userID, subscriptionID int) (bool, error)
+	getAreaSubscriptionsContaining      func(point models.Coordinates) ([]*models.AreaSubscription, error)
+	getNotificationPreferences          func(emails []string) ([]*models.NotificationPreferences, error)
+	upsertNotificationPreferences       func(prefs *models.NotificationPreferences) error
+	claimDueOutboxMessages              func(now, leaseUntil time.Time, limit int) ([]*models.OutboxMessage, error)
+	updateOutboxMessage                 func(msg *models.OutboxMessage) error
+	createOutboxMessage                 func(msg *models.OutboxMessage) error
+	// outbox collects the events written when createOutboxMessage is not set
+	outbox []*models.OutboxMessage
 }
 
 func (m *mockTigerRepo) CreateUser(user *models.User) error {
@@ -35,6 +97,26 @@ func (m *mockTigerRepo) CreateTiger(tiger *models.Tiger) error {
 	return m.createTiger(tiger)
 }
 
+func (m *mockTigerRepo) GetTigerByID(tigerID int) (*models.Tiger, error) {
+	return m.getTigerByID(tigerID)
+}
+
+func (m *mockTigerRepo) GetTigersByIDs(tigerIDs []int) ([]*models.Tiger, error) {
+	return m.getTigersByIDs(tigerIDs)
+}
+
+func (m *mockTigerRepo) LockTiger(tigerID int) (*models.Tiger, error) {
+	return m.lockTiger(tigerID)
+}
+
+func (m *mockTigerRepo) UpdateTiger(tiger *models.Tiger) error {
+	return m.updateTiger(tiger)
+}
+
+func (m *mockTigerRepo) DeleteTiger(tigerID int) error {
+	return m.deleteTiger(tigerID)
+}
+
 func (m *mockTigerRepo) GetAllTigersWithPagination(page, pageSize int) ([]*models.Tiger, int, error) {
 	return m.getAllTigersWithPagination(page, pageSize)
 }
@@ -47,14 +129,187 @@ func (m *mockTigerRepo) GetTigerSightingsByID(tigerID int) ([]*models.TigerSight
 	return m.getTigerSightingsByID(tigerID)
 }
 
+func (m *mockTigerRepo) GetSighting(sightingID int) (*models.TigerSighting, error) {
+	return m.getSighting(sightingID)
+}
+
+func (m *mockTigerRepo) GetSightingImage(sightingID int) (*models.SightingImage, error) {
+	return m.getSightingImage(sightingID)
+}
+
+func (m *mockTigerRepo) GetSightingImageByID(sightingID, imageID int) (*models.SightingImage, error) {
+	return m.getSightingImageByID(sightingID, imageID)
+}
+
+func (m *mockTigerRepo) GetSightingImages(sightingID int) ([]*models.SightingImage, error) {
+	return m.getSightingImages(sightingID)
+}
+
+func (m *mockTigerRepo) AddSightingImages(sightingID int, images []*models.SightingImage, flags []string) error {
+	return m.addSightingImages(sightingID, images, flags)
+}
+
+func (m *mockTigerRepo) FindSimilarImages(hash uint64, maxDistance, limit int) ([]*models.SimilarImage, error) {
+	return m.findSimilarImages(hash, maxDistance, limit)
+}
+
+func (m *mockTigerRepo) GetUnhashedSightingImages(afterID, limit int) ([]*models.SightingImage, error) {
+	return m.getUnhashedSightingImages(afterID, limit)
+}
+
+func (m *mockTigerRepo) SetSightingImageHash(imageID int, hash uint64) error {
+	return m.setSightingImageHash(imageID, hash)
+}
+
+func (m *mockTigerRepo) GetSightingImageKeys(tigerID int) ([]string, error) {
+	return m.getSightingImageKeys(tigerID)
+}
+
+func (m *mockTigerRepo) GetLegacySightingImages(afterID, limit int) ([]*models.SightingImage, error) {
+	return m.getLegacySightingImages(afterID, limit)
+}
+
+func (m *mockTigerRepo) SetSightingImage(image *models.SightingImage) error {
+	return m.setSightingImage(image)
+}
+
 func (m *mockTigerRepo) GetPreviousTigerSighting(tigerID int) (*models.TigerSighting, error) {
 	return m.getPreviousTigerSighting(tigerID)
 }
 
+func (m *mockTigerRepo) GetTigerSightingsBetween(tigerID int, from, to time.Time) ([]*models.TigerSighting, error) {
+	return m.getTigerSightingsBetween(tigerID, from, to)
+}
+
+func (m *mockTigerRepo) GetSightingsBetween(from, to time.Time) ([]*models.TigerSighting, error) {
+	return m.getSightingsBetween(from, to)
+}
+
+func (m *mockTigerRepo) GetSightingsNear(center models.Coordinates, radiusKm float64, since time.Time, limit, protectedDecimals int) ([]*models.NearbySighting, error) {
+	return m.getSightingsNear(center, radiusKm, since, limit, protectedDecimals)
+}
+
+func (m *mockTigerRepo) GetSightingsInBoundingBox(box models.BoundingBox, since time.Time, limit, protectedDecimals int) ([]*models.NearbySighting, error) {
+	return m.getSightingsInBoundingBox(box, since, limit, protectedDecimals)
+}
+
+func (m *mockTigerRepo) GetSightingRule(tigerID int) (*models.SightingRule, error) {
+	return m.getSightingRule(tigerID)
+}
+
+func (m *mockTigerRepo) UpsertSightingRule(rule *models.SightingRule) error {
+	return m.upsertSightingRule(rule)
+}
+
+func (m *mockTigerRepo) GetTigerSightingSummary(tigerID int) (*models.SightingSummary, error) {
+	return m.getTigerSightingSummary(tigerID)
+}
+
+func (m *mockTigerRepo) WithTx(fn func(repository.TigerRepository) error) error {
+	return fn(m)
+}
+
 func (m *mockTigerRepo) GetTigerSightingsByIDWithPagination(tigerID, page, pageSize int) ([]*models.TigerSighting, int, error) {
 	return m.getTigerSightingsByIDWithPagination(tigerID, page, pageSize)
 }
 
+func (m *mockTigerRepo) CreateEmailDelivery(delivery *models.EmailDelivery) error {
+	return m.createEmailDelivery(delivery)
+}
+
+func (m *mockTigerRepo) GetEmailDeliveries(eventID string) ([]*models.EmailDelivery, error) {
+	return m.getEmailDeliveries(eventID)
+}
+
+func (m *mockTigerRepo) UpdateEmailDelivery(delivery *models.EmailDelivery) error {
+	return m.updateEmailDelivery(delivery)
+}
+
+func (m *mockTigerRepo) ClaimDueEmailDeliveries(now, leaseUntil time.Time, limit int) ([]*models.EmailDelivery, error) {
+	return m.claimDueEmailDeliveries(now, leaseUntil, limit)
+}
+
+func (m *mockTigerRepo) SubscribeToTiger(userID, tigerID int) error {
+	return m.subscribeToTiger(userID, tigerID)
+}
+
+func (m *mockTigerRepo) UnsubscribeFromTiger(userID, tigerID int) error {
+	return m.unsubscribeFromTiger(userID, tigerID)
+}
+
+func (m *mockTigerRepo) GetTigerSubscriptions(userID int) ([]int, error) {
+	return m.getTigerSubscriptions(userID)
+}
+
+// The lookups made to notify others of a new sighting find nothing unless the test sets them up,
+// so that sighting tests only describe the subscriptions they are about.
+
+func (m *mockTigerRepo) GetTigerSubscriberEmails(tigerID int) ([]string, error) {
+	if m.getTigerSubscriberEmails == nil {
+		return nil, nil
+	}
+	return m.getTigerSubscriberEmails(tigerID)
+}
+
+func (m *mockTigerRepo) GetAreaSubscriptionsContaining(point models.Coordinates) ([]*models.AreaSubscription, error) {
+	if m.getAreaSubscriptionsContaining == nil {
+		return nil, nil
+	}
+	return m.getAreaSubscriptionsContaining(point)
+}
+
+func (m *mockTigerRepo) GetNotificationPreferences(emails []string) ([]*models.NotificationPreferences, error) {
+	if m.getNotificationPreferences == nil {
+		return nil, nil
+	}
+	return m.getNotificationPreferences(emails)
+}
+
+func (m *mockTigerRepo) CreateAreaSubscription(subscription *models.AreaSubscription) error {
+	return m.createAreaSubscription(subscription)
+}
+
+func (m *mockTigerRepo) GetAreaSubscriptions(userID int) ([]*models.AreaSubscription, error) {
+	return m.getAreaSubscriptions(userID)
+}
+
+func (m *mockTigerRepo) DeleteAreaSubscription(userID, subscriptionID int) (bool, error) {
+	return m.deleteAreaSubscription(userID, subscriptionID)
+}
+
+func (m *mockTigerRepo) UpsertNotificationPreferences(prefs *models.NotificationPreferences) error {
+	return m.upsertNotificationPreferences(prefs)
+}
+
+func (m *mockTigerRepo) CreateOutboxMessage(msg *models.OutboxMessage) error {
+	if m.createOutboxMessage == nil {
+		m.outbox = append(m.outbox, msg)
+		return nil
+	}
+	return m.createOutboxMessage(msg)
+}
+
+func (m *mockTigerRepo) ClaimDueOutboxMessages(now, leaseUntil time.Time, limit int) ([]*models.OutboxMessage, error) {
+	return m.claimDueOutboxMessages(now, leaseUntil, limit)
+}
+
+func (m *mockTigerRepo) UpdateOutboxMessage(msg *models.OutboxMessage) error {
+	return m.updateOutboxMessage(msg)
+}
+
+// outboxEvents decodes the events written to the outbox.
+func (m *mockTigerRepo) outboxEvents(t *testing.T) []events.Envelope {
+	var written []events.Envelope
+	for _, msg := range m.outbox {
+		var event events.Envelope
+		if err := json.Unmarshal(msg.Payload, &event); err != nil {
+			t.Fatal(err)
+		}
+		written = append(written, event)
+	}
+	return written
+}
+
 func TestSignupService_Success(t *testing.T) {
 	// Arrange
 	mockRepo := &mockTigerRepo{
@@ -64,7 +319,7 @@ func TestSignupService_Success(t *testing.T) {
 		},
 	}
 
-	tigerService := NewTigerService(mockRepo, nil)
+	tigerService := NewTigerService(mockRepo)
 
 	// User with password to be hashed
 	user := models.User{
@@ -93,7 +348,7 @@ func TestSignupService_Failure(t *testing.T) {
 		},
 	}
 
-	tigerService := NewTigerService(mockRepo, nil)
+	tigerService := NewTigerService(mockRepo)
 
 	// User with password to be hashed
 	user := models.User{
@@ -124,7 +379,7 @@ func TestLoginService_Success(t *testing.T) {
 		},
 	}
 
-	tigerService := NewTigerService(mockRepo, nil)
+	tigerService := NewTigerService(mockRepo)
 
 	// Login credentials
 	credentials := models.LoginCredentials{
@@ -151,7 +406,7 @@ func TestLoginService_Failure(t *testing.T) {
 		},
 	}
 
-	tigerService := NewTigerService(mockRepo, nil)
+	tigerService := NewTigerService(mockRepo)
 
 	// Login credentials
 	credentials := models.LoginCredentials{
@@ -171,13 +426,17 @@ func TestLoginService_Failure(t *testing.T) {
 func TestCreateTigerService_Success(t *testing.T) {
 	// Arrange
 	mockRepo := &mockTigerRepo{
+		getUserByEmail: func(email string) (*models.User, error) {
+			return &models.User{ID: 7, Email: email}, nil
+		},
 		createTiger: func(tiger *models.Tiger) error {
 			// Mock the CreateTiger method to return nil (success)
+			assert.Equal(t, 7, tiger.CreatedBy, "Tiger should be created by the requesting user")
 			return nil
 		},
 	}
 
-	tigerService := NewTigerService(mockRepo, nil)
+	tigerService := NewTigerService(mockRepo)
 
 	// Create a test tiger
 	tiger := models.Tiger{
@@ -189,7 +448,7 @@ func TestCreateTigerService_Success(t *testing.T) {
 	}
 
 	// Act
-	err := tigerService.CreateTigerService(tiger)
+	err := tigerService.CreateTigerService(tiger, "creator@example.com")
 
 	// Assert
 	assert.NoError(t, err, "CreateTigerService should not return an error")
@@ -198,13 +457,16 @@ func TestCreateTigerService_Success(t *testing.T) {
 func TestCreateTigerService_Failure(t *testing.T) {
 	// Arrange
 	mockRepo := &mockTigerRepo{
+		getUserByEmail: func(email string) (*models.User, error) {
+			return &models.User{ID: 7, Email: email}, nil
+		},
 		createTiger: func(tiger *models.Tiger) error {
 			// Mock the CreateTiger method to return an error
 			return errors.New("failed to create tiger")
 		},
 	}
 
-	tigerService := NewTigerService(mockRepo, nil)
+	tigerService := NewTigerService(mockRepo)
 
 	// Create a test tiger
 	tiger := models.Tiger{
@@ -216,7 +478,7 @@ func TestCreateTigerService_Failure(t *testing.T) {
 	}
 
 	// Act
-	err := tigerService.CreateTigerService(tiger)
+	err := tigerService.CreateTigerService(tiger, "creator@example.com")
 
 	// Assert
 	assert.Error(t, err, "CreateTigerService should return an error")
@@ -248,7 +510,7 @@ func TestGetAllTigersService_Success(t *testing.T) {
 		},
 	}
 
-	tigerService := NewTigerService(mockRepo, nil)
+	tigerService := NewTigerService(mockRepo)
 
 	// Act
 	tigers, totalCount, err := tigerService.GetAllTigersService(1, 10)
@@ -275,7 +537,7 @@ func TestGetAllTigersService_Failure(t *testing.T) {
 		},
 	}
 
-	tigerService := NewTigerService(mockRepo, nil)
+	tigerService := NewTigerService(mockRepo)
 
 	// Act
 	tigers, _, err := tigerService.GetAllTigersService(1, 10)
@@ -286,6 +548,194 @@ func TestGetAllTigersService_Failure(t *testing.T) {
 	assert.Empty(t, tigers, "Tigers should be empty when there is an error")
 }
 
+func TestGetTigerByIDService_Success(t *testing.T) {
+	// Arrange
+	firstSighting := time.Date(2023, time.July, 20, 12, 0, 0, 0, time.UTC)
+	latestSighting := time.Date(2023, time.July, 22, 12, 0, 0, 0, time.UTC)
+	mockRepo := &mockTigerRepo{
+		getTigerByID: func(tigerID int) (*models.Tiger, error) {
+			return &models.Tiger{ID: tigerID, Name: "Tiger 1", Lat: 12.34, Long: 56.78}, nil
+		},
+		getTigerSightingSummary: func(tigerID int) (*models.SightingSummary, error) {
+			return &models.SightingSummary{
+				TotalSightings:    3,
+				FirstSighting:     &firstSighting,
+				LatestSighting:    &latestSighting,
+				DistinctReporters: 2,
+			}, nil
+		},
+		getPreviousTigerSighting: func(tigerID int) (*models.TigerSighting, error) {
+			return &models.TigerSighting{TigerID: tigerID, Timestamp: latestSighting, Lat: 13.35, Long: 56.79}, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo)
+
+	// Act
+	profile, err := tigerService.GetTigerByIDService(1)
+
+	// Assert
+	assert.NoError(t, err, "GetTigerByIDService should not return an error")
+	assert.Equal(t, "Tiger 1", profile.Name, "Tiger names should match")
+	assert.Equal(t, 3, profile.SightingSummary.TotalSightings, "Total sightings should match")
+	assert.Equal(t, 2, profile.SightingSummary.DistinctReporters, "Distinct reporters should match")
+	assert.Equal(t, models.Coordinates{Lat: 13.35, Long: 56.79}, profile.SightingSummary.LastKnownLocation, "Last known location should be the latest sighting")
+}
+
+func TestGetTigerByIDService_NotFound(t *testing.T) {
+	// Arrange
+	mockRepo := &mockTigerRepo{
+		getTigerByID: func(tigerID int) (*models.Tiger, error) {
+			return nil, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo)
+
+	// Act
+	profile, err := tigerService.GetTigerByIDService(1)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrTigerNotFound, "GetTigerByIDService should return ErrTigerNotFound")
+	assert.Nil(t, profile, "Profile should be nil")
+}
+
+func TestUpdateTigerService_Creator(t *testing.T) {
+	// Arrange
+	var updatedTiger *models.Tiger
+	mockRepo := &mockTigerRepo{
+		getTigerByID: func(tigerID int) (*models.Tiger, error) {
+			return &models.Tiger{ID: tigerID, Name: "Tigre", DateOfBirth: time.Date(2018, 1, 15, 0, 0, 0, 0, time.UTC), CreatedBy: 7}, nil
+		},
+		getUserByEmail: func(email string) (*models.User, error) {
+			return &models.User{ID: 7, Email: email, Role: models.RoleUser}, nil
+		},
+		updateTiger: func(tiger *models.Tiger) error {
+			updatedTiger = tiger
+			return nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo)
+	name := "Tiger"
+
+	// Act
+	tiger, err := tigerService.UpdateTigerService(1, models.TigerUpdate{Name: &name}, "creator@example.com")
+
+	// Assert
+	assert.NoError(t, err, "UpdateTigerService should not return an error")
+	assert.Equal(t, "Tiger", tiger.Name, "Tiger name should be updated")
+	assert.Equal(t, time.Date(2018, 1, 15, 0, 0, 0, 0, time.UTC), updatedTiger.DateOfBirth, "Date of birth should be unchanged")
+}
+
+func TestUpdateTigerService_Forbidden(t *testing.T) {
+	// Arrange
+	mockRepo := &mockTigerRepo{
+		getTigerByID: func(tigerID int) (*models.Tiger, error) {
+			return &models.Tiger{ID: tigerID, Name: "Tigre", CreatedBy: 7}, nil
+		},
+		getUserByEmail: func(email string) (*models.User, error) {
+			return &models.User{ID: 8, Email: email, Role: models.RoleUser}, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo)
+	name := "Tiger"
+
+	// Act
+	_, err := tigerService.UpdateTigerService(1, models.TigerUpdate{Name: &name}, "someone@example.com")
+
+	// Assert
+	assert.ErrorIs(t, err, ErrForbidden, "UpdateTigerService should return ErrForbidden")
+}
+
+func TestUpdateTigerService_UnknownRequester(t *testing.T) {
+	// Arrange
+	mockRepo := &mockTigerRepo{
+		getTigerByID: func(tigerID int) (*models.Tiger, error) {
+			return &models.Tiger{ID: tigerID, Name: "Tigre", CreatedBy: 7}, nil
+		},
+		getUserByEmail: func(email string) (*models.User, error) {
+			return nil, repository.ErrUserNotFound
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo)
+	name := "Tiger"
+
+	// Act
+	_, err := tigerService.UpdateTigerService(1, models.TigerUpdate{Name: &name}, "nobody@example.com")
+
+	// Assert
+	assert.ErrorIs(t, err, ErrForbidden, "UpdateTigerService should return ErrForbidden")
+}
+
+func TestUpdateTigerService_UserFetchFailure(t *testing.T) {
+	// Arrange
+	mockRepo := &mockTigerRepo{
+		getTigerByID: func(tigerID int) (*models.Tiger, error) {
+			return &models.Tiger{ID: tigerID, Name: "Tigre", CreatedBy: 7}, nil
+		},
+		getUserByEmail: func(email string) (*models.User, error) {
+			return nil, errors.New("connection reset by peer")
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo)
+	name := "Tiger"
+
+	// Act
+	_, err := tigerService.UpdateTigerService(1, models.TigerUpdate{Name: &name}, "creator@example.com")
+
+	// Assert
+	assert.NotErrorIs(t, err, ErrForbidden, "A failed user fetch should not be reported as forbidden")
+	assert.EqualError(t, err, "failed to fetch user", "Error message should match")
+}
+
+func TestDeleteTigerService_Admin(t *testing.T) {
+	// Arrange
+	deletedTigerID := 0
+	mockRepo := &mockTigerRepo{
+		getTigerByID: func(tigerID int) (*models.Tiger, error) {
+			// Tigers created before ownership was recorded have no creator
+			return &models.Tiger{ID: tigerID, Name: "Tigre"}, nil
+		},
+		getUserByEmail: func(email string) (*models.User, error) {
+			return &models.User{ID: 1, Email: email, Role: models.RoleAdmin}, nil
+		},
+		deleteTiger: func(tigerID int) error {
+			deletedTigerID = tigerID
+			return nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo)
+
+	// Act
+	err := tigerService.DeleteTigerService(3, "admin@example.com")
+
+	// Assert
+	assert.NoError(t, err, "DeleteTigerService should not return an error")
+	assert.Equal(t, 3, deletedTigerID, "Tiger should be deleted")
+}
+
+func TestDeleteTigerService_NotFound(t *testing.T) {
+	// Arrange
+	mockRepo := &mockTigerRepo{
+		getTigerByID: func(tigerID int) (*models.Tiger, error) {
+			return nil, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo)
+
+	// Act
+	err := tigerService.DeleteTigerService(3, "admin@example.com")
+
+	// Assert
+	assert.ErrorIs(t, err, ErrTigerNotFound, "DeleteTigerService should return ErrTigerNotFound")
+}
+
 func TestCreateTigerSightingService_Success(t *testing.T) {
 	// Arrange
 	previousSighting := &models.TigerSighting{
@@ -305,6 +755,12 @@ func TestCreateTigerSightingService_Success(t *testing.T) {
 	}
 
 	mockRepo := &mockTigerRepo{
+		lockTiger: func(tigerID int) (*models.Tiger, error) {
+			return &models.Tiger{ID: tigerID}, nil
+		},
+		getSightingRule: func(tigerID int) (*models.SightingRule, error) {
+			return nil, nil
+		},
 		getPreviousTigerSighting: func(tigerID int) (*models.TigerSighting, error) {
 			return previousSighting, nil
 		},
@@ -318,14 +774,18 @@ func TestCreateTigerSightingService_Success(t *testing.T) {
 		},
 	}
 
-	tigerService := NewTigerService(mockRepo, nil)
+	tigerService := NewTigerService(mockRepo)
 
 	// Act
 	err := tigerService.CreateTigerSightingService(newSighting)
 
 	// Assert
 	assert.NoError(t, err, "CreateTigerSightingService should not return an error")
-
+	// The reporter of the new sighting is the only reporter of the tiger, so nobody is emailed
+	written := mockRepo.outboxEvents(t)
+	if assert.Len(t, written, 1, "The sighting should be announced in the same transaction") {
+		assert.Equal(t, events.SightingCreated, written[0].Type)
+	}
 }
 
 func TestCreateTigerSightingService_ExistingSightingWithin5Km(t *testing.T) {
@@ -347,12 +807,18 @@ func TestCreateTigerSightingService_ExistingSightingWithin5Km(t *testing.T) {
 	}
 
 	mockRepo := &mockTigerRepo{
+		lockTiger: func(tigerID int) (*models.Tiger, error) {
+			return &models.Tiger{ID: tigerID}, nil
+		},
+		getSightingRule: func(tigerID int) (*models.SightingRule, error) {
+			return nil, nil
+		},
 		getPreviousTigerSighting: func(tigerID int) (*models.TigerSighting, error) {
 			return previousSighting, nil
 		},
 	}
 
-	tigerService := NewTigerService(mockRepo, nil)
+	tigerService := NewTigerService(mockRepo)
 
 	// Act
 	err := tigerService.CreateTigerSightingService(newSighting)
@@ -362,6 +828,59 @@ func TestCreateTigerSightingService_ExistingSightingWithin5Km(t *testing.T) {
 	assert.EqualError(t, err, "A tiger sighting within 5 kilometers already exists", "Error message should match")
 }
 
+func TestCreateTigerSightingService_FlaggedWithinTimeWindow(t *testing.T) {
+	// Arrange
+	earlierSighting := &models.TigerSighting{
+		ID:        4,
+		TigerID:   1,
+		Timestamp: time.Date(2023, time.July, 21, 11, 30, 0, 0, time.UTC),
+		Lat:       12.34,
+		Long:      56.78,
+	}
+	newSighting := &models.TigerSighting{
+		TigerID:       1,
+		Timestamp:     time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC),
+		Lat:           12.35,
+		Long:          56.79,
+		ReporterEmail: "reporter@example.com",
+	}
+
+	// The tiger's override switches the configured rejection to flagging
+	flag := string(rules.ActionFlag)
+	var createdSighting *models.TigerSighting
+	mockRepo := &mockTigerRepo{
+		lockTiger: func(tigerID int) (*models.Tiger, error) {
+			return &models.Tiger{ID: tigerID}, nil
+		},
+		getSightingRule: func(tigerID int) (*models.SightingRule, error) {
+			return &models.SightingRule{TigerID: tigerID, Action: &flag}, nil
+		},
+		getTigerSightingsBetween: func(tigerID int, from, to time.Time) ([]*models.TigerSighting, error) {
+			assert.Equal(t, newSighting.Timestamp.Add(-time.Hour), from, "Window should start an hour before the sighting")
+			assert.Equal(t, newSighting.Timestamp.Add(time.Hour), to, "Window should end an hour after the sighting")
+			return []*models.TigerSighting{earlierSighting}, nil
+		},
+		createTigerSighting: func(newSighting *models.TigerSighting) error {
+			createdSighting = newSighting
+			return nil
+		},
+		getTigerSightingsByID: func(tigerID int) ([]*models.TigerSighting, error) {
+			return []*models.TigerSighting{earlierSighting}, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo, WithSightingRule(rules.Rule{MinDistanceKm: 5, TimeWindow: time.Hour, Action: rules.ActionReject}))
+
+	// Act
+	err := tigerService.CreateTigerSightingService(newSighting)
+
+	// Assert
+	assert.NoError(t, err, "CreateTigerSightingService should not return an error")
+	assert.NotNil(t, createdSighting, "Sighting should be created")
+	assert.Len(t, createdSighting.Flags, 1, "Sighting should be flagged")
+	assert.Contains(t, createdSighting.Flags[0], "of sighting 4", "Flag should reference the earlier sighting")
+}
+
 func TestCreateTigerSightingService_RequiredFieldsMissing(t *testing.T) {
 	// Arrange
 	newSighting := &models.TigerSighting{
@@ -378,7 +897,7 @@ func TestCreateTigerSightingService_RequiredFieldsMissing(t *testing.T) {
 		},
 	}
 
-	tigerService := NewTigerService(mockRepo, nil)
+	tigerService := NewTigerService(mockRepo)
 
 	// Act
 	err := tigerService.CreateTigerSightingService(newSighting)
@@ -399,6 +918,12 @@ func TestCreateTigerSightingService_Failure(t *testing.T) {
 	}
 
 	mockRepo := &mockTigerRepo{
+		lockTiger: func(tigerID int) (*models.Tiger, error) {
+			return &models.Tiger{ID: tigerID}, nil
+		},
+		getSightingRule: func(tigerID int) (*models.SightingRule, error) {
+			return nil, nil
+		},
 		getPreviousTigerSighting: func(tigerID int) (*models.TigerSighting, error) {
 			return nil, nil
 		},
@@ -412,7 +937,7 @@ func TestCreateTigerSightingService_Failure(t *testing.T) {
 		},
 	}
 
-	tigerService := NewTigerService(mockRepo, nil)
+	tigerService := NewTigerService(mockRepo)
 
 	// Act
 	err := tigerService.CreateTigerSightingService(newSighting)
@@ -422,21 +947,46 @@ func TestCreateTigerSightingService_Failure(t *testing.T) {
 	assert.EqualError(t, err, "failed to create tiger sighting", "Error message should match")
 }
 
-func TestGetAllTigerSightingsService_Success(t *testing.T) {
+func TestCreateTigerSightingService_TigerNotFound(t *testing.T) {
 	// Arrange
-	tigerID := 1
-	tigerSightings := []*models.TigerSighting{
-		{
-			ID:        1,
-			TigerID:   1,
-			Timestamp: time.Date(2023, time.July, 20, 12, 0, 0, 0, time.UTC),
-		},
-		{
-			ID:        2,
-			TigerID:   1,
-			Timestamp: time.Date(2023, time.July, 22, 12, 0, 0, 0, time.UTC),
-		},
-		{
+	newSighting := &models.TigerSighting{
+		TigerID:       1,
+		Timestamp:     time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC),
+		Lat:           12.35,
+		Long:          56.79,
+		ReporterEmail: "reporter@example.com",
+	}
+
+	mockRepo := &mockTigerRepo{
+		lockTiger: func(tigerID int) (*models.Tiger, error) {
+			return nil, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo)
+
+	// Act
+	err := tigerService.CreateTigerSightingService(newSighting)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrTigerNotFound, "CreateTigerSightingService should return ErrTigerNotFound")
+}
+
+func TestGetAllTigerSightingsService_Success(t *testing.T) {
+	// Arrange
+	tigerID := 1
+	tigerSightings := []*models.TigerSighting{
+		{
+			ID:        1,
+			TigerID:   1,
+			Timestamp: time.Date(2023, time.July, 20, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			ID:        2,
+			TigerID:   1,
+			Timestamp: time.Date(2023, time.July, 22, 12, 0, 0, 0, time.UTC),
+		},
+		{
 			ID:        3,
 			TigerID:   1,
 			Timestamp: time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC),
@@ -452,7 +1002,7 @@ func TestGetAllTigerSightingsService_Success(t *testing.T) {
 		},
 	}
 
-	tigerService := NewTigerService(mockRepo, nil)
+	tigerService := NewTigerService(mockRepo)
 
 	// Act
 	result, totalCount, err := tigerService.GetTigerSightingsByIDService(tigerID, 1, 10)
@@ -480,7 +1030,7 @@ func TestGetAllTigerSightingsService_Failure(t *testing.T) {
 		},
 	}
 
-	tigerService := NewTigerService(mockRepo, nil)
+	tigerService := NewTigerService(mockRepo)
 
 	// Act
 	result, _, err := tigerService.GetTigerSightingsByIDService(tigerID, 1, 10)
@@ -489,3 +1039,1426 @@ func TestGetAllTigerSightingsService_Failure(t *testing.T) {
 	assert.Error(t, err, "GetTigerSightingsByIDService should return an error")
 	assert.Equal(t, result, []*models.TigerSighting{}, "Result should be nil on failure")
 }
+
+func TestGetSightingsNearService_Success(t *testing.T) {
+	// Arrange
+	nearbySightings := []*models.NearbySighting{
+		{TigerSighting: models.TigerSighting{ID: 1, TigerID: 2}, DistanceKm: 0.5},
+		{TigerSighting: models.TigerSighting{ID: 2, TigerID: 1}, DistanceKm: 1.5},
+		{TigerSighting: models.TigerSighting{ID: 3, TigerID: 2}, DistanceKm: 2.5},
+	}
+
+	mockRepo := &mockTigerRepo{
+		getSightingsNear: func(center models.Coordinates, radiusKm float64, since time.Time, limit, protectedDecimals int) ([]*models.NearbySighting, error) {
+			return nearbySightings, nil
+		},
+		getTigersByIDs: func(tigerIDs []int) ([]*models.Tiger, error) {
+			assert.ElementsMatch(t, []int{1, 2}, tigerIDs, "Each tiger should be fetched once")
+			return []*models.Tiger{{ID: 1, Name: "Tiger 1"}, {ID: 2, Name: "Tiger 2"}}, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo)
+
+	// Act
+	result, err := tigerService.GetSightingsNearService(models.Coordinates{Lat: 12.34, Long: 56.78}, 5, time.Time{}, 100)
+
+	// Assert
+	assert.NoError(t, err, "GetSightingsNearService should not return an error")
+	assert.Len(t, result.Sightings, 3, "All sightings should be returned")
+	assert.Len(t, result.Tigers, 2, "Distinct tigers should be returned")
+	assert.Equal(t, 2, result.Tigers[0].ID, "Tigers should be ordered by their nearest sighting")
+}
+
+func TestGetSightingsInBoundingBoxService_Empty(t *testing.T) {
+	// Arrange
+	mockRepo := &mockTigerRepo{
+		getSightingsInBoundingBox: func(box models.BoundingBox, since time.Time, limit, protectedDecimals int) ([]*models.NearbySighting, error) {
+			return nil, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo)
+
+	// Act
+	result, err := tigerService.GetSightingsInBoundingBoxService(models.BoundingBox{MinLat: 1, MinLong: 1, MaxLat: 2, MaxLong: 2}, time.Time{}, 100)
+
+	// Assert
+	assert.NoError(t, err, "GetSightingsInBoundingBoxService should not return an error")
+	assert.Empty(t, result.Sightings, "No sightings should be returned")
+	assert.NotNil(t, result.Tigers, "Tigers should be an empty list")
+}
+
+func TestGetTigerTrackService_Success(t *testing.T) {
+	// Arrange
+	mockRepo := &mockTigerRepo{
+		getTigerByID: func(tigerID int) (*models.Tiger, error) {
+			return &models.Tiger{ID: tigerID, Name: "Tiger 1"}, nil
+		},
+		getTigerSightingsByID: func(tigerID int) ([]*models.TigerSighting, error) {
+			// Sightings are returned latest first
+			return []*models.TigerSighting{
+				{ID: 2, TigerID: tigerID, Timestamp: time.Date(2023, time.July, 22, 12, 0, 0, 0, time.UTC)},
+				{ID: 1, TigerID: tigerID, Timestamp: time.Date(2023, time.July, 20, 12, 0, 0, 0, time.UTC)},
+			}, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo)
+
+	// Act
+	tiger, sightings, err := tigerService.GetTigerTrackService(1)
+
+	// Assert
+	assert.NoError(t, err, "GetTigerTrackService should not return an error")
+	assert.Equal(t, "Tiger 1", tiger.Name, "Tiger should be returned")
+	assert.Equal(t, 1, sightings[0].ID, "Track should start with the earliest sighting")
+}
+
+func TestGetSightingImageService_NotFound(t *testing.T) {
+	// Arrange
+	mockRepo := &mockTigerRepo{
+		getSightingImage: func(sightingID int) (*models.SightingImage, error) {
+			// Sightings without an image have neither a key nor image bytes
+			return &models.SightingImage{SightingID: sightingID}, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo)
+
+	// Act
+	_, err := tigerService.GetSightingImageService(1, models.ImageSizeMedium)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrImageNotFound, "GetSightingImageService should return ErrImageNotFound")
+}
+
+// testPNG returns an encoded PNG image of the given size.
+func testPNG(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// orientedJPEG returns img encoded as JPEG with an EXIF orientation, as phones store portrait photos.
+func orientedJPEG(t *testing.T, img image.Image, orientation uint16) []byte {
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A little-endian TIFF structure whose only IFD holds the orientation
+	var tiff bytes.Buffer
+	tiff.WriteString("II")
+	binary.Write(&tiff, binary.LittleEndian, uint16(42))
+	binary.Write(&tiff, binary.LittleEndian, uint32(8))
+	binary.Write(&tiff, binary.LittleEndian, uint16(1))
+	binary.Write(&tiff, binary.LittleEndian, []uint16{0x0112, 3})
+	binary.Write(&tiff, binary.LittleEndian, uint32(1))
+	binary.Write(&tiff, binary.LittleEndian, []uint16{orientation, 0})
+	binary.Write(&tiff, binary.LittleEndian, uint32(0))
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	var out bytes.Buffer
+	out.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(segment)+2))
+	out.Write(segment)
+	out.Write(encoded.Bytes()[2:])
+	return out.Bytes()
+}
+
+func TestPutImage_AutoOrients(t *testing.T) {
+	images, err := imagestore.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	// A landscape sensor image with a red top-left corner, to be displayed turned 90° clockwise
+	pixels := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	for x := 0; x < 300; x++ {
+		for y := 0; y < 200; y++ {
+			c := color.RGBA{0, 0, 255, 255}
+			if x < 100 && y < 100 {
+				c = color.RGBA{255, 0, 0, 255}
+			}
+			pixels.Set(x, y, c)
+		}
+	}
+
+	img, err := putImage(images, 1, "portrait", orientedJPEG(t, pixels, 6))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 200, img.Width, "The dimensions should be those of the upright image")
+	assert.Equal(t, 300, img.Height)
+	for _, size := range imagestore.Sizes {
+		data, err := images.Get(imagestore.RenditionKey(img.Key, size))
+		assert.NoError(t, err)
+		decoded, _, err := image.Decode(bytes.NewReader(data))
+		assert.NoError(t, err)
+		if size == models.ImageSizeThumb {
+			// Thumbnails are cropped to a fixed landscape size
+			continue
+		}
+		bounds := decoded.Bounds()
+		assert.Greater(t, bounds.Dy(), bounds.Dx(), "The %s image should be stored upright", size)
+		// Turned clockwise, the top-left corner ends up at the top right
+		r, _, b, _ := decoded.At(bounds.Max.X-5, bounds.Min.Y+5).RGBA()
+		assert.Greater(t, r, b, "The %s image should be turned clockwise", size)
+	}
+}
+
+func TestCreateTigerSightingService_StoresImage(t *testing.T) {
+	// Arrange
+	images, err := imagestore.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	imageBytes := testPNG(t, 25, 20)
+	newSighting := &models.TigerSighting{
+		TigerID:       1,
+		Timestamp:     time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC),
+		Lat:           13.35,
+		Long:          56.79,
+		Images:        [][]byte{imageBytes},
+		ReporterEmail: "reporter@example.com",
+	}
+
+	var created *models.TigerSighting
+	mockRepo := &mockTigerRepo{
+		lockTiger: func(tigerID int) (*models.Tiger, error) {
+			return &models.Tiger{ID: tigerID}, nil
+		},
+		getSightingRule: func(tigerID int) (*models.SightingRule, error) {
+			return nil, nil
+		},
+		getPreviousTigerSighting: func(tigerID int) (*models.TigerSighting, error) {
+			return nil, nil
+		},
+		createTigerSighting: func(newSighting *models.TigerSighting) error {
+			created = newSighting
+			return nil
+		},
+		getTigerSightingsByID: func(tigerID int) ([]*models.TigerSighting, error) {
+			return []*models.TigerSighting{newSighting}, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo, WithImageStore(images))
+
+	// Act
+	err = tigerService.CreateTigerSightingService(newSighting)
+
+	// Assert
+	assert.NoError(t, err, "CreateTigerSightingService should not return an error")
+	assert.Nil(t, created.Images, "Image bytes should not be written to the database")
+	assert.Len(t, created.StoredImages, 1)
+	img := created.StoredImages[0]
+	assert.Regexp(t, `^sightings/1/.+\.png$`, img.Key)
+	assert.Equal(t, sha256Hex(imageBytes), img.SHA256)
+	assert.Equal(t, 25, img.Width)
+	assert.Equal(t, 20, img.Height)
+
+	stored, err := images.Get(img.Key)
+	assert.NoError(t, err)
+	assert.Equal(t, imageBytes, stored, "Original image should be kept in the image store")
+
+	thumb, err := images.Get(imagestore.RenditionKey(img.Key, models.ImageSizeThumb))
+	assert.NoError(t, err)
+	thumbConfig, _, err := image.DecodeConfig(bytes.NewReader(thumb))
+	assert.NoError(t, err)
+	assert.Equal(t, 250, thumbConfig.Width, "Thumbnail should be derived from the original")
+}
+
+func TestCreateTigerSightingService_DeletesImageOnFailure(t *testing.T) {
+	// Arrange
+	images, err := imagestore.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	newSighting := &models.TigerSighting{
+		TigerID:       1,
+		Timestamp:     time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC),
+		Lat:           13.35,
+		Long:          56.79,
+		Images:        [][]byte{testPNG(t, 25, 20)},
+		ReporterEmail: "reporter@example.com",
+	}
+
+	mockRepo := &mockTigerRepo{
+		lockTiger: func(tigerID int) (*models.Tiger, error) {
+			// The tiger was deleted while the image was uploaded
+			return nil, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo, WithImageStore(images))
+
+	// Act
+	err = tigerService.CreateTigerSightingService(newSighting)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrTigerNotFound)
+	assert.Len(t, newSighting.StoredImages, 1)
+	key := newSighting.StoredImages[0].Key
+	_, err = images.Get(key)
+	assert.ErrorIs(t, err, imagestore.ErrNotFound, "Image of the rejected sighting should be deleted")
+	_, err = images.Get(imagestore.RenditionKey(key, models.ImageSizeMedium))
+	assert.ErrorIs(t, err, imagestore.ErrNotFound, "Renditions of the rejected sighting should be deleted")
+}
+
+func TestGetSightingImageService_FromStore(t *testing.T) {
+	// Arrange
+	images, err := imagestore.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	assert.NoError(t, images.Put("sightings/1/image.png", []byte("image-bytes"), "image/png"))
+	assert.NoError(t, images.Put("sightings/1/image_thumb.jpeg", []byte("thumb-bytes"), "image/jpeg"))
+
+	mockRepo := &mockTigerRepo{
+		getSightingImage: func(sightingID int) (*models.SightingImage, error) {
+			return &models.SightingImage{SightingID: sightingID, TigerID: 1, Key: "sightings/1/image.png", SHA256: "0123abcd"}, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo, WithImageStore(images))
+
+	// Act
+	original, err := tigerService.GetSightingImageService(1, models.ImageSizeOriginal)
+	assert.NoError(t, err)
+	thumb, err := tigerService.GetSightingImageService(1, models.ImageSizeThumb)
+	assert.NoError(t, err)
+
+	// Assert
+	assert.Equal(t, []byte("image-bytes"), original.Data, "Local images should be read from the store")
+	assert.Empty(t, original.URL, "Local images have no signed URL")
+	assert.Equal(t, []byte("thumb-bytes"), thumb.Data, "Renditions should be read from their own key")
+	assert.Equal(t, sha256Hex([]byte("thumb-bytes")), thumb.SHA256, "Each size should have its own hash")
+}
+
+func TestMigrateLegacyImages(t *testing.T) {
+	// Arrange
+	images, err := imagestore.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	legacy := []*models.SightingImage{
+		{SightingID: 1, TigerID: 1, Data: testPNG(t, 25, 20)},
+		{SightingID: 2, TigerID: 2, Data: []byte("not an image")},
+		{SightingID: 3, TigerID: 2, Data: testPNG(t, 10, 10)},
+	}
+	var migrated []*models.SightingImage
+	mockRepo := &mockTigerRepo{
+		getLegacySightingImages: func(afterID, limit int) ([]*models.SightingImage, error) {
+			// Migrated images are no longer returned, and the image that cannot be moved stays
+			var remaining []*models.SightingImage
+			for _, image := range legacy {
+				if image.SightingID > afterID && len(remaining) < limit {
+					remaining = append(remaining, image)
+				}
+			}
+			return remaining, nil
+		},
+		setSightingImage: func(image *models.SightingImage) error {
+			migrated = append(migrated, image)
+			return nil
+		},
+	}
+
+	// Act
+	moved, skipped, err := MigrateLegacyImages(mockRepo, images, 1)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 2, moved)
+	assert.Equal(t, 1, skipped, "The image that cannot be decoded should be skipped")
+	assert.Len(t, migrated, 2, "The images after the one that cannot be decoded should still move")
+	for i, image := range migrated {
+		original := legacy[i*2]
+		assert.Equal(t, original.SightingID, image.SightingID)
+		assert.Equal(t, sha256Hex(original.Data), image.SHA256)
+
+		stored, err := images.Get(image.Key)
+		assert.NoError(t, err)
+		assert.Equal(t, original.Data, stored)
+	}
+}
+
+func TestCreateTigerSightingService_ImageWithoutExif(t *testing.T) {
+	// Arrange
+	newSighting := &models.TigerSighting{
+		TigerID:       1,
+		Images:        [][]byte{testPNG(t, 25, 20)},
+		ReporterEmail: "reporter@example.com",
+	}
+
+	tigerService := NewTigerService(&mockTigerRepo{})
+
+	// Act
+	err := tigerService.CreateTigerSightingService(newSighting)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrIncompleteSighting, "Missing fields cannot be filled in without EXIF data")
+}
+
+func TestGetTigerSightingsByIDService_CoarsensProtectedTiger(t *testing.T) {
+	// Arrange
+	mockRepo := &mockTigerRepo{
+		getTigerSightingsByIDWithPagination: func(tigerID, page, pageSize int) ([]*models.TigerSighting, int, error) {
+			return []*models.TigerSighting{{ID: 1, TigerID: tigerID, Lat: 12.3456, Long: 56.7891}}, 1, nil
+		},
+		getTigerByID: func(tigerID int) (*models.Tiger, error) {
+			return &models.Tiger{ID: tigerID, Protected: true}, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo, WithProtectedCoordinateDecimals(1))
+
+	// Act
+	sightings, _, err := tigerService.GetTigerSightingsByIDService(1, 1, 10)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 12.3, sightings[0].Lat, "Latitude of a protected tiger should be coarsened")
+	assert.Equal(t, 56.8, sightings[0].Long, "Longitude of a protected tiger should be coarsened")
+}
+
+func TestGetSightingsNearService_CoarsensProtectedTiger(t *testing.T) {
+	// Arrange
+	center := models.Coordinates{Lat: 12.34, Long: 56.78}
+	mockRepo := &mockTigerRepo{
+		getSightingsNear: func(center models.Coordinates, radiusKm float64, since time.Time, limit, protectedDecimals int) ([]*models.NearbySighting, error) {
+			assert.Equal(t, 1, protectedDecimals, "Protected tigers should be matched on their coarsened coordinates")
+			return []*models.NearbySighting{
+				{TigerSighting: models.TigerSighting{ID: 1, TigerID: 1, Lat: 12.3, Long: 56.8}, DistanceKm: 2.2},
+				{TigerSighting: models.TigerSighting{ID: 2, TigerID: 2, Lat: 12.3513, Long: 56.7802}, DistanceKm: 1.25},
+			}, nil
+		},
+		getTigersByIDs: func(tigerIDs []int) ([]*models.Tiger, error) {
+			return []*models.Tiger{{ID: 1, Lat: 12.3412, Long: 56.7801, Protected: true}, {ID: 2, Lat: 12.3513, Long: 56.7802}}, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo, WithProtectedCoordinateDecimals(1))
+
+	// Act
+	result, err := tigerService.GetSightingsNearService(center, 5, time.Time{}, 100)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, models.Coordinates{Lat: 12.3, Long: 56.8}, models.Coordinates{Lat: result.Tigers[0].Lat, Long: result.Tigers[0].Long})
+	assert.Equal(t, 12.3513, result.Tigers[1].Lat, "Other tigers should be exact")
+}
+
+func TestGetSightingsInBoundingBoxService_MatchesExactCoordinatesWithoutCoarsening(t *testing.T) {
+	// Arrange
+	mockRepo := &mockTigerRepo{
+		getSightingsInBoundingBox: func(box models.BoundingBox, since time.Time, limit, protectedDecimals int) ([]*models.NearbySighting, error) {
+			assert.Equal(t, -1, protectedDecimals, "Without coarsening every tiger should be matched on its exact coordinates")
+			return nil, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo)
+
+	// Act
+	_, err := tigerService.GetSightingsInBoundingBoxService(models.BoundingBox{MinLat: 1, MinLong: 1, MaxLat: 2, MaxLong: 2}, time.Time{}, 100)
+
+	// Assert
+	assert.NoError(t, err)
+}
+
+func TestCreateTigerSightingService_StripsImageMetadata(t *testing.T) {
+	// Arrange
+	images, err := imagestore.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	// Add a text chunk to a PNG image after its 33 byte header
+	original := testPNG(t, 25, 20)
+	text := []byte("tEXtComment\x00camera trap 7 at the waterhole")
+	chunk := make([]byte, 4, 4+len(text)+4)
+	binary.BigEndian.PutUint32(chunk, uint32(len(text)-4))
+	chunk = append(chunk, text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(text))
+	withMetadata := append(append(append([]byte{}, original[:33]...), chunk...), original[33:]...)
+
+	newSighting := &models.TigerSighting{
+		TigerID:       1,
+		Timestamp:     time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC),
+		Lat:           13.35,
+		Long:          56.79,
+		Images:        [][]byte{withMetadata},
+		ReporterEmail: "reporter@example.com",
+	}
+
+	mockRepo := &mockTigerRepo{
+		lockTiger: func(tigerID int) (*models.Tiger, error) {
+			return &models.Tiger{ID: tigerID}, nil
+		},
+		getSightingRule: func(tigerID int) (*models.SightingRule, error) {
+			return nil, nil
+		},
+		getPreviousTigerSighting: func(tigerID int) (*models.TigerSighting, error) {
+			return nil, nil
+		},
+		createTigerSighting: func(newSighting *models.TigerSighting) error {
+			return nil
+		},
+		getTigerSightingsByID: func(tigerID int) ([]*models.TigerSighting, error) {
+			return []*models.TigerSighting{newSighting}, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo, WithImageStore(images))
+
+	// Act
+	err = tigerService.CreateTigerSightingService(newSighting)
+
+	// Assert
+	assert.NoError(t, err)
+	stored, err := images.Get(newSighting.StoredImages[0].Key)
+	assert.NoError(t, err)
+	assert.Equal(t, original, stored, "Stored image should not carry metadata")
+}
+
+func TestCreateTigerSightingService_RejectsUnsupportedImage(t *testing.T) {
+	// Arrange
+	newSighting := &models.TigerSighting{
+		TigerID:       1,
+		Timestamp:     time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC),
+		Lat:           13.35,
+		Long:          56.79,
+		Images:        [][]byte{[]byte("GIF89a not a supported image")},
+		ReporterEmail: "reporter@example.com",
+	}
+
+	tigerService := NewTigerService(&mockTigerRepo{}, WithUploadLimits(upload.DefaultLimits))
+
+	// Act
+	err := tigerService.CreateTigerSightingService(newSighting)
+
+	// Assert
+	assert.ErrorIs(t, err, upload.ErrUnsupportedFormat, "Unsupported images should be rejected before they are decoded")
+}
+
+func TestCreateTigerSightingService_StoresEveryImage(t *testing.T) {
+	// Arrange
+	images, err := imagestore.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	newSighting := &models.TigerSighting{
+		TigerID:       1,
+		Timestamp:     time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC),
+		Lat:           13.35,
+		Long:          56.79,
+		Images:        [][]byte{testPNG(t, 25, 20), testPNG(t, 30, 20), testPNG(t, 25, 20)},
+		ReporterEmail: "reporter@example.com",
+	}
+
+	var created *models.TigerSighting
+	mockRepo := &mockTigerRepo{
+		lockTiger: func(tigerID int) (*models.Tiger, error) {
+			return &models.Tiger{ID: tigerID}, nil
+		},
+		getSightingRule: func(tigerID int) (*models.SightingRule, error) {
+			return nil, nil
+		},
+		getPreviousTigerSighting: func(tigerID int) (*models.TigerSighting, error) {
+			return nil, nil
+		},
+		createTigerSighting: func(newSighting *models.TigerSighting) error {
+			created = newSighting
+			return nil
+		},
+		getTigerSightingsByID: func(tigerID int) ([]*models.TigerSighting, error) {
+			return []*models.TigerSighting{newSighting}, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo, WithImageStore(images))
+
+	// Act
+	err = tigerService.CreateTigerSightingService(newSighting)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Len(t, created.StoredImages, 3, "Every image should be stored")
+	assert.Equal(t, 30, created.StoredImages[1].Width, "Images should keep their upload order")
+	assert.NotEqual(t, created.StoredImages[0].Key, created.StoredImages[2].Key, "Identical photos should not share a key")
+}
+
+func TestCreateTigerSightingService_TooManyImages(t *testing.T) {
+	// Arrange
+	newSighting := &models.TigerSighting{
+		TigerID:       1,
+		Timestamp:     time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC),
+		Lat:           13.35,
+		Long:          56.79,
+		Images:        [][]byte{testPNG(t, 25, 20), testPNG(t, 25, 20), testPNG(t, 25, 20)},
+		ReporterEmail: "reporter@example.com",
+	}
+
+	limits := upload.DefaultLimits
+	limits.MaxImages = 2
+	tigerService := NewTigerService(&mockTigerRepo{}, WithUploadLimits(limits))
+
+	// Act
+	err := tigerService.CreateTigerSightingService(newSighting)
+
+	// Assert
+	assert.ErrorIs(t, err, upload.ErrTooManyImages)
+}
+
+func TestAddSightingImagesService(t *testing.T) {
+	sighting := &models.TigerSighting{ID: 7, TigerID: 1, ImageCount: 1, ReporterEmail: "reporter@example.com"}
+	users := map[string]*models.User{
+		"reporter@example.com": {ID: 1, Email: "reporter@example.com", Role: models.RoleUser},
+		"other@example.com":    {ID: 2, Email: "other@example.com", Role: models.RoleUser},
+		"admin@example.com":    {ID: 3, Email: "admin@example.com", Role: models.RoleAdmin},
+	}
+
+	tests := []struct {
+		name        string
+		sightingID  int
+		requester   string
+		images      int
+		expectedErr error
+	}{
+		{"reporter", 7, "reporter@example.com", 2, nil},
+		{"admin", 7, "admin@example.com", 1, nil},
+		{"someone else", 7, "other@example.com", 1, ErrNotSightingReporter},
+		{"unknown requester", 7, "nobody@example.com", 1, ErrNotSightingReporter},
+		{"missing sighting", 8, "reporter@example.com", 1, ErrSightingNotFound},
+		{"over the limit with existing images", 7, "reporter@example.com", 3, upload.ErrTooManyImages},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange
+			images, err := imagestore.NewLocalStore(t.TempDir())
+			assert.NoError(t, err)
+
+			var added []*models.SightingImage
+			mockRepo := &mockTigerRepo{
+				getSighting: func(sightingID int) (*models.TigerSighting, error) {
+					if sightingID != sighting.ID {
+						return nil, nil
+					}
+					return sighting, nil
+				},
+				getUserByEmail: func(email string) (*models.User, error) {
+					if users[email] == nil {
+						return nil, repository.ErrUserNotFound
+					}
+					return users[email], nil
+				},
+				addSightingImages: func(sightingID int, images []*models.SightingImage, flags []string) error {
+					assert.Equal(t, sighting.ID, sightingID)
+					added = images
+					return nil
+				},
+			}
+
+			limits := upload.DefaultLimits
+			limits.MaxImages = 3
+			tigerService := NewTigerService(mockRepo, WithImageStore(images), WithUploadLimits(limits))
+
+			uploads := make([][]byte, test.images)
+			for i := range uploads {
+				uploads[i] = testPNG(t, 25, 20)
+			}
+
+			// Act
+			stored, err := tigerService.AddSightingImagesService(test.sightingID, uploads, test.requester)
+
+			// Assert
+			if test.expectedErr != nil {
+				assert.ErrorIs(t, err, test.expectedErr)
+				assert.Nil(t, added, "No images should be added")
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, stored, test.images)
+			assert.Equal(t, added, stored)
+			for _, img := range stored {
+				_, err := images.Get(img.Key)
+				assert.NoError(t, err, "Added images should be in the image store")
+			}
+		})
+	}
+}
+
+// sqlRepository runs the store queries against a single connection, so that service tests can
+// exercise the SQL with sqlmock.
+type sqlRepository struct {
+	repository.Queries
+}
+
+func (r sqlRepository) WithTx(fn func(repository.TigerRepository) error) error {
+	return fn(r)
+}
+
+func TestAddSightingImagesService_UserFetchFailure(t *testing.T) {
+	// Arrange
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT id, tiger_id, timestamp, lat, long").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tiger_id", "timestamp", "lat", "long", "image_count", "reporter_email", "flags"}).
+			AddRow(7, 1, time.Now(), 12.34, 56.78, 0, "reporter@example.com", "{}"))
+	mock.ExpectQuery("SELECT id, username, email, password, role").
+		WithArgs("reporter@example.com").
+		WillReturnError(errors.New("connection reset by peer"))
+
+	images, err := imagestore.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	tigerService := NewTigerService(sqlRepository{Queries: store.NewPostgresRepository(db)}, WithImageStore(images))
+
+	// Act
+	_, err = tigerService.AddSightingImagesService(7, [][]byte{testPNG(t, 25, 20)}, "reporter@example.com")
+
+	// Assert
+	assert.NotErrorIs(t, err, ErrNotSightingReporter, "A failed user fetch should not be reported as forbidden")
+	assert.EqualError(t, err, "failed to fetch user", "Error message should match")
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("failed to meet expectations: %v", err)
+	}
+}
+
+func TestAddSightingImagesService_DeletesImagesOnFailure(t *testing.T) {
+	// Arrange
+	images, err := imagestore.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	var stored []*models.SightingImage
+	mockRepo := &mockTigerRepo{
+		getSighting: func(sightingID int) (*models.TigerSighting, error) {
+			return &models.TigerSighting{ID: sightingID, TigerID: 1, ReporterEmail: "reporter@example.com"}, nil
+		},
+		getUserByEmail: func(email string) (*models.User, error) {
+			return &models.User{ID: 1, Email: email, Role: models.RoleUser}, nil
+		},
+		addSightingImages: func(sightingID int, images []*models.SightingImage, flags []string) error {
+			stored = images
+			return errors.New("connection reset")
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo, WithImageStore(images))
+
+	// Act
+	_, err = tigerService.AddSightingImagesService(7, [][]byte{testPNG(t, 25, 20)}, "reporter@example.com")
+
+	// Assert
+	assert.Error(t, err)
+	assert.Len(t, stored, 1)
+	_, err = images.Get(stored[0].Key)
+	assert.ErrorIs(t, err, imagestore.ErrNotFound, "Images that were not added should be deleted")
+}
+
+func TestAddSightingImagesService_TruncatedImage(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	images, err := imagestore.NewLocalStore(dir)
+	assert.NoError(t, err)
+
+	added := false
+	mockRepo := &mockTigerRepo{
+		getSighting: func(sightingID int) (*models.TigerSighting, error) {
+			return &models.TigerSighting{ID: sightingID, TigerID: 1, ReporterEmail: "reporter@example.com"}, nil
+		},
+		getUserByEmail: func(email string) (*models.User, error) {
+			return &models.User{ID: 1, Email: email, Role: models.RoleUser}, nil
+		},
+		addSightingImages: func(sightingID int, images []*models.SightingImage, flags []string) error {
+			added = true
+			return nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo, WithImageStore(images))
+
+	// The header is intact, so only decoding the pixels finds the image is cut off
+	truncated := testPNG(t, 25, 20)
+	truncated = truncated[:len(truncated)/2]
+
+	// Act
+	_, err = tigerService.AddSightingImagesService(7, [][]byte{testPNG(t, 25, 20), truncated}, "reporter@example.com")
+
+	// Assert
+	assert.ErrorIs(t, err, upload.ErrInvalidImage)
+	assert.False(t, added, "No images should be added")
+	var files []string
+	assert.NoError(t, filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	}))
+	assert.Empty(t, files, "The images stored before the invalid one should be deleted")
+}
+
+func TestGetSightingImagesService_NotFound(t *testing.T) {
+	// Arrange
+	mockRepo := &mockTigerRepo{
+		getSighting: func(sightingID int) (*models.TigerSighting, error) {
+			return nil, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo)
+
+	// Act
+	_, err := tigerService.GetSightingImagesService(1)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrSightingNotFound)
+}
+
+// testGradientPNG returns an encoded PNG image whose brightness falls from left to right, so that
+// it has a perceptual hash unlike the blank images of testPNG.
+func testGradientPNG(t *testing.T, width, height int) []byte {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(255 - 255*x/width)})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCreateTigerSightingService_FlagsDuplicateImage(t *testing.T) {
+	// Arrange
+	images, err := imagestore.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	newSighting := &models.TigerSighting{
+		TigerID:       1,
+		Timestamp:     time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC),
+		Lat:           13.35,
+		Long:          56.79,
+		Images:        [][]byte{testGradientPNG(t, 90, 80)},
+		ReporterEmail: "reporter@example.com",
+	}
+
+	var created *models.TigerSighting
+	mockRepo := &mockTigerRepo{
+		findSimilarImages: func(hash uint64, maxDistance, limit int) ([]*models.SimilarImage, error) {
+			assert.NotZero(t, hash, "Stored images should be hashed")
+			assert.Equal(t, 4, maxDistance)
+			return []*models.SimilarImage{{SightingImage: models.SightingImage{ID: 10, SightingID: 3, TigerID: 2}, Distance: 1}}, nil
+		},
+		lockTiger: func(tigerID int) (*models.Tiger, error) {
+			return &models.Tiger{ID: tigerID}, nil
+		},
+		getSightingRule: func(tigerID int) (*models.SightingRule, error) {
+			return nil, nil
+		},
+		getPreviousTigerSighting: func(tigerID int) (*models.TigerSighting, error) {
+			return nil, nil
+		},
+		createTigerSighting: func(newSighting *models.TigerSighting) error {
+			created = newSighting
+			return nil
+		},
+		// getTigerSightingsByID is left unset: a repeated image notifies nobody
+	}
+
+	tigerService := NewTigerService(mockRepo, WithImageStore(images))
+
+	// Act
+	err = tigerService.CreateTigerSightingService(newSighting)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"looks like image 10 of sighting 3"}, created.Flags)
+}
+
+// lockingRepo holds a lock from LockTiger until the end of the transaction, as the row lock of the
+// tiger does.
+type lockingRepo struct {
+	*mockTigerRepo
+	mu *sync.Mutex
+}
+
+func (r lockingRepo) WithTx(fn func(repository.TigerRepository) error) error {
+	tx := &lockingTx{mockTigerRepo: r.mockTigerRepo, mu: r.mu}
+	defer tx.release()
+	return fn(tx)
+}
+
+type lockingTx struct {
+	*mockTigerRepo
+	mu     *sync.Mutex
+	locked bool
+}
+
+func (tx *lockingTx) LockTiger(tigerID int) (*models.Tiger, error) {
+	tx.mu.Lock()
+	tx.locked = true
+	return tx.mockTigerRepo.LockTiger(tigerID)
+}
+
+func (tx *lockingTx) WithTx(fn func(repository.TigerRepository) error) error {
+	return fn(tx)
+}
+
+func (tx *lockingTx) release() {
+	if tx.locked {
+		tx.mu.Unlock()
+	}
+}
+
+func TestCreateTigerSightingService_FlagsConcurrentDuplicateImage(t *testing.T) {
+	// Arrange
+	images, err := imagestore.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	var mu sync.Mutex
+	var recorded []*models.SightingImage
+	var created []*models.TigerSighting
+	checks := 0
+	bothChecking := make(chan struct{})
+	mockRepo := &mockTigerRepo{
+		findSimilarImages: func(hash uint64, maxDistance, limit int) ([]*models.SimilarImage, error) {
+			mu.Lock()
+			var matches []*models.SimilarImage
+			for _, img := range recorded {
+				if dhash.Distance(hash, img.DHash) <= maxDistance {
+					matches = append(matches, &models.SimilarImage{SightingImage: *img})
+					break
+				}
+			}
+			if checks++; checks == 2 {
+				close(bothChecking)
+			}
+			mu.Unlock()
+
+			// Wait for the other report to look for duplicates as well, unless the lock keeps it out
+			select {
+			case <-bothChecking:
+			case <-time.After(200 * time.Millisecond):
+			}
+			return matches, nil
+		},
+		lockTiger: func(tigerID int) (*models.Tiger, error) {
+			return &models.Tiger{ID: tigerID}, nil
+		},
+		getSightingRule: func(tigerID int) (*models.SightingRule, error) {
+			return nil, nil
+		},
+		getPreviousTigerSighting: func(tigerID int) (*models.TigerSighting, error) {
+			return nil, nil
+		},
+		createTigerSighting: func(newSighting *models.TigerSighting) error {
+			mu.Lock()
+			defer mu.Unlock()
+			newSighting.ID = len(created) + 1
+			for _, img := range newSighting.StoredImages {
+				stored := *img
+				stored.SightingID = newSighting.ID
+				recorded = append(recorded, &stored)
+			}
+			created = append(created, newSighting)
+			return nil
+		},
+		getTigerSightingsByID: func(tigerID int) ([]*models.TigerSighting, error) {
+			return nil, nil
+		},
+		getTigerSubscriberEmails: func(tigerID int) ([]string, error) {
+			return nil, nil
+		},
+		getAreaSubscriptionsContaining: func(point models.Coordinates) ([]*models.AreaSubscription, error) {
+			return nil, nil
+		},
+		createOutboxMessage: func(msg *models.OutboxMessage) error {
+			return nil
+		},
+	}
+
+	tigerService := NewTigerService(lockingRepo{mockTigerRepo: mockRepo, mu: &sync.Mutex{}}, WithImageStore(images))
+
+	// Act
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = tigerService.CreateTigerSightingService(&models.TigerSighting{
+				TigerID:       1,
+				Timestamp:     time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC),
+				Lat:           13.35,
+				Long:          56.79,
+				Images:        [][]byte{testGradientPNG(t, 90, 80)},
+				ReporterEmail: "reporter@example.com",
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	// Assert
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	if assert.Len(t, created, 2) {
+		assert.Empty(t, created[0].Flags, "The first report should not be flagged")
+		assert.Equal(t, []string{"looks like image 0 of sighting 1"}, created[1].Flags, "The second report should be flagged as a duplicate of the first")
+	}
+}
+
+func TestCreateTigerSightingService_RejectsDuplicateImage(t *testing.T) {
+	// Arrange
+	images, err := imagestore.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	newSighting := &models.TigerSighting{
+		TigerID:       1,
+		Timestamp:     time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC),
+		Lat:           13.35,
+		Long:          56.79,
+		Images:        [][]byte{testPNG(t, 25, 20), testGradientPNG(t, 90, 80)},
+		ReporterEmail: "reporter@example.com",
+	}
+
+	mockRepo := &mockTigerRepo{
+		findSimilarImages: func(hash uint64, maxDistance, limit int) ([]*models.SimilarImage, error) {
+			return []*models.SimilarImage{{SightingImage: models.SightingImage{ID: 10, SightingID: 3, TigerID: 2}}}, nil
+		},
+		lockTiger: func(tigerID int) (*models.Tiger, error) {
+			return &models.Tiger{ID: tigerID}, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo, WithImageStore(images), WithDuplicateCheck(dhash.Check{MaxDistance: 4, Action: rules.ActionReject}))
+
+	// Act
+	err = tigerService.CreateTigerSightingService(newSighting)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrDuplicateImage)
+	assert.ErrorContains(t, err, "image 2: ")
+	for _, img := range newSighting.StoredImages {
+		_, err = images.Get(img.Key)
+		assert.ErrorIs(t, err, imagestore.ErrNotFound, "Images of the rejected sighting should be deleted")
+	}
+}
+
+func TestAddSightingImagesService_FlagsDuplicateImage(t *testing.T) {
+	// Arrange
+	images, err := imagestore.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	var flags []string
+	mockRepo := &mockTigerRepo{
+		getSighting: func(sightingID int) (*models.TigerSighting, error) {
+			return &models.TigerSighting{ID: sightingID, TigerID: 1, ImageCount: 1, ReporterEmail: "reporter@example.com"}, nil
+		},
+		getUserByEmail: func(email string) (*models.User, error) {
+			return &models.User{ID: 1, Email: email, Role: models.RoleUser}, nil
+		},
+		findSimilarImages: func(hash uint64, maxDistance, limit int) ([]*models.SimilarImage, error) {
+			return []*models.SimilarImage{{SightingImage: models.SightingImage{ID: 10, SightingID: 3, TigerID: 2}, Distance: 1}}, nil
+		},
+		addSightingImages: func(sightingID int, images []*models.SightingImage, sightingFlags []string) error {
+			flags = sightingFlags
+			return nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo, WithImageStore(images))
+
+	// Act
+	stored, err := tigerService.AddSightingImagesService(7, [][]byte{testGradientPNG(t, 90, 80)}, "reporter@example.com")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Len(t, stored, 1, "A flagged duplicate should still be added")
+	assert.Equal(t, []string{"looks like image 10 of sighting 3"}, flags)
+}
+
+func TestGetSimilarSightingImagesService(t *testing.T) {
+	// Arrange
+	mockRepo := &mockTigerRepo{
+		getSighting: func(sightingID int) (*models.TigerSighting, error) {
+			return &models.TigerSighting{ID: sightingID, TigerID: 1, ImageCount: 3}, nil
+		},
+		getSightingImages: func(sightingID int) ([]*models.SightingImage, error) {
+			return []*models.SightingImage{
+				{ID: 0, SightingID: sightingID},
+				{ID: 20, SightingID: sightingID, DHash: 0xff},
+				{ID: 21, SightingID: sightingID, DHash: 0xfe},
+			}, nil
+		},
+		findSimilarImages: func(hash uint64, maxDistance, limit int) ([]*models.SimilarImage, error) {
+			own := &models.SimilarImage{SightingImage: models.SightingImage{ID: 20, SightingID: 7}}
+			if hash == 0xff {
+				return []*models.SimilarImage{
+					own,
+					{SightingImage: models.SightingImage{ID: 10, SightingID: 3}, Distance: 3},
+				}, nil
+			}
+			return []*models.SimilarImage{
+				{SightingImage: models.SightingImage{ID: 10, SightingID: 3}, Distance: 2},
+				{SightingImage: models.SightingImage{ID: 11, SightingID: 4}, Distance: 1},
+			}, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo)
+
+	// Act
+	similar, err := tigerService.GetSimilarSightingImagesService(7)
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.Len(t, similar, 2, "Images of the sighting itself should not be listed, and others only once") {
+		assert.Equal(t, 11, similar[0].ID, "The closest image should come first")
+		assert.Equal(t, 10, similar[1].ID)
+		assert.Equal(t, 21, similar[1].MatchedImageID, "An image should be listed with its closest match")
+		assert.Equal(t, 2, similar[1].Distance)
+	}
+}
+
+func TestGetSimilarSightingImagesService_NotFound(t *testing.T) {
+	// Arrange
+	mockRepo := &mockTigerRepo{
+		getSighting: func(sightingID int) (*models.TigerSighting, error) {
+			return nil, nil
+		},
+	}
+
+	tigerService := NewTigerService(mockRepo)
+
+	// Act
+	_, err := tigerService.GetSimilarSightingImagesService(1)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrSightingNotFound)
+}
+
+func TestBackfillImageHashes(t *testing.T) {
+	// Arrange
+	images, err := imagestore.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	assert.NoError(t, images.Put("sightings/1/a.png", testGradientPNG(t, 90, 80), "image/png"))
+	assert.NoError(t, images.Put("sightings/1/b.png", []byte("not an image"), "image/png"))
+
+	hashes := map[int]uint64{}
+	mockRepo := &mockTigerRepo{
+		getUnhashedSightingImages: func(afterID, limit int) ([]*models.SightingImage, error) {
+			// The image that cannot be decoded stays unhashed, so it is skipped by its ID
+			if afterID == 0 {
+				return []*models.SightingImage{{ID: 1, SightingID: 1, Key: "sightings/1/a.png"}, {ID: 2, SightingID: 1, Key: "sightings/1/b.png"}}, nil
+			}
+			return nil, nil
+		},
+		setSightingImageHash: func(imageID int, hash uint64) error {
+			hashes[imageID] = hash
+			return nil
+		},
+	}
+
+	// Act
+	hashed, err := BackfillImageHashes(mockRepo, images, 2)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 1, hashed)
+	assert.Len(t, hashes, 1)
+	assert.NotZero(t, hashes[1])
+}
+
+func TestSightingMails_CoarsensProtectedTiger(t *testing.T) {
+	// Arrange
+	tigerService := NewTigerService(&mockTigerRepo{}, WithProtectedCoordinateDecimals(1), WithPublicURL("http://localhost:8080/")).(service)
+	tiger := &models.Tiger{ID: 1, Name: "Sher Khan", Protected: true}
+	newSighting := &models.TigerSighting{
+		TigerID:       1,
+		Timestamp:     time.Date(2023, time.July, 21, 12, 30, 0, 0, time.UTC),
+		Lat:           12.9716,
+		Long:          77.5946,
+		ReporterEmail: "reporter@example.com",
+	}
+	recipients := []utils.Recipient{{Email: "reporter@example.com"}, {Email: "ranger@example.com"}}
+
+	// Act
+	emails := tigerService.sightingMails(tiger, tigerService.describeSighting(tiger, newSighting), recipients)
+
+	// Assert
+	if assert.Len(t, emails, 1, "Only the other reporter should be notified") {
+		assert.Equal(t, "ranger@example.com", emails[0].Recipient)
+		assert.Contains(t, emails[0].Body, "{Lat: 13, Long: 77.6}", "The location of a protected tiger should be coarsened")
+		assert.Equal(t, "http://localhost:8080/tiger/1/sightings", emails[0].Link)
+	}
+	assert.Equal(t, 12.9716, newSighting.Lat, "The sighting itself should keep its exact location")
+}
+
+func TestSightingRecipients_SubscribersAndPreferences(t *testing.T) {
+	// Arrange
+	newSighting := &models.TigerSighting{TigerID: 1, Lat: 12.97, Long: 77.59, ReporterEmail: "reporter@example.com"}
+	mockRepo := &mockTigerRepo{
+		getTigerSightingsByID: func(tigerID int) ([]*models.TigerSighting, error) {
+			return []*models.TigerSighting{{TigerID: 1, ReporterEmail: "ranger@example.com"}}, nil
+		},
+		getTigerSubscriberEmails: func(tigerID int) ([]string, error) {
+			return []string{"Ranger@example.com", "fan@example.com", "muted@example.com"}, nil
+		},
+		getAreaSubscriptionsContaining: func(point models.Coordinates) ([]*models.AreaSubscription, error) {
+			assert.Equal(t, models.Coordinates{Lat: 12.97, Long: 77.59}, point)
+			return []*models.AreaSubscription{{Email: "local@example.com", Lat: 13, Long: 77.5, RadiusKm: 25}}, nil
+		},
+		getNotificationPreferences: func(emails []string) ([]*models.NotificationPreferences, error) {
+			return []*models.NotificationPreferences{
+				{Email: "muted@example.com", Channels: []string{}, Timezone: "UTC", DigestTime: "08:00"},
+				{Email: "local@example.com", Channels: []string{models.ChannelEmail}, Timezone: "UTC", Digest: true, DigestTime: "08:00"},
+			}, nil
+		},
+	}
+	tigerService := NewTigerService(mockRepo).(service)
+
+	// Act
+	recipients, err := tigerService.sightingRecipients(mockRepo, &models.Tiger{ID: 1}, newSighting)
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.Len(t, recipients, 4, "The user who turned notifications off should be left out") {
+		assert.Equal(t, "ranger@example.com", recipients[0].Email)
+		assert.Equal(t, "you reported a sighting of this tiger", recipients[0].Reason)
+		assert.Equal(t, "you subscribed to this tiger", recipients[2].Reason)
+		assert.True(t, recipients[2].DeliverAfter.IsZero(), "Users without preferences should be notified right away")
+		assert.Equal(t, "local@example.com", recipients[3].Email)
+		assert.Equal(t, "you subscribed to sightings within 25 km of {Lat: 13, Long: 77.5}", recipients[3].Reason)
+		assert.False(t, recipients[3].DeliverAfter.IsZero(), "Digest users should be notified at their digest time")
+	}
+}
+
+func TestSightingRecipients_ProtectedTigerSkipsAreaSubscriptions(t *testing.T) {
+	// Arrange
+	mockRepo := &mockTigerRepo{
+		getTigerSightingsByID: func(tigerID int) ([]*models.TigerSighting, error) {
+			return nil, nil
+		},
+		getTigerSubscriberEmails: func(tigerID int) ([]string, error) {
+			return []string{"fan@example.com"}, nil
+		},
+		getAreaSubscriptionsContaining: func(point models.Coordinates) ([]*models.AreaSubscription, error) {
+			t.Error("Area subscriptions should not be consulted for a protected tiger")
+			return nil, nil
+		},
+	}
+	tigerService := NewTigerService(mockRepo).(service)
+
+	// Act
+	recipients, err := tigerService.sightingRecipients(mockRepo, &models.Tiger{ID: 1, Protected: true}, &models.TigerSighting{TigerID: 1, Lat: 12.97, Long: 77.59})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Recipient{{Email: "fan@example.com", Reason: "you subscribed to this tiger"}}, recipients)
+}
+
+func TestSubscribeToTigerService(t *testing.T) {
+	// Arrange
+	var subscribed [2]int
+	mockRepo := &mockTigerRepo{
+		getTigerByID: func(tigerID int) (*models.Tiger, error) {
+			if tigerID != 1 {
+				return nil, nil
+			}
+			return &models.Tiger{ID: 1}, nil
+		},
+		getUserByEmail: func(email string) (*models.User, error) {
+			return &models.User{ID: 7, Email: email}, nil
+		},
+		subscribeToTiger: func(userID, tigerID int) error {
+			subscribed = [2]int{userID, tigerID}
+			return nil
+		},
+	}
+	tigerService := NewTigerService(mockRepo)
+
+	// Act & Assert
+	assert.NoError(t, tigerService.SubscribeToTigerService(1, "fan@example.com"))
+	assert.Equal(t, [2]int{7, 1}, subscribed)
+	assert.ErrorIs(t, tigerService.SubscribeToTigerService(2, "fan@example.com"), ErrTigerNotFound)
+}
+
+func TestDeleteAreaSubscriptionService_NotFound(t *testing.T) {
+	// Arrange
+	mockRepo := &mockTigerRepo{
+		getUserByEmail: func(email string) (*models.User, error) {
+			return &models.User{ID: 7, Email: email}, nil
+		},
+		deleteAreaSubscription: func(userID, subscriptionID int) (bool, error) {
+			// Only the subscription 3 of the user exists
+			return userID == 7 && subscriptionID == 3, nil
+		},
+	}
+	tigerService := NewTigerService(mockRepo)
+
+	// Act & Assert
+	assert.NoError(t, tigerService.DeleteAreaSubscriptionService(3, "fan@example.com"))
+	assert.ErrorIs(t, tigerService.DeleteAreaSubscriptionService(4, "fan@example.com"), ErrSubscriptionNotFound)
+}
+
+func TestGetNotificationPreferencesService_Defaults(t *testing.T) {
+	// Arrange
+	mockRepo := &mockTigerRepo{
+		getNotificationPreferences: func(emails []string) ([]*models.NotificationPreferences, error) {
+			return nil, nil
+		},
+	}
+	tigerService := NewTigerService(mockRepo)
+
+	// Act
+	prefs, err := tigerService.GetNotificationPreferencesService("fan@example.com")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, models.DefaultNotificationPreferences(), *prefs)
+}
+
+func TestSetNotificationPreferencesService(t *testing.T) {
+	// Arrange
+	var saved *models.NotificationPreferences
+	mockRepo := &mockTigerRepo{
+		getUserByEmail: func(email string) (*models.User, error) {
+			return &models.User{ID: 7, Email: email}, nil
+		},
+		upsertNotificationPreferences: func(prefs *models.NotificationPreferences) error {
+			saved = prefs
+			return nil
+		},
+	}
+	tigerService := NewTigerService(mockRepo)
+
+	// Act
+	prefs, err := tigerService.SetNotificationPreferencesService(models.NotificationPreferences{
+		Channels:        []string{models.ChannelEmail},
+		QuietHoursStart: "22:00",
+		QuietHoursEnd:   "07:00",
+	}, "fan@example.com")
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.NotNil(t, saved) {
+		assert.Equal(t, 7, saved.UserID)
+		assert.Equal(t, "UTC", saved.Timezone, "The time zone should default to UTC")
+		assert.Equal(t, "08:00", saved.DigestTime)
+	}
+	assert.Equal(t, saved, prefs)
+
+	_, err = tigerService.SetNotificationPreferencesService(models.NotificationPreferences{Channels: []string{"sms"}}, "fan@example.com")
+	assert.ErrorIs(t, err, ErrInvalidNotificationPreferences)
+}
+
+func TestCreateTigerSightingService_WritesEventsToOutbox(t *testing.T) {
+	// Arrange
+	newSighting := &models.TigerSighting{
+		TigerID:       1,
+		Timestamp:     time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC),
+		Lat:           13.35,
+		Long:          56.79,
+		ReporterEmail: "reporter@example.com",
+	}
+	mockRepo := &mockTigerRepo{
+		lockTiger: func(tigerID int) (*models.Tiger, error) {
+			return &models.Tiger{ID: tigerID, Name: "Sher Khan"}, nil
+		},
+		getSightingRule: func(tigerID int) (*models.SightingRule, error) {
+			return nil, nil
+		},
+		getPreviousTigerSighting: func(tigerID int) (*models.TigerSighting, error) {
+			return nil, nil
+		},
+		createTigerSighting: func(newSighting *models.TigerSighting) error {
+			newSighting.ID = 9
+			return nil
+		},
+		getTigerSightingsByID: func(tigerID int) ([]*models.TigerSighting, error) {
+			return []*models.TigerSighting{{TigerID: 1, ReporterEmail: "ranger@example.com"}}, nil
+		},
+	}
+	tigerService := NewTigerService(mockRepo)
+
+	// Act
+	err := tigerService.CreateTigerSightingService(newSighting)
+
+	// Assert
+	assert.NoError(t, err, "CreateTigerSightingService should not return an error")
+	written := mockRepo.outboxEvents(t)
+	if assert.Len(t, written, 2, "The sighting and the emails about it should be written to the outbox") {
+		var sighting events.SightingCreatedData
+		assert.NoError(t, written[0].Decode(&sighting))
+		assert.Equal(t, 9, sighting.SightingID)
+		assert.Equal(t, "Sher Khan", sighting.TigerName)
+
+		assert.Equal(t, events.EmailRequested, written[1].Type)
+		assert.Equal(t, written[0].CorrelationID, written[1].CorrelationID, "The emails should be correlated with the sighting")
+		var emails events.EmailRequestedData
+		assert.NoError(t, written[1].Decode(&emails))
+		if assert.Len(t, emails.Emails, 1) {
+			assert.Equal(t, "ranger@example.com", emails.Emails[0].Recipient)
+		}
+	}
+}
+
+func TestCreateTigerSightingService_OutboxFailure(t *testing.T) {
+	// Arrange
+	newSighting := &models.TigerSighting{
+		TigerID:       1,
+		Timestamp:     time.Date(2023, time.July, 21, 12, 0, 0, 0, time.UTC),
+		Lat:           13.35,
+		Long:          56.79,
+		ReporterEmail: "reporter@example.com",
+	}
+	mockRepo := &mockTigerRepo{
+		lockTiger: func(tigerID int) (*models.Tiger, error) {
+			return &models.Tiger{ID: tigerID}, nil
+		},
+		getSightingRule: func(tigerID int) (*models.SightingRule, error) {
+			return nil, nil
+		},
+		getPreviousTigerSighting: func(tigerID int) (*models.TigerSighting, error) {
+			return nil, nil
+		},
+		createTigerSighting: func(newSighting *models.TigerSighting) error {
+			return nil
+		},
+		createOutboxMessage: func(msg *models.OutboxMessage) error {
+			return errors.New("connection reset")
+		},
+	}
+	tigerService := NewTigerService(mockRepo)
+
+	// Act
+	err := tigerService.CreateTigerSightingService(newSighting)
+
+	// Assert
+	assert.Error(t, err, "A sighting whose event cannot be recorded should not be created")
+}
+
+func TestSignupService_WritesEventToOutbox(t *testing.T) {
+	// Arrange
+	mockRepo := &mockTigerRepo{
+		createUser: func(user *models.User) error {
+			user.ID = 4
+			return nil
+		},
+	}
+	tigerService := NewTigerService(mockRepo)
+
+	// Act
+	err := tigerService.SignupService(&models.User{Username: "ranger", Email: "ranger@example.com", Password: "secret"})
+
+	// Assert
+	assert.NoError(t, err)
+	written := mockRepo.outboxEvents(t)
+	if assert.Len(t, written, 1) {
+		var data events.UserSignedUpData
+		assert.NoError(t, written[0].Decode(&data))
+		assert.Equal(t, events.UserSignedUpData{UserID: 4, Username: "ranger", Email: "ranger@example.com"}, data)
+	}
+}
@@ -0,0 +1,89 @@
+// Package upload validates images uploaded with sightings before they are decoded.
+package upload
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+
+	conf "github.com/tigerhall-kittens/config"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	// ErrTooLarge is returned for images with more bytes than allowed.
+	ErrTooLarge = errors.New("image is too large")
+	// ErrTooManyPixels is returned for images with more pixels than allowed, which could exhaust memory when decoded.
+	ErrTooManyPixels = errors.New("image has too many pixels")
+	// ErrUnsupportedFormat is returned for images that are not JPEG, PNG or WebP.
+	ErrUnsupportedFormat = errors.New("image format is not supported, upload a JPEG, PNG or WebP image")
+	// ErrInvalidImage is returned for images that cannot be decoded.
+	ErrInvalidImage = errors.New("image is corrupt or truncated")
+	// ErrTooManyImages is returned when a sighting would have more images than allowed.
+	ErrTooManyImages = errors.New("sighting has too many images")
+)
+
+// allowedTypes are the sniffed content types of the accepted image formats.
+var allowedTypes = map[string]bool{"image/jpeg": true, "image/png": true, "image/webp": true}
+
+// heifBrands are the ISO base media file brands of HEIC and HEIF images.
+var heifBrands = map[string]bool{"heic": true, "heix": true, "hevc": true, "hevx": true, "heim": true, "heis": true, "mif1": true, "msf1": true}
+
+// Limits bound the size of uploaded images and how many a sighting can have.
+type Limits struct {
+	MaxBytes  int64
+	MaxPixels int
+	MaxImages int
+}
+
+// DefaultLimits accept up to 10 images of up to 10 MB and 40 megapixels each.
+var DefaultLimits = Limits{MaxBytes: 10 << 20, MaxPixels: 40_000_000, MaxImages: 10}
+
+// FromConfig builds the limits from the configuration.
+func FromConfig(config conf.Uploads) Limits {
+	return Limits{MaxBytes: config.MaxBytes, MaxPixels: config.MaxPixels, MaxImages: config.MaxImages}
+}
+
+// CheckCount returns ErrTooManyImages when adding images to a sighting that already has
+// existing ones would take it over the limit.
+func (l Limits) CheckCount(existing, added int) error {
+	if existing+added > l.MaxImages {
+		return fmt.Errorf("%w: at most %d are allowed", ErrTooManyImages, l.MaxImages)
+	}
+	return nil
+}
+
+// Validate checks the size and format of an uploaded image from its header, without
+// decoding its pixels. It returns the content type of the image.
+func (l Limits) Validate(data []byte) (string, error) {
+	if int64(len(data)) > l.MaxBytes {
+		return "", fmt.Errorf("%w: %d bytes, at most %d are allowed", ErrTooLarge, len(data), l.MaxBytes)
+	}
+
+	// Sniff the format from the content; the file name and declared type cannot be trusted
+	contentType := http.DetectContentType(data)
+	if !allowedTypes[contentType] {
+		if isHEIF(data) {
+			return "", fmt.Errorf("%w: convert HEIC images to JPEG before uploading them", ErrUnsupportedFormat)
+		}
+		return "", fmt.Errorf("%w: got %s", ErrUnsupportedFormat, contentType)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width <= 0 || config.Height <= 0 {
+		return "", ErrInvalidImage
+	}
+	if pixels := int64(config.Width) * int64(config.Height); pixels > int64(l.MaxPixels) {
+		return "", fmt.Errorf("%w: %dx%d, at most %d pixels are allowed", ErrTooManyPixels, config.Width, config.Height, l.MaxPixels)
+	}
+	return contentType, nil
+}
+
+// isHEIF reports whether data starts with the file type box of a HEIC or HEIF image.
+func isHEIF(data []byte) bool {
+	return len(data) >= 12 && string(data[4:8]) == "ftyp" && heifBrands[string(data[8:12])]
+}
@@ -0,0 +1,75 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/gif"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLimits_Validate(t *testing.T) {
+	limits := Limits{MaxBytes: 1 << 20, MaxPixels: 10_000}
+
+	var gifImage bytes.Buffer
+	if err := gif.Encode(&gifImage, image.NewGray(image.Rect(0, 0, 10, 10)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// A PNG header claiming a 20000x20000 image, as sent by decompression bombs
+	bomb := encodePNG(t, 10, 10)
+	binary.BigEndian.PutUint32(bomb[16:20], 20000)
+	binary.BigEndian.PutUint32(bomb[20:24], 20000)
+	binary.BigEndian.PutUint32(bomb[29:33], crc32.ChecksumIEEE(bomb[12:29]))
+
+	tests := []struct {
+		name        string
+		data        []byte
+		expectedErr error
+	}{
+		{"valid", encodePNG(t, 100, 100), nil},
+		{"too many bytes", make([]byte, 1<<20+1), ErrTooLarge},
+		{"too many pixels", encodePNG(t, 101, 100), ErrTooManyPixels},
+		{"decompression bomb", bomb, ErrTooManyPixels},
+		{"unsupported format", gifImage.Bytes(), ErrUnsupportedFormat},
+		{"HEIC", append([]byte("\x00\x00\x00\x18ftypheic"), make([]byte, 12)...), ErrUnsupportedFormat},
+		{"truncated", encodePNG(t, 100, 100)[:20], ErrInvalidImage},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := limits.Validate(test.data)
+			if test.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, test.expectedErr)
+			}
+		})
+	}
+}
+
+func TestLimits_ValidateHEICMessage(t *testing.T) {
+	_, err := DefaultLimits.Validate(append([]byte("\x00\x00\x00\x18ftypheic"), make([]byte, 12)...))
+	assert.ErrorContains(t, err, "convert HEIC images to JPEG")
+}
+
+func TestLimits_CheckCount(t *testing.T) {
+	limits := Limits{MaxImages: 3}
+
+	assert.NoError(t, limits.CheckCount(0, 3))
+	assert.NoError(t, limits.CheckCount(2, 1))
+	assert.ErrorIs(t, limits.CheckCount(0, 4), ErrTooManyImages)
+	assert.ErrorIs(t, limits.CheckCount(3, 1), ErrTooManyImages)
+}
@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"image"
+	"math"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/disintegration/imaging"
 	"github.com/tigerhall-kittens/pkg/models"
@@ -16,24 +19,54 @@ type EmailTemplate struct {
 	Sub       string `json:"subject"`
 	Body      string `json:"body"`
 	Recipient string `json:"recipient"`
+	// Link points the recipient at more details, such as the sightings of the tiger
+	Link string `json:"link,omitempty"`
+	// Reason completes "You receive this email because ..."
+	Reason string `json:"reason,omitempty"`
+	// DeliverAfter holds the email back, for the quiet hours or the digest of the recipient
+	DeliverAfter *time.Time `json:"deliverAfter,omitempty"`
 }
 
-func GetMails(previousSightings []*models.TigerSighting) []byte {
-	var emails []EmailTemplate
-	for _, pr := range previousSightings {
-		emails = append(emails, EmailTemplate{
-			Sub:       "Tiger Sights",
-			Body:      fmt.Sprintf(`Tiger_%v is found at {Lat: %v,Long: %v}`, pr.TigerID, pr.Lat, pr.Long),
-			Recipient: pr.ReporterEmail,
-		})
-	}
+// Recipient is someone to notify of a sighting.
+type Recipient struct {
+	Email string
+	// Reason completes "You receive this email because ..."
+	Reason string
+	// DeliverAfter holds the email back; the zero time sends it right away
+	DeliverAfter time.Time
+}
 
-	emailsJSON, err := json.Marshal(emails)
-	if err != nil {
-		fmt.Println("Error marshaling to JSON:", err)
-		return nil
+// GetMails builds one email about the new sighting of the tiger for every distinct recipient, except
+// the reporter of the new sighting. Recipients listed more than once get the email for their first reason.
+func GetMails(tiger *models.Tiger, newSighting *models.TigerSighting, recipients []Recipient, link string) []EmailTemplate {
+	subject := fmt.Sprintf("New sighting of %s", tiger.Name)
+	body := fmt.Sprintf("%s was sighted on %s at {Lat: %v, Long: %v}.",
+		tiger.Name, newSighting.Timestamp.UTC().Format("2 Jan 2006 15:04 MST"), newSighting.Lat, newSighting.Long)
+
+	// Addresses differ in case between sightings reported by the same person
+	notified := map[string]bool{strings.ToLower(newSighting.ReporterEmail): true}
+	emails := []EmailTemplate{}
+	for _, recipient := range recipients {
+		address := strings.ToLower(recipient.Email)
+		if address == "" || notified[address] {
+			continue
+		}
+		notified[address] = true
+
+		email := EmailTemplate{
+			Sub:       subject,
+			Body:      body,
+			Recipient: recipient.Email,
+			Link:      link,
+			Reason:    recipient.Reason,
+		}
+		if !recipient.DeliverAfter.IsZero() {
+			deliverAfter := recipient.DeliverAfter
+			email.DeliverAfter = &deliverAfter
+		}
+		emails = append(emails, email)
 	}
-	return []byte(emailsJSON)
+	return emails
 }
 
 func CalculateDistance(coord1, coord2 models.Coordinates) float64 {
@@ -45,6 +78,37 @@ func CalculateDistance(coord1, coord2 models.Coordinates) float64 {
 	return distanceKm
 }
 
+// kmPerDegree is the length of one degree of latitude on the sphere used by CalculateDistance.
+const kmPerDegree = 6371 * math.Pi / 180
+
+// BoundingBoxAround returns a bounding box containing every point within radiusKm of center.
+func BoundingBoxAround(center models.Coordinates, radiusKm float64) models.BoundingBox {
+	latDelta := radiusKm / kmPerDegree
+
+	// Degrees of longitude shrink towards the poles; near them the box spans every longitude
+	longDelta := 180.0
+	if cosLat := math.Cos(center.Lat * math.Pi / 180); cosLat > radiusKm/(kmPerDegree*180) {
+		longDelta = math.Min(radiusKm/(kmPerDegree*cosLat), 180)
+	}
+
+	return models.BoundingBox{
+		MinLat:  math.Max(center.Lat-latDelta, -90),
+		MinLong: math.Max(center.Long-longDelta, -180),
+		MaxLat:  math.Min(center.Lat+latDelta, 90),
+		MaxLong: math.Min(center.Long+longDelta, 180),
+	}
+}
+
+// CoarsenCoordinates rounds the coordinates to the given number of decimal places.
+// One decimal place is about 11 km of latitude.
+func CoarsenCoordinates(coord models.Coordinates, decimals int) models.Coordinates {
+	scale := math.Pow(10, float64(decimals))
+	return models.Coordinates{
+		Lat:  math.Round(coord.Lat*scale) / scale,
+		Long: math.Round(coord.Long*scale) / scale,
+	}
+}
+
 func ResizeImage(imageBytes []byte, width, height int) ([]byte, error) {
 	// Decode the imageBytes into an image.Image
 	img, _, err := image.Decode(bytes.NewReader(imageBytes))
@@ -5,49 +5,52 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/tigerhall-kittens/pkg/models"
 )
 
 func TestGetMails(t *testing.T) {
-	// Create a slice of previousSightings to be used for testing
-	previousSightings := []*models.TigerSighting{
-		{
-			TigerID:       1,
-			Lat:           40.7128,
-			Long:          -74.0060,
-			ReporterEmail: "test1@example.com",
-		},
-		{
-			TigerID:       2,
-			Lat:           34.0522,
-			Long:          -118.2437,
-			ReporterEmail: "test2@example.com",
-		},
+	tiger := &models.Tiger{ID: 1, Name: "Sher Khan"}
+	newSighting := &models.TigerSighting{
+		TigerID:       1,
+		Timestamp:     time.Date(2023, time.July, 21, 12, 30, 0, 0, time.UTC),
+		Lat:           12.9716,
+		Long:          77.5946,
+		ReporterEmail: "reporter@example.com",
 	}
 
+	// The reporters of earlier sightings, including the new one and several by the same rangers, then a subscriber
+	deliverAfter := time.Date(2023, time.July, 22, 8, 0, 0, 0, time.UTC)
+	recipients := []Recipient{
+		{Email: "reporter@example.com", Reason: "you reported a sighting of this tiger"},
+		{Email: "ranger@example.com", Reason: "you reported a sighting of this tiger"},
+		{Email: "other@example.com", Reason: "you reported a sighting of this tiger", DeliverAfter: deliverAfter},
+		{Email: "Ranger@example.com", Reason: "you reported a sighting of this tiger"},
+		{Email: "Reporter@example.com", Reason: "you subscribed to this tiger"},
+		{Email: "ranger@example.com", Reason: "you subscribed to this tiger"},
+		{Email: "subscriber@example.com", Reason: "you subscribed to this tiger"},
+	}
+
+	body := "Sher Khan was sighted on 21 Jul 2023 12:30 UTC at {Lat: 12.9716, Long: 77.5946}."
+	link := "http://localhost:8080/tiger/1/sightings"
 	expectedEmails := []EmailTemplate{
-		{
-			Sub:       "Tiger Sights",
-			Body:      "Tiger_1 is found at {Lat: 40.7128,Long: -74.006}",
-			Recipient: "test1@example.com",
-		},
-		{
-			Sub:       "Tiger Sights",
-			Body:      "Tiger_2 is found at {Lat: 34.0522,Long: -118.2437}",
-			Recipient: "test2@example.com",
-		},
+		{Sub: "New sighting of Sher Khan", Body: body, Recipient: "ranger@example.com", Link: link, Reason: "you reported a sighting of this tiger"},
+		{Sub: "New sighting of Sher Khan", Body: body, Recipient: "other@example.com", Link: link, Reason: "you reported a sighting of this tiger", DeliverAfter: &deliverAfter},
+		{Sub: "New sighting of Sher Khan", Body: body, Recipient: "subscriber@example.com", Link: link, Reason: "you subscribed to this tiger"},
 	}
 
-	emailsJSON := GetMails(previousSightings)
-	assert.NotNil(t, emailsJSON)
+	actualEmails := GetMails(tiger, newSighting, recipients, link)
+	assert.Equal(t, expectedEmails, actualEmails, "Each other recipient should get one email about the new sighting")
+}
 
-	// Unmarshal the JSON to EmailTemplate slice for comparison
-	var actualEmails []EmailTemplate
-	err := json.Unmarshal(emailsJSON, &actualEmails)
-	assert.NoError(t, err)
-	assert.Equal(t, expectedEmails, actualEmails)
+func TestGetMails_OnlyReporter(t *testing.T) {
+	newSighting := &models.TigerSighting{TigerID: 1, ReporterEmail: "reporter@example.com"}
+
+	emails := GetMails(&models.Tiger{ID: 1, Name: "Sher Khan"}, newSighting, []Recipient{{Email: "reporter@example.com"}}, "")
+
+	assert.Empty(t, emails, "The reporter should not be notified of their own sighting")
 }
 
 func TestCalculateDistance(t *testing.T) {
@@ -63,6 +66,18 @@ func TestCalculateDistance(t *testing.T) {
 	assert.InDelta(t, expectedDistance, distance, 0.1)
 }
 
+func TestBoundingBoxAround(t *testing.T) {
+	center := models.Coordinates{Lat: 21.5, Long: 80.25}
+
+	box := BoundingBoxAround(center, 10)
+
+	// Every corner of the box is at least the radius away along each axis
+	assert.InDelta(t, 10, CalculateDistance(center, models.Coordinates{Lat: box.MaxLat, Long: center.Long}), 0.01)
+	assert.InDelta(t, 10, CalculateDistance(center, models.Coordinates{Lat: box.MinLat, Long: center.Long}), 0.01)
+	assert.InDelta(t, 10, CalculateDistance(center, models.Coordinates{Lat: center.Lat, Long: box.MaxLong}), 0.01)
+	assert.InDelta(t, 10, CalculateDistance(center, models.Coordinates{Lat: center.Lat, Long: box.MinLong}), 0.01)
+}
+
 //// Mock struct for image.Image
 //type mockImage struct{}
 //